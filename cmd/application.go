@@ -1,37 +1,289 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	internal "github.com/danielrrv/got/internal"
 )
 
 const (
-	initName   = "init"
-	addName    = "add"
-	statusName = "status"
-	commitName = "commit"
-	catTreeName    = "cat-tree"
+	initName           = "init"
+	addName            = "add"
+	statusName         = "status"
+	commitName         = "commit"
+	catTreeName        = "cat-tree"
+	logName            = "log"
+	branchName         = "branch"
+	checkoutName       = "checkout"
+	switchName         = "switch"
+	diffName           = "diff"
+	mergeName          = "merge"
+	migrateObjectsName = "migrate-objects"
+	importGitName      = "import-git"
+	exportGitName      = "export-git"
+	gcName             = "gc"
+	pruneName          = "prune"
+	fsckName           = "fsck"
+	checkIgnoreName    = "check-ignore"
+	rmName             = "rm"
+	mvName             = "mv"
+	blameName          = "blame"
+	// Layout of the dates shown by log, as git shows them.
+	logDateLayout = "Mon Jan 2 15:04:05 2006 -0700"
 )
 
 var (
+	addArguments = []Arg{{
+		Name:         "A",
+		DefaultValue: "false",
+		Usage:        "stage the deletions too, the whole worktree without paths",
+		Bool:         true,
+	}, {
+		Name:         "all",
+		DefaultValue: "false",
+		Usage:        "same as -A",
+		Bool:         true,
+	}, {
+		Name:         "u",
+		DefaultValue: "false",
+		Usage:        "stage the tracked files only, the whole worktree without paths",
+		Bool:         true,
+	}, {
+		Name:         "update",
+		DefaultValue: "false",
+		Usage:        "same as -u",
+		Bool:         true,
+	}, {
+		Name:         "dry-run",
+		DefaultValue: "false",
+		Usage:        "list the files without staging them",
+		Bool:         true,
+	}, {
+		Name:         "v",
+		DefaultValue: "false",
+		Usage:        "list the files staged",
+		Bool:         true,
+	}, {
+		Name:         "f",
+		DefaultValue: "false",
+		Usage:        "stage the ignored files too",
+		Bool:         true,
+	}}
+	rmArguments = []Arg{{
+		Name:         "cached",
+		DefaultValue: "false",
+		Usage:        "stop tracking the files but keep them in the worktree",
+		Bool:         true,
+	}, {
+		Name:         "r",
+		DefaultValue: "false",
+		Usage:        "remove the files of the folders given",
+		Bool:         true,
+	}, {
+		Name:         "f",
+		DefaultValue: "false",
+		Usage:        "remove the files even when they have modifications",
+		Bool:         true,
+	}}
+	statusArguments = []Arg{{
+		Name:     "porcelain",
+		Usage:    "give the output in a format for scripts, v1 or v2",
+		Optional: true,
+	}, {
+		Name:         "short",
+		DefaultValue: "false",
+		Usage:        "give the output in the short format",
+		Bool:         true,
+	}, {
+		Name:         "s",
+		DefaultValue: "false",
+		Usage:        "same as --short",
+		Bool:         true,
+	}, {
+		Name:         "z",
+		DefaultValue: "false",
+		Usage:        "terminate the entries with NUL, implies --porcelain without format",
+		Bool:         true,
+	}, {
+		Name:         "branch",
+		DefaultValue: "false",
+		Usage:        "show the branch in the short and porcelain formats",
+		Bool:         true,
+	}, {
+		Name:         "b",
+		DefaultValue: "false",
+		Usage:        "same as --branch",
+		Bool:         true,
+	}, {
+		Name:         "ignored",
+		DefaultValue: "false",
+		Usage:        "show the ignored files too",
+		Bool:         true,
+	}}
+	blameArguments = []Arg{{
+		Name:         "L",
+		DefaultValue: "",
+		Usage:        "blame the lines start,end only",
+	}, {
+		Name:         "porcelain",
+		DefaultValue: "false",
+		Usage:        "give the output in a format for scripts",
+		Bool:         true,
+	}}
+	mvArguments = []Arg{{
+		Name:         "f",
+		DefaultValue: "false",
+		Usage:        "overwrite the destination file",
+		Bool:         true,
+	}}
+	checkIgnoreArguments = []Arg{{
+		Name:         "v",
+		DefaultValue: "false",
+		Usage:        "show the rule matching each path",
+		Bool:         true,
+	}}
 	initArguments = []Arg{{
 		Name:         "path",
 		DefaultValue: "",
 		Usage:        "got add <path>...",
 	}}
+	commitArguments = []Arg{{
+		Name:         "m",
+		DefaultValue: "",
+		Usage:        "the commit message",
+	}, {
+		Name:         "author",
+		DefaultValue: "",
+		Usage:        "override the author, \"Name <email>\"",
+	}, {
+		Name:         "date",
+		DefaultValue: "",
+		Usage:        "override the author date",
+	}}
+	branchArguments = []Arg{{
+		Name:         "d",
+		DefaultValue: "false",
+		Usage:        "delete a branch fully merged into HEAD",
+		Bool:         true,
+	}, {
+		Name:         "D",
+		DefaultValue: "false",
+		Usage:        "delete a branch even when it is not merged",
+		Bool:         true,
+	}, {
+		Name:         "m",
+		DefaultValue: "false",
+		Usage:        "rename a branch",
+		Bool:         true,
+	}}
+	checkoutArguments = []Arg{{
+		Name:         "force",
+		DefaultValue: "false",
+		Usage:        "throw away the local modifications",
+		Bool:         true,
+	}}
+	diffArguments = []Arg{{
+		Name:         "staged",
+		DefaultValue: "false",
+		Usage:        "compare the stage area with HEAD",
+		Bool:         true,
+	}, {
+		Name:         "cached",
+		DefaultValue: "false",
+		Usage:        "same as --staged",
+		Bool:         true,
+	}, {
+		Name:         "U",
+		DefaultValue: strconv.Itoa(internal.DefaultContextLines),
+		Usage:        "lines of context around the changes",
+	}, {
+		Name:     "M",
+		Usage:    "detect the renames more similar than the threshold, 50% by default",
+		Optional: true,
+	}, {
+		Name:     "C",
+		Usage:    "detect the copies too, as -M",
+		Optional: true,
+	}, {
+		Name:         "no-renames",
+		DefaultValue: "false",
+		Usage:        "show the renames as a deletion and an addition",
+		Bool:         true,
+	}}
+	mergeArguments = []Arg{{
+		Name:         "m",
+		DefaultValue: "",
+		Usage:        "the merge commit message",
+	}}
+	exportGitArguments = []Arg{{
+		Name:         "bare",
+		DefaultValue: "false",
+		Usage:        "write into the destination itself instead of its .git folder",
+		Bool:         true,
+	}, {
+		Name:         "f",
+		DefaultValue: "false",
+		Usage:        "overwrite the branches and tags of the destination that aren't fast-forwards",
+		Bool:         true,
+	}}
+	pruneArguments = []Arg{{
+		Name:         "dry-run",
+		DefaultValue: "false",
+		Usage:        "list the objects without removing them",
+		Bool:         true,
+	}, {
+		Name:         "expire",
+		DefaultValue: internal.DefaultPruneExpire.String(),
+		Usage:        "keep the objects modified within this duration, or \"now\"",
+	}}
+	logArguments = []Arg{{
+		Name:         "oneline",
+		DefaultValue: "false",
+		Usage:        "show each commit in a single line",
+		Bool:         true,
+	}, {
+		Name:         "n",
+		DefaultValue: "0",
+		Usage:        "limit the number of commits to show",
+	}, {
+		Name:         "follow",
+		DefaultValue: "false",
+		Usage:        "follow the file across its renames",
+		Bool:         true,
+	}}
 )
 
 func Execute() int {
 	application := NewApplication()
 	//commands.
 	application.AddCommand(initName, initArguments, CommandInit)
-	application.AddCommand(addName, nil, CommandAdd)
-	application.AddCommand(statusName, nil, CommandStatus)
-	application.AddCommand(commitName, nil, CommandCommit)
+	application.AddCommand(addName, addArguments, CommandAdd)
+	application.AddCommand(statusName, statusArguments, CommandStatus)
+	application.AddCommand(commitName, commitArguments, CommandCommit)
 	application.AddCommand(catTreeName, nil, catTree)
+	application.AddCommand(logName, logArguments, CommandLog)
+	application.AddCommand(branchName, branchArguments, CommandBranch)
+	application.AddCommand(checkoutName, checkoutArguments, CommandCheckout)
+	application.AddCommand(switchName, checkoutArguments, CommandCheckout)
+	application.AddCommand(diffName, diffArguments, CommandDiff)
+	application.AddCommand(mergeName, mergeArguments, CommandMerge)
+	application.AddCommand(migrateObjectsName, nil, CommandMigrateObjects)
+	application.AddCommand(importGitName, nil, CommandImportGit)
+	application.AddCommand(exportGitName, exportGitArguments, CommandExportGit)
+	application.AddCommand(gcName, nil, CommandGC)
+	application.AddCommand(pruneName, pruneArguments, CommandPrune)
+	application.AddCommand(fsckName, nil, CommandFsck)
+	application.AddCommand(checkIgnoreName, checkIgnoreArguments, CommandCheckIgnore)
+	application.AddCommand(rmName, rmArguments, CommandRm)
+	application.AddCommand(mvName, mvArguments, CommandMv)
+	application.AddCommand(blameName, blameArguments, CommandBlame)
 	return application.Run()
 }
 
@@ -63,63 +315,97 @@ func CommandAdd(app *Application, args []string) int {
 	repo, err := internal.FindOrCreateRepo(app.pwd)
 	if err != nil {
 		app.Report(err)
+		return 1
+	}
+	if err := repo.Lock(); err != nil {
+		app.Report(err)
+		return 1
 	}
+	defer repo.Unlock()
 
-	repo.Index.AddOrModifyEntries(repo, args)
-	if err := repo.Index.Persist(repo); err != nil {
-		panic(err)
+	flags := make([]bool, 7)
+	for i := range flags {
+		flags[i], _ = strconv.ParseBool(args[i])
+	}
+	all, update, dryRun, verbose, force := flags[0] || flags[1], flags[2] || flags[3], flags[4], flags[5], flags[6]
+	result, err := internal.Add(repo, app.pwd, args[7:], internal.AddOptions{All: all, Update: update, DryRun: dryRun, Force: force})
+	if err != nil {
+		app.Report(err)
+		return 1
+	}
+	if verbose || dryRun {
+		for _, path := range result.Added {
+			fmt.Printf("add '%s'\n", path)
+		}
+		for _, path := range result.Removed {
+			fmt.Printf("remove '%s'\n", path)
+		}
 	}
 	return 0
 }
 
 // CommandStatus is the handler for the "status" command.
+//
+// got status [--porcelain[=v1|v2]] [--short|-s] [-z] [--branch|-b] [--ignored]
 func CommandStatus(app *Application, args []string) int {
 	repo, err := internal.FindOrCreateRepo(app.pwd)
 	if err != nil {
 		app.Report(err)
+		return 1
+	}
+	porcelain, short, z := args[0], args[1] == "true" || args[2] == "true", args[3] == "true"
+	options := internal.StatusWriteOptions{Branch: args[4] == "true" || args[5] == "true", NulTerminated: z, Pwd: app.pwd}
+	switch {
+	case porcelain == "v2":
+		options.Format = internal.StatusPorcelainV2
+	case porcelain == "v1" || porcelain == "true":
+		options.Format = internal.StatusPorcelainV1
+	case porcelain != "":
+		app.Report(fmt.Errorf("unsupported porcelain format: %s", porcelain))
+		return 1
+	case short:
+		options.Format = internal.StatusShort
+	case z:
+		options.Format = internal.StatusPorcelainV1
+	}
+	status, err := repo.Status(internal.StatusOptions{Ignored: args[6] == "true"})
+	if err != nil {
+		app.Report(err)
+		return 1
+	}
+	if err := internal.WriteStatus(repo, os.Stdout, status, options); err != nil {
+		app.Report(err)
+		return 1
 	}
-	repo.Status()
 	return 0
 }
 
 // CommandCommit is the handler for the "commit" command.
+//
+// got commit -m <message> [--author <"Name <email>">] [--date <date>]
 func CommandCommit(app *Application, args []string) int {
-	//TODO: add message and author.
 	repo, err := internal.FindOrCreateRepo(app.pwd)
 	if err != nil {
 		app.Report(err)
+		return 1
 	}
-
-	files := make([]string, 0)
-	for _, entry := range repo.Index.Cache {
-		files = append(files, entry.PathName)
+	if err := repo.Lock(); err != nil {
+		app.Report(err)
+		return 1
 	}
-	//what it does: persist the repo index.
-	repo.Index.Persist(repo)
-	//what it does: create a map from the files.
-	m := internal.CreateTreeFromFiles(repo, files)
-	//what it does: create a tree from the map.
-	tree := internal.FromMapToTree(repo, m, filepath.Base(repo.GotTree))
-	//what it does: create a commit.
-	commit := internal.CreateCommit(repo, &tree, "some-message", "")
-	//what it does: write the commit to the disk.
-	hash, err := internal.WriteObject(repo, *commit, internal.CommitHeaderName)
+	defer repo.Unlock()
+	hash, err := internal.CommitIndex(repo, args[0], internal.CommitOptions{Author: args[1], Date: args[2]})
 	if err != nil {
-		panic(err)
+		app.Report(err)
+		return 1
 	}
-	//what it does: traverse the tree and write the objects to the disk.
-	tree.TraverseTree(func(ti internal.TreeItem) {
-		//	Here we have to go index and capture the cache of the stage area.
-		cache, err := internal.GetEntryFromCache(repo, ti.Path)
-		if err != nil {
-			panic(err)
-		}
-		internal.WriteObject(repo, cache, internal.BlobHeaderName)
-	},
-		func(ti internal.TreeItem) {
-			internal.WriteObject(repo, ti, internal.TreeHeaderName)
-		})
-	fmt.Println("Committed with hash:", hash)
+	branch, ok := repo.GetHEADBranch()
+	if !ok {
+		branch = "detached HEAD"
+	}
+	// What it does: the message is the one of the commit, the one of the merge when none was given.
+	message := internal.ReadCommit(repo, hash).Description
+	fmt.Printf("[%s %s] %s\n", branch, hash[:7], strings.SplitN(message, "\n", 2)[0])
 	return 0
 }
 
@@ -134,3 +420,616 @@ func catTree(app *Application, args []string) int {
 	fmt.Println("Tree:", tree)
 	return 0
 }
+
+// CommandLog is the handler for the "log" command.
+//
+// got log [--oneline] [-n <count>] [--follow] [<revision>] [[--] <path>...]
+func CommandLog(app *Application, args []string) int {
+	repo, err := internal.FindOrCreateRepo(app.pwd)
+	if err != nil {
+		app.Report(err)
+		return 1
+	}
+	oneline, _ := strconv.ParseBool(args[0])
+	maxCount, err := strconv.Atoi(args[1])
+	if err != nil {
+		app.Report(fmt.Errorf("invalid count %q", args[1]))
+		return 1
+	}
+	follow := args[2] == "true"
+	// What it does: the first argument is the revision when it resolves to one. The rest are paths.
+	rev := ""
+	paths := make([]string, 0)
+	for i, arg := range args[3:] {
+		if arg == "--" {
+			paths = append(paths, args[3+i+1:]...)
+			break
+		}
+		if _, err := internal.ResolveRevision(repo, arg); i == 0 && err == nil {
+			rev = arg
+			continue
+		}
+		paths = append(paths, arg)
+	}
+	for i, path := range paths {
+		rel, err := filepath.Rel(repo.GotTree, filepath.Join(app.pwd, path))
+		if err != nil {
+			app.Report(err)
+			return 1
+		}
+		paths[i] = rel
+	}
+	entries, err := internal.Log(repo, rev, internal.LogOptions{MaxCount: maxCount, Paths: paths, Follow: follow})
+	if err != nil {
+		app.Report(err)
+		return 1
+	}
+	for _, entry := range entries {
+		if oneline {
+			fmt.Printf("%s %s\n", entry.Hash[:7], strings.SplitN(entry.Commit.Description, "\n", 2)[0])
+			continue
+		}
+		fmt.Printf("commit %s\n", entry.Hash)
+		fmt.Printf("Author: %s\n", entry.Commit.Author.Identity())
+		fmt.Printf("Date:   %s\n\n", entry.Commit.Author.Time().Format(logDateLayout))
+		for _, line := range strings.Split(entry.Commit.Description, "\n") {
+			fmt.Printf("    %s\n", line)
+		}
+		fmt.Println()
+	}
+	return 0
+}
+
+// CommandBranch is the handler for the "branch" command.
+//
+// got branch                     list the branches.
+// got branch <name> [<start>]    create a branch at HEAD or at the start revision.
+// got branch -d|-D <name>...     delete the branches.
+// got branch -m [<old>] <new>    rename the branch, the current one by default.
+func CommandBranch(app *Application, args []string) int {
+	repo, err := internal.FindOrCreateRepo(app.pwd)
+	if err != nil {
+		app.Report(err)
+		return 1
+	}
+	if err := repo.Lock(); err != nil {
+		app.Report(err)
+		return 1
+	}
+	defer repo.Unlock()
+	remove, _ := strconv.ParseBool(args[0])
+	forceRemove, _ := strconv.ParseBool(args[1])
+	rename, _ := strconv.ParseBool(args[2])
+	names := args[3:]
+	switch {
+	case remove || forceRemove:
+		for _, name := range names {
+			if err := internal.DeleteBranch(repo, name, forceRemove); err != nil {
+				app.Report(fmt.Errorf("%s: %w", name, err))
+				return 1
+			}
+			fmt.Printf("Deleted branch %s\n", name)
+		}
+	case rename:
+		if len(names) == 1 {
+			current, ok := repo.GetHEADBranch()
+			if !ok {
+				app.Report(errors.New("HEAD is detached, there is no branch to rename"))
+				return 1
+			}
+			names = []string{current, names[0]}
+		}
+		if len(names) != 2 {
+			app.Report(errors.New("usage: got branch -m [<old>] <new>"))
+			return 1
+		}
+		if err := internal.RenameBranch(repo, names[0], names[1]); err != nil {
+			app.Report(err)
+			return 1
+		}
+	case len(names) > 0:
+		start := ""
+		if len(names) > 1 {
+			start = names[1]
+		}
+		if err := internal.CreateBranch(repo, names[0], start); err != nil {
+			app.Report(err)
+			return 1
+		}
+	default:
+		branches, err := internal.ListBranches(repo)
+		if err != nil {
+			app.Report(err)
+			return 1
+		}
+		for _, branch := range branches {
+			marker := " "
+			if branch.Current {
+				marker = "*"
+			}
+			fmt.Printf("%s %s\n", marker, branch.Name)
+		}
+	}
+	return 0
+}
+
+// CommandCheckout is the handler for the "checkout" and "switch" commands.
+//
+// got checkout [--force] <branch|hash>
+func CommandCheckout(app *Application, args []string) int {
+	repo, err := internal.FindOrCreateRepo(app.pwd)
+	if err != nil {
+		app.Report(err)
+		return 1
+	}
+	if err := repo.Lock(); err != nil {
+		app.Report(err)
+		return 1
+	}
+	defer repo.Unlock()
+	force, _ := strconv.ParseBool(args[0])
+	if len(args) != 2 {
+		app.Report(errors.New("usage: got checkout [--force] <branch|hash>"))
+		return 1
+	}
+	result, err := internal.Checkout(repo, args[1], force)
+	if err != nil {
+		app.Report(err)
+		return 1
+	}
+	if result.Branch != "" {
+		fmt.Printf("Switched to branch '%s'\n", result.Branch)
+	} else {
+		fmt.Printf("HEAD is now at %s %s\n", result.Hash[:7], strings.SplitN(internal.ReadCommit(repo, result.Hash).Description, "\n", 2)[0])
+	}
+	return 0
+}
+
+// CommandDiff is the handler for the "diff" command.
+//
+// got diff [-U <n>]                   changes of the worktree not staged yet.
+// got diff --staged [-U <n>]          changes staged for the next commit.
+// got diff [-U <n>] <commit>          changes of the worktree since the commit.
+// got diff [-U <n>] <commit> <commit> changes between two commits.
+//
+// The renames are detected, -M<n> and -C<n> set the threshold and -C detects the copies too.
+func CommandDiff(app *Application, args []string) int {
+	repo, err := internal.FindOrCreateRepo(app.pwd)
+	if err != nil {
+		app.Report(err)
+		return 1
+	}
+	staged, _ := strconv.ParseBool(args[0])
+	cached, _ := strconv.ParseBool(args[1])
+	context, err := strconv.Atoi(args[2])
+	if err != nil || context < 0 {
+		app.Report(fmt.Errorf("invalid context %q", args[2]))
+		return 1
+	}
+	renames, err := renameOptions(args[3], args[4], args[5] == "true")
+	if err != nil {
+		app.Report(err)
+		return 1
+	}
+	revisions := args[6:]
+	var from, to internal.TreeItem
+	switch {
+	case (staged || cached) && len(revisions) == 0:
+		from, to = internal.HEADTree(repo), internal.IndexTree(repo)
+	case len(revisions) == 0:
+		from, to = internal.IndexTree(repo), internal.WorktreeTree(repo)
+	case len(revisions) == 1:
+		if from, err = internal.RevisionTree(repo, revisions[0]); err != nil {
+			app.Report(err)
+			return 1
+		}
+		to = internal.WorktreeTree(repo)
+	case len(revisions) == 2:
+		if from, err = internal.RevisionTree(repo, revisions[0]); err != nil {
+			app.Report(err)
+			return 1
+		}
+		if to, err = internal.RevisionTree(repo, revisions[1]); err != nil {
+			app.Report(err)
+			return 1
+		}
+	default:
+		app.Report(errors.New("usage: got diff [--staged] [-U <n>] [-M[<n>]] [-C[<n>]] [--no-renames] [<commit> [<commit>]]"))
+		return 1
+	}
+	changes := internal.DiffTrees(from, to)
+	if renames != nil {
+		changes = internal.DetectRenames(repo, changes, *renames)
+	}
+	if err := internal.WritePatch(repo, os.Stdout, changes, context); err != nil {
+		app.Report(err)
+		return 1
+	}
+	return 0
+}
+
+// The rename detection of diff: -M and -C given bare are "true", and the renames are detected unless --no-renames.
+func renameOptions(renames string, copies string, disabled bool) (*internal.RenameOptions, error) {
+	if disabled {
+		return nil, nil
+	}
+	options := internal.DefaultRenameOptions
+	threshold := renames
+	if copies != "" {
+		options.Copies, threshold = true, copies
+	}
+	if threshold == "true" {
+		threshold = ""
+	}
+	var err error
+	if options.Threshold, err = internal.ParseSimilarity(threshold); err != nil {
+		return nil, err
+	}
+	return &options, nil
+}
+
+// CommandMerge is the handler for the "merge" command.
+//
+// got merge [-m <message>] <branch|hash>
+func CommandMerge(app *Application, args []string) int {
+	repo, err := internal.FindOrCreateRepo(app.pwd)
+	if err != nil {
+		app.Report(err)
+		return 1
+	}
+	if err := repo.Lock(); err != nil {
+		app.Report(err)
+		return 1
+	}
+	defer repo.Unlock()
+	if len(args) != 2 {
+		app.Report(errors.New("usage: got merge [-m <message>] <branch|hash>"))
+		return 1
+	}
+	result, err := internal.Merge(repo, args[1], args[0])
+	if err != nil {
+		app.Report(err)
+		return 1
+	}
+	switch {
+	case result.UpToDate:
+		fmt.Println("Already up to date.")
+	case result.FastForward:
+		fmt.Printf("Fast-forward to %s\n", result.Hash[:7])
+	case len(result.Conflicts) > 0:
+		for _, path := range result.Conflicts {
+			fmt.Printf("CONFLICT (content): Merge conflict in %s\n", path)
+		}
+		fmt.Println("Automatic merge failed; fix conflicts and then commit the result.")
+		return 1
+	default:
+		fmt.Printf("Merge made by the three-way strategy: %s\n", result.Hash[:7])
+	}
+	return 0
+}
+
+// CommandMigrateObjects is the handler for the "migrate-objects" command.
+//
+// got migrate-objects
+func CommandMigrateObjects(app *Application, args []string) int {
+	repo, err := internal.FindOrCreateRepo(app.pwd)
+	if err != nil {
+		app.Report(err)
+		return 1
+	}
+	if err := repo.Lock(); err != nil {
+		app.Report(err)
+		return 1
+	}
+	defer repo.Unlock()
+	mapping, err := internal.MigrateObjects(repo)
+	if errors.Is(err, internal.ErrorObjectFormatCurrent) {
+		fmt.Println("Objects already in git format.")
+		return 0
+	}
+	if err != nil {
+		app.Report(err)
+		return 1
+	}
+	fmt.Printf("Migrated %d objects to git format.\n", len(mapping))
+	return 0
+}
+
+// CommandImportGit is the handler for the "import-git" command.
+//
+// got import-git <path>
+func CommandImportGit(app *Application, args []string) int {
+	repo, err := internal.FindOrCreateRepo(app.pwd)
+	if err != nil {
+		app.Report(err)
+		return 1
+	}
+	if err := repo.Lock(); err != nil {
+		app.Report(err)
+		return 1
+	}
+	defer repo.Unlock()
+	if len(args) != 1 {
+		app.Report(errors.New("usage: got import-git <path>"))
+		return 1
+	}
+	result, err := internal.ImportGit(repo, args[0])
+	if err != nil {
+		app.Report(err)
+		return 1
+	}
+	fmt.Printf("Imported %d objects, %d already present.\n", result.Converted, result.Skipped)
+	for _, ref := range result.Refs {
+		fmt.Println(ref)
+	}
+	for _, ref := range result.Kept {
+		fmt.Printf("warning: %s kept, it exists already and the one of git isn't a fast-forward of it\n", ref)
+	}
+	return 0
+}
+
+// CommandExportGit is the handler for the "export-git" command.
+//
+// got export-git [--bare] [-f] <dest>
+func CommandExportGit(app *Application, args []string) int {
+	repo, err := internal.FindOrCreateRepo(app.pwd)
+	if err != nil {
+		app.Report(err)
+		return 1
+	}
+	if len(args) != 3 {
+		app.Report(errors.New("usage: got export-git [--bare] [-f] <dest>"))
+		return 1
+	}
+	if err := repo.Lock(); err != nil {
+		app.Report(err)
+		return 1
+	}
+	defer repo.Unlock()
+	bare, _ := strconv.ParseBool(args[0])
+	force, _ := strconv.ParseBool(args[1])
+	result, err := internal.ExportGit(repo, args[2], internal.ExportOptions{Bare: bare, Force: force})
+	if err != nil {
+		app.Report(err)
+		return 1
+	}
+	fmt.Printf("Exported %d objects, %d already present.\n", result.Written, result.Skipped)
+	for _, ref := range result.Refs {
+		fmt.Println(ref)
+	}
+	for _, ref := range result.Kept {
+		fmt.Printf("warning: %s kept, the one of got isn't a fast-forward of it, use -f to overwrite it\n", ref)
+	}
+	return 0
+}
+
+// CommandGC is the handler for the "gc" command.
+//
+// got gc
+func CommandGC(app *Application, args []string) int {
+	repo, err := internal.FindOrCreateRepo(app.pwd)
+	if err != nil {
+		app.Report(err)
+		return 1
+	}
+	if err := repo.Lock(); err != nil {
+		app.Report(err)
+		return 1
+	}
+	defer repo.Unlock()
+	result, err := internal.GC(repo)
+	if err != nil {
+		app.Report(err)
+		return 1
+	}
+	if result.Pack == "" {
+		fmt.Println("Nothing to pack.")
+		return 0
+	}
+	fmt.Printf("Packed %d objects (%d deltas) into %s, removed %d loose objects.\n", result.Packed, result.Deltas, filepath.Base(result.Pack), result.Removed)
+	return 0
+}
+
+// CommandPrune is the handler for the "prune" command.
+//
+// got prune [--dry-run] [--expire <duration>]
+func CommandPrune(app *Application, args []string) int {
+	repo, err := internal.FindOrCreateRepo(app.pwd)
+	if err != nil {
+		app.Report(err)
+		return 1
+	}
+	if err := repo.Lock(); err != nil {
+		app.Report(err)
+		return 1
+	}
+	defer repo.Unlock()
+	if len(args) != 2 {
+		app.Report(errors.New("usage: got prune [--dry-run] [--expire <duration>]"))
+		return 1
+	}
+	dryRun, _ := strconv.ParseBool(args[0])
+	var expire time.Duration
+	if args[1] != "now" {
+		if expire, err = time.ParseDuration(args[1]); err != nil {
+			app.Report(err)
+			return 1
+		}
+	}
+	pruned, err := internal.Prune(repo, internal.PruneOptions{DryRun: dryRun, Expire: expire})
+	if err != nil {
+		app.Report(err)
+		return 1
+	}
+	for _, object := range pruned {
+		fmt.Printf("%s %s\n", object.Hash, object.Type)
+	}
+	if dryRun {
+		fmt.Printf("Would prune %d objects.\n", len(pruned))
+	} else {
+		fmt.Printf("Pruned %d objects.\n", len(pruned))
+	}
+	return 0
+}
+
+// CommandFsck is the handler for the "fsck" command.
+//
+// got fsck
+func CommandFsck(app *Application, args []string) int {
+	repo, err := internal.FindOrCreateRepo(app.pwd)
+	if err != nil {
+		app.Report(err)
+		return 1
+	}
+	problems, err := internal.Fsck(repo)
+	if err != nil {
+		app.Report(err)
+		return 1
+	}
+	// What it does: one problem per line, so that scripts can parse them. Dangling commits alone exit 0.
+	status := 0
+	for _, problem := range problems {
+		fmt.Println(problem)
+		if problem.IsError() {
+			status = 1
+		}
+	}
+	return status
+}
+
+// CommandCheckIgnore is the handler for the "check-ignore" command. It prints the ignored paths, or the rule matching
+// each path with -v, as git does:
+//
+//	<source>:<line>:<pattern>\t<path>
+//
+// The command exits with 1 when no path is ignored.
+func CommandCheckIgnore(app *Application, args []string) int {
+	repo, err := internal.FindOrCreateRepo(app.pwd)
+	if err != nil {
+		app.Report(err)
+		return 1
+	}
+	verbose, _ := strconv.ParseBool(args[0])
+	if len(args[1:]) == 0 {
+		app.Report(errors.New("no path specified"))
+		return 1
+	}
+	matches, err := internal.CheckIgnore(repo, app.pwd, args[1:])
+	if err != nil {
+		app.Report(err)
+		return 1
+	}
+	status := 1
+	for _, match := range matches {
+		if match.Ignored {
+			status = 0
+		}
+		switch {
+		case verbose:
+			fmt.Printf("%s:%d:%s\t%s\n", match.Source, match.Line, match.Pattern, match.Path)
+		case match.Ignored:
+			fmt.Println(match.Path)
+		}
+	}
+	return status
+}
+
+// CommandRm is the handler for the "rm" command.
+func CommandRm(app *Application, args []string) int {
+	repo, err := internal.FindOrCreateRepo(app.pwd)
+	if err != nil {
+		app.Report(err)
+		return 1
+	}
+	if err := repo.Lock(); err != nil {
+		app.Report(err)
+		return 1
+	}
+	defer repo.Unlock()
+
+	cached, _ := strconv.ParseBool(args[0])
+	recursive, _ := strconv.ParseBool(args[1])
+	force, _ := strconv.ParseBool(args[2])
+	if len(args[3:]) == 0 {
+		app.Report(errors.New("no path specified"))
+		return 1
+	}
+	removed, err := internal.Remove(repo, app.pwd, args[3:], internal.RemoveOptions{Cached: cached, Recursive: recursive, Force: force})
+	if err != nil {
+		app.Report(err)
+		return 1
+	}
+	for _, path := range removed {
+		fmt.Printf("rm '%s'\n", path)
+	}
+	return 0
+}
+
+// CommandMv is the handler for the "mv" command.
+func CommandMv(app *Application, args []string) int {
+	repo, err := internal.FindOrCreateRepo(app.pwd)
+	if err != nil {
+		app.Report(err)
+		return 1
+	}
+	if err := repo.Lock(); err != nil {
+		app.Report(err)
+		return 1
+	}
+	defer repo.Unlock()
+
+	force, _ := strconv.ParseBool(args[0])
+	paths := args[1:]
+	if len(paths) < 2 {
+		app.Report(errors.New("usage: got mv [-f] <source>... <destination>"))
+		return 1
+	}
+	if _, err := internal.Move(repo, app.pwd, paths[:len(paths)-1], paths[len(paths)-1], force); err != nil {
+		app.Report(err)
+		return 1
+	}
+	return 0
+}
+
+// CommandBlame is the handler for the "blame" command.
+//
+// got blame [-L <start>,<end>] [--porcelain] [<revision>] [--] <file>
+func CommandBlame(app *Application, args []string) int {
+	repo, err := internal.FindOrCreateRepo(app.pwd)
+	if err != nil {
+		app.Report(err)
+		return 1
+	}
+	options := internal.BlameOptions{}
+	if args[0] != "" {
+		if options.Start, options.End, err = internal.ParseLineRange(args[0]); err != nil {
+			app.Report(err)
+			return 1
+		}
+	}
+	porcelain, _ := strconv.ParseBool(args[1])
+	rest := slices.DeleteFunc(slices.Clone(args[2:]), func(arg string) bool { return arg == "--" })
+	switch len(rest) {
+	case 1:
+	case 2:
+		options.Revision = rest[0]
+	default:
+		app.Report(errors.New("usage: got blame [-L <start>,<end>] [--porcelain] [<revision>] [--] <file>"))
+		return 1
+	}
+	path, err := filepath.Rel(repo.GotTree, filepath.Join(app.pwd, rest[len(rest)-1]))
+	if err != nil {
+		app.Report(err)
+		return 1
+	}
+	lines, err := internal.Blame(repo, filepath.ToSlash(path), options)
+	if err != nil {
+		app.Report(err)
+		return 1
+	}
+	if err := internal.WriteBlame(os.Stdout, lines, porcelain); err != nil {
+		app.Report(err)
+		return 1
+	}
+	return 0
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"slices"
+	"strconv"
 )
 
 // go build -o got  && sudo cp got /usr/bin
@@ -16,41 +17,71 @@ func usage() {
 		init		Create an empty repository or find a existing one in path provided.
 		add			Add files to stage area.
 		status		Report the state of the working tree.
+		commit		Record the staged changes in the repository.
+		log			Show the commit history.
+		branch		List, create, delete or rename branches.
+		checkout	Switch the working tree to a branch or commit.
+		diff		Show changes between the working tree, the index and commits.
+		merge		Join the history of a branch into the current one.
+		migrate-objects	Rewrite the objects of an existing repository in git format.
+		import-git	Import the objects, branches and tags of a git repository.
+		export-git	Write the history into a git repository.
+		gc		Pack the reachable objects and remove their loose copies.
+		prune		Remove the loose objects nothing points to.
+		fsck		Verify the objects and refs of the repository.
+		check-ignore	Show whether paths are ignored, and by which rule.
+		rm		Remove files from the worktree and the index.
+		mv		Move or rename a file or folder in the worktree and the index.
+		blame		Show the commit that last changed each line of a file.
    `
-	
+
 	fmt.Fprintln(os.Stderr, format)
 }
+
 type Application struct {
-	stdErr *os.File
-	pwd string
+	stdErr   *os.File
+	pwd      string
 	commands []Command
 }
 
 type Command struct {
 	name string
-	Run  func(a * Application, args []string) int
+	Run  func(a *Application, args []string) int
 }
 
 type Arg struct {
 	Name         string
 	DefaultValue string
 	Usage        string
+	// The flag is a switch and takes no value. Its value is passed as "true" or "false".
+	Bool bool
+	// The flag takes its value after "=" only, or none, as --porcelain[=v2]. Its value is passed as "true" when given
+	// without one.
+	Optional bool
 }
 
+// The value of an optional flag. The flag package sets a boolean flag given without value to "true".
+type optionalValue string
 
+func (v *optionalValue) String() string     { return string(*v) }
+func (v *optionalValue) Set(s string) error { *v = optionalValue(s); return nil }
+func (v *optionalValue) IsBoolFlag() bool   { return true }
 
 func NewApplication() *Application {
-	pwd, err := os.Getwd() 
-	if err !=  nil {panic(err)}
+	pwd, err := os.Getwd()
+	if err != nil {
+		panic(err)
+	}
 	return &Application{
-		pwd: pwd,
+		stdErr:   os.Stderr,
+		pwd:      pwd,
 		commands: make([]Command, 0),
 	}
 }
 
-func (a *Application) Run()  int{
+func (a *Application) Run() int {
 	for _, cmd := range a.commands {
-		if len(os.Args) < 2{
+		if len(os.Args) < 2 {
 			usage()
 			os.Exit(1)
 		}
@@ -64,30 +95,60 @@ func (a *Application) Run()  int{
 	return 1
 }
 
-func(a * Application)Report(format error){
-	fmt.Fprintln(a.stdErr, format)	
+func (a *Application) Report(format error) {
+	fmt.Fprintln(a.stdErr, format)
 }
 
-
-func (a *Application) AddCommand(name string, args []Arg, callback func(app * Application,args []string) int) {
+func (a *Application) AddCommand(name string, args []Arg, callback func(app *Application, args []string) int) {
+	flags := args
 	cmd := flag.NewFlagSet(name, flag.ContinueOnError)
-	arguments := make([]*string, 0)
+	arguments := make([]func() string, 0)
 	for _, v := range args {
+		if v.Bool {
+			defaultValue, _ := strconv.ParseBool(v.DefaultValue)
+			ptrB := cmd.Bool(v.Name, defaultValue, v.Usage)
+			arguments = append(arguments, func() string { return strconv.FormatBool(*ptrB) })
+			continue
+		}
+		if v.Optional {
+			value := optionalValue(v.DefaultValue)
+			cmd.Var(&value, v.Name, v.Usage)
+			arguments = append(arguments, value.String)
+			continue
+		}
 		ptrS := cmd.String(v.Name, v.DefaultValue, v.Usage)
-		arguments = append(arguments, ptrS)
+		arguments = append(arguments, func() string { return *ptrS })
 	}
 	a.commands = append(a.commands, Command{
 		name: name,
-		Run: func(app * Application,args []string) int {
-			cmd.Parse(args)
-			_args := make([]string,0)
+		Run: func(app *Application, args []string) int {
+			if err := cmd.Parse(stuckValues(args, flags)); err != nil {
+				return 2
+			}
+			_args := make([]string, 0)
 			for _, arg := range arguments {
-				_args = append(_args, *arg) 
+				_args = append(_args, arg())
 			}
-		
+
 			_args = append(_args, slices.Clone(cmd.Args())...)
-			
+
 			return callback(app, _args)
 		},
 	})
 }
+
+// Split the value stuck to a one letter optional flag, as git does: "-M50%" is given as "-M=50%".
+func stuckValues(args []string, flags []Arg) []string {
+	split := slices.Clone(args)
+	for i, arg := range split {
+		if arg == "--" {
+			break
+		}
+		for _, f := range flags {
+			if f.Optional && len(f.Name) == 1 && len(arg) > 2 && arg[:2] == "-"+f.Name && arg[2] != '=' {
+				split[i] = "-" + f.Name + "=" + arg[2:]
+			}
+		}
+	}
+	return split
+}
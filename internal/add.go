@@ -0,0 +1,216 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var (
+	// Add was given no path, and neither All nor Update.
+	ErrorNothingSpecified = errors.New("nothing specified, nothing added")
+	// A path given to add matches no file of the worktree nor of the index.
+	ErrorPathspecNoMatch = errors.New("pathspec did not match any files")
+	// A path given to add names an ignored file. Force adds it.
+	ErrorPathIgnored = errors.New("path is ignored by a .gotignore rule, use -f to add it")
+	// A path given to add is not inside the worktree.
+	ErrorPathOutsideRepository = errors.New("path is outside the repository")
+)
+
+type AddOptions struct {
+	// Stage the deletions of the tracked files too. Without paths, the whole worktree is staged.
+	All bool
+	// Stage the tracked files only, their modifications and deletions. Without paths, the whole worktree is staged.
+	Update bool
+	// List the files without staging them.
+	DryRun bool
+	// Stage the ignored files too.
+	Force bool
+}
+
+type AddResult struct {
+	// The files staged, new or modified, relative to the worktree.
+	Added []string
+	// The tracked files deleted from the worktree, removed from the index.
+	Removed []string
+}
+
+// Stage the files the paths match and persist the index. The paths are relative to the folder pwd inside the worktree,
+// and are either:
+//   - A file.
+//   - A folder, "." included, matching the files under it.
+//   - A glob pattern, whose "*" matches across folders as git does: "*.go" matches "src/main.go".
+//
+// The deletions are staged with All or Update only, or when a path names the deleted file. The ignored files are left
+// out unless Force, see Ignore, the tracked ones aside.
+func Add(repo *GotRepository, pwd string, paths []string, options AddOptions) (*AddResult, error) {
+	if len(paths) == 0 && !options.All && !options.Update {
+		return nil, ErrorNothingSpecified
+	}
+	specs := make([]pathspec, 0, len(paths))
+	for _, path := range paths {
+		spec, err := newPathspec(repo, pwd, path)
+		if err != nil {
+			return nil, err
+		}
+		specs = append(specs, spec)
+	}
+	// What it does: remember which paths matched something, the others are reported.
+	matched := make([]bool, len(specs))
+	match := func(path string, exact bool) bool {
+		found := len(specs) == 0
+		for i, spec := range specs {
+			if spec.match(path) && (!exact || spec.path == path) {
+				matched[i], found = true, true
+			}
+		}
+		return found
+	}
+
+	var ignore *Ignore
+	if !options.Force {
+		var err error
+		if ignore, err = NewIgnore(repo); err != nil {
+			return nil, err
+		}
+	}
+	tracked := make(map[string]IndexEntry)
+	conflicted := make(map[string]bool)
+	for _, entry := range repo.Index.Entries {
+		tracked[entry.PathName] = entry
+		if entry.Stage != 0 {
+			conflicted[entry.PathName] = true
+		}
+	}
+	result := &AddResult{Added: make([]string, 0), Removed: make([]string, 0)}
+	files, _ := listWorkTree(repo, ignore)
+	positions := repo.Index.positions()
+	for _, file := range files {
+		path := filepath.ToSlash(relativize(repo, file))
+		entry, isTracked := tracked[path]
+		if !match(path, false) || options.Update && !isTracked {
+			continue
+		}
+		// What it does: adding a conflicted file resolves it, even when it is unchanged. A file that only changed of
+		// mode is added again.
+		if isTracked && !conflicted[path] {
+			if fi, err := os.Lstat(file); err == nil && statMode(fi) == entry.FileMode && hashUserFile(repo, positions, path, fi) == entry.Hash {
+				continue
+			}
+		}
+		result.Added = append(result.Added, path)
+	}
+	for path, entry := range tracked {
+		// What it does: the submodules are empty folders of the worktree, they stay tracked.
+		if ok, _ := isFile(filepath.Join(repo.GotTree, path)); ok || entry.FileMode == statModeGitlink {
+			continue
+		}
+		if match(path, !options.All && !options.Update) {
+			result.Removed = append(result.Removed, path)
+		}
+	}
+	for i, spec := range specs {
+		switch {
+		case matched[i]:
+		case ignore != nil && ignore.Ignored(spec.path, pathExist(filepath.Join(repo.GotTree, spec.path), true)):
+			return nil, fmt.Errorf("%w: %s", ErrorPathIgnored, spec.given)
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrorPathspecNoMatch, spec.given)
+		}
+	}
+	slices.Sort(result.Added)
+	slices.Sort(result.Removed)
+	if options.DryRun {
+		return result, nil
+	}
+	if err := repo.Index.AddOrModifyEntries(repo, result.Added); err != nil {
+		return nil, err
+	}
+	removed := make(map[string]bool, len(result.Removed))
+	for _, path := range result.Removed {
+		removed[path] = true
+	}
+	repo.Index.Entries = slices.DeleteFunc(repo.Index.Entries, func(entry IndexEntry) bool {
+		return removed[entry.PathName]
+	})
+	if err := repo.Index.Persist(repo); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// A path given to add, relative to the worktree.
+type pathspec struct {
+	// The path as it was given.
+	given string
+	// The path relative to the worktree, with forward slashes. "." is the whole worktree.
+	path string
+	// The pattern of a glob, nil otherwise.
+	glob *regexp.Regexp
+}
+
+// Resolve the path given relative to pwd into the path relative to the worktree.
+func newPathspec(repo *GotRepository, pwd string, given string) (pathspec, error) {
+	abs := given
+	if !filepath.IsAbs(abs) {
+		abs = filepath.Join(pwd, given)
+	}
+	rel, err := filepath.Rel(repo.GotTree, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		return pathspec{}, fmt.Errorf("%w: %s", ErrorPathOutsideRepository, given)
+	}
+	spec := pathspec{given: given, path: filepath.ToSlash(rel)}
+	if strings.ContainsAny(spec.path, "*?[") {
+		spec.glob, err = globRegexp(spec.path)
+		if err != nil {
+			return pathspec{}, fmt.Errorf("%w: %s", ErrorPathspecNoMatch, given)
+		}
+	}
+	return spec, nil
+}
+
+// Whether the path of a file relative to the worktree is matched.
+func (spec pathspec) match(path string) bool {
+	switch {
+	case spec.glob != nil:
+		return spec.glob.MatchString(path)
+	case spec.path == ".":
+		return true
+	}
+	return path == spec.path || strings.HasPrefix(path, spec.path+"/")
+}
+
+// Convert a glob pattern into a regular expression matching the whole path. "*" matches any run of characters,
+// slashes included, "?" a single one, and "[...]" a class, "[!...]" negated.
+func globRegexp(pattern string) (*regexp.Regexp, error) {
+	var expr strings.Builder
+	expr.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			expr.WriteString(".*")
+		case '?':
+			expr.WriteString(".")
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				expr.WriteString(regexp.QuoteMeta("["))
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.Compile(expr.String())
+}
@@ -0,0 +1,117 @@
+package internal_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	internal "github.com/danielrrv/got/internal"
+)
+
+func stagedPathsTesting(repo *internal.GotRepository) []string {
+	paths := make([]string, 0)
+	for _, entry := range repo.Index.Entries {
+		paths = append(paths, entry.PathName)
+	}
+	slices.Sort(paths)
+	return paths
+}
+
+func TestAdd(t *testing.T) {
+	files := []TestingFile{
+		{Name: "readme.md", RelativePath: "readme.md", Data: []byte("readme\n")},
+		{Name: "main.go", RelativePath: "src/main.go", Data: []byte("package main\n")},
+		{Name: "util.go", RelativePath: "src/lib/util.go", Data: []byte("package lib\n")},
+		{Name: "notes.txt", RelativePath: "src/lib/notes.txt", Data: []byte("notes\n")},
+	}
+
+	t.Run("folders and the current folder", func(t *testing.T) {
+		tmp := t.TempDir()
+		repo, _ := internal.FindOrCreateRepo(tmp)
+		CreateFilesTesting(tmp, []string{"src/lib"}, files)
+		result, err := internal.Add(repo, filepath.Join(tmp, "src"), []string{"lib"}, internal.AddOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(result.Added, []string{"src/lib/notes.txt", "src/lib/util.go"}) {
+			t.Errorf("Expected the files of the folder relative to the current one, got %v", result.Added)
+		}
+		result, err = internal.Add(repo, filepath.Join(tmp, "src"), []string{"."}, internal.AddOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(result.Added, []string{"src/main.go"}) {
+			t.Errorf("Expected the unchanged files skipped, got %v", result.Added)
+		}
+		repo, _ = internal.FindOrCreateRepo(tmp)
+		if paths := stagedPathsTesting(repo); !slices.Equal(paths, []string{"src/lib/notes.txt", "src/lib/util.go", "src/main.go"}) {
+			t.Errorf("Expected the index persisted, got %v", paths)
+		}
+		if _, err := internal.Add(repo, tmp, []string{"../elsewhere"}, internal.AddOptions{}); !errors.Is(err, internal.ErrorPathOutsideRepository) {
+			t.Errorf("Expected the path outside the worktree refused, got %v", err)
+		}
+		if _, err := internal.Add(repo, tmp, nil, internal.AddOptions{}); !errors.Is(err, internal.ErrorNothingSpecified) {
+			t.Errorf("Expected add without paths refused, got %v", err)
+		}
+	})
+
+	t.Run("glob patterns", func(t *testing.T) {
+		tmp := t.TempDir()
+		repo, _ := internal.FindOrCreateRepo(tmp)
+		CreateFilesTesting(tmp, []string{"src/lib"}, files)
+		result, err := internal.Add(repo, tmp, []string{"*.go"}, internal.AddOptions{DryRun: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(result.Added, []string{"src/lib/util.go", "src/main.go"}) {
+			t.Errorf("Expected the pattern to match across folders, got %v", result.Added)
+		}
+		if len(repo.Index.Entries) != 0 {
+			t.Errorf("Expected the dry run not to stage, got %v", repo.Index.Entries)
+		}
+		result, _ = internal.Add(repo, filepath.Join(tmp, "src"), []string{"lib/[!u]*"}, internal.AddOptions{})
+		if !slices.Equal(result.Added, []string{"src/lib/notes.txt"}) {
+			t.Errorf("Expected the negated class to match, got %v", result.Added)
+		}
+		if _, err := internal.Add(repo, tmp, []string{"*.rs"}, internal.AddOptions{}); !errors.Is(err, internal.ErrorPathspecNoMatch) {
+			t.Errorf("Expected the pattern matching nothing reported, got %v", err)
+		}
+	})
+
+	t.Run("deletions and tracked files only", func(t *testing.T) {
+		tmp := t.TempDir()
+		repo, _ := internal.FindOrCreateRepo(tmp)
+		CreateFilesTesting(tmp, []string{"src/lib"}, files)
+		if _, err := internal.Add(repo, tmp, []string{"readme.md", "src"}, internal.AddOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		os.Remove(filepath.Join(tmp, "src/lib/notes.txt"))
+		os.WriteFile(filepath.Join(tmp, "src/main.go"), []byte("package main\n\nfunc main() {}\n"), 0644)
+		os.WriteFile(filepath.Join(tmp, "new.txt"), []byte("new\n"), 0644)
+
+		result, _ := internal.Add(repo, tmp, []string{"."}, internal.AddOptions{DryRun: true})
+		if !slices.Equal(result.Added, []string{"new.txt", "src/main.go"}) || len(result.Removed) != 0 {
+			t.Errorf("Expected the deletion not staged by a folder, got %+v", result)
+		}
+		result, _ = internal.Add(repo, tmp, nil, internal.AddOptions{Update: true, DryRun: true})
+		if !slices.Equal(result.Added, []string{"src/main.go"}) || !slices.Equal(result.Removed, []string{"src/lib/notes.txt"}) {
+			t.Errorf("Expected the tracked files only, got %+v", result)
+		}
+		result, _ = internal.Add(repo, filepath.Join(tmp, "src"), []string{"lib/notes.txt"}, internal.AddOptions{DryRun: true})
+		if !slices.Equal(result.Removed, []string{"src/lib/notes.txt"}) {
+			t.Errorf("Expected the deleted file named staged, got %+v", result)
+		}
+		result, err := internal.Add(repo, filepath.Join(tmp, "src"), nil, internal.AddOptions{All: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(result.Added, []string{"new.txt", "src/main.go"}) || !slices.Equal(result.Removed, []string{"src/lib/notes.txt"}) {
+			t.Errorf("Expected the whole worktree staged, got %+v", result)
+		}
+		if paths := stagedPathsTesting(repo); !slices.Equal(paths, []string{"new.txt", "readme.md", "src/lib/util.go", "src/main.go"}) {
+			t.Errorf("Expected the deleted file removed from the index, got %v", paths)
+		}
+	})
+}
@@ -0,0 +1,293 @@
+package internal
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// The file to blame is not in the revision.
+	ErrorNoSuchPath = errors.New("no such path in the revision")
+	// The range of lines given to blame is out of the file.
+	ErrorInvalidLineRange = errors.New("invalid line range")
+)
+
+// The commit the lines of the worktree not committed yet are blamed on.
+const NotCommittedHash = "0000000000000000000000000000000000000000"
+
+type BlameOptions struct {
+	// The revision whose file is blamed. Empty blames the file of the worktree, its lines not in HEAD are blamed on
+	// NotCommittedHash.
+	Revision string
+	// The 1-based first and last lines to blame, both included. Zero is the first or the last line of the file.
+	Start int
+	End   int
+}
+
+// A line of the file and the commit that introduced it.
+type BlameLine struct {
+	// The commit, NotCommittedHash for the lines of the worktree.
+	Hash   string
+	Commit *Commit
+	// The path of the file in the commit, the former one before a rename.
+	Path string
+	// The 1-based number of the line in the file of the commit, and in the file blamed.
+	OrigLine  int
+	FinalLine int
+	// The line, terminator included.
+	Text string
+	// The commit has no parent.
+	Boundary bool
+	// The parent the commit was compared with and the path of the file in it. Empty when the commit added the file.
+	Previous     string
+	PreviousPath string
+}
+
+// A commit lines are blamed on, until they are found in one of its parents.
+type blameSuspect struct {
+	hash   string
+	commit *Commit
+	path   string
+	blob   string
+	lines  []string
+	// The lines still to blame: the index of the line in lines to the indexes of the lines blamed.
+	tracked map[int][]int
+}
+
+// Attribute each line of the file, relative to the worktree, to the commit that introduced it.
+//
+// What it does: walk the history newest commit first. The lines a commit shares with a parent, per the line diff, are
+// passed to the parent, the first parent that has them. The lines left are the ones the commit introduced. The file is
+// followed across its renames, see DetectRenames.
+func Blame(repo *GotRepository, path string, options BlameOptions) ([]BlameLine, error) {
+	commits := make(map[string]*Commit)
+	readCommit := func(hash string) *Commit {
+		if _, ok := commits[hash]; !ok {
+			commits[hash] = ReadCommit(repo, hash)
+		}
+		return commits[hash]
+	}
+	trees := make(map[string]map[string]string)
+	blobsOf := func(hash string) map[string]string {
+		if _, ok := trees[hash]; !ok {
+			trees[hash] = flattenTree(repo, readCommit(hash).Tree)
+		}
+		return trees[hash]
+	}
+	readLines := func(hash string) ([]string, error) {
+		content, err := ReadBlob(repo, hash)
+		if err != nil {
+			return nil, err
+		}
+		return SplitLines(content), nil
+	}
+
+	rev := cmp.Or(options.Revision, "HEAD")
+	head, err := ResolveRevision(repo, rev)
+	if err != nil {
+		return nil, err
+	}
+	blob, ok := blobsOf(head)[path]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s in %s", ErrorNoSuchPath, path, rev)
+	}
+	first := &blameSuspect{hash: head, commit: readCommit(head), path: path, blob: blob}
+	if first.lines, err = readLines(blob); err != nil {
+		return nil, err
+	}
+	// What it does: the worktree file is the child of HEAD, its modifications are blamed on a commit not made yet.
+	if hash, exists := hashWorktreeFile(repo, repo.Index.positions(), path); options.Revision == "" && exists && hash != blob {
+		worktree, err := BlobFromUserPath(repo, path)
+		if err != nil {
+			return nil, err
+		}
+		now := Signature{Name: "Not Committed Yet", Email: "not.committed.yet", When: time.Now().Unix()}
+		commit := &Commit{Parents: []string{head}, Author: now, Committer: now, Description: "Version of " + path + " from the worktree"}
+		first = &blameSuspect{hash: NotCommittedHash, commit: commit, path: path, blob: hash, lines: SplitLines(worktree.Serialize())}
+	}
+
+	start, end := cmp.Or(options.Start, 1), cmp.Or(options.End, len(first.lines))
+	if len(first.lines) > 0 && (start < 1 || end < start || end > len(first.lines)) || len(first.lines) == 0 && options.Start+options.End > 0 {
+		return nil, fmt.Errorf("%w: %d,%d, the file has %d lines", ErrorInvalidLineRange, start, end, len(first.lines))
+	}
+	first.tracked = make(map[int][]int)
+	for i := start - 1; i < end; i++ {
+		first.tracked[i] = []int{i}
+	}
+
+	blamed := make([]BlameLine, max(end-start+1, 0))
+	pending := []*blameSuspect{first}
+	for len(pending) > 0 {
+		// What it does: take the newest commit, its children have passed it their lines already.
+		next := 0
+		for i, suspect := range pending {
+			if suspect.commit.Committer.When > pending[next].commit.Committer.When {
+				next = i
+			}
+		}
+		suspect := pending[next]
+		pending = append(pending[:next], pending[next+1:]...)
+
+		previous, previousPath := "", ""
+		for _, parent := range suspect.commit.Parents {
+			if len(suspect.tracked) == 0 {
+				break
+			}
+			parentPath := suspect.path
+			parentBlob, ok := blobsOf(parent)[parentPath]
+			if !ok {
+				if parentPath, ok = renamedFrom(repo, suspect.commit, parent, suspect.path); !ok {
+					continue
+				}
+				parentBlob = blobsOf(parent)[parentPath]
+			}
+			if previous == "" {
+				previous, previousPath = parent, parentPath
+			}
+			target := (*blameSuspect)(nil)
+			for _, other := range pending {
+				if other.hash == parent && other.path == parentPath {
+					target = other
+				}
+			}
+			if target == nil {
+				target = &blameSuspect{hash: parent, commit: readCommit(parent), path: parentPath, blob: parentBlob, tracked: make(map[int][]int)}
+				if target.lines, err = readLines(parentBlob); err != nil {
+					return nil, err
+				}
+			}
+			passed := len(target.tracked)
+			for _, edit := range DiffLines(target.lines, suspect.lines) {
+				if finals, ok := suspect.tracked[edit.NewIndex]; ok && edit.Operation == EditEqual {
+					target.tracked[edit.OldIndex] = append(target.tracked[edit.OldIndex], finals...)
+					delete(suspect.tracked, edit.NewIndex)
+				}
+			}
+			if passed == 0 && len(target.tracked) > 0 {
+				pending = append(pending, target)
+			}
+		}
+		for index, finals := range suspect.tracked {
+			for _, final := range finals {
+				blamed[final-(start-1)] = BlameLine{Hash: suspect.hash, Commit: suspect.commit, Path: suspect.path,
+					OrigLine: index + 1, FinalLine: final + 1, Text: suspect.lines[index],
+					Boundary: len(suspect.commit.Parents) == 0, Previous: previous, PreviousPath: previousPath}
+			}
+		}
+	}
+	return blamed, nil
+}
+
+// Parse the range of -L: "start,end", "start,+count", "start," to the end of the file and ",end" from its first line.
+func ParseLineRange(value string) (int, int, error) {
+	startValue, endValue, found := strings.Cut(value, ",")
+	invalid := fmt.Errorf("%w: %s", ErrorInvalidLineRange, value)
+	if !found {
+		return 0, 0, invalid
+	}
+	start, end := 0, 0
+	var err error
+	if startValue != "" {
+		if start, err = strconv.Atoi(startValue); err != nil || start < 1 {
+			return 0, 0, invalid
+		}
+	}
+	if count, relative := strings.CutPrefix(endValue, "+"); relative {
+		n, err := strconv.Atoi(count)
+		if err != nil || n < 1 {
+			return 0, 0, invalid
+		}
+		end = max(start, 1) + n - 1
+	} else if endValue != "" {
+		if end, err = strconv.Atoi(endValue); err != nil || end < max(start, 1) {
+			return 0, 0, invalid
+		}
+	}
+	return start, end, nil
+}
+
+// Write the lines blamed as git blame does: the short hash, "^" before the one of a commit without parent, the
+// author, the date and the line. The path of the file in the commit is shown too when the file was renamed.
+//
+// The porcelain format is the one of git blame --porcelain, for scripts: a header per group of lines of the same
+// commit, the details of the commit the first time it is shown, and each line after a tab.
+func WriteBlame(w io.Writer, lines []BlameLine, porcelain bool) error {
+	var out strings.Builder
+	if porcelain {
+		writePorcelainBlame(&out, lines)
+		_, err := io.WriteString(w, out.String())
+		return err
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	authorWidth, pathWidth, renamed := 0, 0, false
+	for _, line := range lines {
+		authorWidth, pathWidth = max(authorWidth, len(line.Commit.Author.Name)), max(pathWidth, len(line.Path))
+		renamed = renamed || line.Path != lines[0].Path
+	}
+	numberWidth := len(strconv.Itoa(lines[len(lines)-1].FinalLine))
+	for _, line := range lines {
+		hash := line.Hash[:8]
+		if line.Boundary {
+			hash = "^" + line.Hash[:7]
+		}
+		out.WriteString(hash + " ")
+		if renamed {
+			fmt.Fprintf(&out, "%-*s ", pathWidth, line.Path)
+		}
+		fmt.Fprintf(&out, "(%-*s %s %*d) %s", authorWidth, line.Commit.Author.Name,
+			line.Commit.Author.Time().Format("2006-01-02 15:04:05 -0700"), numberWidth, line.FinalLine, lineText(line.Text))
+	}
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+func writePorcelainBlame(out *strings.Builder, lines []BlameLine) {
+	shown := make(map[string]bool)
+	for i, line := range lines {
+		fmt.Fprintf(out, "%s %d %d", line.Hash, line.OrigLine, line.FinalLine)
+		continued := func(j int) bool {
+			return j > 0 && lines[j-1].Hash == lines[j].Hash && lines[j-1].Path == lines[j].Path && lines[j-1].OrigLine+1 == lines[j].OrigLine
+		}
+		if !continued(i) {
+			count := 1
+			for i+count < len(lines) && continued(i+count) {
+				count++
+			}
+			fmt.Fprintf(out, " %d", count)
+		}
+		out.WriteString("\n")
+		if !shown[line.Hash] {
+			shown[line.Hash] = true
+			for _, person := range []struct {
+				name      string
+				signature Signature
+			}{{"author", line.Commit.Author}, {"committer", line.Commit.Committer}} {
+				fmt.Fprintf(out, "%s %s\n%s-mail <%s>\n%s-time %d\n%s-tz %s\n", person.name, person.signature.Name,
+					person.name, person.signature.Email, person.name, person.signature.When, person.name, person.signature.Zone())
+			}
+			fmt.Fprintf(out, "summary %s\n", strings.SplitN(line.Commit.Description, "\n", 2)[0])
+			if line.Boundary {
+				out.WriteString("boundary\n")
+			} else if line.Previous != "" {
+				fmt.Fprintf(out, "previous %s %s\n", line.Previous, line.PreviousPath)
+			}
+			fmt.Fprintf(out, "filename %s\n", line.Path)
+		}
+		out.WriteString("\t" + lineText(line.Text))
+	}
+}
+
+// The line with its terminator, the last line of a file may lack it.
+func lineText(text string) string {
+	if strings.HasSuffix(text, "\n") {
+		return text
+	}
+	return text + "\n"
+}
@@ -0,0 +1,160 @@
+package internal_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	internal "github.com/danielrrv/got/internal"
+)
+
+// The commit each line of the lines blamed is blamed on.
+func blamedHashesTesting(lines []internal.BlameLine) []string {
+	hashes := make([]string, 0)
+	for _, line := range lines {
+		hashes = append(hashes, line.Hash)
+	}
+	return hashes
+}
+
+func TestBlame(t *testing.T) {
+	t.Run("attribute the lines across commits and renames", func(t *testing.T) {
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		first := CommitFilesTesting(repo, "first", "", map[string]string{"old.c": "one\ntwo\nthree\nfour\n"})
+		second := CommitFilesTesting(repo, "second", first, map[string]string{"old.c": "one\nTWO\nthree\nfour\nfive\n"})
+		third := CommitFilesTesting(repo, "third", second, map[string]string{"src/new.c": "one\nTWO\nthree\nfour\nfive\nsix"})
+
+		lines, err := internal.Blame(repo, "src/new.c", internal.BlameOptions{Revision: third})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []string{first, second, first, first, second, third}
+		if hashes := blamedHashesTesting(lines); strings.Join(hashes, " ") != strings.Join(expected, " ") {
+			t.Errorf("Expected the lines blamed on %v, got %v", expected, hashes)
+		}
+		if lines[0].Path != "old.c" || !lines[0].Boundary || lines[5].Path != "src/new.c" || lines[5].Text != "six" {
+			t.Errorf("Expected the former path of the renamed file, got %+v and %+v", lines[0], lines[5])
+		}
+		if lines[1].OrigLine != 2 || lines[1].FinalLine != 2 || lines[1].Previous != first || lines[1].PreviousPath != "old.c" {
+			t.Errorf("Expected the line numbers and the parent compared with, got %+v", lines[1])
+		}
+		if lines[4].Previous != first || lines[5].Previous != second || lines[5].PreviousPath != "old.c" {
+			t.Errorf("Expected the parent of the renaming commit, got %+v", lines[5])
+		}
+		if _, err := internal.Blame(repo, "missing.c", internal.BlameOptions{Revision: third}); !errors.Is(err, internal.ErrorNoSuchPath) {
+			t.Errorf("Expected the path missing from the revision, got %v", err)
+		}
+	})
+
+	t.Run("lines of a merge and of the worktree", func(t *testing.T) {
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		base := commitWorktreeTesting(t, repo, "base", []TestingFile{{RelativePath: "readme.md", Data: []byte("a\nb\nc\n")}})
+		feature := CommitFilesTesting(repo, "feature", base, map[string]string{"readme.md": "a\nb\nc\nfeature\n"})
+		main := CommitFilesTesting(repo, "main", base, map[string]string{"readme.md": "main\na\nb\nc\n"})
+		merged := CommitFilesTesting(repo, "merge", main, map[string]string{"readme.md": "main\na\nb\nc\nfeature\nmerge\n"})
+		commit := internal.ReadCommit(repo, merged)
+		commit.Parents = append(commit.Parents, feature)
+		merge, err := internal.WriteObject(repo, *commit, internal.CommitHeaderName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		internal.CreateOrUpdateRepoFile(repo, filepath.Join("refs", "heads", "main"), []byte(merge))
+
+		lines, err := internal.Blame(repo, "readme.md", internal.BlameOptions{Revision: merge})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []string{main, base, base, base, feature, merge}
+		if hashes := blamedHashesTesting(lines); strings.Join(hashes, " ") != strings.Join(expected, " ") {
+			t.Errorf("Expected the lines of both sides of the merge, got %v", hashes)
+		}
+
+		os.WriteFile(filepath.Join(repo.GotTree, "readme.md"), []byte("main\na\nchanged\nc\nfeature\nmerge\n"), 0644)
+		lines, err = internal.Blame(repo, "readme.md", internal.BlameOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lines[2].Hash != internal.NotCommittedHash || lines[2].Commit.Author.Name != "Not Committed Yet" || lines[3].Hash != base {
+			t.Errorf("Expected the modified line of the worktree not committed yet, got %v", blamedHashesTesting(lines))
+		}
+		lines, _ = internal.Blame(repo, "readme.md", internal.BlameOptions{Revision: "HEAD"})
+		if lines[2].Hash != base {
+			t.Errorf("Expected the file of the revision, got %v", blamedHashesTesting(lines))
+		}
+	})
+
+	t.Run("line range and output formats", func(t *testing.T) {
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		first := CommitFilesTesting(repo, "first", "", map[string]string{"main.c": "one\ntwo\nthree\n"})
+		second := CommitFilesTesting(repo, "second\n\nbody", first, map[string]string{"main.c": "one\nTWO\nthree\n"})
+
+		lines, err := internal.Blame(repo, "main.c", internal.BlameOptions{Revision: second, Start: 2, End: 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(lines) != 2 || lines[0].FinalLine != 2 || lines[0].Hash != second || lines[1].Hash != first {
+			t.Errorf("Expected the lines 2 and 3 only, got %+v", lines)
+		}
+		for _, options := range []internal.BlameOptions{{Start: 3, End: 2}, {Start: 2, End: 4}, {Start: 0, End: 9}} {
+			options.Revision = second
+			if _, err := internal.Blame(repo, "main.c", options); !errors.Is(err, internal.ErrorInvalidLineRange) {
+				t.Errorf("Expected the range %d,%d refused, got %v", options.Start, options.End, err)
+			}
+		}
+		ranges := map[string][2]int{"2,3": {2, 3}, "2,+2": {2, 3}, "2,": {2, 0}, ",2": {0, 2}}
+		for value, expected := range ranges {
+			if start, end, err := internal.ParseLineRange(value); err != nil || start != expected[0] || end != expected[1] {
+				t.Errorf("Expected %q parsed as %v, got %d,%d %v", value, expected, start, end, err)
+			}
+		}
+		for _, value := range []string{"2", "3,2", "0,1", "a,b", "1,+0"} {
+			if _, _, err := internal.ParseLineRange(value); !errors.Is(err, internal.ErrorInvalidLineRange) {
+				t.Errorf("Expected %q refused, got %v", value, err)
+			}
+		}
+
+		lines, _ = internal.Blame(repo, "main.c", internal.BlameOptions{Revision: second})
+		var out bytes.Buffer
+		if err := internal.WriteBlame(&out, lines, false); err != nil {
+			t.Fatal(err)
+		}
+		date := lines[0].Commit.Author.Time().Format("2006-01-02 15:04:05 -0700")
+		author := lines[0].Commit.Author.Name
+		expected := "^" + first[:7] + " (" + author + " " + date + " 1) one\n" +
+			second[:8] + " (" + author + " " + date + " 2) TWO\n"
+		if !strings.HasPrefix(out.String(), expected) {
+			t.Errorf("Expected\n%s, got\n%s", expected, out.String())
+		}
+
+		out.Reset()
+		if err := internal.WriteBlame(&out, lines, true); err != nil {
+			t.Fatal(err)
+		}
+		for _, part := range []string{
+			first + " 1 1 1\nauthor " + author + "\n",
+			"summary first\nboundary\nfilename main.c\n\tone\n",
+			second + " 2 2 1\n",
+			"summary second\nprevious " + first + " main.c\nfilename main.c\n\tTWO\n",
+			first + " 3 3 1\n\tthree\n",
+		} {
+			if !strings.Contains(out.String(), part) {
+				t.Errorf("Expected %q in the porcelain output, got\n%s", part, out.String())
+			}
+		}
+		if strings.Count(out.String(), "author-mail") != 2 {
+			t.Errorf("Expected the details of each commit once, got\n%s", out.String())
+		}
+	})
+}
@@ -2,7 +2,7 @@ package internal
 
 import (
 	"errors"
-	// "io/fs"
+	"io/fs"
 	"os"
 	"path/filepath"
 )
@@ -33,13 +33,26 @@ type Blob struct {
 
 // Reads the blob raw data from the path/
 func (b Blob) Serialize() []byte {
-	content, err := os.ReadFile(b.Path)
+	content, err := readUserFile(b.Path)
 	if err != nil {
 		panic(err)
 	}
 	return content
 }
 
+// Read the content of the user file as git stores it: the target of a symbolic link, not the file it points to.
+func readUserFile(path string) ([]byte, error) {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+	if fi.Mode()&fs.ModeSymlink != 0 {
+		target, err := os.Readlink(path)
+		return []byte(target), err
+	}
+	return os.ReadFile(path)
+}
+
 // The deserialization of the blob is its content.
 func (b Blob) Deserialize(d []byte) Blob {
 	b.FileContent = d
@@ -88,15 +101,31 @@ func BlobFromUserPath(repo *GotRepository, path string) (*Blob, error) {
 }
 
 
-func BlobFromCacheEntry(repo *GotRepository, entry CacheEntry) (*Blob, error) {
-	//Create base blob object. At least the content must be filled out.
-	blob := Blob{
-		Repo:        repo,
-		Hash:        entry.Hash,
-		// Serialize of blob will look for the content of the file.
-		FileContent: nil,
-		Path:        filepath.Join(repo.GotTree, entry.PathName),
-		Commit:      nil,
+// Read the blob content from DB given its hash.
+func ReadBlob(repo *GotRepository, hash string) ([]byte, error) {
+	return ReadObject(repo, BlobHeaderName, hash)
+}
+
+// Hash of the user file given its path relative to the worktree. The second value is false when the file doesn't exist.
+//
+// The file is read only when its stat data differs from the one of its index entry, found through the positions of
+// Index.positions.
+func hashWorktreeFile(repo *GotRepository, positions map[string]int, path string) (string, bool) {
+	fi, err := os.Lstat(filepath.Join(repo.GotTree, path))
+	if err != nil || fi.IsDir() {
+		return "", false
 	}
-	return &blob, nil
-}
\ No newline at end of file
+	return hashUserFile(repo, positions, path, fi), true
+}
+
+// Hash of the user file whose info is already known, see hashWorktreeFile.
+func hashUserFile(repo *GotRepository, positions map[string]int, path string, fi fs.FileInfo) string {
+	if idx, ok := positions[path]; ok && repo.Index.unchanged(repo.Index.Entries[idx], fi) {
+		return repo.Index.Entries[idx].Hash
+	}
+	blob, err := BlobFromUserPath(repo, path)
+	if err != nil {
+		panic(err)
+	}
+	return blob.Hash
+}
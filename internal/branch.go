@@ -0,0 +1,193 @@
+package internal
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+var (
+	// The name doesn't follow the reference name rules.
+	ErrorInvalidRefName = errors.New("invalid reference name")
+	// There is a branch with the same name.
+	ErrorBranchExists = errors.New("branch already exists")
+	// There is no branch with that name.
+	ErrorBranchNotFound = errors.New("branch not found")
+	// The branch has commits HEAD can't reach.
+	ErrorBranchNotMerged = errors.New("branch is not fully merged, use force to delete it")
+	// The branch HEAD points to can't be deleted.
+	ErrorDeleteCurrentBranch = errors.New("cannot delete the branch HEAD points to")
+)
+
+type Branch struct {
+	// Branch name, relative to refs/heads.
+	Name string
+	// The commit the branch points to.
+	Hash string
+	// HEAD points to this branch.
+	Current bool
+}
+
+// Validate the reference name following git's rules(see git check-ref-format):
+//
+//   - Components are separated by slashes, none of them can be empty, start with a dot or end with .lock.
+//   - It can't contain "..", "@{", ASCII control characters, space, ~, ^, :, ?, *, [ or backslash.
+//   - It can't end with a dot nor be the single character @.
+func ValidateRefName(name string) error {
+	if name == "" || name == "@" || strings.HasSuffix(name, ".") {
+		return ErrorInvalidRefName
+	}
+	if strings.Contains(name, "..") || strings.Contains(name, "@{") {
+		return ErrorInvalidRefName
+	}
+	for _, c := range name {
+		if c < 0x20 || c == 0x7f || strings.ContainsRune(" ~^:?*[\\", c) {
+			return ErrorInvalidRefName
+		}
+	}
+	for _, component := range strings.Split(name, "/") {
+		if component == "" || strings.HasPrefix(component, ".") || strings.HasSuffix(component, ".lock") {
+			return ErrorInvalidRefName
+		}
+	}
+	return nil
+}
+
+// Validate the branch name. Besides the reference rules, a branch can't be named HEAD nor start with a dash.
+func validateBranchName(name string) error {
+	if name == "HEAD" || strings.HasPrefix(name, "-") {
+		return ErrorInvalidRefName
+	}
+	return ValidateRefName(name)
+}
+
+// Location of the branch reference on the repo dir.
+func branchPath(repo *GotRepository, name string) string {
+	return filepath.Join(repo.GotDir, gotRepositoryDirRefs, gotRepositoryDirRefsHeads, name)
+}
+
+// List the branches sorted by name, marking the one HEAD points to.
+func ListBranches(repo *GotRepository) ([]Branch, error) {
+	headsDir := filepath.Join(repo.GotDir, gotRepositoryDirRefs, gotRepositoryDirRefsHeads)
+	current, _ := repo.GetHEADBranch()
+	branches := make([]Branch, 0)
+	err := filepath.WalkDir(headsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || strings.HasSuffix(path, lockSuffix) {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(headsDir, path)
+		if err != nil {
+			return err
+		}
+		name = filepath.ToSlash(name)
+		branches = append(branches, Branch{
+			Name:    name,
+			Hash:    strings.TrimSpace(string(content)),
+			Current: name == current,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(branches, func(a, b Branch) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return branches, nil
+}
+
+// Create the branch pointing to the revision. An empty revision means HEAD.
+func CreateBranch(repo *GotRepository, name string, rev string) error {
+	if err := validateBranchName(name); err != nil {
+		return err
+	}
+	if pathExist(branchPath(repo, name), false) {
+		return ErrorBranchExists
+	}
+	hash, err := ResolveRevision(repo, rev)
+	if err != nil {
+		return err
+	}
+	if _, err := ReadObject(repo, CommitHeaderName, hash); err != nil {
+		return err
+	}
+	return UpdateBranch(repo, name, hash)
+}
+
+// Delete the branch. Branches with commits HEAD can't reach are kept unless forced.
+func DeleteBranch(repo *GotRepository, name string, force bool) error {
+	if err := validateBranchName(name); err != nil {
+		return err
+	}
+	if current, ok := repo.GetHEADBranch(); ok && current == name {
+		return ErrorDeleteCurrentBranch
+	}
+	path := branchPath(repo, name)
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return ErrorBranchNotFound
+	}
+	if !force {
+		head := repo.GetHEADReference()
+		if head.Invalid || !IsAncestor(repo, strings.TrimSpace(string(content)), head.Reference) {
+			return ErrorBranchNotMerged
+		}
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	removeEmptyRefDirs(repo, filepath.Dir(path))
+	return nil
+}
+
+// Rename the branch. HEAD follows the branch when it points to it.
+func RenameBranch(repo *GotRepository, oldName string, newName string) error {
+	if err := validateBranchName(oldName); err != nil {
+		return err
+	}
+	if err := validateBranchName(newName); err != nil {
+		return err
+	}
+	if pathExist(branchPath(repo, newName), false) {
+		return ErrorBranchExists
+	}
+	current, ok := repo.GetHEADBranch()
+	isCurrent := ok && current == oldName
+	content, err := os.ReadFile(branchPath(repo, oldName))
+	switch {
+	case err == nil:
+		if err := UpdateBranch(repo, newName, strings.TrimSpace(string(content))); err != nil {
+			return err
+		}
+		if err := os.Remove(branchPath(repo, oldName)); err != nil {
+			return err
+		}
+		removeEmptyRefDirs(repo, filepath.Dir(branchPath(repo, oldName)))
+	// What it does: the current branch has no commit yet, only HEAD knows about it.
+	case !isCurrent:
+		return ErrorBranchNotFound
+	}
+	if isCurrent {
+		ref := Ref{IsDirect: false, Reference: newName}
+		return ref.WriteRef(repo)
+	}
+	return nil
+}
+
+// Remove the empty directories left behind by a branch with slashes, up to refs/heads.
+func removeEmptyRefDirs(repo *GotRepository, dir string) {
+	headsDir := filepath.Join(repo.GotDir, gotRepositoryDirRefs, gotRepositoryDirRefsHeads)
+	for dir != headsDir && strings.HasPrefix(dir, headsDir) {
+		if os.Remove(dir) != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
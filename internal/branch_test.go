@@ -0,0 +1,147 @@
+package internal_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	internal "github.com/danielrrv/got/internal"
+)
+
+func TestBranch(t *testing.T) {
+	t.Run("validate reference names", func(t *testing.T) {
+		for _, name := range []string{"main", "feature/login-2", "release-1.0", "v2", "fix_bug", "a.b/c"} {
+			if err := internal.ValidateRefName(name); err != nil {
+				t.Errorf("Expected %q to be valid", name)
+			}
+		}
+		for _, name := range []string{"", "@", "a..b", "a.lock", "a/b.lock/c", ".hidden", "a/.b", "a/", "/a", "a//b", "a.", "a b", "a~1", "a^", "a:b", "a?", "a*", "a[b", "a\\b", "a@{1}", "a\x01"} {
+			if err := internal.ValidateRefName(name); err != internal.ErrorInvalidRefName {
+				t.Errorf("Expected %q to be invalid", name)
+			}
+		}
+	})
+	t.Run("create and list branches", func(t *testing.T) {
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := internal.CreateBranch(repo, "feature", ""); err != internal.ErrorNoCommitYet {
+			t.Errorf("Expected no commit yet, got %v", err)
+		}
+		first := CommitFilesTesting(repo, "first", "", map[string]string{"readme.md": "v1"})
+		second := CommitFilesTesting(repo, "second", first, map[string]string{"readme.md": "v2"})
+		if err := internal.CreateBranch(repo, "feature/login", first[:7]); err != nil {
+			t.Fatal(err)
+		}
+		if err := internal.CreateBranch(repo, "hotfix", ""); err != nil {
+			t.Fatal(err)
+		}
+		if err := internal.CreateBranch(repo, "hotfix", ""); err != internal.ErrorBranchExists {
+			t.Errorf("Expected branch exists, got %v", err)
+		}
+		if err := internal.CreateBranch(repo, "bad..name", ""); err != internal.ErrorInvalidRefName {
+			t.Errorf("Expected invalid name, got %v", err)
+		}
+		branches, err := internal.ListBranches(repo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []internal.Branch{
+			{Name: "feature/login", Hash: first},
+			{Name: "hotfix", Hash: second},
+			{Name: "main", Hash: second, Current: true},
+		}
+		if len(branches) != len(expected) {
+			t.Fatalf("Expected %v, got %v", expected, branches)
+		}
+		for i := range expected {
+			if branches[i] != expected[i] {
+				t.Errorf("Expected %v, got %v", expected[i], branches[i])
+			}
+		}
+	})
+	t.Run("delete branches", func(t *testing.T) {
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		first := CommitFilesTesting(repo, "first", "", map[string]string{"readme.md": "v1"})
+		internal.CreateBranch(repo, "feature/merged", "")
+		// A commit main can't reach.
+		unmerged := CommitFilesTesting(repo, "unmerged", first, map[string]string{"readme.md": "v2"})
+		internal.CreateBranch(repo, "unmerged", "")
+		internal.UpdateBranch(repo, "main", first)
+
+		if err := internal.DeleteBranch(repo, "main", true); err != internal.ErrorDeleteCurrentBranch {
+			t.Errorf("Expected the current branch to be kept, got %v", err)
+		}
+		if err := internal.DeleteBranch(repo, "unmerged", false); err != internal.ErrorBranchNotMerged {
+			t.Errorf("Expected not merged, got %v", err)
+		}
+		if err := internal.DeleteBranch(repo, "feature/merged", false); err != nil {
+			t.Errorf("Expected to delete the merged branch, got %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(repo.GotDir, "refs", "heads", "feature")); !os.IsNotExist(err) {
+			t.Errorf("Expected the empty feature folder to be removed")
+		}
+		if err := internal.DeleteBranch(repo, "unmerged", true); err != nil {
+			t.Errorf("Expected to force the deletion, got %v", err)
+		}
+		if err := internal.DeleteBranch(repo, "unmerged", true); err != internal.ErrorBranchNotFound {
+			t.Errorf("Expected branch not found, got %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(repo.GotDir, "objects", unmerged[:2], unmerged[2:])); err != nil {
+			t.Errorf("Expected the commit to be kept")
+		}
+		// What it does: a name out of the refs folder is refused before anything is read or deleted.
+		if err := internal.DeleteBranch(repo, "../../config", true); err != internal.ErrorInvalidRefName {
+			t.Errorf("Expected the name refused, got %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(repo.GotDir, "config")); err != nil {
+			t.Errorf("Expected the config kept, got %v", err)
+		}
+		os.WriteFile(filepath.Join(repo.GotDir, "outside"), []byte(first), 0644)
+		if _, err := internal.ResolveRevision(repo, "refs/../outside"); err != internal.ErrorUnknownRevision {
+			t.Errorf("Expected the file out of the refs folder not read, got %v", err)
+		}
+		if _, err := internal.ResolveRevision(repo, "../../outside"); err != internal.ErrorUnknownRevision {
+			t.Errorf("Expected the file out of the refs folder not read, got %v", err)
+		}
+	})
+	t.Run("rename branches", func(t *testing.T) {
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		first := CommitFilesTesting(repo, "first", "", map[string]string{"readme.md": "v1"})
+		internal.CreateBranch(repo, "feature", "")
+
+		if err := internal.RenameBranch(repo, "feature", "main"); err != internal.ErrorBranchExists {
+			t.Errorf("Expected branch exists, got %v", err)
+		}
+		if err := internal.RenameBranch(repo, "feature", "topic/feature"); err != nil {
+			t.Fatal(err)
+		}
+		if current, _ := repo.GetHEADBranch(); current != "main" {
+			t.Errorf("Expected HEAD to stay on main, got %s", current)
+		}
+		// What it does: renaming the current branch to a shorter name must rewrite HEAD completely.
+		if err := internal.RenameBranch(repo, "main", "m"); err != nil {
+			t.Fatal(err)
+		}
+		head, _ := os.ReadFile(filepath.Join(repo.GotDir, "HEAD"))
+		if string(head) != "ref: refs/heads/m" {
+			t.Errorf("Expected HEAD to follow the renamed branch, got %q", head)
+		}
+		if ref := repo.GetHEADReference(); ref.Invalid || ref.Reference != first {
+			t.Errorf("Expected HEAD to resolve to the first commit")
+		}
+		if err := internal.RenameBranch(repo, "missing", "other"); err != internal.ErrorBranchNotFound {
+			t.Errorf("Expected branch not found, got %v", err)
+		}
+		if err := internal.RenameBranch(repo, "../../HEAD", "other"); err != internal.ErrorInvalidRefName {
+			t.Errorf("Expected the name refused, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,189 @@
+package internal
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+var (
+	// The checkout would throw away local modifications.
+	ErrorCheckoutOverwrite = errors.New("local changes would be overwritten by checkout")
+)
+
+// Result of a checkout.
+type CheckoutResult struct {
+	// The commit HEAD points to after the checkout.
+	Hash string
+	// The branch HEAD points to. Empty when HEAD is detached.
+	Branch string
+}
+
+// Checkout the branch or commit into the worktree.
+//
+//   - Every blob of the target tree is written into the worktree and the tracked files missing from it are deleted.
+//   - The index is rebuilt to match the target tree. Staged changes on files the checkout doesn't touch are kept.
+//   - HEAD points to the branch, or to the commit itself(detached) when the revision isn't a branch.
+//
+// Unless forced, the checkout is refused when a local modification would be overwritten or a merge is in progress.
+// A forced checkout abandons the merge.
+func Checkout(repo *GotRepository, rev string, force bool) (*CheckoutResult, error) {
+	if readMergeHead(repo) != "" && !force {
+		return nil, ErrorMergeInProgress
+	}
+	hash, err := ResolveRevision(repo, rev)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkoutCommit(repo, hash, force); err != nil {
+		return nil, err
+	}
+	if err := clearMergeState(repo); err != nil {
+		return nil, err
+	}
+	// What it does: a branch keeps HEAD symbolic, anything else detaches it.
+	result := &CheckoutResult{Hash: hash}
+	ref := Ref{IsDirect: true, Reference: hash}
+	if rev != "" && rev != "HEAD" && pathExist(branchPath(repo, rev), false) {
+		result.Branch = rev
+		ref = Ref{IsDirect: false, Reference: rev}
+	}
+	if err := ref.WriteRef(repo); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Write the tree of the commit into the worktree and rebuild the index. HEAD is left as is.
+func checkoutCommit(repo *GotRepository, hash string, force bool) error {
+	rawData, err := ReadObject(repo, CommitHeaderName, hash)
+	if err != nil {
+		return err
+	}
+	target := flattenTreeItems(repo, Commit{}.Deserialize(rawData).Tree)
+	head := make(map[string]TreeItem)
+	if ref := repo.GetHEADReference(); !ref.Invalid {
+		head = flattenTreeItems(repo, ReadCommit(repo, ref.Reference).Tree)
+	}
+	return checkoutTrees(repo, head, target, force)
+}
+
+// Move the worktree and the index from the entries of head to the ones of target, both maps of path to tree entry.
+// The files get the mode of their entry, see writeWorktreeFile. A gitlink is an empty folder, as git leaves the
+// submodules not cloned.
+func checkoutTrees(repo *GotRepository, head, target map[string]TreeItem, force bool) error {
+	staged := make(map[string]string)
+	for _, entry := range repo.Index.Entries {
+		staged[entry.PathName] = entry.Hash
+	}
+	// What it does: a path is touched when it differs between HEAD and the target, or everything when forced.
+	touched := func(path string) bool {
+		return force || head[path].Hash != target[path].Hash || !bytes.Equal(head[path].Mode, target[path].Mode)
+	}
+	// What it does: a tree with a path out of the worktree or into the repository folder is refused before writing.
+	for _, items := range []map[string]TreeItem{head, target} {
+		for path := range items {
+			if err := verifyTreePath(path); err != nil {
+				return err
+			}
+		}
+	}
+	if !force {
+		if conflicts := checkoutConflicts(repo, blobHashes(head), blobHashes(target), staged); len(conflicts) > 0 {
+			return fmt.Errorf("%w: %v", ErrorCheckoutOverwrite, conflicts)
+		}
+	}
+	// Implementation to delete the files of HEAD missing from the target.
+	for path, item := range head {
+		if _, ok := target[path]; ok {
+			continue
+		}
+		err := os.Remove(filepath.Join(repo.GotTree, path))
+		// What it does: the folder of a gitlink is kept when the submodule was cloned into it.
+		if err != nil && !errors.Is(err, os.ErrNotExist) && !bytes.Equal(item.Mode, GitlinkMode) {
+			return err
+		}
+		removeEmptyDirs(repo, filepath.Dir(filepath.Join(repo.GotTree, path)))
+	}
+	// Implementation to write the blobs of the target.
+	for path, item := range target {
+		if _, isStaged := staged[path]; isStaged && !touched(path) {
+			continue
+		}
+		if bytes.Equal(item.Mode, GitlinkMode) {
+			if err := os.MkdirAll(filepath.Join(repo.GotTree, path), 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		content, err := ReadBlob(repo, item.Hash)
+		if err != nil {
+			return err
+		}
+		if err := writeWorktreeFile(repo, path, item.Mode, content); err != nil {
+			return err
+		}
+	}
+	// Implementation to rebuild the index. The stage area of the untouched files is kept.
+	entries := slices.DeleteFunc(slices.Clone(repo.Index.Entries), func(entry IndexEntry) bool {
+		return touched(entry.PathName)
+	})
+	for path, item := range target {
+		if _, isStaged := staged[path]; isStaged && !touched(path) {
+			continue
+		}
+		entry := newIndexEntry(repo, path, item.Hash)
+		if bytes.Equal(item.Mode, GitlinkMode) {
+			entry.FileMode = statModeGitlink
+		}
+		entries = append(entries, entry)
+	}
+	slices.SortFunc(entries, func(a, b IndexEntry) int {
+		return cmp.Compare(a.PathName, b.PathName)
+	})
+	repo.Index.Entries = entries
+	return repo.Index.Persist(repo)
+}
+
+// Find the paths whose local modifications the checkout would overwrite.
+func checkoutConflicts(repo *GotRepository, head, target, staged map[string]string) []string {
+	conflicts := make([]string, 0)
+	paths := make(map[string]bool)
+	for _, tree := range []map[string]string{head, target, staged} {
+		for path := range tree {
+			paths[path] = true
+		}
+	}
+	positions := repo.Index.positions()
+	for path := range paths {
+		if head[path] == target[path] {
+			continue
+		}
+		userHash, exists := hashWorktreeFile(repo, positions, path)
+		_, isTracked := staged[path]
+		switch {
+		// Staged changes differ from both HEAD and the target.
+		case isTracked && staged[path] != head[path] && staged[path] != target[path]:
+			conflicts = append(conflicts, path)
+		// The user file changed since staged, or an untracked file lives where the target has one.
+		case exists && userHash != staged[path] && userHash != target[path]:
+			conflicts = append(conflicts, path)
+		}
+	}
+	slices.Sort(conflicts)
+	return conflicts
+}
+
+// Remove the empty directories up to the worktree root.
+func removeEmptyDirs(repo *GotRepository, dir string) {
+	for dir != repo.GotTree && len(dir) > len(repo.GotTree) {
+		if os.Remove(dir) != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
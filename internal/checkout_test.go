@@ -0,0 +1,197 @@
+package internal_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	internal "github.com/danielrrv/got/internal"
+)
+
+// Stage the user files and commit them.
+func commitWorktreeTesting(t *testing.T, repo *internal.GotRepository, message string, files []TestingFile) string {
+	folders := make([]string, 0)
+	paths := make([]string, 0)
+	for _, file := range files {
+		folders = append(folders, filepath.Dir(file.RelativePath))
+		paths = append(paths, file.RelativePath)
+		os.Remove(filepath.Join(repo.GotTree, file.RelativePath))
+	}
+	CreateFilesTesting(repo.GotTree, folders, files)
+	repo.Index.AddOrModifyEntries(repo, paths)
+	hash, err := internal.CommitIndex(repo, message, internal.CommitOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+func readFileTesting(repo *internal.GotRepository, path string) string {
+	content, err := os.ReadFile(filepath.Join(repo.GotTree, path))
+	if err != nil {
+		return ""
+	}
+	return string(content)
+}
+
+// A commit of the files, as a crafted repository could have, without moving any branch.
+func unsafeCommitTesting(repo *internal.GotRepository, parent string, files map[string]string) string {
+	tree := treeFilesTesting(repo, ".", files)
+	hash, err := internal.WriteObject(repo, *internal.CreateCommit(repo, &tree, "unsafe", parent), internal.CommitHeaderName)
+	if err != nil {
+		panic(err)
+	}
+	return hash
+}
+
+func TestCheckout(t *testing.T) {
+	t.Run("switch between branches", func(t *testing.T) {
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		first := commitWorktreeTesting(t, repo, "first", []TestingFile{
+			{Name: "readme.md", RelativePath: "readme.md", Data: []byte("v1")},
+			{Name: "cache.rs", RelativePath: "src/cache.rs", Data: []byte("v1")},
+		})
+		internal.CreateBranch(repo, "feature", "")
+		result, err := internal.Checkout(repo, "feature", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Branch != "feature" || result.Hash != first {
+			t.Errorf("Expected to be on feature at the first commit, got %v", result)
+		}
+		second := commitWorktreeTesting(t, repo, "second", []TestingFile{
+			{Name: "readme.md", RelativePath: "readme.md", Data: []byte("v2")},
+			{Name: "base64.c", RelativePath: "src/lib/base64.c", Data: []byte("v2")},
+		})
+
+		if _, err := internal.Checkout(repo, "main", false); err != nil {
+			t.Fatal(err)
+		}
+		if branch, _ := repo.GetHEADBranch(); branch != "main" {
+			t.Errorf("Expected HEAD to point to main, got %s", branch)
+		}
+		if content := readFileTesting(repo, "readme.md"); content != "v1" {
+			t.Errorf("Expected readme.md from main, got %q", content)
+		}
+		if _, err := os.Stat(filepath.Join(repo.GotTree, "src", "lib")); !os.IsNotExist(err) {
+			t.Errorf("Expected the file missing from main to be deleted with its folder")
+		}
+		if len(repo.Index.Entries) != 2 {
+			t.Errorf("Expected the index to match main, got %v", repo.Index.Entries)
+		}
+
+		if _, err := internal.Checkout(repo, "feature", false); err != nil {
+			t.Fatal(err)
+		}
+		if content := readFileTesting(repo, "src/lib/base64.c"); content != "v2" {
+			t.Errorf("Expected the file of feature to be written, got %q", content)
+		}
+		// The index is persisted and matches the commit.
+		repo, _ = internal.FindOrCreateRepo(repo.GotTree)
+		if _, err := internal.CommitIndex(repo, "nothing", internal.CommitOptions{}); err != internal.ErrorNothingToCommit {
+			t.Errorf("Expected the index to match the feature commit, got %v", err)
+		}
+		if ref := repo.GetHEADReference(); ref.Reference != second {
+			t.Errorf("Expected HEAD to resolve to the second commit")
+		}
+	})
+	t.Run("detach HEAD on hashes", func(t *testing.T) {
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		first := commitWorktreeTesting(t, repo, "first", []TestingFile{{Name: "readme.md", RelativePath: "readme.md", Data: []byte("v1")}})
+		commitWorktreeTesting(t, repo, "second", []TestingFile{{Name: "readme.md", RelativePath: "readme.md", Data: []byte("v2")}})
+		result, err := internal.Checkout(repo, first[:10], false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Branch != "" {
+			t.Errorf("Expected HEAD to be detached")
+		}
+		if head, _ := os.ReadFile(filepath.Join(repo.GotDir, "HEAD")); string(head) != first {
+			t.Errorf("Expected HEAD to hold the hash, got %q", head)
+		}
+		if content := readFileTesting(repo, "readme.md"); content != "v1" {
+			t.Errorf("Expected readme.md of the first commit, got %q", content)
+		}
+	})
+	t.Run("refuse to overwrite local modifications", func(t *testing.T) {
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		commitWorktreeTesting(t, repo, "first", []TestingFile{
+			{Name: "readme.md", RelativePath: "readme.md", Data: []byte("v1")},
+			{Name: "notes.txt", RelativePath: "notes.txt", Data: []byte("v1")},
+		})
+		internal.CreateBranch(repo, "feature", "")
+		commitWorktreeTesting(t, repo, "second", []TestingFile{{Name: "readme.md", RelativePath: "readme.md", Data: []byte("v2")}})
+
+		// notes.txt is the same on both branches so its modification is carried over.
+		os.WriteFile(filepath.Join(repo.GotTree, "notes.txt"), []byte("local notes"), 0644)
+		if _, err := internal.Checkout(repo, "feature", false); err != nil {
+			t.Fatalf("Expected the untouched modification to be carried over, got %v", err)
+		}
+		if content := readFileTesting(repo, "notes.txt"); content != "local notes" {
+			t.Errorf("Expected the local notes to be kept, got %q", content)
+		}
+
+		os.WriteFile(filepath.Join(repo.GotTree, "readme.md"), []byte("local change"), 0644)
+		if _, err := internal.Checkout(repo, "main", false); !errors.Is(err, internal.ErrorCheckoutOverwrite) {
+			t.Fatalf("Expected the checkout to be refused, got %v", err)
+		}
+		if content := readFileTesting(repo, "readme.md"); content != "local change" {
+			t.Errorf("Expected the worktree to be untouched, got %q", content)
+		}
+		if branch, _ := repo.GetHEADBranch(); branch != "feature" {
+			t.Errorf("Expected HEAD to stay on feature")
+		}
+		if _, err := internal.Checkout(repo, "main", true); err != nil {
+			t.Fatal(err)
+		}
+		if content := readFileTesting(repo, "readme.md"); content != "v2" {
+			t.Errorf("Expected the forced checkout to overwrite readme.md, got %q", content)
+		}
+		if content := readFileTesting(repo, "notes.txt"); content != "v1" {
+			t.Errorf("Expected the forced checkout to reset notes.txt, got %q", content)
+		}
+	})
+	t.Run("refuse to overwrite untracked files", func(t *testing.T) {
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		commitWorktreeTesting(t, repo, "first", []TestingFile{{Name: "readme.md", RelativePath: "readme.md", Data: []byte("v1")}})
+		internal.CreateBranch(repo, "feature", "")
+		commitWorktreeTesting(t, repo, "second", []TestingFile{{Name: "todo.txt", RelativePath: "todo.txt", Data: []byte("v2")}})
+		internal.Checkout(repo, "feature", false)
+		os.WriteFile(filepath.Join(repo.GotTree, "todo.txt"), []byte("untracked"), 0644)
+		if _, err := internal.Checkout(repo, "main", false); !errors.Is(err, internal.ErrorCheckoutOverwrite) {
+			t.Errorf("Expected the checkout to be refused, got %v", err)
+		}
+	})
+	t.Run("refuse paths out of the worktree", func(t *testing.T) {
+		worktree := filepath.Join(t.TempDir(), "worktree")
+		os.Mkdir(worktree, 0755)
+		repo, _ := internal.FindOrCreateRepo(worktree)
+		first := commitWorktreeTesting(t, repo, "first", []TestingFile{{Name: "a.txt", RelativePath: "a.txt", Data: []byte("a")}})
+		config, _ := os.ReadFile(filepath.Join(repo.GotDir, "config"))
+		for _, path := range []string{".got/config", ".GIT/config", "../escape.txt"} {
+			unsafe := unsafeCommitTesting(repo, first, map[string]string{"a.txt": "a", path: "owned"})
+			if _, err := internal.Checkout(repo, unsafe, false); !errors.Is(err, internal.ErrorInvalidTreePath) {
+				t.Errorf("Expected %s refused, got %v", path, err)
+			}
+		}
+		if content, _ := os.ReadFile(filepath.Join(repo.GotDir, "config")); string(content) != string(config) {
+			t.Errorf("Expected the repository folder untouched, got %q", content)
+		}
+		if pathExistTesting(filepath.Join(repo.GotTree, "..", "escape.txt")) {
+			t.Errorf("Expected nothing written out of the worktree")
+		}
+	})
+}
@@ -2,7 +2,10 @@ package internal
 
 import (
 	"bytes"
+	"encoding"
+	"errors"
 	"reflect"
+	"slices"
 	"strings"
 	"time"
 )
@@ -11,71 +14,195 @@ const (
 	tagName = "object"
 )
 
+var (
+	// The commit has no message.
+	ErrorEmptyCommitMessage = errors.New("empty commit message")
+	// The staged tree is the same as the HEAD tree.
+	ErrorNothingToCommit = errors.New("nothing to commit")
+	// The index has conflicts not resolved yet.
+	ErrorUnmergedPaths = errors.New("cannot commit, there are unmerged files")
+)
+
+// The commit object. It is serialized as git does, one header line per field, a blank line and the message:
+//
+//	tree <hash>
+//	parent <hash>
+//	parent <hash>
+//	author Name <email> 1700000000 +0100
+//	committer Name <email> 1700000000 +0100
+//
+//	<message>
+//
+// A commit carries from zero(root commit) to N parents in order, one line each.
 type Commit struct {
-	Author      string `object:"author"`
-	Committer   string `object:"committer"`
-	Tree        string `object:"tree"`
-	Date        string `object:"date"`
-	Description string `object:"description"`
-	Parent      string `object:"parent"`
+	Tree string `object:"tree"`
+	// The first parent is the mainline, the rest are the merged commits.
+	Parents     []string  `object:"parent"`
+	Author      Signature `object:"author"`
+	Committer   Signature `object:"committer"`
+	Description string    `object:"-"`
 }
 
 // Turn Commit instance into array of bytes.
 func (c Commit) Serialize() []byte {
+	return serializeHeaders(c)
+}
+
+// Convert an array of byte to a Commit instance. Commits written with the former "key\tvalue" format are read too.
+func (c Commit) Deserialize(d []byte) Commit {
+	if isLegacyCommit(d) {
+		return deserializeLegacyCommit(d)
+	}
+	deserializeHeaders(d, &c)
+	return c
+}
+
+// Encode the struct as one header line per field, "key value", in the order of the fields, a blank line and the
+// field tagged "-" as message. The key is the tag of the field.
+//
+// A slice field writes one line per element. A struct field implementing encoding.TextMarshaler writes its text,
+// or nothing when it is zero.
+func serializeHeaders(object any) []byte {
 	var out bytes.Buffer
-	t := reflect.TypeOf(c)
-	v := reflect.ValueOf(c)
+	t := reflect.TypeOf(object)
+	v := reflect.ValueOf(object)
 
 	if t.Kind() != reflect.Struct {
 		panic(ErrorIsNotObject)
 	}
+	writeLine := func(key string, value string) {
+		out.WriteString(key)
+		out.WriteByte(space)
+		out.WriteString(value)
+		out.WriteByte(newLine)
+	}
+	message := ""
 	for index := range t.NumField() {
-		out.Write([]byte(t.Field(index).Tag.Get(tagName)))
-		out.WriteByte(tab)
-		out.Write([]byte(v.Field(index).String()))
-		if t.NumField()-1 > index {
-			out.WriteByte(newLine)
+		key := t.Field(index).Tag.Get(tagName)
+		switch field := v.Field(index); {
+		case key == "-":
+			message = field.String()
+		case field.Kind() == reflect.Slice:
+			for i := range field.Len() {
+				writeLine(key, field.Index(i).String())
+			}
+		case field.Kind() == reflect.Struct:
+			if field.IsZero() {
+				continue
+			}
+			text, err := field.Interface().(encoding.TextMarshaler).MarshalText()
+			if err != nil {
+				panic(err)
+			}
+			writeLine(key, string(text))
+		default:
+			writeLine(key, field.String())
 		}
 	}
+	out.WriteByte(newLine)
+	out.WriteString(message)
 	return out.Bytes()
 }
 
-// Convert an array of byte to a Commit instance.
-func (c Commit) Deserialize(d []byte) Commit {
-	t := reflect.TypeOf(c)
-	v := reflect.ValueOf(&c).Elem()
-	m := make(map[string]interface{})
-
-	lines := strings.Split(string(d), string(newLine))
-	for _, line := range lines {
-		elements := strings.Split(line, string(tab))
-		if len(elements) < 2 {
+// Decode the header lines and the message into the struct the pointer points to. See serializeHeaders.
+//
+// The unknown headers, like the continuation lines of a signed commit, are skipped.
+func deserializeHeaders(d []byte, object any) {
+	v := reflect.ValueOf(object).Elem()
+	t := v.Type()
+	// What it does: the object may have no message at all.
+	headers, message, _ := bytes.Cut(d, []byte{newLine, newLine})
+	fields := make(map[string]int)
+	for i := range t.NumField() {
+		fields[t.Field(i).Tag.Get(tagName)] = i
+	}
+	for _, line := range strings.Split(string(headers), string(newLine)) {
+		key, value, found := strings.Cut(line, string(space))
+		if !found {
 			panic(ErrorParsingObject)
 		}
-		m[elements[0]] = elements[1]
+		index, ok := fields[key]
+		if !ok || key == "-" {
+			continue
+		}
+		switch field := v.Field(index); field.Kind() {
+		case reflect.Slice:
+			field.Set(reflect.Append(field, reflect.ValueOf(value)))
+		case reflect.Struct:
+			if err := field.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value)); err != nil {
+				panic(ErrorParsingObject)
+			}
+		default:
+			field.SetString(value)
+		}
 	}
-	for i := range t.NumField() {
-		field := v.FieldByName(t.Field(i).Name)
-		if !field.CanSet() {
+	if index, ok := fields["-"]; ok {
+		v.Field(index).SetString(string(message))
+	}
+}
+
+// The former format has no blank line before the message and separates keys and values with a tab.
+func isLegacyCommit(d []byte) bool {
+	firstLine, _, _ := bytes.Cut(d, []byte{newLine})
+	return bytes.IndexByte(firstLine, tab) >= 0 && !bytes.Contains(d, []byte{newLine, newLine})
+}
+
+func deserializeLegacyCommit(d []byte) Commit {
+	m := make(map[string]string)
+	for _, line := range strings.Split(string(d), string(newLine)) {
+		key, value, found := strings.Cut(line, string(tab))
+		if !found {
 			panic(ErrorParsingObject)
 		}
-		field.Set(reflect.ValueOf(m[t.Field(i).Tag.Get(tagName)]))
+		m[key] = value
+	}
+	// What it does: the former format kept the user name as author, the email as committer and a local date.
+	when, _ := time.ParseInLocation(time.DateTime, m["date"], time.Local)
+	signature := NewSignature(m["author"], m["committer"], when)
+	return Commit{
+		Tree:        m["tree"],
+		Parents:     strings.Fields(m["parent"]),
+		Author:      signature,
+		Committer:   signature,
+		Description: m["description"],
 	}
-	return v.Interface().(Commit)
 }
 
-func CreateCommit(repo *GotRepository, t *TreeItem, message string, parentCommit string) *Commit {
+// Create the commit of the tree signed by the configured user at the current time.
+// The first parent is the mainline, the rest are the merged commits.
+func CreateCommit(repo *GotRepository, t *TreeItem, message string, parents ...string) *Commit {
 	config := repo.GetConfiguration()
+	signature := NewSignature(config.User.Name, config.User.Email, time.Now())
 	return &Commit{
-		Author:      config.User.Name,
-		Committer:   config.User.Email,
 		Tree:        t.Hash,
-		Date:        time.Now().Format(time.DateTime),
+		Parents:     slices.DeleteFunc(slices.Clone(parents), func(p string) bool { return p == "" }),
+		Author:      signature,
+		Committer:   signature,
 		Description: message,
-		Parent:      parentCommit,
 	}
 }
 
+// Collect the commit and every commit reachable walking its parents.
+func ancestors(repo *GotRepository, commit string) map[string]bool {
+	visited := make(map[string]bool)
+	pending := []string{commit}
+	for len(pending) > 0 {
+		hash := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if hash == "" || visited[hash] {
+			continue
+		}
+		visited[hash] = true
+		pending = append(pending, ReadCommit(repo, hash).Parents...)
+	}
+	return visited
+}
+
+// Determine whether the ancestor commit is reachable walking the parents of the commit. A commit is its own ancestor.
+func IsAncestor(repo *GotRepository, ancestor string, commit string) bool {
+	return ancestors(repo, commit)[ancestor]
+}
+
 func ReadCommit(repo *GotRepository, objId string) *Commit {
 	rawData, err := ReadObject(repo, CommitHeaderName, objId)
 	if err != nil {
@@ -85,3 +212,64 @@ func ReadCommit(repo *GotRepository, objId string) *Commit {
 	commit := dummy.Deserialize(rawData)
 	return &commit
 }
+
+// Commit the staged files on top of HEAD. The branch HEAD points to moves to the new commit,
+// or HEAD itself when detached. While a merge is in progress, an empty message is the one of the merge.
+func CommitIndex(repo *GotRepository, message string, options CommitOptions) (string, error) {
+	// What it does: a merge in progress records the merged commit as second parent.
+	mergeHead := readMergeHead(repo)
+	if strings.TrimSpace(message) == "" && mergeHead != "" {
+		message = ReadMergeMessage(repo)
+	}
+	if strings.TrimSpace(message) == "" {
+		return "", ErrorEmptyCommitMessage
+	}
+	author, committer, err := repo.Signatures(options)
+	if err != nil {
+		return "", err
+	}
+	files := make([]string, 0)
+	for _, entry := range repo.Index.Entries {
+		if entry.Stage != 0 {
+			return "", ErrorUnmergedPaths
+		}
+		files = append(files, entry.PathName)
+	}
+	if len(files) == 0 {
+		return "", ErrorNothingToCommit
+	}
+	//what it does: create a tree from the staged files.
+	tree := FromMapToTree(repo, CreateTreeFromFiles(repo, files), ".")
+	parent := ""
+	if ref := repo.GetHEADReference(); !ref.Invalid {
+		parent = ref.Reference
+		if mergeHead == "" && ReadCommit(repo, parent).Tree == tree.Hash {
+			return "", ErrorNothingToCommit
+		}
+	}
+	//what it does: the trees are written. The blobs are in DB since they were staged.
+	tree.TraverseTree(func(ti TreeItem) {}, func(ti TreeItem) {
+		if _, writeErr := WriteObject(repo, ti, TreeHeaderName); writeErr != nil {
+			err = writeErr
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+	commit := CreateCommit(repo, &tree, message, parent, mergeHead)
+	commit.Author, commit.Committer = author, committer
+	hash, err := WriteObject(repo, *commit, CommitHeaderName)
+	if err != nil {
+		return "", err
+	}
+	if err := repo.AdvanceHEAD(hash); err != nil {
+		return "", err
+	}
+	if err := clearMergeState(repo); err != nil {
+		return "", err
+	}
+	if err := repo.Index.Persist(repo); err != nil {
+		return "", err
+	}
+	return hash, nil
+}
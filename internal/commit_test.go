@@ -2,6 +2,11 @@ package internal_test
 
 import (
 	// "fmt"
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 
 	internal "github.com/danielrrv/got/internal"
@@ -30,12 +35,10 @@ func TestCommit(t *testing.T) {
 		tree := internal.FromMapToTree(repo, m, "src")
 
 		tree.TraverseTree(func(ti internal.TreeItem) {
-			//	Here we have to go index and capture the cache of the stage area.
-			cache, err := internal.GetEntryFromCache(repo, ti.Path)
-			if err != nil {
-				panic(err)
+			//	The blobs of the stage area are in DB since they were added.
+			if _, err := internal.ReadBlob(repo, ti.Hash); err != nil {
+				t.Errorf("Expected the staged blob %s in DB, %v", ti.Path, err)
 			}
-			internal.WriteObject(repo, cache, internal.BlobHeaderName)
 		},
 			func(ti internal.TreeItem) {
 				internal.WriteObject(repo, ti, internal.TreeHeaderName)
@@ -67,12 +70,10 @@ func TestCommit(t *testing.T) {
 		m := internal.CreateTreeFromFiles(repo, []string{"src/readme.md", "src/cache.rs", "src/base64.c"})
 		tree := internal.FromMapToTree(repo, m, "src")
 		tree.TraverseTree(func(ti internal.TreeItem) {
-			//	Here we have to go index and capture the cache of the stage area.
-			cache, err := internal.GetEntryFromCache(repo, ti.Path)
-			if err != nil {
-				panic(err)
+			//	The blobs of the stage area are in DB since they were added.
+			if _, err := internal.ReadBlob(repo, ti.Hash); err != nil {
+				t.Errorf("Expected the staged blob %s in DB, %v", ti.Path, err)
 			}
-			internal.WriteObject(repo, cache, internal.BlobHeaderName)
 		}, func(ti internal.TreeItem) {
 			internal.WriteObject(repo, ti, internal.TreeHeaderName)
 		})
@@ -87,4 +88,126 @@ func TestCommit(t *testing.T) {
 		}
 	})
 
+	t.Run("commit the index on top of HEAD", func(t *testing.T) {
+		tmp := t.TempDir()
+		repo, err := internal.FindOrCreateRepo(tmp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		CreateFilesTesting(tmp, []string{"src/a"}, []TestingFile{
+			{Name: "readme.md", RelativePath: "readme.md", Data: []byte("some-readme")},
+			{Name: "cache.rs", RelativePath: "src/cache.rs", Data: []byte("some-cache")},
+			{Name: "base64.c", RelativePath: "src/a/base64.c", Data: []byte("some-base64")},
+		})
+		repo.Index.AddOrModifyEntries(repo, []string{"readme.md", "src/cache.rs", "src/a/base64.c"})
+		first, err := internal.CommitIndex(repo, "first", internal.CommitOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(repo.Index.Entries) != 3 {
+			t.Errorf("Expected the index to keep the committed files, got %v", repo.Index.Entries)
+		}
+		if branch, _ := os.ReadFile(filepath.Join(repo.GotDir, "refs", "heads", "main")); string(branch) != first {
+			t.Errorf("Expected main to point to the commit, got %s", branch)
+		}
+		tree := internal.ReadTree(repo, internal.ReadCommit(repo, first).Tree)
+		if len(tree.FlatItems()) != 3 {
+			t.Errorf("Expected the tree to have the 3 blobs, got %v", tree.FlatItems())
+		}
+
+		if _, err := internal.CommitIndex(repo, "nothing", internal.CommitOptions{}); err != internal.ErrorNothingToCommit {
+			t.Errorf("Expected nothing to commit, got %v", err)
+		}
+		CreateFilesTesting(tmp, nil, []TestingFile{
+			{Name: "cache.rs", RelativePath: "src/cache.rs", Data: []byte("some-other-cache")},
+		})
+		repo.Index.AddOrModifyEntries(repo, []string{"src/cache.rs"})
+		second, err := internal.CommitIndex(repo, "second", internal.CommitOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		commit := internal.ReadCommit(repo, second)
+		if len(commit.Parents) != 1 || commit.Parents[0] != first {
+			t.Errorf("Expected the parent to be the previous HEAD commit")
+		}
+		if ref := repo.GetHEADReference(); ref.Reference != second {
+			t.Errorf("Expected HEAD to resolve to the new commit")
+		}
+		// The unchanged blobs are kept from the previous commit.
+		tree = internal.ReadTree(repo, commit.Tree)
+		if len(tree.FlatItems()) != 3 {
+			t.Errorf("Expected the tree to keep the 3 blobs")
+		}
+	})
+	t.Run("commit on detached HEAD", func(t *testing.T) {
+		tmp := t.TempDir()
+		repo, err := internal.FindOrCreateRepo(tmp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		first := CommitFilesTesting(repo, "first", "", map[string]string{"readme.md": "some-readme"})
+		ref := internal.Ref{IsDirect: true, Reference: first}
+		ref.WriteRef(repo)
+		CreateFilesTesting(tmp, nil, []TestingFile{
+			{Name: "readme.md", RelativePath: "readme.md", Data: []byte("other-readme")},
+		})
+		repo.Index.AddOrModifyEntries(repo, []string{"readme.md"})
+		second, err := internal.CommitIndex(repo, "second", internal.CommitOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if head, _ := os.ReadFile(filepath.Join(repo.GotDir, "HEAD")); string(head) != second {
+			t.Errorf("Expected the detached HEAD to point to the commit, got %s", head)
+		}
+		if branch, _ := os.ReadFile(filepath.Join(repo.GotDir, "refs", "heads", "main")); string(branch) != first {
+			t.Errorf("Expected main to stay at the first commit")
+		}
+		if _, err := internal.CommitIndex(repo, " ", internal.CommitOptions{}); err != internal.ErrorEmptyCommitMessage {
+			t.Errorf("Expected empty message error, got %v", err)
+		}
+	})
+	t.Run("merge commit round-trip", func(t *testing.T) {
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		commit := internal.Commit{
+			Tree:        "1f7a7a472abf3dd9643fd615f6da379c4acb3e3a",
+			Parents:     []string{"3b18e512dba79e4c8300dd08aeb37f8e728b8dad", "d670460b4b4aece5915caf5c68d12f560a9fe3e4", "a0b1c2d3e4f5a6b7c8d9e0f1a2b3c4d5e6f7a8b9"},
+			Author:      internal.Signature{Name: "Daniel", Email: "daniel@got.dev", When: 1709287200, Offset: 60},
+			Committer:   internal.Signature{Name: "Daniel", Email: "daniel@got.dev", When: 1709290800, Offset: -330},
+			Description: "Merge branches 'a' and 'b'\n\nThe body\nkeeps its lines.\n",
+		}
+		hash, err := internal.WriteObject(repo, commit, internal.CommitHeaderName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		read := internal.ReadCommit(repo, hash)
+		if !reflect.DeepEqual(*read, commit) {
+			t.Errorf("Expected the commit to round-trip, got %#v", *read)
+		}
+		if !bytes.Equal(read.Serialize(), commit.Serialize()) {
+			t.Errorf("Expected the same bytes once serialized again")
+		}
+		expected := "tree 1f7a7a472abf3dd9643fd615f6da379c4acb3e3a\n" +
+			"parent 3b18e512dba79e4c8300dd08aeb37f8e728b8dad\n" +
+			"parent d670460b4b4aece5915caf5c68d12f560a9fe3e4\n" +
+			"parent a0b1c2d3e4f5a6b7c8d9e0f1a2b3c4d5e6f7a8b9\n"
+		if !strings.HasPrefix(string(commit.Serialize()), expected) {
+			t.Errorf("Expected one parent line per parent in order, got %q", commit.Serialize())
+		}
+
+		root := internal.Commit{Tree: commit.Tree, Author: commit.Author, Committer: commit.Committer, Description: "root"}
+		if parsed := (internal.Commit{}).Deserialize(root.Serialize()); len(parsed.Parents) != 0 || parsed.Description != "root" {
+			t.Errorf("Expected a root commit without parents, got %#v", parsed)
+		}
+		legacy := "author\tDaniel\ncommitter\tdaniel@got.dev\ntree\t1f7a7a47\ndate\t2024-03-01 10:00:00\ndescription\tfirst\nparent\t3b18e512"
+		if parsed := (internal.Commit{}).Deserialize([]byte(legacy)); parsed.Tree != "1f7a7a47" || parsed.Description != "first" || len(parsed.Parents) != 1 || parsed.Author.Identity() != "Daniel <daniel@got.dev>" {
+			t.Errorf("Expected the former format to be read, got %#v", parsed)
+		}
+		legacyRoot := strings.Replace(legacy, "parent\t3b18e512", "parent\t", 1)
+		if parsed := (internal.Commit{}).Deserialize([]byte(legacyRoot)); len(parsed.Parents) != 0 {
+			t.Errorf("Expected the former root commit without parents, got %#v", parsed.Parents)
+		}
+	})
 }
@@ -22,6 +22,17 @@ type UserConfig struct {
 type CoreConfig struct {
 	Bare     bool `property:"bare"`
 	Filemode bool `property:"filemode"`
+	// Encoding of the objects, git or got. Empty means got, the encoding of the repositories created before.
+	ObjectFormat string `property:"objectformat"`
+	// The global ignore file, read by every repository after .got/info/exclude. See NewIgnore.
+	ExcludesFile string `property:"excludesfile"`
+}
+
+type PackConfig struct {
+	// The number of the former objects tried as delta base of each object. Zero means the default.
+	Window int `property:"window"`
+	// The longest chain of deltas in packs. Zero means the default.
+	Depth int `property:"depth"`
 }
 
 type GotConfig struct {
@@ -30,6 +41,7 @@ type GotConfig struct {
 	Branch   string     `property:"branch"`
 	Core     CoreConfig `property:"core"`
 	MaxCache int        `property:"max_cache"`
+	Pack     PackConfig `property:"pack"`
 }
 
 // Encode the g interface into buffer of string java properties-ish.
@@ -0,0 +1,226 @@
+package internal
+
+import (
+	"cmp"
+	"errors"
+	"slices"
+)
+
+var (
+	// The delta does not apply to its base object.
+	ErrorMalformedDelta = errors.New("malformed delta")
+)
+
+// Rebuild the object from its base and the delta as git encodes it:
+//
+//	[base size varint]|[result size varint]|[instructions]
+//
+// A copy instruction has the high bit set, its low 4 bits select the offset bytes and the next 3 bits
+// the size bytes to read, little endian. Any other instruction inserts the next n bytes.
+func applyDelta(base []byte, delta []byte) ([]byte, error) {
+	baseSize, delta, ok := readDeltaSize(delta)
+	if !ok || baseSize != uint64(len(base)) {
+		return nil, ErrorMalformedDelta
+	}
+	resultSize, delta, ok := readDeltaSize(delta)
+	if !ok {
+		return nil, ErrorMalformedDelta
+	}
+	result := make([]byte, 0, resultSize)
+	for len(delta) > 0 {
+		op := delta[0]
+		delta = delta[1:]
+		switch {
+		case op&0x80 != 0:
+			var offset, size uint64
+			for i := 0; i < 7; i++ {
+				if op&(1<<i) == 0 {
+					continue
+				}
+				if len(delta) == 0 {
+					return nil, ErrorMalformedDelta
+				}
+				if i < 4 {
+					offset |= uint64(delta[0]) << (8 * i)
+				} else {
+					size |= uint64(delta[0]) << (8 * (i - 4))
+				}
+				delta = delta[1:]
+			}
+			// What it does: a size of 0 stands for 64KiB.
+			if size == 0 {
+				size = 0x10000
+			}
+			if offset+size > uint64(len(base)) {
+				return nil, ErrorMalformedDelta
+			}
+			result = append(result, base[offset:offset+size]...)
+		case op != 0:
+			if int(op) > len(delta) {
+				return nil, ErrorMalformedDelta
+			}
+			result = append(result, delta[:op]...)
+			delta = delta[op:]
+		default:
+			return nil, ErrorMalformedDelta
+		}
+	}
+	if uint64(len(result)) != resultSize {
+		return nil, ErrorMalformedDelta
+	}
+	return result, nil
+}
+
+// Read the little endian size of 7 bits groups. The high bit tells whether another group follows.
+func readDeltaSize(d []byte) (uint64, []byte, bool) {
+	var size uint64
+	for shift := 0; len(d) > 0 && shift < 64; shift += 7 {
+		c := d[0]
+		d = d[1:]
+		size |= uint64(c&0x7f) << shift
+		if c&0x80 == 0 {
+			return size, d, true
+		}
+	}
+	return 0, nil, false
+}
+
+// The length of the chunks of the base indexed to find the matches.
+const deltaBlockSize = 16
+
+// Encode the target as a delta against the base: the parts found in the base are copied and the rest
+// inserted. The inverse of applyDelta.
+func createDelta(base []byte, target []byte) []byte {
+	delta := appendDeltaSize(nil, uint64(len(base)))
+	delta = appendDeltaSize(delta, uint64(len(target)))
+	// Implementation to index the chunks of the base, the first occurrence wins.
+	blocks := make(map[string]int, len(base)/deltaBlockSize)
+	for i := 0; i+deltaBlockSize <= len(base); i += deltaBlockSize {
+		if _, ok := blocks[string(base[i:i+deltaBlockSize])]; !ok {
+			blocks[string(base[i:i+deltaBlockSize])] = i
+		}
+	}
+	insert := make([]byte, 0)
+	for i := 0; i < len(target); {
+		offset, ok := -1, false
+		if i+deltaBlockSize <= len(target) {
+			offset, ok = blocks[string(target[i:i+deltaBlockSize])]
+		}
+		if !ok {
+			insert = append(insert, target[i])
+			i++
+			continue
+		}
+		// What it does: grow the match backwards over the pending insert, then forwards.
+		for offset > 0 && len(insert) > 0 && base[offset-1] == insert[len(insert)-1] {
+			offset--
+			insert = insert[:len(insert)-1]
+			i--
+		}
+		size := 0
+		for offset+size < len(base) && i+size < len(target) && base[offset+size] == target[i+size] {
+			size++
+		}
+		delta = appendDeltaInsert(delta, insert)
+		insert = insert[:0]
+		delta = appendDeltaCopy(delta, offset, size)
+		i += size
+	}
+	return appendDeltaInsert(delta, insert)
+}
+
+func appendDeltaSize(delta []byte, size uint64) []byte {
+	for size >= 0x80 {
+		delta = append(delta, byte(size)|0x80)
+		size >>= 7
+	}
+	return append(delta, byte(size))
+}
+
+// Insert instructions carry 127 bytes at most.
+func appendDeltaInsert(delta []byte, data []byte) []byte {
+	for len(data) > 0 {
+		n := min(len(data), 0x7f)
+		delta = append(delta, byte(n))
+		delta = append(delta, data[:n]...)
+		data = data[n:]
+	}
+	return delta
+}
+
+// Copy instructions carry 64KiB at most, the zero bytes of the offset and size are left out.
+func appendDeltaCopy(delta []byte, offset int, size int) []byte {
+	for size > 0 {
+		n := min(size, 0x10000)
+		op := len(delta)
+		delta = append(delta, 0x80)
+		for i := 0; i < 4; i++ {
+			if b := byte(offset >> (8 * i)); b != 0 {
+				delta[op] |= 1 << i
+				delta = append(delta, b)
+			}
+		}
+		for i := 0; i < 3; i++ {
+			if b := byte(n >> (8 * i)); b != 0 {
+				delta[op] |= 1 << (4 + i)
+				delta = append(delta, b)
+			}
+		}
+		offset += n
+		size -= n
+	}
+	return delta
+}
+
+const (
+	// The number of the former blobs tried as base of each blob, by default.
+	deltaWindow = 10
+	// The longest chain of deltas, by default. Reading an object applies every delta of its chain.
+	deltaDepth = 50
+	// The blobs smaller than this are stored whole.
+	deltaMinSize = 64
+)
+
+// Choose a base for the blobs of the pack. The blobs are sorted by name, then largest first, so that the
+// revisions of a file follow each other and the deltas mostly remove content. Each blob is tried against
+// the former blobs of the window:
+//   - The base must be at most depth-1 deltas away from a whole object.
+//   - The delta must be smaller than half the blob, less the deeper the base is, and smaller than the
+//     best delta so far. The bases too different in size are not even tried.
+//
+// Returns the number of deltas.
+func findDeltas(objects []packInput, window int, depth int) int {
+	blobs := make([]int, 0)
+	for i, object := range objects {
+		if object.header == BlobHeaderName && len(object.data) >= deltaMinSize {
+			blobs = append(blobs, i)
+		}
+	}
+	slices.SortStableFunc(blobs, func(a, b int) int {
+		return cmp.Or(cmp.Compare(objects[a].name, objects[b].name), cmp.Compare(len(objects[b].data), len(objects[a].data)))
+	})
+	deltas := 0
+	for n, i := range blobs {
+		target := &objects[i]
+		for _, j := range blobs[max(0, n-window):n] {
+			base := objects[j]
+			if base.depth >= depth {
+				continue
+			}
+			maxSize := len(target.data) / 2 * (depth - base.depth) / depth
+			if target.base != "" {
+				maxSize = min(maxSize, len(target.delta)-1)
+			}
+			if sizeDiff := len(target.data) - len(base.data); sizeDiff >= maxSize || len(base.data) < len(target.data)/32 {
+				continue
+			}
+			if delta := createDelta(base.data, target.data); len(delta) <= maxSize {
+				target.base, target.delta, target.depth = base.hash, delta, base.depth+1
+			}
+		}
+		if target.base != "" {
+			deltas++
+		}
+	}
+	return deltas
+}
@@ -0,0 +1,414 @@
+package internal
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// The similarity given to -M or -C is not a number or a percentage.
+var ErrorInvalidSimilarity = errors.New("invalid similarity")
+
+type ChangeType int
+
+const (
+	ChangeAdded ChangeType = iota
+	ChangeDeleted
+	ChangeModified
+	ChangeModeChanged
+	// A deleted blob found again at another path.
+	ChangeRenamed
+	// An added blob made from a blob kept at its path.
+	ChangeCopied
+)
+
+func (c ChangeType) String() string {
+	switch c {
+	case ChangeAdded:
+		return "added"
+	case ChangeDeleted:
+		return "deleted"
+	case ChangeModified:
+		return "modified"
+	case ChangeModeChanged:
+		return "mode changed"
+	case ChangeRenamed:
+		return "renamed"
+	case ChangeCopied:
+		return "copied"
+	default:
+		panic("No conversion type.")
+	}
+}
+
+// A blob that differs between two trees.
+type TreeChange struct {
+	Type ChangeType
+	// Blob path relative to the worktree.
+	Path string
+	// The former path of a renamed blob, the source of a copied one.
+	OldPath string
+	// How much of the former blob is kept by a renamed or copied one, in percent.
+	Similarity int
+	OldHash    string
+	NewHash    string
+	OldMode    Mode
+	NewMode    Mode
+}
+
+// Compare two tree graphs blob by blob. The changes are sorted by path.
+func DiffTrees(from TreeItem, to TreeItem) []TreeChange {
+	fromBlobs := blobsByPath(from)
+	toBlobs := blobsByPath(to)
+	changes := make([]TreeChange, 0)
+	for path, old := range fromBlobs {
+		current, ok := toBlobs[path]
+		switch {
+		case !ok:
+			changes = append(changes, TreeChange{Type: ChangeDeleted, Path: path, OldHash: old.Hash, OldMode: old.Mode})
+		case old.Hash != current.Hash:
+			changes = append(changes, TreeChange{Type: ChangeModified, Path: path, OldHash: old.Hash, NewHash: current.Hash, OldMode: old.Mode, NewMode: current.Mode})
+		case !bytes.Equal(old.Mode, current.Mode):
+			changes = append(changes, TreeChange{Type: ChangeModeChanged, Path: path, OldHash: old.Hash, NewHash: current.Hash, OldMode: old.Mode, NewMode: current.Mode})
+		}
+	}
+	for path, current := range toBlobs {
+		if _, ok := fromBlobs[path]; !ok {
+			changes = append(changes, TreeChange{Type: ChangeAdded, Path: path, NewHash: current.Hash, NewMode: current.Mode})
+		}
+	}
+	slices.SortFunc(changes, func(a, b TreeChange) int {
+		return cmp.Compare(a.Path, b.Path)
+	})
+	return changes
+}
+
+// Options to pair the deleted and added blobs into renames.
+type RenameOptions struct {
+	// The minimum similarity of a rename or a copy, in percent. 100 pairs the blobs of the same content only.
+	Threshold int
+	// Pair the added blobs left with the deleted and modified ones too, as copies.
+	Copies bool
+}
+
+// The renames git finds by default, half of the content kept.
+var DefaultRenameOptions = RenameOptions{Threshold: 50}
+
+// Parse the similarity of -M and -C as git does: "50%" is a percentage, "5" a fraction with a decimal point before it,
+// 50% as well, and "05" 5%. Empty is the default threshold.
+func ParseSimilarity(value string) (int, error) {
+	if value == "" {
+		return DefaultRenameOptions.Threshold, nil
+	}
+	digits, percent := strings.CutSuffix(value, "%")
+	number, err := strconv.Atoi(digits)
+	if err != nil || number < 0 || strings.ContainsAny(digits, "+-") {
+		return 0, fmt.Errorf("%w: %s", ErrorInvalidSimilarity, value)
+	}
+	if !percent {
+		// What it does: "05" is 0.05, the digits past the second one are rounded off.
+		fraction, _ := strconv.ParseFloat("0."+digits, 64)
+		number = int(fraction*100 + 0.5)
+	}
+	return min(number, 100), nil
+}
+
+// Pair the deleted blobs with the added ones into renames: the blobs of the same content first, then the most similar
+// ones above the threshold, each deleted blob renamed once. With Copies, the added blobs left are paired with the
+// deleted and modified blobs they are the most similar to. The changes stay sorted by path, the new path of the renames.
+//
+// What it does: the similarity is the share of the bytes of the larger blob found in the lines of the other one.
+func DetectRenames(repo *GotRepository, changes []TreeChange, options RenameOptions) []TreeChange {
+	deleted := make(map[string][]int)
+	for i, change := range changes {
+		if change.Type == ChangeDeleted {
+			deleted[change.OldHash] = append(deleted[change.OldHash], i)
+		}
+	}
+	paired := make(map[int]bool)
+	pair := func(i int, from int, changeType ChangeType, similarity int) {
+		source, change := changes[from], changes[i]
+		changes[i] = TreeChange{Type: changeType, Path: change.Path, OldPath: source.Path, Similarity: similarity,
+			OldHash: source.OldHash, NewHash: change.NewHash, OldMode: source.OldMode, NewMode: change.NewMode}
+	}
+	for i, change := range changes {
+		candidates := deleted[change.NewHash]
+		if change.Type != ChangeAdded || len(candidates) == 0 {
+			continue
+		}
+		// What it does: each deleted blob is the source of one rename only.
+		from := candidates[0]
+		deleted[change.NewHash] = candidates[1:]
+		paired[from] = true
+		pair(i, from, ChangeRenamed, 100)
+	}
+
+	// Implementation to score every deleted and added pair left, and take the best ones first.
+	contents := make(map[string][]byte)
+	content := func(hash string, path string) ([]byte, bool) {
+		if data, ok := contents[hash]; ok {
+			return data, data != nil
+		}
+		data, err := blobContent(repo, hash, path)
+		if err != nil {
+			data = nil
+		}
+		contents[hash] = data
+		return data, data != nil
+	}
+	type candidate struct {
+		from, to, similarity int
+	}
+	score := func(from int, to int) (candidate, bool) {
+		source, change := changes[from], changes[to]
+		src, ok := content(source.OldHash, source.Path)
+		if !ok {
+			return candidate{}, false
+		}
+		dst, ok := content(change.NewHash, change.Path)
+		if !ok {
+			return candidate{}, false
+		}
+		// What it does: blobs of too different sizes can't reach the threshold, they are not compared.
+		if small, large := min(len(src), len(dst)), max(len(src), len(dst)); large > 0 && small*100 < large*options.Threshold {
+			return candidate{}, false
+		}
+		similarity := blobSimilarity(src, dst)
+		return candidate{from: from, to: to, similarity: similarity}, similarity >= options.Threshold
+	}
+	best := func(candidates []candidate) []candidate {
+		slices.SortStableFunc(candidates, func(a, b candidate) int {
+			return cmp.Or(cmp.Compare(b.similarity, a.similarity), cmp.Compare(changes[a.to].Path, changes[b.to].Path),
+				cmp.Compare(changes[a.from].Path, changes[b.from].Path))
+		})
+		return candidates
+	}
+	if options.Threshold < 100 {
+		candidates := make([]candidate, 0)
+		for to, change := range changes {
+			if change.Type != ChangeAdded {
+				continue
+			}
+			for from, source := range changes {
+				if source.Type != ChangeDeleted || paired[from] {
+					continue
+				}
+				if c, ok := score(from, to); ok {
+					candidates = append(candidates, c)
+				}
+			}
+		}
+		for _, c := range best(candidates) {
+			if paired[c.from] || changes[c.to].Type != ChangeAdded {
+				continue
+			}
+			paired[c.from] = true
+			pair(c.to, c.from, ChangeRenamed, c.similarity)
+		}
+	}
+	if options.Copies {
+		candidates := make([]candidate, 0)
+		for to, change := range changes {
+			if change.Type != ChangeAdded {
+				continue
+			}
+			for from, source := range changes {
+				isSource := source.Type == ChangeDeleted || source.Type == ChangeModified || source.Type == ChangeModeChanged
+				if !isSource {
+					continue
+				}
+				if source.OldHash == change.NewHash {
+					candidates = append(candidates, candidate{from: from, to: to, similarity: 100})
+				} else if c, ok := score(from, to); ok {
+					candidates = append(candidates, c)
+				}
+			}
+		}
+		for _, c := range best(candidates) {
+			if changes[c.to].Type == ChangeAdded {
+				pair(c.to, c.from, ChangeCopied, c.similarity)
+			}
+		}
+	}
+	renamed := make([]TreeChange, 0, len(changes))
+	for i, change := range changes {
+		if !paired[i] {
+			renamed = append(renamed, change)
+		}
+	}
+	return renamed
+}
+
+// The share of the larger content found in the lines of the other one, in percent. Each line of the source is found
+// once.
+func blobSimilarity(src []byte, dst []byte) int {
+	if len(src) == 0 && len(dst) == 0 {
+		return 100
+	}
+	lines := make(map[string]int)
+	for _, line := range bytes.SplitAfter(src, []byte("\n")) {
+		lines[string(line)]++
+	}
+	common := 0
+	for _, line := range bytes.SplitAfter(dst, []byte("\n")) {
+		if lines[string(line)] > 0 {
+			lines[string(line)]--
+			common += len(line)
+		}
+	}
+	return common * 100 / max(len(src), len(dst))
+}
+
+// Index the blobs of the tree graph by their path.
+func blobsByPath(t TreeItem) map[string]TreeItem {
+	blobs := make(map[string]TreeItem)
+	for _, item := range t.FlatItems() {
+		blobs[item.Path] = item
+	}
+	return blobs
+}
+
+// Create the tree graph of the blobs given their path, hash and mode. Nothing is written in DB.
+func CreateTreeFromBlobs(repo *GotRepository, blobs map[string]TreeItem) TreeItem {
+	m := make(map[string][]OFS)
+	inserted := make(map[string]bool)
+	for path, blob := range blobs {
+		insertOFS(m, inserted, OFS{path: path, mode: blob.Mode, hash: blob.Hash})
+	}
+	return FromMapToTree(repo, m, ".")
+}
+
+// Tree graph of the stage area.
+func IndexTree(repo *GotRepository) TreeItem {
+	blobs := make(map[string]TreeItem)
+	for _, entry := range repo.Index.Entries {
+		// What it does: the conflicted files have no blob in the stage area until resolved.
+		if entry.Stage == 0 {
+			blobs[entry.PathName] = TreeItem{Mode: treeEntryMode(entry.FileMode), Hash: entry.Hash}
+		}
+	}
+	return CreateTreeFromBlobs(repo, blobs)
+}
+
+// Tree graph of the tracked user files as they are in the worktree, with their current mode. Deleted files are
+// missing from it. The gitlinks are taken from the index, the worktree has no commit of them.
+func WorktreeTree(repo *GotRepository) TreeItem {
+	blobs := make(map[string]TreeItem)
+	positions := repo.Index.positions()
+	for _, entry := range repo.Index.Entries {
+		if entry.FileMode == statModeGitlink {
+			blobs[entry.PathName] = TreeItem{Mode: GitlinkMode, Hash: entry.Hash}
+			continue
+		}
+		if fi, err := os.Lstat(filepath.Join(repo.GotTree, entry.PathName)); err == nil && !fi.IsDir() {
+			blobs[entry.PathName] = TreeItem{Mode: treeEntryMode(statMode(fi)), Hash: hashUserFile(repo, positions, entry.PathName, fi)}
+		}
+	}
+	return CreateTreeFromBlobs(repo, blobs)
+}
+
+// Tree graph of the commit the revision points to.
+func RevisionTree(repo *GotRepository, rev string) (TreeItem, error) {
+	hash, err := ResolveRevision(repo, rev)
+	if err != nil {
+		return TreeItem{}, err
+	}
+	rawData, err := ReadObject(repo, CommitHeaderName, hash)
+	if err != nil {
+		return TreeItem{}, err
+	}
+	return ReadTree(repo, Commit{}.Deserialize(rawData).Tree), nil
+}
+
+// Tree graph of the HEAD commit. Empty when there is no commit yet.
+func HEADTree(repo *GotRepository) TreeItem {
+	tree, err := RevisionTree(repo, "HEAD")
+	if err != nil {
+		return TreeItem{Mode: TreeMode}
+	}
+	return tree
+}
+
+// Content of the blob. Blobs not in DB are looked up in the worktree.
+func blobContent(repo *GotRepository, hash string, path string) ([]byte, error) {
+	if content, err := ReadBlob(repo, hash); err == nil {
+		return content, nil
+	}
+	if userHash, ok := hashWorktreeFile(repo, repo.Index.positions(), path); ok && userHash == hash {
+		blob, err := BlobFromUserPath(repo, path)
+		if err != nil {
+			return nil, err
+		}
+		return blob.Serialize(), nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrorNotBlobFound, hash)
+}
+
+// Write the changes as a git-style patch with the given lines of context. A rename or copy shows the changes from its
+// source, none when the content is the same.
+func WritePatch(repo *GotRepository, w io.Writer, changes []TreeChange, context int) error {
+	for _, change := range changes {
+		oldPath := change.Path
+		if change.Type == ChangeRenamed || change.Type == ChangeCopied {
+			oldPath = change.OldPath
+		}
+		oldName, newName := "a/"+oldPath, "b/"+change.Path
+		fmt.Fprintf(w, "diff --git %s %s\n", oldName, newName)
+		switch change.Type {
+		case ChangeAdded:
+			fmt.Fprintf(w, "new file mode %s\n", string(change.NewMode))
+			oldName = "/dev/null"
+		case ChangeDeleted:
+			fmt.Fprintf(w, "deleted file mode %s\n", string(change.OldMode))
+			newName = "/dev/null"
+		case ChangeModeChanged:
+			fmt.Fprintf(w, "old mode %s\nnew mode %s\n", string(change.OldMode), string(change.NewMode))
+			continue
+		case ChangeRenamed, ChangeCopied:
+			if !bytes.Equal(change.OldMode, change.NewMode) {
+				fmt.Fprintf(w, "old mode %s\nnew mode %s\n", string(change.OldMode), string(change.NewMode))
+			}
+			verb := map[ChangeType]string{ChangeRenamed: "rename", ChangeCopied: "copy"}[change.Type]
+			fmt.Fprintf(w, "similarity index %d%%\n%s from %s\n%s to %s\n", change.Similarity, verb, oldPath, verb, change.Path)
+			if change.OldHash == change.NewHash {
+				continue
+			}
+		}
+		if (change.Type != ChangeAdded && change.Type != ChangeDeleted) && bytes.Equal(change.OldMode, change.NewMode) {
+			fmt.Fprintf(w, "index %s..%s %s\n", shortHash(change.OldHash), shortHash(change.NewHash), string(change.NewMode))
+		} else {
+			fmt.Fprintf(w, "index %s..%s\n", shortHash(change.OldHash), shortHash(change.NewHash))
+		}
+		oldContent, newContent := []byte{}, []byte{}
+		var err error
+		if change.OldHash != "" {
+			if oldContent, err = blobContent(repo, change.OldHash, oldPath); err != nil {
+				return err
+			}
+		}
+		if change.NewHash != "" {
+			if newContent, err = blobContent(repo, change.NewHash, change.Path); err != nil {
+				return err
+			}
+		}
+		if _, err := io.WriteString(w, UnifiedDiff(oldName, newName, oldContent, newContent, context)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Abbreviated object id. The missing object is all zeros, as git shows it.
+func shortHash(hash string) string {
+	if hash == "" {
+		return "0000000"
+	}
+	return hash[:7]
+}
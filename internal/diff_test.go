@@ -0,0 +1,174 @@
+package internal_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	internal "github.com/danielrrv/got/internal"
+)
+
+func TestDiff(t *testing.T) {
+	t.Run("compare tree graphs", func(t *testing.T) {
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		first := CommitFilesTesting(repo, "first", "", map[string]string{"readme.md": "v1", "src/cache.rs": "v1", "src/a/old.c": "v1"})
+		second := CommitFilesTesting(repo, "second", first, map[string]string{"readme.md": "v1", "src/cache.rs": "v2", "src/b/new.c": "v1"})
+		from, _ := internal.RevisionTree(repo, first)
+		to, _ := internal.RevisionTree(repo, second)
+		changes := internal.DiffTrees(from, to)
+		expected := []struct {
+			path       string
+			changeType internal.ChangeType
+		}{
+			{"src/a/old.c", internal.ChangeDeleted},
+			{"src/b/new.c", internal.ChangeAdded},
+			{"src/cache.rs", internal.ChangeModified},
+		}
+		if len(changes) != len(expected) {
+			t.Fatalf("Expected %d changes, got %v", len(expected), changes)
+		}
+		for i, change := range changes {
+			if change.Path != expected[i].path || change.Type != expected[i].changeType {
+				t.Errorf("Expected %s %s, got %s %s", expected[i].path, expected[i].changeType, change.Path, change.Type)
+			}
+		}
+		if len(internal.DiffTrees(from, from)) != 0 {
+			t.Errorf("Expected no changes between the same tree")
+		}
+		blob := internal.TreeItem{Mode: internal.BlobMode, Path: "run.sh", Hash: first}
+		executable := internal.TreeItem{Mode: internal.Mode("100755"), Path: "run.sh", Hash: first}
+		changes = internal.DiffTrees(internal.TreeItem{Mode: internal.TreeMode, Children: []internal.TreeItem{blob}}, internal.TreeItem{Mode: internal.TreeMode, Children: []internal.TreeItem{executable}})
+		if len(changes) != 1 || changes[0].Type != internal.ChangeModeChanged {
+			t.Errorf("Expected a mode change, got %v", changes)
+		}
+	})
+	t.Run("worktree, index and HEAD", func(t *testing.T) {
+		tmp := t.TempDir()
+		repo, err := internal.FindOrCreateRepo(tmp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		CreateFilesTesting(tmp, []string{"src"}, []TestingFile{
+			{Name: "readme.md", RelativePath: "readme.md", Data: []byte("a\nb\nc\n")},
+			{Name: "cache.rs", RelativePath: "src/cache.rs", Data: []byte("cache\n")},
+		})
+		repo.Index.AddOrModifyEntries(repo, []string{"readme.md", "src/cache.rs"})
+		if _, err := internal.CommitIndex(repo, "first", internal.CommitOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		os.WriteFile(filepath.Join(tmp, "readme.md"), []byte("a\nB\nc\n"), 0644)
+		os.Remove(filepath.Join(tmp, "src", "cache.rs"))
+
+		unstaged := internal.DiffTrees(internal.IndexTree(repo), internal.WorktreeTree(repo))
+		if len(unstaged) != 2 || unstaged[0].Type != internal.ChangeModified || unstaged[1].Type != internal.ChangeDeleted {
+			t.Fatalf("Expected readme.md modified and src/cache.rs deleted, got %v", unstaged)
+		}
+		if staged := internal.DiffTrees(internal.HEADTree(repo), internal.IndexTree(repo)); len(staged) != 0 {
+			t.Errorf("Expected nothing staged, got %v", staged)
+		}
+		var patch bytes.Buffer
+		if err := internal.WritePatch(repo, &patch, unstaged, 3); err != nil {
+			t.Fatal(err)
+		}
+		for _, expected := range []string{
+			"diff --git a/readme.md b/readme.md\n",
+			"@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+			"deleted file mode 100644\n",
+			"+++ /dev/null\n@@ -1 +0,0 @@\n-cache\n",
+		} {
+			if !strings.Contains(patch.String(), expected) {
+				t.Errorf("Expected the patch to contain %q, got\n%s", expected, patch.String())
+			}
+		}
+
+		repo.Index.AddOrModifyEntries(repo, []string{"readme.md"})
+		staged := internal.DiffTrees(internal.HEADTree(repo), internal.IndexTree(repo))
+		if len(staged) != 1 || staged[0].Path != "readme.md" {
+			t.Fatalf("Expected readme.md staged, got %v", staged)
+		}
+		patch.Reset()
+		// The staged blob is only in the stage area so far.
+		if err := internal.WritePatch(repo, &patch, staged, 0); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(patch.String(), "@@ -2 +2 @@\n-b\n+B\n") {
+			t.Errorf("Expected the staged hunk without context, got\n%s", patch.String())
+		}
+	})
+	t.Run("detect renames and copies", func(t *testing.T) {
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		long, util := strings.Repeat("a line kept as it is\n", 20), strings.Repeat("util\n", 20)
+		first := CommitFilesTesting(repo, "first", "", map[string]string{"same.c": "same\n", "edited.c": long, "gone.c": "gone\n", "util.c": util})
+		second := CommitFilesTesting(repo, "second", first, map[string]string{"moved.c": "same\n", "src/edited.c": long + "one more\n",
+			"other.c": "something else\n", "util.c": util + "changed\n", "copy.c": util})
+		from, _ := internal.RevisionTree(repo, first)
+		to, _ := internal.RevisionTree(repo, second)
+
+		changes := internal.DetectRenames(repo, internal.DiffTrees(from, to), internal.DefaultRenameOptions)
+		expected := []struct {
+			path, oldPath string
+			changeType    internal.ChangeType
+			similarity    int
+		}{
+			{"copy.c", "", internal.ChangeAdded, 0},
+			{"gone.c", "", internal.ChangeDeleted, 0},
+			{"moved.c", "same.c", internal.ChangeRenamed, 100},
+			{"other.c", "", internal.ChangeAdded, 0},
+			{"src/edited.c", "edited.c", internal.ChangeRenamed, 97},
+			{"util.c", "", internal.ChangeModified, 0},
+		}
+		if len(changes) != len(expected) {
+			t.Fatalf("Expected %d changes, got %v", len(expected), changes)
+		}
+		for i, change := range changes {
+			e := expected[i]
+			if change.Path != e.path || change.OldPath != e.oldPath || change.Type != e.changeType || change.Similarity != e.similarity {
+				t.Errorf("Expected %s %s from %q at %d%%, got %+v", e.path, e.changeType, e.oldPath, e.similarity, change)
+			}
+		}
+		changes = internal.DetectRenames(repo, internal.DiffTrees(from, to), internal.RenameOptions{Threshold: 100, Copies: true})
+		for _, change := range changes {
+			if change.Path == "src/edited.c" && change.Type != internal.ChangeAdded {
+				t.Errorf("Expected the similar file below the threshold, got %+v", change)
+			}
+			if change.Path == "copy.c" && (change.Type != internal.ChangeCopied || change.OldPath != "util.c" || change.Similarity != 100) {
+				t.Errorf("Expected the copy of the modified file, got %+v", change)
+			}
+		}
+
+		var out bytes.Buffer
+		changes = internal.DetectRenames(repo, internal.DiffTrees(from, to), internal.RenameOptions{Threshold: 50, Copies: true})
+		if err := internal.WritePatch(repo, &out, changes, 0); err != nil {
+			t.Fatal(err)
+		}
+		for _, part := range []string{
+			"diff --git a/same.c b/moved.c\nsimilarity index 100%\nrename from same.c\nrename to moved.c\ndiff --git",
+			"diff --git a/edited.c b/src/edited.c\nsimilarity index 97%\nrename from edited.c\nrename to src/edited.c\nindex ",
+			"--- a/edited.c\n+++ b/src/edited.c\n@@ -20,0 +21 @@\n+one more\n",
+			"diff --git a/util.c b/copy.c\nsimilarity index 100%\ncopy from util.c\ncopy to copy.c\n",
+		} {
+			if !strings.Contains(out.String(), part) {
+				t.Errorf("Expected %q in the patch, got\n%s", part, out.String())
+			}
+		}
+
+		cases := map[string]int{"": 50, "50%": 50, "5": 50, "05": 5, "75": 75, "9": 90, "100%": 100, "150%": 100}
+		for value, threshold := range cases {
+			if got, err := internal.ParseSimilarity(value); err != nil || got != threshold {
+				t.Errorf("Expected %q parsed as %d%%, got %d %v", value, threshold, got, err)
+			}
+		}
+		if _, err := internal.ParseSimilarity("x%"); !errors.Is(err, internal.ErrorInvalidSimilarity) {
+			t.Errorf("Expected an invalid similarity, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,193 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const (
+	// The configuration of the git repositories created by export.
+	gitConfigTemplate = "[core]\n\trepositoryformatversion = 0\n\tfilemode = true\n\tbare = %t\n"
+)
+
+var (
+	// An object the history points to is not in DB.
+	ErrorMissingObject = errors.New("missing object")
+)
+
+type ExportOptions struct {
+	// Write the objects and refs straight into the destination instead of its .git folder.
+	Bare bool
+	// Overwrite the branches and tags of the destination even when the ones of got aren't fast-forwards of them.
+	Force bool
+}
+
+type ExportResult struct {
+	// Objects written into git.
+	Written int
+	// Objects git has already, exported by a former run.
+	Skipped int
+	// The references written, refs/heads/main.
+	Refs []string
+	// The references of the destination left as they were: the one of got isn't a fast-forward of them. Force
+	// overwrites them.
+	Kept []string
+}
+
+// Export the objects reachable from the branches, tags and HEAD into the git repository at dest, created
+// when it doesn't exist. The objects are written loose and HEAD points where the HEAD of got does. A branch of
+// the destination is only moved forward and a tag never, unless Force: the refs that would be rewritten are kept
+// and listed in the result.
+//
+// The worktree and the index of git are left as they are.
+func ExportGit(repo *GotRepository, dest string, options ExportOptions) (*ExportResult, error) {
+	if repo.ObjectFormat().Name() != ObjectFormatGit {
+		return nil, ErrorObjectFormatNotGit
+	}
+	gitDir := dest
+	if !options.Bare {
+		gitDir = filepath.Join(dest, gitRepositoryDir)
+	}
+	if err := initGitDir(gitDir, options.Bare); err != nil {
+		return nil, err
+	}
+	refs, err := readRefs(repo.GotDir)
+	if err != nil {
+		return nil, err
+	}
+	roots := make([]string, 0, len(refs)+1)
+	for _, ref := range refs {
+		roots = append(roots, ref.hash)
+	}
+	head, err := os.ReadFile(filepath.Join(repo.GotDir, "HEAD"))
+	if err != nil {
+		return nil, err
+	}
+	if ref := repo.GetHEADReference(); !ref.Invalid && ref.IsDirect {
+		roots = append(roots, ref.Reference)
+	}
+	result := &ExportResult{Refs: make([]string, 0, len(refs)), Kept: make([]string, 0)}
+	objectsDir := filepath.Join(gitDir, gotRepositoryDirObjects)
+	err = walkReachable(repo, roots, func(hash string, header string, data []byte) error {
+		if pathExist(filepath.Join(objectsDir, hash[:2], hash[2:]), false) {
+			result.Skipped++
+			return nil
+		}
+		written, err := writeLooseObject(objectsDir, gitFormat{}.Encode(header, data))
+		if err != nil {
+			return err
+		}
+		if written != hash {
+			return fmt.Errorf("%s: %w", hash, ErrorCorruptedData)
+		}
+		result.Written++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	existing, err := readRefs(gitDir)
+	if err != nil {
+		return nil, err
+	}
+	current := make(map[string]string, len(existing))
+	for _, ref := range existing {
+		current[ref.name] = ref.hash
+	}
+	for _, ref := range refs {
+		if hash, ok := current[ref.name]; ok && hash == ref.hash {
+			result.Refs = append(result.Refs, ref.name)
+			continue
+		} else if ok && !options.Force {
+			// What it does: the commit of git is unknown to got when git has commits of its own, it isn't an ancestor.
+			isBranch := strings.HasPrefix(ref.name, gotRepositoryDirRefs+"/"+gotRepositoryDirRefsHeads+"/")
+			if !isBranch || !IsAncestor(repo, hash, ref.hash) {
+				result.Kept = append(result.Kept, ref.name)
+				continue
+			}
+		}
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(gitDir, ref.name)), 0755); err != nil {
+			return nil, err
+		}
+		if err := writeFileAtomic(gitDir, filepath.Join(gitDir, ref.name), []byte(ref.hash+"\n")); err != nil {
+			return nil, err
+		}
+		result.Refs = append(result.Refs, ref.name)
+	}
+	if err := writeFileAtomic(gitDir, filepath.Join(gitDir, "HEAD"), append(bytes.TrimSpace(head), newLine)); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Create the folders and files git expects when the git folder doesn't have them.
+func initGitDir(gitDir string, bare bool) error {
+	for _, dir := range []string{
+		filepath.Join(gotRepositoryDirObjects, "info"),
+		filepath.Join(gotRepositoryDirObjects, packDir),
+		filepath.Join(gotRepositoryDirRefs, gotRepositoryDirRefsHeads),
+		filepath.Join(gotRepositoryDirRefs, gotRepositoryDirRefsTags),
+	} {
+		if err := os.MkdirAll(filepath.Join(gitDir, dir), 0755); err != nil {
+			return err
+		}
+	}
+	config := filepath.Join(gitDir, "config")
+	if pathExist(config, false) {
+		return nil
+	}
+	return writeFileAtomic(gitDir, config, []byte(fmt.Sprintf(gitConfigTemplate, bare)))
+}
+
+// Visit once every object reachable from the roots: the trees and parents of the commits, the children
+// of the trees and the objects of the tags. The submodules commits are not followed.
+func walkReachable(repo *GotRepository, roots []string, visit func(hash string, header string, data []byte) error) error {
+	format := repo.ObjectFormat()
+	seen := make(map[string]bool)
+	pending := slices.Clone(roots)
+	for len(pending) > 0 {
+		hash := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if seen[hash] {
+			continue
+		}
+		seen[hash] = true
+		header, data, err := readObjectWith(repo, format, hash)
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("%s: %w", hash, ErrorMissingObject)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", hash, err)
+		}
+		switch header {
+		case CommitHeaderName:
+			commit := Commit{}.Deserialize(data)
+			pending = append(pending, commit.Tree)
+			pending = append(pending, commit.Parents...)
+		case TreeHeaderName:
+			tree, err := format.DecodeTree(TreeItem{Mode: TreeMode}, data)
+			if err != nil {
+				return fmt.Errorf("%s: %w", hash, err)
+			}
+			for _, child := range tree.Children {
+				if !bytes.Equal(child.Mode, GitlinkMode) {
+					pending = append(pending, child.Hash)
+				}
+			}
+		case TagHeaderName:
+			pending = append(pending, Tag{}.Deserialize(data).Object)
+		case BlobHeaderName:
+		default:
+			return fmt.Errorf("%s: %w", hash, ErrorIncorrectOBjectType)
+		}
+		if err := visit(hash, header, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
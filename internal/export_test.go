@@ -0,0 +1,140 @@
+package internal_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	internal "github.com/danielrrv/got/internal"
+)
+
+func TestExportGit(t *testing.T) {
+	t.Run("export to a bare repository", func(t *testing.T) {
+		repo, _ := divergeTesting(t,
+			[]TestingFile{
+				{Name: "a.txt", RelativePath: "a.txt", Data: []byte("1\n2\n3\n")},
+				{Name: "b.c", RelativePath: "src/lib/b.c", Data: []byte("hello\n")},
+			},
+			[]TestingFile{{Name: "a.txt", RelativePath: "a.txt", Data: []byte("one\n2\n3\n")}},
+			[]TestingFile{{Name: "a.txt", RelativePath: "a.txt", Data: []byte("1\n2\nthree\n")}},
+		)
+		merge, err := internal.Merge(repo, "feature", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		bare := filepath.Join(t.TempDir(), "bare.git")
+		result, err := internal.ExportGit(repo, bare, internal.ExportOptions{Bare: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		gitTesting(t, bare, "fsck", "--strict", "--no-dangling")
+		if head := gitTesting(t, bare, "rev-parse", "HEAD"); head != merge.Hash {
+			t.Errorf("Expected HEAD at the merge commit, got %s", head)
+		}
+		if commits := strings.Fields(gitTesting(t, bare, "rev-list", "--all")); len(commits) != 4 {
+			t.Errorf("Expected the 4 commits, got %v", commits)
+		}
+		if content := gitTesting(t, bare, "cat-file", "-p", "main:src/lib/b.c"); content != "hello" {
+			t.Errorf("Expected git to read the nested blob, got %q", content)
+		}
+		if branches := gitTesting(t, bare, "for-each-ref", "--format=%(refname)"); branches != "refs/heads/feature\nrefs/heads/main" {
+			t.Errorf("Expected the branches, got %q", branches)
+		}
+		again, err := internal.ExportGit(repo, bare, internal.ExportOptions{Bare: true})
+		if err != nil || again.Written != 0 || again.Skipped != result.Written {
+			t.Errorf("Expected nothing new to write, got %+v %v", again, err)
+		}
+	})
+
+	t.Run("export to a worktree", func(t *testing.T) {
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		commitWorktreeTesting(t, repo, "first", []TestingFile{{Name: "b.c", RelativePath: "src/b.c", Data: []byte("int main;\n")}})
+		dest := t.TempDir()
+		if _, err := internal.ExportGit(repo, dest, internal.ExportOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		gitTesting(t, dest, "fsck", "--strict")
+		gitTesting(t, dest, "reset", "-q", "--hard")
+		if content, _ := os.ReadFile(filepath.Join(dest, "src", "b.c")); string(content) != "int main;\n" {
+			t.Errorf("Expected git to check out the exported commit, got %q", content)
+		}
+		if status := gitTesting(t, dest, "status", "--porcelain"); status != "" {
+			t.Errorf("Expected a clean git worktree, got %q", status)
+		}
+	})
+
+	t.Run("round trip with import", func(t *testing.T) {
+		dir := gitFixtureTesting(t)
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := internal.ImportGit(repo, dir); err != nil {
+			t.Fatal(err)
+		}
+		bare := filepath.Join(t.TempDir(), "bare.git")
+		if _, err := internal.ExportGit(repo, bare, internal.ExportOptions{Bare: true}); err != nil {
+			t.Fatal(err)
+		}
+		gitTesting(t, bare, "fsck", "--strict", "--no-dangling")
+		format := "--format=%(objectname) %(objecttype) %(refname)"
+		if exported, original := gitTesting(t, bare, "for-each-ref", format), gitTesting(t, dir, "for-each-ref", format); exported != original {
+			t.Errorf("Expected the same refs as the original, got %q and %q", exported, original)
+		}
+	})
+
+	t.Run("only move the refs of git forward", func(t *testing.T) {
+		repo, first := divergeTesting(t,
+			[]TestingFile{{Name: "a.txt", RelativePath: "a.txt", Data: []byte("a\n")}},
+			[]TestingFile{{Name: "b.txt", RelativePath: "b.txt", Data: []byte("b\n")}},
+			nil,
+		)
+		os.WriteFile(filepath.Join(repo.GotDir, "refs", "tags", "v1"), []byte(first), 0644)
+		bare := filepath.Join(t.TempDir(), "bare.git")
+		if _, err := internal.ExportGit(repo, bare, internal.ExportOptions{Bare: true}); err != nil {
+			t.Fatal(err)
+		}
+		// What it does: git commits on main and moves the tag, got commits on feature.
+		own := gitTesting(t, bare, "commit-tree", gitTesting(t, bare, "rev-parse", "main^{tree}"), "-p", "main", "-m", "own")
+		gitTesting(t, bare, "update-ref", "refs/heads/main", own)
+		gitTesting(t, bare, "tag", "-f", "v1", own)
+		internal.Checkout(repo, "feature", false)
+		feature := commitWorktreeTesting(t, repo, "more", []TestingFile{{Name: "c.txt", RelativePath: "c.txt", Data: []byte("c\n")}})
+		result, err := internal.ExportGit(repo, bare, internal.ExportOptions{Bare: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(result.Kept, " ") != "refs/heads/main refs/tags/v1" {
+			t.Errorf("Expected the refs moved by git kept, got %+v", result)
+		}
+		if main, tag := gitTesting(t, bare, "rev-parse", "main"), gitTesting(t, bare, "rev-parse", "v1"); main != own || tag != own {
+			t.Errorf("Expected the commit of git kept, got %s and %s", main, tag)
+		}
+		if moved := gitTesting(t, bare, "rev-parse", "feature"); moved != feature {
+			t.Errorf("Expected feature moved forward, got %s", moved)
+		}
+		forced, err := internal.ExportGit(repo, bare, internal.ExportOptions{Bare: true, Force: true})
+		if err != nil || len(forced.Kept) != 0 {
+			t.Fatalf("Expected every ref overwritten, got %+v %v", forced, err)
+		}
+		if main, _ := internal.ResolveRevision(repo, "main"); gitTesting(t, bare, "rev-parse", "main") != main {
+			t.Errorf("Expected main overwritten with the one of got")
+		}
+	})
+
+	t.Run("refuse the former object format", func(t *testing.T) {
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		setObjectFormatTesting(t, repo, internal.ObjectFormatGot)
+		if _, err := internal.ExportGit(repo, t.TempDir(), internal.ExportOptions{}); !errors.Is(err, internal.ErrorObjectFormatNotGit) {
+			t.Errorf("Expected the git object format to be required, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,172 @@
+package internal
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/sha1"
+	"fmt"
+	"slices"
+	"strconv"
+)
+
+const (
+	// Objects encoded as git does, readable by git itself. The default of new repositories.
+	ObjectFormatGit = "git"
+	// Objects encoded with the former got encoding: binary size and full paths in trees.
+	// The repositories whose config has no object format use it.
+	ObjectFormatGot = "got"
+)
+
+// Encoding of the objects in DB.
+type ObjectFormat interface {
+	// Name of the format as written in config.
+	Name() string
+	// Frame the object data with its type and size.
+	Encode(header string, data []byte) []byte
+	// Split the framed object into its type and data.
+	Decode(raw []byte) (string, []byte, error)
+	// Encode the entries of the tree. No recursive.
+	EncodeTree(t TreeItem) []byte
+	// Decode the entries of the tree. No recursive, the children paths are relative to the worktree.
+	DecodeTree(t TreeItem, d []byte) (TreeItem, error)
+}
+
+// An object whose data depends on the object format, like trees.
+type formatObject interface {
+	serializeWith(format ObjectFormat) []byte
+}
+
+func (t TreeItem) serializeWith(format ObjectFormat) []byte {
+	return format.EncodeTree(t)
+}
+
+// Obtain the object format given its name. Empty is the former got format.
+func ObjectFormatByName(name string) (ObjectFormat, error) {
+	switch name {
+	case ObjectFormatGit:
+		return gitFormat{}, nil
+	case ObjectFormatGot, "":
+		return gotFormat{}, nil
+	default:
+		return nil, fmt.Errorf("unknown object format %q", name)
+	}
+}
+
+// The object format of the repository as set in config.
+func (repo *GotRepository) ObjectFormat() ObjectFormat {
+	format, err := ObjectFormatByName(repo.GetConfiguration().Core.ObjectFormat)
+	if err != nil {
+		panic(err)
+	}
+	return format
+}
+
+// header[unbound size uint8]|0x20[uint8 x 1]|size[uint32 x 1]|0x00[uint8 x 1]|data[unbound size uint8]
+type gotFormat struct{}
+
+func (gotFormat) Name() string {
+	return ObjectFormatGot
+}
+
+func (gotFormat) Encode(header string, data []byte) []byte {
+	packet := AllocatePacket(0)
+	packet.Set([]byte(header), []byte{space}, Bit32(len(data)).Bytes(), []byte{0x00}, data)
+	return packet.buff
+}
+
+func (gotFormat) Decode(raw []byte) (string, []byte, error) {
+	headerEnd := bytes.IndexByte(raw, space)
+	if headerEnd < 0 || len(raw) < headerEnd+6 || raw[headerEnd+5] != 0x00 {
+		return "", nil, ErrorMalformedObject
+	}
+	//Size of data is uint32
+	sizeOfData := int(Bit32FromBytes(raw[headerEnd+1 : headerEnd+5]))
+	// after the size and 0x00, data comes.
+	if len(raw) != headerEnd+6+sizeOfData {
+		return "", nil, ErrorMalformedObject
+	}
+	return string(raw[:headerEnd]), raw[headerEnd+6 : headerEnd+6+sizeOfData], nil
+}
+
+// [mode of 6 bytes]|[space with 0x20]|[full path from got tree]|[terminator 0x00]|[sha1 of 20 bytes]
+func (gotFormat) EncodeTree(t TreeItem) []byte {
+	children := slices.Clone(t.Children)
+	// What it does: Sort the path so that the hash of the tree with the same item but different order give the same hash.
+	slices.SortFunc(children, func(a, b TreeItem) int {
+		return cmp.Compare(a.Path, b.Path)
+	})
+	bb := make([]byte, 0)
+	for _, child := range children {
+		bb = append(bb, child.Mode...)
+		bb = append(bb, space)
+		bb = append(bb, child.Path...)
+		bb = append(bb, 0x00)
+		bb = append(bb, Hex2bytes(child.Hash)...)
+	}
+	return bb
+}
+
+func (gotFormat) DecodeTree(t TreeItem, d []byte) (TreeItem, error) {
+	for len(d) > 0 {
+		modeSep := bytes.IndexByte(d, space)
+		pathTerm := bytes.IndexByte(d, 0x00)
+		if modeSep < 0 || pathTerm < modeSep || len(d) < pathTerm+sha1.Size+1 {
+			return TreeItem{}, ErrorMalformedObject
+		}
+		mode := Mode(d[:modeSep])
+		if !isOctalMode(mode) {
+			return TreeItem{}, ErrorMalformedObject
+		}
+		t.Children = append(t.Children, TreeItem{
+			Mode: mode,
+			Path: string(d[modeSep+1 : pathTerm]),
+			Hash: Bytes2hex(d[pathTerm+1 : pathTerm+1+sha1.Size]),
+		})
+		d = d[pathTerm+1+sha1.Size:]
+	}
+	return t, nil
+}
+
+// header[unbound size uint8]|0x20[uint8 x 1]|size[ASCII decimal]|0x00[uint8 x 1]|data[unbound size uint8]
+//
+// Trees are encoded as TreeItem.Serialize does.
+type gitFormat struct{}
+
+func (gitFormat) Name() string {
+	return ObjectFormatGit
+}
+
+func (gitFormat) Encode(header string, data []byte) []byte {
+	raw := make([]byte, 0, len(header)+len(data)+12)
+	raw = append(raw, header...)
+	raw = append(raw, space)
+	raw = strconv.AppendInt(raw, int64(len(data)), 10)
+	raw = append(raw, 0x00)
+	return append(raw, data...)
+}
+
+func (gitFormat) Decode(raw []byte) (string, []byte, error) {
+	headerEnd := bytes.IndexByte(raw, space)
+	sizeEnd := bytes.IndexByte(raw, 0x00)
+	if headerEnd < 0 || sizeEnd < headerEnd {
+		return "", nil, ErrorMalformedObject
+	}
+	size, err := strconv.Atoi(string(raw[headerEnd+1 : sizeEnd]))
+	if err != nil || size != len(raw)-sizeEnd-1 {
+		return "", nil, ErrorMalformedObject
+	}
+	return string(raw[:headerEnd]), raw[sizeEnd+1:], nil
+}
+
+func (gitFormat) EncodeTree(t TreeItem) []byte {
+	return t.Serialize()
+}
+
+func (gitFormat) DecodeTree(t TreeItem, d []byte) (tree TreeItem, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = ErrorMalformedObject
+		}
+	}()
+	return t.Deserialize(d), nil
+}
@@ -0,0 +1,150 @@
+package internal_test
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	internal "github.com/danielrrv/got/internal"
+)
+
+// Switch the repository to the given object format.
+func setObjectFormatTesting(t *testing.T, repo *internal.GotRepository, format string) {
+	updateConfigTesting(t, repo, func(config *internal.GotConfig) {
+		config.Core.ObjectFormat = format
+	})
+}
+
+// Change the configuration of the repository.
+func updateConfigTesting(t *testing.T, repo *internal.GotRepository, update func(config *internal.GotConfig)) {
+	config := repo.GetConfiguration()
+	update(&config)
+	if err := repo.SetConfiguration(config); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestObjectFormat(t *testing.T) {
+	t.Run("new repositories are git compatible", func(t *testing.T) {
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name := repo.ObjectFormat().Name(); name != internal.ObjectFormatGit {
+			t.Errorf("Expected the git format by default, got %s", name)
+		}
+		hash, err := internal.WriteObject(repo, rawObject("hello\n"), internal.BlobHeaderName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// git hash-object of "hello\n".
+		if hash != "ce013625030ba8dba906f756967f9e9ca394464a" {
+			t.Errorf("Expected the blob hash of git, got %s", hash)
+		}
+		empty, _ := internal.WriteObject(repo, internal.TreeItem{Mode: internal.TreeMode}, internal.TreeHeaderName)
+		if empty != "4b825dc642cb6eb9a060e54bf8d69288fbee4904" {
+			t.Errorf("Expected the empty tree hash of git, got %s", empty)
+		}
+		if content, err := internal.ReadBlob(repo, hash); err != nil || string(content) != "hello\n" {
+			t.Errorf("Expected to read the blob back, got %q %v", content, err)
+		}
+	})
+
+	t.Run("the config is read once", func(t *testing.T) {
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		repo.ObjectFormat()
+		os.Remove(filepath.Join(repo.GotDir, "config"))
+		if name := repo.ObjectFormat().Name(); name != internal.ObjectFormatGit {
+			t.Errorf("Expected the format of the config read before, got %s", name)
+		}
+		setObjectFormatTesting(t, repo, internal.ObjectFormatGot)
+		if name := repo.ObjectFormat().Name(); name != internal.ObjectFormatGot {
+			t.Errorf("Expected the format of the config written, got %s", name)
+		}
+		if reopened, _ := internal.FindOrCreateRepo(repo.GotTree); reopened.ObjectFormat().Name() != internal.ObjectFormatGot {
+			t.Errorf("Expected the config written to the file")
+		}
+	})
+
+	t.Run("git tree entries", func(t *testing.T) {
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		first := CommitFilesTesting(repo, "first", "", map[string]string{
+			"src/a/b.c": "x\n",
+			"src-x":     "y\n",
+			"src.c":     "z\n",
+		})
+		tree := internal.ReadTree(repo, internal.ReadCommit(repo, first).Tree)
+		names := make([]string, 0)
+		for _, child := range tree.Children {
+			names = append(names, child.Path)
+		}
+		// What it does: git sorts "src" as "src/", after "src-x" and "src.c".
+		if strings.Join(names, ",") != "src-x,src.c,src" {
+			t.Errorf("Expected the children in git order, got %v", names)
+		}
+		if blobs := tree.FlatItems(); len(blobs) != 3 || blobs[2].Path != "src/a/b.c" {
+			t.Errorf("Expected the paths relative to the worktree, got %v", blobs)
+		}
+		raw, err := internal.ReadObject(repo, internal.TreeHeaderName, tree.Hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasPrefix(raw, []byte("100644 src-x\x00")) || !bytes.Contains(raw, []byte("40000 src\x00")) {
+			t.Errorf("Expected base names and git modes, got %q", raw)
+		}
+	})
+
+	t.Run("git reads the objects", func(t *testing.T) {
+		git, err := exec.LookPath("git")
+		if err != nil {
+			t.Skip("git is not installed")
+		}
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		hash := commitWorktreeTesting(t, repo, "first", []TestingFile{
+			{Name: "readme.md", RelativePath: "readme.md", Data: []byte("readme\n")},
+			{Name: "b.c", RelativePath: "src/b.c", Data: []byte("int main;\n")},
+		})
+		cmd := exec.Command(git, "cat-file", "-p", hash+"^{tree}:src/b.c")
+		cmd.Dir = t.TempDir()
+		cmd.Env = append(cmd.Environ(), "GIT_DIR="+filepath.Join(cmd.Dir, "none"), "GIT_OBJECT_DIRECTORY="+filepath.Join(repo.GotDir, "objects"))
+		if err := exec.Command(git, "init", "-q", "--bare", filepath.Join(cmd.Dir, "none")).Run(); err != nil {
+			t.Fatal(err)
+		}
+		out, err := cmd.CombinedOutput()
+		if err != nil || string(out) != "int main;\n" {
+			t.Errorf("Expected git to read the blob through the commit, got %q %v", out, err)
+		}
+	})
+
+	t.Run("former got format", func(t *testing.T) {
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		setObjectFormatTesting(t, repo, internal.ObjectFormatGot)
+		hash, err := internal.WriteObject(repo, rawObject("hello\n"), internal.BlobHeaderName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hash == "ce013625030ba8dba906f756967f9e9ca394464a" {
+			t.Errorf("Expected the former encoding to hash differently")
+		}
+		first := CommitFilesTesting(repo, "first", "", map[string]string{"src/a/b.c": "x\n", "readme.md": "r\n"})
+		tree := internal.ReadTree(repo, internal.ReadCommit(repo, first).Tree)
+		if blobs := tree.FlatItems(); len(blobs) != 2 {
+			t.Errorf("Expected the former trees to be read, got %v", blobs)
+		}
+	})
+}
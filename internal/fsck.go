@@ -0,0 +1,261 @@
+package internal
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const (
+	// The object file can't be uncompressed, or its header is wrong.
+	FsckCorrupt = "corrupt"
+	// The content of the object doesn't hash to its id.
+	FsckHashMismatch = "hash-mismatch"
+	// The tree, commit or tag can't be parsed.
+	FsckMalformed = "malformed"
+	// An object points to an object the DB doesn't have.
+	FsckMissing = "missing"
+	// A ref or HEAD holds no object id, or the id of a missing object.
+	FsckBrokenRef = "broken-ref"
+	// A commit nothing points to. Not an error, prune removes it eventually.
+	FsckDangling = "dangling"
+)
+
+// A problem found by Fsck. It is printed as one line:
+//
+//	<problem> <type> <id>\t<detail>
+//
+// The id of a broken ref is its name, and its type is "ref".
+type FsckProblem struct {
+	Problem string
+	// The object type: blob, tree, commit or tag. Empty when it can't be told.
+	Type   string
+	ID     string
+	Detail string
+}
+
+func (p FsckProblem) String() string {
+	line := fmt.Sprintf("%s %s %s", p.Problem, cmp.Or(p.Type, "unknown"), p.ID)
+	if p.Detail != "" {
+		line += "\t" + p.Detail
+	}
+	return line
+}
+
+// Whether the problem is a damage of the repository. Dangling commits are not.
+func (p FsckProblem) IsError() bool {
+	return p.Problem != FsckDangling
+}
+
+// An object pointed to by another one, and the type it is expected to be.
+type fsckLink struct {
+	hash string
+	kind string
+}
+
+// Verify the objects, loose and packed, and the refs:
+//   - Every object hashes to its id, has a valid header and size, and its tree, commit or tag parses.
+//   - Every object a tree, commit or tag points to is in DB. Gitlinks point to other repositories and are skipped.
+//   - Every ref and HEAD points to an object in DB.
+//
+// The commits nothing points to are reported as dangling. The error is about reading the repository, not its
+// problems.
+func Fsck(repo *GotRepository) ([]FsckProblem, error) {
+	format := repo.ObjectFormat()
+	objectsDir := filepath.Join(repo.GotDir, gotRepositoryDirObjects)
+	problems := make([]FsckProblem, 0)
+	present := make(map[string]bool)
+	headers := make(map[string]string)
+	links := make(map[string][]fsckLink)
+
+	check := func(hash string, raw []byte) {
+		present[hash] = true
+		if sum := sha1.Sum(raw); hex.EncodeToString(sum[:]) != hash {
+			problems = append(problems, FsckProblem{Problem: FsckHashMismatch, ID: hash, Detail: "content hashes to " + hex.EncodeToString(sum[:])})
+			return
+		}
+		header, data, err := format.Decode(raw)
+		if err != nil {
+			problems = append(problems, FsckProblem{Problem: FsckCorrupt, ID: hash, Detail: err.Error()})
+			return
+		}
+		headers[hash] = header
+		pointed, err := fsckParse(format, header, data)
+		if err != nil {
+			problems = append(problems, FsckProblem{Problem: FsckMalformed, Type: header, ID: hash, Detail: err.Error()})
+			return
+		}
+		links[hash] = pointed
+	}
+
+	hashes, err := listLooseObjects(objectsDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, hash := range hashes {
+		content, err := os.ReadFile(filepath.Join(objectsDir, hash[:2], hash[2:]))
+		if err != nil {
+			return nil, err
+		}
+		raw, err := inflateObject(content)
+		if err != nil {
+			present[hash] = true
+			problems = append(problems, FsckProblem{Problem: FsckCorrupt, ID: hash, Detail: err.Error()})
+			continue
+		}
+		check(hash, raw)
+	}
+	packs, err := repo.Packs()
+	if err != nil {
+		return nil, err
+	}
+	for _, pack := range packs {
+		for _, hash := range pack.Hashes() {
+			if present[hash] {
+				continue
+			}
+			header, data, err := pack.Read(hash)
+			if err != nil {
+				present[hash] = true
+				problems = append(problems, FsckProblem{Problem: FsckCorrupt, ID: hash, Detail: fmt.Sprintf("%s: %s", filepath.Base(pack.Path), err)})
+				continue
+			}
+			// What it does: packs are written in git format only.
+			check(hash, gitFormat{}.Encode(header, data))
+		}
+	}
+
+	// Implementation to report the missing objects and find the commits something points to.
+	pointed := make(map[string]bool)
+	for hash, children := range links {
+		for _, child := range children {
+			pointed[child.hash] = true
+			if !present[child.hash] {
+				problems = append(problems, FsckProblem{Problem: FsckMissing, Type: child.kind, ID: child.hash,
+					Detail: fmt.Sprintf("referenced by %s %s", headers[hash], hash)})
+			}
+		}
+	}
+
+	refProblems, err := fsckRefs(repo, present)
+	if err != nil {
+		return nil, err
+	}
+	problems = append(problems, refProblems...)
+
+	roots, err := reachabilityRoots(repo)
+	if err != nil {
+		return nil, err
+	}
+	for _, root := range roots {
+		pointed[root] = true
+	}
+	for hash, header := range headers {
+		if header == CommitHeaderName && !pointed[hash] {
+			problems = append(problems, FsckProblem{Problem: FsckDangling, Type: header, ID: hash})
+		}
+	}
+	slices.SortFunc(problems, func(a, b FsckProblem) int {
+		return cmp.Or(cmp.Compare(a.Problem, b.Problem), cmp.Compare(a.ID, b.ID), cmp.Compare(a.Detail, b.Detail))
+	})
+	return problems, nil
+}
+
+// Parse the tree, commit or tag and return the objects it points to.
+func fsckParse(format ObjectFormat, header string, data []byte) (links []fsckLink, err error) {
+	// What it does: the headers parser panics on a line without a key.
+	defer func() {
+		if r := recover(); r != nil {
+			err = ErrorParsingObject
+		}
+	}()
+	isHash := func(hash string) bool {
+		return len(hash) == sha1.Size*2 && isHexString(hash)
+	}
+	switch header {
+	case BlobHeaderName:
+	case TreeHeaderName:
+		tree, err := format.DecodeTree(TreeItem{Mode: TreeMode}, data)
+		if err != nil {
+			return nil, err
+		}
+		for _, child := range tree.Children {
+			if !validTreeEntryName(child.Path) || !isOctalMode(child.Mode) || child.Mode.String() == "unknown" {
+				return nil, fmt.Errorf("%w: entry %q", ErrorMalformedObject, child.Path)
+			}
+			if !bytes.Equal(child.Mode, GitlinkMode) {
+				links = append(links, fsckLink{hash: child.Hash, kind: child.Mode.String()})
+			}
+		}
+	case CommitHeaderName:
+		commit := Commit{}.Deserialize(data)
+		if !isHash(commit.Tree) {
+			return nil, fmt.Errorf("%w: tree %q", ErrorMalformedObject, commit.Tree)
+		}
+		links = append(links, fsckLink{hash: commit.Tree, kind: TreeHeaderName})
+		for _, parent := range commit.Parents {
+			if !isHash(parent) {
+				return nil, fmt.Errorf("%w: parent %q", ErrorMalformedObject, parent)
+			}
+			links = append(links, fsckLink{hash: parent, kind: CommitHeaderName})
+		}
+	case TagHeaderName:
+		tag := Tag{}.Deserialize(data)
+		if !isHash(tag.Object) {
+			return nil, fmt.Errorf("%w: object %q", ErrorMalformedObject, tag.Object)
+		}
+		links = append(links, fsckLink{hash: tag.Object, kind: tag.Type})
+	default:
+		return nil, ErrorIncorrectOBjectType
+	}
+	return links, nil
+}
+
+// Verify the refs, a detached HEAD and the merge in progress point to objects in DB. A HEAD pointing to a branch
+// not created yet is fine: it is the state of a repository without commits.
+func fsckRefs(repo *GotRepository, present map[string]bool) ([]FsckProblem, error) {
+	problems := make([]FsckProblem, 0)
+	checkRef := func(name string, content []byte) {
+		hash := string(bytes.TrimSpace(content))
+		switch {
+		case len(hash) != sha1.Size*2 || !isHexString(hash):
+			problems = append(problems, FsckProblem{Problem: FsckBrokenRef, Type: "ref", ID: name, Detail: fmt.Sprintf("invalid object id %q", hash)})
+		case !present[hash]:
+			problems = append(problems, FsckProblem{Problem: FsckBrokenRef, Type: "ref", ID: name, Detail: "points to missing object " + hash})
+		}
+	}
+	err := filepath.WalkDir(filepath.Join(repo.GotDir, gotRepositoryDirRefs), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || strings.HasSuffix(path, lockSuffix) {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		name, _ := filepath.Rel(repo.GotDir, path)
+		checkRef(filepath.ToSlash(name), content)
+		return nil
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	head, err := os.ReadFile(filepath.Join(repo.GotDir, "HEAD"))
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(head, []byte("ref: ")) {
+		checkRef("HEAD", head)
+	}
+	if mergeHead, err := os.ReadFile(filepath.Join(repo.GotDir, mergeHeadFile)); err == nil {
+		checkRef(mergeHeadFile, mergeHead)
+	}
+	return problems, nil
+}
@@ -0,0 +1,162 @@
+package internal_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	internal "github.com/danielrrv/got/internal"
+)
+
+// Replace the file of the loose object with the given content, compressed unless raw.
+func overwriteObjectTesting(t *testing.T, repo *internal.GotRepository, hash string, content []byte, raw bool) {
+	objPath := filepath.Join(repo.GotDir, "objects", hash[:2], hash[2:])
+	if !raw {
+		var bb bytes.Buffer
+		internal.Compress(content, &bb)
+		content = bb.Bytes()
+	}
+	os.Remove(objPath)
+	if err := os.WriteFile(objPath, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func problemsTesting(t *testing.T, repo *internal.GotRepository) map[string]internal.FsckProblem {
+	problems, err := internal.Fsck(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := make(map[string]internal.FsckProblem)
+	for _, problem := range problems {
+		found[problem.Problem+" "+problem.ID] = problem
+	}
+	return found
+}
+
+func TestFsck(t *testing.T) {
+	t.Run("a sound repository has no problem", func(t *testing.T) {
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if problems := problemsTesting(t, repo); len(problems) != 0 {
+			t.Errorf("Expected no problem in an empty repository, got %v", problems)
+		}
+		commitWorktreeTesting(t, repo, "first", []TestingFile{{Name: "b.c", RelativePath: "src/b.c", Data: []byte("int main;\n")}})
+		commitWorktreeTesting(t, repo, "second", []TestingFile{{Name: "a.txt", RelativePath: "a.txt", Data: []byte("a\n")}})
+		if problems := problemsTesting(t, repo); len(problems) != 0 {
+			t.Errorf("Expected no problem, got %v", problems)
+		}
+		if _, err := internal.GC(repo); err != nil {
+			t.Fatal(err)
+		}
+		if problems := problemsTesting(t, repo); len(problems) != 0 {
+			t.Errorf("Expected no problem in the packed objects, got %v", problems)
+		}
+	})
+
+	t.Run("corrupted objects are reported, not read", func(t *testing.T) {
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		setObjectFormatTesting(t, repo, internal.ObjectFormatGit)
+		garbage, _ := internal.WriteObject(repo, rawObject("garbage\n"), internal.BlobHeaderName)
+		swapped, _ := internal.WriteObject(repo, rawObject("swapped\n"), internal.BlobHeaderName)
+		overwriteObjectTesting(t, repo, garbage, []byte("not zlib at all"), true)
+		overwriteObjectTesting(t, repo, swapped, []byte("blob 6\x00other\n"), false)
+		// What it does: the id matches the content, but the header claims more data than there is.
+		truncatedContent := []byte("blob 10\x00trunc")
+		truncated := string(internal.CreateSha1(truncatedContent))
+		os.MkdirAll(filepath.Join(repo.GotDir, "objects", truncated[:2]), 0755)
+		overwriteObjectTesting(t, repo, truncated, truncatedContent, false)
+
+		if _, err := internal.ReadBlob(repo, garbage); err == nil {
+			t.Errorf("Expected the corrupted object not to be read")
+		}
+		problems := problemsTesting(t, repo)
+		if _, ok := problems["corrupt "+garbage]; !ok {
+			t.Errorf("Expected the invalid zlib data reported, got %v", problems)
+		}
+		if _, ok := problems["hash-mismatch "+swapped]; !ok {
+			t.Errorf("Expected the content of another object reported, got %v", problems)
+		}
+		if _, ok := problems["corrupt "+truncated]; !ok {
+			t.Errorf("Expected the size of the truncated object reported, got %v", problems)
+		}
+		if len(problems) != 3 {
+			t.Errorf("Expected 3 problems, got %v", problems)
+		}
+	})
+
+	t.Run("malformed commit", func(t *testing.T) {
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		setObjectFormatTesting(t, repo, internal.ObjectFormatGit)
+		hash, _ := internal.WriteObject(repo, rawObject("tree x\n\nmessage"), internal.CommitHeaderName)
+		problem, ok := problemsTesting(t, repo)["malformed "+hash]
+		if !ok || problem.Type != internal.CommitHeaderName {
+			t.Errorf("Expected the commit without tree reported, got %v", problem)
+		}
+		if problem.String() != "malformed commit "+hash+"\tmalformed object: tree \"x\"" {
+			t.Errorf("Expected a line of the problem, the type, the id and the detail, got %q", problem.String())
+		}
+	})
+
+	t.Run("malformed tree entries", func(t *testing.T) {
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		setObjectFormatTesting(t, repo, internal.ObjectFormatGit)
+		blob, _ := internal.WriteObject(repo, rawObject("content"), internal.BlobHeaderName)
+		id, _ := hex.DecodeString(blob)
+		for _, name := range []string{".", "..", ".got", ".GIT"} {
+			hash, _ := internal.WriteObject(repo, rawObject("100644 "+name+"\x00"+string(id)), internal.TreeHeaderName)
+			if problem, ok := problemsTesting(t, repo)["malformed "+hash]; !ok || problem.Type != internal.TreeHeaderName {
+				t.Errorf("Expected the entry %q reported, got %v", name, problem)
+			}
+		}
+		// What it does: the group writable files of the former versions of git are blobs, a mode git never writes isn't.
+		hash, _ := internal.WriteObject(repo, rawObject("100664 a.txt\x00"+string(id)), internal.TreeHeaderName)
+		if problem, ok := problemsTesting(t, repo)["malformed "+hash]; ok {
+			t.Errorf("Expected the 100664 entry read as a blob, got %v", problem)
+		}
+		hash, _ = internal.WriteObject(repo, rawObject("170000 a.txt\x00"+string(id)), internal.TreeHeaderName)
+		if problem, ok := problemsTesting(t, repo)["malformed "+hash]; !ok || problem.Type != internal.TreeHeaderName {
+			t.Errorf("Expected the unknown mode reported, got %v", problem)
+		}
+	})
+
+	t.Run("missing objects, broken refs and dangling commits", func(t *testing.T) {
+		repo, first, second := abandonCommitTesting(t)
+		tree := internal.ReadCommit(repo, first).Tree
+		internal.RemoveObjectFrom(repo, tree)
+		missing := "0123456789abcdef0123456789abcdef01234567"
+		os.WriteFile(filepath.Join(repo.GotDir, "refs", "heads", "gone"), []byte(missing+"\n"), 0644)
+		os.WriteFile(filepath.Join(repo.GotDir, "refs", "heads", "junk"), []byte("junk\n"), 0644)
+
+		problems := problemsTesting(t, repo)
+		if problem, ok := problems["missing "+tree]; !ok || problem.Type != internal.TreeHeaderName || problem.Detail != "referenced by commit "+first {
+			t.Errorf("Expected the missing tree of the first commit reported, got %v", problems)
+		}
+		if problem, ok := problems["broken-ref refs/heads/gone"]; !ok || problem.Detail != "points to missing object "+missing {
+			t.Errorf("Expected the branch of a missing commit reported, got %v", problems)
+		}
+		if _, ok := problems["broken-ref refs/heads/junk"]; !ok {
+			t.Errorf("Expected the branch without an object id reported, got %v", problems)
+		}
+		dangling, ok := problems["dangling "+second]
+		if !ok || dangling.IsError() {
+			t.Errorf("Expected the abandoned commit reported as dangling only, got %v", problems)
+		}
+		if len(problems) != 4 {
+			t.Errorf("Expected 4 problems, got %v", problems)
+		}
+	})
+}
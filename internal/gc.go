@@ -0,0 +1,113 @@
+package internal
+
+import (
+	"cmp"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type GCResult struct {
+	// The pack written. Empty when there was nothing to pack.
+	Pack string
+	// Objects in the pack.
+	Packed int
+	// Objects stored as delta against another one.
+	Deltas int
+	// Loose objects removed because they are packed now.
+	Removed int
+}
+
+// Pack the objects reachable from the branches, tags, HEAD, the index and the reflogs into a single pack and remove
+// their loose copies. The former packs are replaced, the objects of them no longer reachable are kept loose.
+//
+// Similar blobs are stored as delta against each other, see findDeltas.
+func GC(repo *GotRepository) (*GCResult, error) {
+	if repo.ObjectFormat().Name() != ObjectFormatGit {
+		return nil, ErrorObjectFormatNotGit
+	}
+	roots, err := reachabilityRoots(repo)
+	if err != nil {
+		return nil, err
+	}
+	objects := make([]packInput, 0)
+	// The base name of the blobs, so that the revisions of a file are tried as base of each other.
+	names := make(map[string]string)
+	err = walkReachable(repo, roots, func(hash string, header string, data []byte) error {
+		objects = append(objects, packInput{hash: hash, header: header, data: data})
+		if header == TreeHeaderName {
+			tree, _ := gitFormat{}.DecodeTree(TreeItem{Mode: TreeMode}, data)
+			for _, child := range tree.Children {
+				names[child.Hash] = child.Path
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := &GCResult{Packed: len(objects)}
+	if len(objects) == 0 {
+		return result, nil
+	}
+	for i := range objects {
+		objects[i].name = names[objects[i].hash]
+	}
+	config := repo.GetConfiguration().Pack
+	result.Deltas = findDeltas(objects, cmp.Or(config.Window, deltaWindow), cmp.Or(config.Depth, deltaDepth))
+	objectsDir := filepath.Join(repo.GotDir, gotRepositoryDirObjects)
+	if result.Pack, err = writePack(objectsDir, objects); err != nil {
+		return nil, err
+	}
+	packed := make(map[string]bool, len(objects))
+	for _, object := range objects {
+		packed[object.hash] = true
+	}
+	// Implementation to keep loose the objects of the former packs not packed again.
+	formerPacks, err := repo.Packs()
+	if err != nil {
+		return nil, err
+	}
+	for _, pack := range formerPacks {
+		if pack.Path == result.Pack {
+			continue
+		}
+		for _, hash := range pack.Hashes() {
+			if packed[hash] || pathExist(filepath.Join(objectsDir, hash[:2], hash[2:]), false) {
+				continue
+			}
+			header, data, err := pack.Read(hash)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := writeLooseObject(objectsDir, gitFormat{}.Encode(header, data)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	repo.closePacks()
+	for _, pack := range formerPacks {
+		if pack.Path == result.Pack {
+			continue
+		}
+		if err := os.Remove(pack.Path); err != nil {
+			return nil, err
+		}
+		os.Remove(strings.TrimSuffix(pack.Path, ".pack") + ".idx")
+	}
+	hashes, err := listLooseObjects(objectsDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, hash := range hashes {
+		if !packed[hash] {
+			continue
+		}
+		if err := RemoveObjectFrom(repo, hash); err != nil {
+			return nil, err
+		}
+		os.Remove(filepath.Join(objectsDir, hash[:2]))
+		result.Removed++
+	}
+	return result, nil
+}
@@ -0,0 +1,184 @@
+package internal_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	internal "github.com/danielrrv/got/internal"
+)
+
+// The object ids of the loose objects of the repository.
+func looseObjectsTesting(repo *internal.GotRepository) []string {
+	paths, _ := filepath.Glob(filepath.Join(repo.GotDir, "objects", "??", "*"))
+	hashes := make([]string, 0, len(paths))
+	for _, path := range paths {
+		hashes = append(hashes, filepath.Base(filepath.Dir(path))+filepath.Base(path))
+	}
+	return hashes
+}
+
+// A file of many lines with the given lines edited.
+func configFileTesting(edited ...int) []byte {
+	lines := make([]string, 0)
+	for i := 0; i < 100; i++ {
+		lines = append(lines, fmt.Sprintf("setting.%d = a value long enough to be worth a delta", i))
+	}
+	for _, i := range edited {
+		lines[i] = fmt.Sprintf("setting.%d = edited", i)
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
+func TestGC(t *testing.T) {
+	t.Run("pack the reachable objects", func(t *testing.T) {
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		commits := make([]string, 0)
+		for i := 0; i < 3; i++ {
+			commits = append(commits, commitWorktreeTesting(t, repo, fmt.Sprintf("edit %d", i), []TestingFile{
+				{Name: "app.conf", RelativePath: "etc/app.conf", Data: configFileTesting(i * 10)},
+				{Name: "readme.md", RelativePath: "readme.md", Data: []byte(fmt.Sprintf("readme %d\n", i))},
+			}))
+		}
+		orphan, _ := internal.WriteObject(repo, rawObject("nobody points to me\n"), internal.BlobHeaderName)
+		loose := len(looseObjectsTesting(repo))
+
+		result, err := internal.GC(repo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Packed != loose-1 || result.Removed != loose-1 {
+			t.Errorf("Expected the %d reachable objects packed, got %+v", loose-1, result)
+		}
+		if result.Deltas == 0 {
+			t.Errorf("Expected the revisions of the config file stored as delta")
+		}
+		if left := looseObjectsTesting(repo); !slices.Equal(left, []string{orphan}) {
+			t.Errorf("Expected the unreachable object only to stay loose, got %v", left)
+		}
+		entries, err := internal.Log(repo, "", internal.LogOptions{})
+		if err != nil || len(entries) != 3 {
+			t.Fatalf("Expected the history read from the pack, got %d %v", len(entries), err)
+		}
+		for i, entry := range entries {
+			tree := internal.ReadTree(repo, entry.Commit.Tree)
+			blobs := tree.FlatItems()
+			content, err := internal.ReadBlob(repo, blobs[0].Hash)
+			if err != nil || string(content) != string(configFileTesting((2-i)*10)) {
+				t.Errorf("Expected the config file of %s, got %v", entry.Hash, err)
+			}
+		}
+		if hash, err := internal.ResolveRevision(repo, commits[0][:8]); err != nil || hash != commits[0] {
+			t.Errorf("Expected the abbreviated id of a packed commit to resolve, got %s %v", hash, err)
+		}
+		idx := strings.TrimSuffix(result.Pack, ".pack") + ".idx"
+		if out := gitTesting(t, t.TempDir(), "verify-pack", "-v", idx); !strings.Contains(out, "chain length = 1") {
+			t.Errorf("Expected git to verify the pack and its deltas, got %s", out)
+		}
+	})
+
+	t.Run("chains of deltas bounded by the depth", func(t *testing.T) {
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		updateConfigTesting(t, repo, func(config *internal.GotConfig) {
+			config.Pack.Depth = 2
+		})
+		revisions := make([][]byte, 0)
+		for i := 0; i < 8; i++ {
+			revisions = append(revisions, configFileTesting(i*10, 99-i))
+			commitWorktreeTesting(t, repo, fmt.Sprintf("edit %d", i), []TestingFile{{Name: "app.conf", RelativePath: "app.conf", Data: revisions[i]}})
+		}
+		result, err := internal.GC(repo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Deltas < 5 {
+			t.Errorf("Expected most revisions stored as delta, got %+v", result)
+		}
+		entries, _ := internal.Log(repo, "", internal.LogOptions{})
+		for i, entry := range entries {
+			tree := internal.ReadTree(repo, entry.Commit.Tree)
+			content, err := internal.ReadBlob(repo, tree.Children[0].Hash)
+			if err != nil || string(content) != string(revisions[len(revisions)-1-i]) {
+				t.Errorf("Expected the revision %d rebuilt from its chain, got %v", len(revisions)-1-i, err)
+			}
+		}
+		idx := strings.TrimSuffix(result.Pack, ".pack") + ".idx"
+		out := gitTesting(t, t.TempDir(), "verify-pack", "-v", idx)
+		if !strings.Contains(out, "chain length = 2") || strings.Contains(out, "chain length = 3") {
+			t.Errorf("Expected chains of 2 deltas at most, got %s", out)
+		}
+	})
+
+	t.Run("packed objects are not written loose again", func(t *testing.T) {
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		commitWorktreeTesting(t, repo, "first", []TestingFile{{Name: "b.c", RelativePath: "src/b.c", Data: []byte("int main;\n")}})
+		if _, err := internal.GC(repo); err != nil {
+			t.Fatal(err)
+		}
+		commitWorktreeTesting(t, repo, "second", []TestingFile{{Name: "a.txt", RelativePath: "a.txt", Data: []byte("a\n")}})
+		// What it does: the blob, root tree and commit are new. src and src/b.c are packed.
+		if loose := looseObjectsTesting(repo); len(loose) != 3 {
+			t.Errorf("Expected the new objects only to be loose, got %v", loose)
+		}
+	})
+
+	t.Run("unreachable objects of the former packs are kept loose", func(t *testing.T) {
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		first := commitWorktreeTesting(t, repo, "first", []TestingFile{{Name: "a.txt", RelativePath: "a.txt", Data: []byte("1\n")}})
+		second := commitWorktreeTesting(t, repo, "second", []TestingFile{{Name: "a.txt", RelativePath: "a.txt", Data: []byte("2\n")}})
+		former, err := internal.GC(repo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		internal.UpdateBranch(repo, "main", first)
+		if _, err := internal.Checkout(repo, "main", true); err != nil {
+			t.Fatal(err)
+		}
+		result, err := internal.GC(repo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(former.Pack); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Expected the former pack to be removed")
+		}
+		if packs, _ := filepath.Glob(filepath.Join(repo.GotDir, "objects", "pack", "*.pack")); len(packs) != 1 || packs[0] != result.Pack {
+			t.Errorf("Expected a single pack, got %v", packs)
+		}
+		if !slices.Contains(looseObjectsTesting(repo), second) {
+			t.Errorf("Expected the commit no longer reachable to be loose")
+		}
+		if commit := internal.ReadCommit(repo, second); commit.Description != "second" {
+			t.Errorf("Expected the loose commit to be readable, got %v", commit)
+		}
+	})
+
+	t.Run("nothing to pack", func(t *testing.T) {
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result, err := internal.GC(repo); err != nil || result.Pack != "" {
+			t.Errorf("Expected no pack for an empty repository, got %+v %v", result, err)
+		}
+		setObjectFormatTesting(t, repo, internal.ObjectFormatGot)
+		if _, err := internal.GC(repo); !errors.Is(err, internal.ErrorObjectFormatNotGit) {
+			t.Errorf("Expected the git object format to be required, got %v", err)
+		}
+	})
+}
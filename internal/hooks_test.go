@@ -0,0 +1,26 @@
+package internal
+
+import (
+	"os"
+	"time"
+)
+
+// Interrupt the atomic writes once the data is in the temporary file, as a killed process would.
+// Returns the function restoring the writes.
+func InterruptWritesTesting(interrupt func(tmpPath string) error) func() {
+	former := beforeRename
+	beforeRename = interrupt
+	return func() { beforeRename = former }
+}
+
+// Wait this long for the locks held by another process. Returns the function restoring the timeout.
+func LockTimeoutTesting(timeout time.Duration) func() {
+	former := lockTimeout
+	lockTimeout = timeout
+	return func() { lockTimeout = former }
+}
+
+// Break the lock inspected before, as if another process took it over in between. See breakLock.
+func BreakLockTesting(lockPath string, inspected os.FileInfo, content []byte) bool {
+	return breakLock(lockPath, inspected, content)
+}
@@ -0,0 +1,293 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	// The ignore file of a folder, read for the paths under the folder.
+	ignoreFileName = ".gotignore"
+	// The rules of the repository not shared with the others, as git's info/exclude.
+	infoExcludeFile = "info/exclude"
+)
+
+// A rule of an ignore file matching a path. The rule is a negation when the path is not ignored.
+type IgnoreMatch struct {
+	// The path as it was given.
+	Path string
+	// The file of the rule: a .gotignore relative to the worktree, .got/info/exclude or the global excludes file.
+	Source string
+	// The line of the rule in its file, from 1.
+	Line int
+	// The rule as it is written.
+	Pattern string
+	// Whether the path is ignored. A negation, "!rule", makes the path not ignored.
+	Ignored bool
+}
+
+// A line of an ignore file, as gitignore reads it.
+type ignoreRule struct {
+	source  string
+	line    int
+	pattern string
+	// The folder of the .gotignore, relative to the worktree. The rules are relative to it, empty for the worktree.
+	base    string
+	negate  bool
+	dirOnly bool
+	// A rule with a slash other than the trailing one matches the path relative to base, the others match its name.
+	anchored bool
+	regex    *regexp.Regexp
+}
+
+// The ignore rules of the worktree. The .gotignore files are read the first time a path of their folder is matched.
+//
+// The rules are looked up as git does, the last rule matching the path decides, and:
+//   - The rules of a .gotignore take precedence over the ones of its parent folders, which take precedence over
+//     .got/info/exclude, which take precedence over the global excludes file, core.excludesfile in the config.
+//   - A file can't be included again when a parent folder is ignored.
+type Ignore struct {
+	repo *GotRepository
+	// The rules of .got/info/exclude after the ones of the global excludes file.
+	excludes []ignoreRule
+	// The rules of the .gotignore of each folder, by folder.
+	folders map[string][]ignoreRule
+}
+
+// Read the global excludes file and .got/info/exclude. Without core.excludesfile in the config, the global excludes
+// file is $XDG_CONFIG_HOME/got/ignore, or ~/.config/got/ignore.
+func NewIgnore(repo *GotRepository) (*Ignore, error) {
+	ignore := &Ignore{repo: repo, folders: make(map[string][]ignoreRule)}
+	global := repo.GetConfiguration().Core.ExcludesFile
+	home, _ := os.UserHomeDir()
+	switch {
+	case global == "" && os.Getenv("XDG_CONFIG_HOME") != "":
+		global = filepath.Join(os.Getenv("XDG_CONFIG_HOME"), "got", "ignore")
+	case global == "" && home != "":
+		global = filepath.Join(home, ".config", "got", "ignore")
+	case strings.HasPrefix(global, "~/") && home != "":
+		global = filepath.Join(home, global[2:])
+	case global != "" && !filepath.IsAbs(global):
+		global = filepath.Join(repo.GotTree, global)
+	}
+	for _, file := range []struct{ path, source string }{
+		{global, global},
+		{filepath.Join(repo.GotDir, infoExcludeFile), filepath.ToSlash(filepath.Join(gotRootRepositoryDir, infoExcludeFile))},
+	} {
+		if file.path == "" {
+			continue
+		}
+		rules, err := readIgnoreFile(file.path, file.source, "")
+		if err != nil {
+			return nil, err
+		}
+		ignore.excludes = append(ignore.excludes, rules...)
+	}
+	return ignore, nil
+}
+
+// The rule deciding whether the path, relative to the worktree with forward slashes, is ignored. False when no rule
+// matches it.
+func (ignore *Ignore) Match(path string, isDir bool) (IgnoreMatch, bool) {
+	// What it does: a file of an ignored folder is ignored, whatever its own rules are.
+	parts := strings.Split(path, "/")
+	for i := 1; i < len(parts); i++ {
+		if match, ok := ignore.matchPath(strings.Join(parts[:i], "/"), true); ok && match.Ignored {
+			return match, true
+		}
+	}
+	return ignore.matchPath(path, isDir)
+}
+
+// Whether the path is ignored. The files of the ignored folders are.
+func (ignore *Ignore) Ignored(path string, isDir bool) bool {
+	match, ok := ignore.Match(path, isDir)
+	return ok && match.Ignored
+}
+
+// The last rule matching the path, its parent folders aside.
+func (ignore *Ignore) matchPath(path string, isDir bool) (IgnoreMatch, bool) {
+	// Implementation to try the rules from the highest precedence: the .gotignore of the deepest folder first.
+	folders := []string{""}
+	parts := strings.Split(path, "/")
+	for i := 1; i < len(parts); i++ {
+		folders = append(folders, strings.Join(parts[:i], "/"))
+	}
+	for i := len(folders) - 1; i >= 0; i-- {
+		if rule, ok := lastMatchingRule(ignore.folderRules(folders[i]), path, isDir); ok {
+			return rule.match(path), true
+		}
+	}
+	if rule, ok := lastMatchingRule(ignore.excludes, path, isDir); ok {
+		return rule.match(path), true
+	}
+	return IgnoreMatch{}, false
+}
+
+// The rules of the .gotignore of the folder. A missing or unreadable file has none.
+func (ignore *Ignore) folderRules(folder string) []ignoreRule {
+	if rules, ok := ignore.folders[folder]; ok {
+		return rules
+	}
+	source := path.Join(folder, ignoreFileName)
+	rules, _ := readIgnoreFile(filepath.Join(ignore.repo.GotTree, filepath.FromSlash(source)), source, folder)
+	ignore.folders[folder] = rules
+	return rules
+}
+
+// Read the rules of an ignore file. A missing file has none.
+func readIgnoreFile(filePath string, source string, base string) ([]ignoreRule, error) {
+	content, err := os.ReadFile(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	rules := make([]ignoreRule, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for line := 1; scanner.Scan(); line++ {
+		if rule, ok := parseIgnoreRule(scanner.Text(), base); ok {
+			rule.source, rule.line = source, line
+			rules = append(rules, rule)
+		}
+	}
+	return rules, scanner.Err()
+}
+
+// Parse a line of an ignore file as gitignore does:
+//   - Blank lines and lines starting with "#" are skipped. "\#" and "\!" start a rule with "#" and "!".
+//   - The trailing spaces are dropped, unless escaped with a backslash.
+//   - "!" negates the rule, the paths it matches are not ignored.
+//   - A trailing "/" matches folders only.
+//   - A leading or middle "/" anchors the rule to the folder of the file, the other rules match the name at any depth.
+//   - "*" and "?" don't match "/". "**/" matches any number of folders, a trailing "/**" everything inside.
+func parseIgnoreRule(line string, base string) (ignoreRule, bool) {
+	line = strings.TrimRight(line, "\r")
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+	rule := ignoreRule{pattern: line, base: base}
+	pattern := line
+	if strings.HasPrefix(pattern, "!") {
+		rule.negate, pattern = true, pattern[1:]
+	} else if strings.HasPrefix(pattern, `\!`) || strings.HasPrefix(pattern, `\#`) {
+		pattern = pattern[1:]
+	}
+	if strings.HasSuffix(pattern, "/") {
+		rule.dirOnly, pattern = true, strings.TrimRight(pattern, "/")
+	}
+	rule.anchored = strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+	if pattern == "" {
+		return ignoreRule{}, false
+	}
+	regex, err := regexp.Compile(ignoreRegexp(pattern))
+	if err != nil {
+		return ignoreRule{}, false
+	}
+	rule.regex = regex
+	return rule, true
+}
+
+// Convert a gitignore pattern into a regular expression matching the whole path.
+func ignoreRegexp(pattern string) string {
+	var expr strings.Builder
+	expr.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/") && (i == 0 || pattern[i-1] == '/'):
+			expr.WriteString("(?:.*/)?")
+			i += 2
+		case pattern[i:] == "**" && i > 0 && pattern[i-1] == '/':
+			expr.WriteString(".*")
+			i++
+		case c == '*':
+			expr.WriteString("[^/]*")
+		case c == '?':
+			expr.WriteString("[^/]")
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			expr.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		case c == '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				expr.WriteString(regexp.QuoteMeta("["))
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expr.WriteString("$")
+	return expr.String()
+}
+
+// The last rule of the list matching the path.
+func lastMatchingRule(rules []ignoreRule, path string, isDir bool) (ignoreRule, bool) {
+	for i := len(rules) - 1; i >= 0; i-- {
+		if rules[i].matches(path, isDir) {
+			return rules[i], true
+		}
+	}
+	return ignoreRule{}, false
+}
+
+func (rule ignoreRule) matches(path string, isDir bool) bool {
+	if rule.dirOnly && !isDir {
+		return false
+	}
+	rel := path
+	if rule.base != "" {
+		if !strings.HasPrefix(path, rule.base+"/") {
+			return false
+		}
+		rel = path[len(rule.base)+1:]
+	}
+	if !rule.anchored {
+		rel = rel[strings.LastIndexByte(rel, '/')+1:]
+	}
+	return rule.regex.MatchString(rel)
+}
+
+func (rule ignoreRule) match(path string) IgnoreMatch {
+	return IgnoreMatch{Path: path, Source: rule.source, Line: rule.line, Pattern: rule.pattern, Ignored: !rule.negate}
+}
+
+// The rules matching the paths, relative to the folder pwd inside the worktree, with the paths as they were given.
+// The paths no rule matches are left out.
+func CheckIgnore(repo *GotRepository, pwd string, paths []string) ([]IgnoreMatch, error) {
+	ignore, err := NewIgnore(repo)
+	if err != nil {
+		return nil, err
+	}
+	matches := make([]IgnoreMatch, 0)
+	for _, given := range paths {
+		spec, err := newPathspec(repo, pwd, given)
+		if err != nil {
+			return nil, err
+		}
+		isDir := strings.HasSuffix(given, "/") || pathExist(filepath.Join(repo.GotTree, filepath.FromSlash(spec.path)), true)
+		if match, ok := ignore.Match(spec.path, isDir); ok {
+			match.Path = given
+			matches = append(matches, match)
+		}
+	}
+	return matches, nil
+}
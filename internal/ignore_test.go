@@ -0,0 +1,135 @@
+package internal_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	internal "github.com/danielrrv/got/internal"
+)
+
+func TestIgnore(t *testing.T) {
+	// What it does: the global excludes file of the user running the tests is not read.
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	t.Run("gitignore rules", func(t *testing.T) {
+		tmp := t.TempDir()
+		repo, _ := internal.FindOrCreateRepo(tmp)
+		CreateFilesTesting(tmp, []string{"src/build", "docs"}, []TestingFile{
+			{RelativePath: ".gotignore", Data: []byte("# comment\n*.log\n!keep.log\n/root.txt\nbuild/\nsrc/**/gen.go\n\\#hash\n")},
+			{RelativePath: "src/.gotignore", Data: []byte("!debug.log\n*.tmp\n")},
+		})
+		ignore, err := internal.NewIgnore(repo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cases := []struct {
+			path    string
+			isDir   bool
+			ignored bool
+		}{
+			{"a.log", false, true},
+			{"docs/deep/a.log", false, true},
+			{"keep.log", false, false},
+			{"src/debug.log", false, false},
+			{"src/a.tmp", false, true},
+			{"a.tmp", false, false},
+			{"root.txt", false, true},
+			{"docs/root.txt", false, false},
+			{"src/build", true, true},
+			{"build", false, false},
+			{"src/build/keep.log", false, true},
+			{"src/gen.go", false, true},
+			{"src/a/b/gen.go", false, true},
+			{"gen.go", false, false},
+			{"#hash", false, true},
+			{"main.go", false, false},
+		}
+		for _, c := range cases {
+			if ignored := ignore.Ignored(c.path, c.isDir); ignored != c.ignored {
+				t.Errorf("Expected %s ignored %v, got %v", c.path, c.ignored, ignored)
+			}
+		}
+		match, ok := ignore.Match("src/debug.log", false)
+		if !ok || match.Source != "src/.gotignore" || match.Line != 1 || match.Pattern != "!debug.log" {
+			t.Errorf("Expected the negation of the folder to decide, got %+v", match)
+		}
+		match, _ = ignore.Match("src/build/keep.log", false)
+		if match.Pattern != "build/" || match.Line != 5 {
+			t.Errorf("Expected the ignored folder to decide for its files, got %+v", match)
+		}
+	})
+
+	t.Run("info/exclude and the global excludes file", func(t *testing.T) {
+		tmp := t.TempDir()
+		repo, _ := internal.FindOrCreateRepo(tmp)
+		global := filepath.Join(t.TempDir(), "ignore")
+		os.WriteFile(global, []byte("*.bak\n*.swp\n"), 0644)
+		updateConfigTesting(t, repo, func(config *internal.GotConfig) {
+			config.Core.ExcludesFile = global
+		})
+		os.MkdirAll(filepath.Join(repo.GotDir, "info"), 0755)
+		os.WriteFile(filepath.Join(repo.GotDir, "info", "exclude"), []byte("!a.bak\nsecret\n"), 0644)
+		os.WriteFile(filepath.Join(tmp, ".gotignore"), []byte("!secret\n"), 0644)
+		ignore, err := internal.NewIgnore(repo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ignore.Ignored("b.bak", false) || !ignore.Ignored("x.swp", false) {
+			t.Errorf("Expected the rules of the global excludes file")
+		}
+		if ignore.Ignored("a.bak", false) {
+			t.Errorf("Expected .got/info/exclude to take precedence over the global excludes file")
+		}
+		if ignore.Ignored("secret", false) {
+			t.Errorf("Expected .gotignore to take precedence over .got/info/exclude")
+		}
+		match, _ := ignore.Match("b.bak", false)
+		if match.Source != global || match.Line != 1 {
+			t.Errorf("Expected the global excludes file as source, got %+v", match)
+		}
+	})
+
+	t.Run("status, add and check-ignore respect the rules", func(t *testing.T) {
+		tmp := t.TempDir()
+		repo, _ := internal.FindOrCreateRepo(tmp)
+		CreateFilesTesting(tmp, []string{"node_modules/lib", "src"}, []TestingFile{
+			{RelativePath: ".gotignore", Data: []byte("node_modules/\n*.o\n")},
+			{RelativePath: "node_modules/lib/index.js", Data: []byte("js\n")},
+			{RelativePath: "src/main.c", Data: []byte("int main;\n")},
+			{RelativePath: "src/main.o", Data: []byte("obj\n")},
+			{RelativePath: "src/vendored.o", Data: []byte("obj\n")},
+		})
+		if _, err := internal.Add(repo, tmp, []string{"src/vendored.o"}, internal.AddOptions{}); !errors.Is(err, internal.ErrorPathIgnored) {
+			t.Errorf("Expected the ignored file named refused, got %v", err)
+		}
+		if _, err := internal.Add(repo, tmp, []string{"src/vendored.o"}, internal.AddOptions{Force: true}); err != nil {
+			t.Fatal(err)
+		}
+		os.WriteFile(filepath.Join(tmp, "src/vendored.o"), []byte("obj changed\n"), 0644)
+		result, err := internal.Add(repo, tmp, []string{"."}, internal.AddOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(result.Added, []string{".gotignore", "src/main.c", "src/vendored.o"}) {
+			t.Errorf("Expected the ignored files left out but the tracked one, got %v", result.Added)
+		}
+
+		os.WriteFile(filepath.Join(tmp, "new.o"), []byte("obj\n"), 0644)
+		os.WriteFile(filepath.Join(tmp, "new.c"), []byte("int x;\n"), 0644)
+		status := statusTesting(t, repo)
+		if !slices.Equal(status.Untracked, []string{"new.c"}) {
+			t.Errorf("Expected the ignored files out of the untracked files, got %v", status.Untracked)
+		}
+
+		matches, err := internal.CheckIgnore(repo, filepath.Join(tmp, "src"), []string{"main.o", "main.c", "../node_modules/lib/index.js"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(matches) != 2 || matches[0].Path != "main.o" || matches[0].Pattern != "*.o" || matches[1].Pattern != "node_modules/" {
+			t.Errorf("Expected the rules of the ignored paths, got %+v", matches)
+		}
+	})
+}
@@ -0,0 +1,250 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const (
+	gitRepositoryDir = ".git"
+	gitPackedRefs    = "packed-refs"
+)
+
+var (
+	// The path is neither a git worktree nor a bare git repository.
+	ErrorNotGitRepository = errors.New("not a git repository")
+	// The objects of git can only be imported into or exported from a repository of the git object format.
+	ErrorObjectFormatNotGit = errors.New("the objects must be in git format, run got migrate-objects first")
+)
+
+type ImportResult struct {
+	// Objects written into got.
+	Converted int
+	// Objects got has already, imported by a former run.
+	Skipped int
+	// The references mirrored, refs/heads/main.
+	Refs []string
+	// The references of got left as they were: they exist already and the one of git isn't a fast-forward of them.
+	Kept []string
+}
+
+// Import the objects, branches, tags and HEAD of the git repository at path. The path is either the
+// worktree holding the .git folder or a bare repository.
+//
+// Loose objects and packs are read, the objects got has already are skipped so that later runs only
+// convert the new ones. A branch of got is only moved forward, a tag never: the refs that would be rewritten
+// are kept and listed in the result. HEAD is imported only when got has no commit yet, and then the worktree
+// and the index are checked out from it.
+func ImportGit(repo *GotRepository, path string) (*ImportResult, error) {
+	if repo.ObjectFormat().Name() != ObjectFormatGit {
+		return nil, ErrorObjectFormatNotGit
+	}
+	gitDir, err := findGitDir(path)
+	if err != nil {
+		return nil, err
+	}
+	result := &ImportResult{Refs: make([]string, 0), Kept: make([]string, 0)}
+	unborn := repo.GetHEADReference().Invalid
+	objectsDir := filepath.Join(gitDir, gotRepositoryDirObjects)
+	hashes, err := listLooseObjects(objectsDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, hash := range hashes {
+		err := importObject(repo, result, hash, func() (string, []byte, error) {
+			return readLooseObject(filepath.Join(objectsDir, hash[:2], hash[2:]), gitFormat{})
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	packs, err := openPacks(objectsDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, pack := range packs {
+		defer pack.Close()
+	}
+	for _, pack := range packs {
+		for _, hash := range pack.Hashes() {
+			if err := importObject(repo, result, hash, func() (string, []byte, error) { return pack.Read(hash) }); err != nil {
+				return nil, err
+			}
+		}
+	}
+	refs, err := readRefs(gitDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range refs {
+		if content, err := os.ReadFile(filepath.Join(repo.GotDir, ref.name)); err == nil {
+			current := strings.TrimSpace(string(content))
+			isBranch := strings.HasPrefix(ref.name, gotRepositoryDirRefs+"/"+gotRepositoryDirRefsHeads+"/")
+			if current != ref.hash && (!isBranch || !IsAncestor(repo, current, ref.hash)) {
+				result.Kept = append(result.Kept, ref.name)
+				continue
+			}
+		}
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(repo.GotDir, ref.name)), 0755); err != nil {
+			return nil, err
+		}
+		if err := CreateOrUpdateRepoFile(repo, ref.name, []byte(ref.hash)); err != nil {
+			return nil, err
+		}
+		result.Refs = append(result.Refs, ref.name)
+	}
+	if !unborn {
+		return result, nil
+	}
+	if err := importGitHEAD(repo, gitDir); err != nil {
+		return nil, err
+	}
+	// What it does: the worktree gets the files of HEAD as a checkout from an empty commit would, refused when an
+	// untracked file is in the way.
+	if ref := repo.GetHEADReference(); !ref.Invalid {
+		target := flattenTreeItems(repo, ReadCommit(repo, ref.Reference).Tree)
+		if err := checkoutTrees(repo, make(map[string]TreeItem), target, false); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// Find the git folder of the worktree, or the path itself when it is a bare repository.
+func findGitDir(path string) (string, error) {
+	if dir := filepath.Join(path, gitRepositoryDir); pathExist(dir, true) {
+		return dir, nil
+	}
+	if pathExist(filepath.Join(path, gotRepositoryDirObjects), true) && pathExist(filepath.Join(path, "HEAD"), false) {
+		return path, nil
+	}
+	return "", fmt.Errorf("%s: %w", path, ErrorNotGitRepository)
+}
+
+// Write the object into got unless it is there already. The object id is checked against the data.
+func importObject(repo *GotRepository, result *ImportResult, hash string, read func() (string, []byte, error)) error {
+	if repo.HasObject(hash) {
+		result.Skipped++
+		return nil
+	}
+	header, data, err := read()
+	if err != nil {
+		return fmt.Errorf("%s: %w", hash, err)
+	}
+	if !slices.Contains([]string{BlobHeaderName, TreeHeaderName, CommitHeaderName, TagHeaderName}, header) {
+		return fmt.Errorf("%s: %w", hash, ErrorIncorrectOBjectType)
+	}
+	// What it does: a tree whose entries would be written out of the worktree or into the repository folder is refused.
+	if header == TreeHeaderName {
+		tree, err := gitFormat{}.DecodeTree(TreeItem{Mode: TreeMode}, data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", hash, err)
+		}
+		for _, child := range tree.Children {
+			if !validTreeEntryName(child.Path) {
+				return fmt.Errorf("%s: %w: %q", hash, ErrorInvalidTreePath, child.Path)
+			}
+		}
+	}
+	written, err := writeObjectWith(repo, gitFormat{}, rawData(data), header)
+	if err != nil {
+		return err
+	}
+	if written != hash {
+		RemoveObjectFrom(repo, written)
+		return fmt.Errorf("%s: %w", hash, ErrorCorruptedData)
+	}
+	result.Converted++
+	return nil
+}
+
+type gitRef struct {
+	// Full name, refs/heads/main.
+	name string
+	hash string
+}
+
+// Read the branches and tags of the git or got folder, sorted by name. The loose refs take precedence over
+// the packed ones.
+func readRefs(gitDir string) ([]gitRef, error) {
+	refs := make(map[string]string)
+	packed, err := os.Open(filepath.Join(gitDir, gitPackedRefs))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		defer packed.Close()
+		scanner := bufio.NewScanner(packed)
+		for scanner.Scan() {
+			// What it does: "#" starts the header and "^" the peeled object of the tag above.
+			line := scanner.Text()
+			if strings.HasPrefix(line, "#") || strings.HasPrefix(line, "^") {
+				continue
+			}
+			if hash, name, ok := strings.Cut(line, " "); ok {
+				refs[name] = hash
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	for _, kind := range []string{gotRepositoryDirRefsHeads, gotRepositoryDirRefsTags} {
+		root := filepath.Join(gitDir, gotRepositoryDirRefs, kind)
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			name, _ := filepath.Rel(gitDir, path)
+			refs[filepath.ToSlash(name)] = string(bytes.TrimSpace(content))
+			return nil
+		})
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	sorted := make([]gitRef, 0, len(refs))
+	for name, hash := range refs {
+		isBranchOrTag := strings.HasPrefix(name, gotRepositoryDirRefs+"/"+gotRepositoryDirRefsHeads+"/") ||
+			strings.HasPrefix(name, gotRepositoryDirRefs+"/"+gotRepositoryDirRefsTags+"/")
+		if !isBranchOrTag || ValidateRefName(name) != nil || len(hash) != 40 || !isHexString(hash) {
+			continue
+		}
+		sorted = append(sorted, gitRef{name: name, hash: hash})
+	}
+	slices.SortFunc(sorted, func(a, b gitRef) int {
+		return cmp.Compare(a.name, b.name)
+	})
+	return sorted, nil
+}
+
+// Point HEAD where the HEAD of git points, a branch or a detached commit.
+func importGitHEAD(repo *GotRepository, gitDir string) error {
+	content, err := os.ReadFile(filepath.Join(gitDir, "HEAD"))
+	if err != nil {
+		return err
+	}
+	head := strings.TrimSpace(string(content))
+	prefix := "ref: " + gotRepositoryDirRefs + "/" + gotRepositoryDirRefsHeads + "/"
+	if branch, ok := strings.CutPrefix(head, prefix); ok && validateBranchName(branch) == nil {
+		ref := Ref{IsDirect: false, Reference: branch}
+		return ref.WriteRef(repo)
+	}
+	if len(head) == 40 && isHexString(head) {
+		ref := Ref{IsDirect: true, Reference: head}
+		return ref.WriteRef(repo)
+	}
+	return fmt.Errorf("HEAD %q: %w", head, ErrorInvalidRefName)
+}
@@ -0,0 +1,273 @@
+package internal_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	internal "github.com/danielrrv/got/internal"
+)
+
+// Build a git repository with a nested tree, an executable file, a branch and both kinds of tags.
+func gitFixtureTesting(t *testing.T) string {
+	dir := t.TempDir()
+	gitTesting(t, dir, "init", "-q", "-b", "main")
+	CreateFilesTesting(dir, []string{"src/lib"}, []TestingFile{
+		{Name: "a.txt", RelativePath: "a.txt", Data: []byte("1\n2\n3\n")},
+		{Name: "b.c", RelativePath: "src/lib/b.c", Data: []byte("hello\n")},
+	})
+	if err := os.WriteFile(filepath.Join(dir, "run.sh"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	gitTesting(t, dir, "add", ".")
+	gitTesting(t, dir, "commit", "-q", "-m", "first")
+	gitTesting(t, dir, "tag", "-a", "v1", "-m", "release v1")
+	gitTesting(t, dir, "checkout", "-q", "-b", "feature")
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("one\n2\n3\n"), 0644)
+	gitTesting(t, dir, "commit", "-q", "-am", "feature")
+	gitTesting(t, dir, "tag", "light")
+	gitTesting(t, dir, "checkout", "-q", "main")
+	return dir
+}
+
+func TestImportGit(t *testing.T) {
+	t.Run("import loose objects and refs", func(t *testing.T) {
+		dir := gitFixtureTesting(t)
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := internal.ImportGit(repo, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		objects := strings.Fields(gitTesting(t, dir, "rev-list", "--all", "--objects", "--no-object-names"))
+		if result.Converted != len(objects) || result.Skipped != 0 {
+			t.Errorf("Expected %d objects converted, got %d and %d skipped", len(objects), result.Converted, result.Skipped)
+		}
+		if !slices.Equal(result.Refs, []string{"refs/heads/feature", "refs/heads/main", "refs/tags/light", "refs/tags/v1"}) {
+			t.Errorf("Expected the branches and tags, got %v", result.Refs)
+		}
+		for rev, expected := range map[string]string{"HEAD": "main", "feature": "feature", "v1": "v1^{commit}", "light": "feature"} {
+			hash, err := internal.ResolveRevision(repo, rev)
+			if err != nil || hash != gitTesting(t, dir, "rev-parse", expected) {
+				t.Errorf("Expected %s to resolve as git does, got %s %v", rev, hash, err)
+			}
+		}
+		if branch, ok := repo.GetHEADBranch(); !ok || branch != "main" {
+			t.Errorf("Expected HEAD to point to main, got %s", branch)
+		}
+		tagId, _ := os.ReadFile(filepath.Join(repo.GotDir, "refs", "tags", "v1"))
+		raw, err := internal.ReadObject(repo, internal.TagHeaderName, string(tagId))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tag := internal.Tag{}.Deserialize(raw)
+		if tag.Name != "v1" || tag.Type != internal.CommitHeaderName || tag.Tagger.Name != "Ada" || tag.Message != "release v1\n" {
+			t.Errorf("Expected the annotated tag, got %+v", tag)
+		}
+		entries, err := internal.Log(repo, "feature", internal.LogOptions{})
+		if err != nil || len(entries) != 2 || entries[0].Commit.Description != "feature\n" {
+			t.Errorf("Expected the history of feature, got %v %v", entries, err)
+		}
+		head, _ := internal.ResolveRevision(repo, "HEAD")
+		tree := internal.ReadTree(repo, internal.ReadCommit(repo, head).Tree)
+		blobs := tree.FlatItems()
+		if i := slices.IndexFunc(blobs, func(ti internal.TreeItem) bool { return ti.Path == "run.sh" }); i < 0 || !bytes.Equal(blobs[i].Mode, internal.ExecutableMode) {
+			t.Errorf("Expected the executable mode to be kept, got %v", blobs)
+		}
+		if content, err := internal.ReadBlob(repo, blobs[slices.IndexFunc(blobs, func(ti internal.TreeItem) bool { return ti.Path == "src/lib/b.c" })].Hash); err != nil || string(content) != "hello\n" {
+			t.Errorf("Expected the nested blob, got %q %v", content, err)
+		}
+		if len(repo.Index.Entries) != 3 {
+			t.Errorf("Expected the index to be filled from HEAD, got %v", repo.Index.Entries)
+		}
+		if content := readFileTesting(repo, "src/lib/b.c"); content != "hello\n" || !statusTesting(t, repo).Clean() {
+			t.Errorf("Expected the worktree checked out from HEAD, got %q", content)
+		}
+	})
+
+	t.Run("a second run only converts the new objects", func(t *testing.T) {
+		dir := gitFixtureTesting(t)
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		first, err := internal.ImportGit(repo, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		again, err := internal.ImportGit(repo, dir)
+		if err != nil || again.Converted != 0 || again.Skipped != first.Converted {
+			t.Errorf("Expected nothing new, got %+v %v", again, err)
+		}
+		// A new commit of one file at the root: blob, root tree and commit. Everything packed.
+		os.WriteFile(filepath.Join(dir, "new.txt"), []byte("new\n"), 0644)
+		gitTesting(t, dir, "add", "new.txt")
+		gitTesting(t, dir, "commit", "-q", "-m", "new")
+		gitTesting(t, dir, "gc", "-q")
+		next, err := internal.ImportGit(repo, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if next.Converted != 3 || next.Skipped != first.Converted {
+			t.Errorf("Expected the 3 new objects only, got %+v", next)
+		}
+		head, _ := internal.ResolveRevision(repo, "main")
+		if head != gitTesting(t, dir, "rev-parse", "main") {
+			t.Errorf("Expected main to move to the new commit")
+		}
+	})
+
+	t.Run("keep the refs and HEAD of got", func(t *testing.T) {
+		dir := gitFixtureTesting(t)
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		own := commitWorktreeTesting(t, repo, "own", []TestingFile{{Name: "own.txt", RelativePath: "own.txt", Data: []byte("own\n")}})
+		result, err := internal.ImportGit(repo, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(result.Kept, []string{"refs/heads/main"}) || slices.Contains(result.Refs, "refs/heads/main") {
+			t.Errorf("Expected main of got kept, got %+v", result)
+		}
+		if main, _ := internal.ResolveRevision(repo, "main"); main != own {
+			t.Errorf("Expected main not to be rewritten, got %s", main)
+		}
+		if feature, _ := internal.ResolveRevision(repo, "feature"); feature != gitTesting(t, dir, "rev-parse", "feature") {
+			t.Errorf("Expected the new branch imported, got %s", feature)
+		}
+		if pathExistTesting(filepath.Join(repo.GotTree, "a.txt")) || len(repo.Index.Entries) != 1 {
+			t.Errorf("Expected the worktree and the index of got untouched, got %v", repo.Index.Entries)
+		}
+	})
+
+	t.Run("keep the modes through commit and checkout", func(t *testing.T) {
+		dir := gitFixtureTesting(t)
+		if err := os.Symlink("a.txt", filepath.Join(dir, "link")); err != nil {
+			t.Fatal(err)
+		}
+		gitTesting(t, dir, "add", "link")
+		gitTesting(t, dir, "update-index", "--add", "--cacheinfo", "160000,"+gitTesting(t, dir, "rev-parse", "HEAD")+",sub")
+		gitTesting(t, dir, "commit", "-q", "-m", "modes")
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := internal.ImportGit(repo, dir); err != nil {
+			t.Fatal(err)
+		}
+		checkWorktree := func(when string) {
+			if fi, err := os.Lstat(filepath.Join(repo.GotTree, "run.sh")); err != nil || fi.Mode().Perm()&0100 == 0 {
+				t.Errorf("Expected run.sh executable %s, got %v", when, err)
+			}
+			if target, err := os.Readlink(filepath.Join(repo.GotTree, "link")); err != nil || target != "a.txt" {
+				t.Errorf("Expected the symbolic link %s, got %q %v", when, target, err)
+			}
+			if !pathExistTesting(filepath.Join(repo.GotTree, "sub")) {
+				t.Errorf("Expected the folder of the submodule %s", when)
+			}
+		}
+		checkWorktree("after the import")
+		if status := statusTesting(t, repo); !status.Clean() {
+			t.Errorf("Expected a clean worktree, got %+v", status.Entries)
+		}
+		commit := commitWorktreeTesting(t, repo, "own", []TestingFile{{Name: "own.txt", RelativePath: "own.txt", Data: []byte("own\n")}})
+		modes := make(map[string]string)
+		tree := internal.ReadTree(repo, internal.ReadCommit(repo, commit).Tree)
+		for _, item := range tree.FlatItems() {
+			modes[item.Path] = string(item.Mode)
+		}
+		for path, mode := range map[string]string{"run.sh": "100755", "link": "120000", "sub": "160000", "a.txt": "100644", "own.txt": "100644"} {
+			if modes[path] != mode {
+				t.Errorf("Expected %s committed as %s, got %v", path, mode, modes)
+			}
+		}
+		if _, err := internal.Checkout(repo, "v1", false); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Lstat(filepath.Join(repo.GotTree, "link")); err == nil {
+			t.Errorf("Expected the symbolic link removed")
+		}
+		if _, err := internal.Checkout(repo, "main", false); err != nil {
+			t.Fatal(err)
+		}
+		checkWorktree("after the checkout")
+	})
+
+	t.Run("refuse unsafe trees", func(t *testing.T) {
+		dir := t.TempDir()
+		gitTesting(t, dir, "init", "-q", "-b", "main")
+		CreateFilesTesting(dir, []string{".got"}, []TestingFile{{Name: "config", RelativePath: ".got/config", Data: []byte("owned\n")}})
+		gitTesting(t, dir, "add", ".got/config")
+		gitTesting(t, dir, "commit", "-q", "-m", "unsafe")
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := internal.ImportGit(repo, dir); !errors.Is(err, internal.ErrorInvalidTreePath) {
+			t.Errorf("Expected the tree with a .got folder refused, got %v", err)
+		}
+	})
+
+	t.Run("import a bare repository with deltas", func(t *testing.T) {
+		dir := t.TempDir()
+		gitTesting(t, dir, "init", "-q", "-b", "main")
+		lines := make([]string, 0)
+		for i := 0; i < 200; i++ {
+			lines = append(lines, strings.Repeat("line of the long lived config file ", 2)+string(rune('a'+i%26)))
+		}
+		for i := 0; i < 5; i++ {
+			lines[i*40] = "edited"
+			os.WriteFile(filepath.Join(dir, "config.txt"), []byte(strings.Join(lines, "\n")), 0644)
+			gitTesting(t, dir, "add", "config.txt")
+			gitTesting(t, dir, "commit", "-q", "-m", "edit")
+		}
+		bare := filepath.Join(t.TempDir(), "bare.git")
+		gitTesting(t, dir, "clone", "-q", "--bare", dir, bare)
+		gitTesting(t, bare, "repack", "-q", "-a", "-d", "-f", "--depth=10")
+		idx, _ := filepath.Glob(filepath.Join(bare, "objects", "pack", "*.idx"))
+		if len(idx) != 1 || !strings.Contains(gitTesting(t, bare, "verify-pack", "-v", idx[0]), "chain length") {
+			t.Skip("git packed no delta")
+		}
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := internal.ImportGit(repo, bare); err != nil {
+			t.Fatal(err)
+		}
+		entries, err := internal.Log(repo, "main", internal.LogOptions{})
+		if err != nil || len(entries) != 5 {
+			t.Fatalf("Expected the 5 commits, got %d %v", len(entries), err)
+		}
+		for _, entry := range entries {
+			tree := internal.ReadTree(repo, entry.Commit.Tree)
+			blobs := tree.FlatItems()
+			content, err := internal.ReadBlob(repo, blobs[0].Hash)
+			if err != nil || string(content) != gitTesting(t, bare, "show", entry.Hash+":config.txt") {
+				t.Errorf("Expected the blob of %s rebuilt from its delta, got %v", entry.Hash, err)
+			}
+		}
+	})
+
+	t.Run("refuse the former object format and non git folders", func(t *testing.T) {
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := internal.ImportGit(repo, t.TempDir()); !errors.Is(err, internal.ErrorNotGitRepository) {
+			t.Errorf("Expected not a git repository, got %v", err)
+		}
+		setObjectFormatTesting(t, repo, internal.ObjectFormatGot)
+		if _, err := internal.ImportGit(repo, t.TempDir()); !errors.Is(err, internal.ErrorObjectFormatNotGit) {
+			t.Errorf("Expected the git object format to be required, got %v", err)
+		}
+	})
+}
@@ -5,9 +5,8 @@ import (
 	"crypto/sha1"
 	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"fmt"
-
-	// "fmt"
 	"os"
 	"path/filepath"
 	"slices"
@@ -32,9 +31,15 @@ const (
 
 var (
 	// Index signature
-	Signature = Byte4{'D', 'I', 'R', 'C'}
-	// Index version
-	IndexVersion = Byte4{'1', '1', '1', '2'}
+	IndexSignature = Byte4{'D', 'I', 'R', 'C'}
+	// Index version. The entries carry the whole stat data of the files, the index ends with its checksum.
+	IndexVersion = Byte4{'1', '1', '1', '4'}
+	// The former versions, followed by the cache of the staged content. The first one's entries carry the ctime,
+	// mtime and size only.
+	indexVersionShortStat = Byte4{'1', '1', '1', '2'}
+	indexVersionCache     = Byte4{'1', '1', '1', '3'}
+	// The index file can't be read.
+	ErrorCorruptIndex = errors.New("corrupt index")
 )
 
 type Byte4 [blockSize]byte
@@ -79,44 +84,37 @@ func Bit32FromBytes(v []byte) Bit32 {
 	return (Bit32)(binary.BigEndian.Uint32(v))
 }
 
+// The stat data tells whether the file changed since it was added without reading it, see statMatches.
 type IndexEntry struct {
 	// the last time a file's metadata changed
 	Ctime_s Bit32
 	// the ctime nanosecond fractions
+	Ctime_ns Bit32
+	// the last time the file's content changed
 	Mtime_s Bit32
+	// the mtime nanosecond fractions
+	Mtime_ns Bit32
+	// The device and inode of the file.
+	Dev Bit32
+	Ino Bit32
+	// The git mode of the file: 100644, 100755 or 120000 in octal.
+	FileMode Bit32
+	// The owner of the file.
+	Uid Bit32
+	Gid Bit32
 	// This is the on-disk size from stat(2), truncated to 32-bit.
 	FileSize Bit32
 	// The sha1 hash of the file.
 	Hash     string //sha1
 	// The path name of the file.
 	PathName string
+	// Merge stage. 0 for regular entries, 1(base), 2(ours) and 3(theirs) for the sides of a conflict.
+	Stage uint8
 }
 func (i IndexEntry) String() string {
 	return fmt.Sprintf("PathName: %s, Hash: %s", i.PathName, i.Hash)
 }
 
-type CacheEntry struct {
-	// PathName of the file.
-	PathName              string
-	// Hash of the file.
-	Hash                  string
-	// Compressed file content.
-	CompressedFileContent []byte
-}
-
-// String representation of the cache entry.
-func (c CacheEntry) String() string {
-	return fmt.Sprintf("PathName: %s, Hash: %s", c.PathName, c.Hash)
-}
-
-// Serialize the cache entry.
-func(c CacheEntry) Serialize() []byte {
-	var bb bytes.Buffer
-	Decompress(c.CompressedFileContent, &bb)
-	return bb.Bytes()
-}
-
-
 type Index struct {
 	// Signature of the index.
 	Signature Byte4
@@ -126,21 +124,22 @@ type Index struct {
 	Size Bit32
 	// Entries of the index.
 	Entries []IndexEntry
-	Cache   []CacheEntry
+	// The modification time of the index file when it was read or written. The entries modified since are racy.
+	timestamp time.Time
+	// The content of the staged files read from an index of a former version, by hash. See upgrade.
+	legacyCache map[string][]byte
 }
 
 func (i *Index) String() string {
-	return fmt.Sprintf("Signature: %v, Version: %v, Size: %v, Entries: %v, Cache: %v", i.Signature, i.Version, i.Size, i.Entries, i.Cache)
+	return fmt.Sprintf("Signature: %v, Version: %v, Size: %v, Entries: %v", i.Signature, i.Version, i.Size, i.Entries)
 }
 
-
 func NewIndex() *Index {
 	return &Index{
-		Signature: Signature,
+		Signature: IndexSignature,
 		Version:   IndexVersion,
 		Size:      Bit32(0),
 		Entries:   nil,
-		Cache:     nil,
 	}
 }
 
@@ -155,190 +154,264 @@ func Bytes2hex(d []byte) string {
 	return hex.EncodeToString(d)
 }
 
-// Convert index non-zero pointer into bytes.
+// Convert index non-zero pointer into bytes. The staged content is in DB, the index holds the entries only:
+//
+//	[signature|version|number of entries uint32|entries...|sha1 of the former bytes]
+//
+// Each entry is the stat data, the hash and the path:
+//
+//	[ctime s|ctime ns|mtime s|mtime ns|dev|ino|mode|uid|gid|size, uint32 each]|[sha1 of 20 bytes]|[flags uint16]|[path]|[0x00]
+//
+// The flags hold the merge stage in bits 12-13 and the length of the path in the low 12 bits, 0xFFF when longer.
 func (i *Index) SerializeIndex() []byte {
 	packet := AllocatePacket(0)
 	i.Size = Bit32(len(i.Entries))
-	//[signature| version | size of entries | entries...[ctime(uint32)|mtime(uint32)|filesize(uint32)|hash|nameLength(uint32)| pathName] ]
 	packet.Set(i.Signature[:], i.Version[:], i.Size.Bytes())
 	for _, entry := range i.Entries {
-		nameLength := Bit12(len(entry.PathName))
-		packet.Set(entry.Ctime_s.Bytes(), entry.Mtime_s.Bytes())
-		packet.Set(entry.FileSize.Bytes(), Hex2bytes(entry.Hash), nameLength.Bytes(), []byte(entry.PathName))
+		// What it does: the 4 bits left by the name length hold the merge stage, as git does.
+		flags := Bit12(min(len(entry.PathName), 0xFFF)).Bytes()
+		flags[0] |= (entry.Stage & 0x3) << 4
+		packet.Set(entry.Ctime_s.Bytes(), entry.Ctime_ns.Bytes(), entry.Mtime_s.Bytes(), entry.Mtime_ns.Bytes())
+		packet.Set(entry.Dev.Bytes(), entry.Ino.Bytes(), entry.FileMode.Bytes(), entry.Uid.Bytes(), entry.Gid.Bytes())
+		packet.Set(entry.FileSize.Bytes(), Hex2bytes(entry.Hash), flags, []byte(entry.PathName))
 		packet.Set([]byte{0x00})
 	}
-	for _, cacheEntry := range i.Cache {
-		fileSizeCompressed := Bit12(len(cacheEntry.CompressedFileContent))
-		internalPacket := AllocatePacket(0)
-		// Construct the cache packet for the entry.
-		internalPacket.Set([]byte{0x13})
-		//TODO: deserialize this.
-		internalPacket.Set([]byte(cacheEntry.PathName), []byte{0x20}, Hex2bytes(cacheEntry.Hash), fileSizeCompressed.Bytes(), cacheEntry.CompressedFileContent)
-		packet.Set(internalPacket.buff)
-	}
+	sum := sha1.Sum(packet.buff)
+	packet.Set(sum[:])
 	return packet.buff
 }
 
-// Convert bytes into Index pointer.
-func (index *Index) DeserializeIndex(data []byte) {
-	if !bytes.Equal(data[0:blockSize], Signature[:]) {
-		panic("Invalid index.")
+// Convert bytes into Index pointer. The index of the former versions is read too, see deserializeLegacyIndex.
+func (index *Index) DeserializeIndex(data []byte) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = ErrorCorruptIndex
+		}
+	}()
+	if len(data) < blockSize*3 || !bytes.Equal(data[0:blockSize], IndexSignature[:]) {
+		return ErrorCorruptIndex
 	}
-	if !bytes.Equal(data[blockSize:blockSize*2], IndexVersion[:]) {
-		panic("Invalid index.")
+	switch version := Byte4(data[blockSize : blockSize*2]); version {
+	case IndexVersion:
+	case indexVersionShortStat, indexVersionCache:
+		return index.deserializeLegacyIndex(data, version)
+	default:
+		return fmt.Errorf("%w: unknown version %s", ErrorCorruptIndex, version[:])
 	}
-	index.Signature = Signature
-	index.Version = IndexVersion
+	content, sum := data[:len(data)-sha1.Size], data[len(data)-sha1.Size:]
+	if computed := sha1.Sum(content); !bytes.Equal(computed[:], sum) {
+		return fmt.Errorf("%w: checksum mismatch", ErrorCorruptIndex)
+	}
+	sizeOfEntry := Bit32FromBytes(content[blockSize*2 : blockSize*3])
+	content = content[blockSize*3:]
+	entries := make([]IndexEntry, 0, sizeOfEntry)
+	for ; sizeOfEntry > 0; sizeOfEntry-- {
+		entry := IndexEntry{}
+		stat := []*Bit32{&entry.Ctime_s, &entry.Ctime_ns, &entry.Mtime_s, &entry.Mtime_ns, &entry.Dev, &entry.Ino, &entry.FileMode, &entry.Uid, &entry.Gid, &entry.FileSize}
+		for i, field := range stat {
+			*field = Bit32FromBytes(content[blockSize*i : blockSize*(i+1)])
+		}
+		content = content[blockSize*len(stat):]
+		entry.Hash = Bytes2hex(content[:sha1.Size])
+		entry.Stage = (content[sha1.Size] >> 4) & 0x3
+		// What it does: the path ends at the terminator, its length in the flags is capped.
+		nameEnd := bytes.IndexByte(content[sha1.Size+2:], 0x00)
+		if nameEnd < 0 {
+			return ErrorCorruptIndex
+		}
+		entry.PathName = string(content[sha1.Size+2 : sha1.Size+2+nameEnd])
+		entries = append(entries, entry)
+		content = content[sha1.Size+2+nameEnd+1:]
+	}
+	if len(content) != 0 {
+		return ErrorCorruptIndex
+	}
+	index.Signature, index.Version, index.Size = IndexSignature, IndexVersion, Bit32(len(entries))
+	index.Entries = entries
+	return nil
+}
+
+// Read the index of the former versions. Their entries carry the ctime, mtime and size only (1112) or the whole stat
+// data (1113). They are followed by the compressed content of the staged files, the cache:
+//
+//	[0x13]|[path]|[0x20]|[sha1 of 20 bytes]|[compressed size uint16]|[compressed content]
+//
+// The compressed size is 12 bits: the content of more than 4095 bytes compressed is cut, see upgrade.
+func (index *Index) deserializeLegacyIndex(data []byte, version Byte4) error {
 	sizeOfEntry := Bit32FromBytes(data[blockSize*2 : blockSize*3])
 	data = data[blockSize*3:]
 	entries := make([]IndexEntry, 0)
 	for sizeOfEntry > 0 {
-		//Times
-		Ctime_s := Bit32FromBytes(data[:blockSize*1])
-		Mtime_s := Bit32FromBytes(data[blockSize*1 : blockSize*2])
-		//File
-		FileSize := Bit32FromBytes(data[blockSize*2 : blockSize*3])
-		Hash := data[blockSize*3 : (blockSize*3)+sha1.Size]
-
-		//filename length.
-		nameLength := Bit12FromBytes(data[(blockSize*3)+sha1.Size : (blockSize*3)+sha1.Size+2])
-		//34 bytes
-		PathName := string(data[(blockSize*3)+sha1.Size+2 : (blockSize*3)+sha1.Size+2+nameLength])
-		//34 + namelength
-		entries = append(entries, IndexEntry{
-			Ctime_s:  Ctime_s,
-			Mtime_s:  Mtime_s,
-			FileSize: FileSize,
-			Hash:     Bytes2hex(Hash),
-			PathName: PathName,
-		})
+		entry := IndexEntry{}
+		//Stat data, 10 fields or 3 in the first version.
+		stat := []*Bit32{&entry.Ctime_s, &entry.Ctime_ns, &entry.Mtime_s, &entry.Mtime_ns, &entry.Dev, &entry.Ino, &entry.FileMode, &entry.Uid, &entry.Gid, &entry.FileSize}
+		if version == indexVersionShortStat {
+			stat = []*Bit32{&entry.Ctime_s, &entry.Mtime_s, &entry.FileSize}
+		}
+		for i, field := range stat {
+			*field = Bit32FromBytes(data[blockSize*i : blockSize*(i+1)])
+		}
+		statSize := blockSize * len(stat)
+		entry.Hash = Bytes2hex(data[statSize : statSize+sha1.Size])
+
+		//filename length and merge stage.
+		flags := slices.Clone(data[statSize+sha1.Size : statSize+sha1.Size+2])
+		entry.Stage = (flags[0] >> 4) & 0x3
+		flags[0] &= 0x0F
+		nameLength := int(Bit12FromBytes(flags))
+		entry.PathName = string(data[statSize+sha1.Size+2 : statSize+sha1.Size+2+nameLength])
+		entries = append(entries, entry)
 		sizeOfEntry = sizeOfEntry - 1
-		data = data[(blockSize*3+sha1.Size+2+nameLength)+1:]
+		data = data[(statSize+sha1.Size+2+nameLength)+1:]
 	}
-	cache := make([]CacheEntry, 0)
-	//there caches entries.
-
-	if len(data) > 0 && data[0] == 0x13 {
+	cache := make(map[string][]byte)
+	for len(data) > 0 && data[0] == 0x13 {
 		data = data[1:]
-		for len(data) > 0 {
-			//TODO: refactor indexes.
-			pathSep := slices.Index(data[1:], byte(0x20))
-			dataCompressSize := Bit12FromBytes(data[pathSep + 1 + sha1.Size + 1 : pathSep + 1 + sha1.Size + 3])
-			cache = append(cache, CacheEntry{
-				PathName:              string(data[0 : pathSep+1]),
-				Hash:                  Bytes2hex(data[pathSep+2 : pathSep+2+sha1.Size]),
-				CompressedFileContent: data[pathSep+2+sha1.Size+2 : pathSep+2+sha1.Size+2+int(dataCompressSize)],
-			})
-			// What it does: break when no more data to consume.
-			if pathSep+2+sha1.Size+2+int(dataCompressSize) == len(data){
-				break
+		pathSep := bytes.IndexByte(data, 0x20)
+		// What it does: the rest of a cache cut in the middle is not read, the worktree may have its files.
+		if pathSep < 0 || len(data) < pathSep+1+sha1.Size+2 {
+			break
+		}
+		hash := Bytes2hex(data[pathSep+1 : pathSep+1+sha1.Size])
+		compressedSize := int(Bit12FromBytes(slices.Clone(data[pathSep+1+sha1.Size : pathSep+1+sha1.Size+2])))
+		start := pathSep + 1 + sha1.Size + 2
+		cache[hash] = data[start:min(start+compressedSize, len(data))]
+		data = data[min(start+compressedSize, len(data)):]
+	}
+	index.Signature, index.Version, index.Size = IndexSignature, IndexVersion, Bit32(len(entries))
+	index.Entries = entries
+	index.legacyCache = cache
+	return nil
+}
+
+// Write in DB the staged content an index of a former version kept in its cache, so that the entries point to
+// objects in DB. The cut content is taken from the worktree when the file is still the one staged.
+//
+// The index is written in the current version the next time it is persisted.
+func (index *Index) upgrade(repo *GotRepository) error {
+	positions := repo.Index.positions()
+	for _, entry := range index.Entries {
+		compressed, ok := index.legacyCache[entry.Hash]
+		if !ok || repo.HasObject(entry.Hash) {
+			continue
+		}
+		content, err := inflateObject(compressed)
+		if err != nil || string(CreateSha1(repo.ObjectFormat().Encode(BlobHeaderName, content))) != entry.Hash {
+			if hash, ok := hashWorktreeFile(repo, positions, entry.PathName); !ok || hash != entry.Hash {
+				continue
 			}
-			data = data[pathSep+2+sha1.Size+2+int(dataCompressSize)+1:]
+			if content, err = readUserFile(filepath.Join(repo.GotTree, entry.PathName)); err != nil {
+				return err
+			}
+		}
+		if _, err := WriteObject(repo, rawData(content), BlobHeaderName); err != nil {
+			return err
 		}
-		fmt.Println("with cache", cache)
+	}
+	index.legacyCache = nil
+	return nil
+}
 
-	} else {
-		fmt.Println("without cache", string(data))
+// Read the index file of the repository into a new index. A missing or empty file is an empty index.
+func readIndex(repo *GotRepository) (*Index, error) {
+	index := NewIndex()
+	content, err := os.ReadFile(filepath.Join(repo.GotDir, "index"))
+	if errors.Is(err, os.ErrNotExist) || len(content) == 0 {
+		return index, nil
 	}
-	if len(entries) > 0 {
-		index.Entries = slices.Clone(entries)
-		index.Size = Bit32(len(entries))
+	if err != nil {
+		return nil, err
 	}
-	if len(cache) > 0 {
-		index.Cache = slices.Clone(cache)
+	if err := index.DeserializeIndex(content); err != nil {
+		return nil, err
 	}
+	index.stamp(repo)
+	return index, index.upgrade(repo)
 }
 
 // Read from disk the latest state of the index.
 func (i *Index) Refresh(repo *GotRepository) {
-	indexContent, err := os.ReadFile(filepath.Join(repo.GotDir, "index"))
+	index, err := readIndex(repo)
 	if err != nil {
 		panic(err)
 	}
-	i.DeserializeIndex(indexContent)
+	*i = *index
 }
 
+// Write the index. The entries modified within the timestamp of the new index file are smudged, see
+// smudgeRacyEntries.
 func (i *Index) Persist(repo *GotRepository) error {
-	return CreateOrUpdateRepoFile(repo, "index", i.SerializeIndex())
+	i.smudgeRacyEntries(time.Now().Truncate(time.Second))
+	if err := CreateOrUpdateRepoFile(repo, "index", i.SerializeIndex()); err != nil {
+		return err
+	}
+	i.stamp(repo)
+	return nil
 }
 
-// Add or modify entries in the index.
-func (index *Index) AddOrModifyEntries(repo *GotRepository, filePaths []string) {
-	// index.Refresh(repo)
+// Keep the modification time of the index file, the entries modified since are not trusted.
+func (i *Index) stamp(repo *GotRepository) {
+	if fi, err := os.Stat(filepath.Join(repo.GotDir, "index")); err == nil {
+		i.timestamp = fi.ModTime()
+	}
+}
+
+// Add or modify entries in the index. The content of the files is written in DB right away, the entries point to it.
+// The files unchanged are left as they are, silently: the callers report the files they add.
+func (index *Index) AddOrModifyEntries(repo *GotRepository, filePaths []string) error {
 	// TODO: empty folder are ignored.
-	// TODO: Support add/modify trees, because a file inside of a existing tree[traverseTree] means modify that treeItem and append the blob to that tree.
+	adding := make(map[string]bool, len(filePaths))
+	for _, fileP := range filePaths {
+		adding[fileP] = true
+	}
+	// What it does: adding a conflicted file marks it as resolved.
+	index.Entries = slices.DeleteFunc(index.Entries, func(entry IndexEntry) bool {
+		return entry.Stage != 0 && adding[entry.PathName]
+	})
+	positions := index.positions()
 	for _, fileP := range filePaths {
-		possibleBlob, err := BlobFromUserPath(repo, fileP)
+		fi, err := os.Lstat(filepath.Join(repo.GotTree, fileP))
+		if err != nil {
+			return err
+		}
+		idx, staged := positions[fileP]
+		// What it does: the stat data of the file tells it is the one staged, without reading it.
+		if staged && index.unchanged(index.Entries[idx], fi) {
+			continue
+		}
+		content, err := readUserFile(filepath.Join(repo.GotTree, fileP))
+		if err != nil {
+			return err
+		}
+		hash, err := WriteObject(repo, rawData(content), BlobHeaderName)
 		if err != nil {
-			panic(err)
+			return err
 		}
 		//Index in the db.
-		idx := slices.IndexFunc(index.Entries, func(entry IndexEntry) bool {
-			return entry.PathName == fileP
-		})
-
-		//Index in the cache.
-		cachedIdx := slices.IndexFunc(index.Cache, func(entry CacheEntry) bool {
-			return entry.PathName == fileP
-		})
-
-		// Update only if path exists already and the hash are different.
-		if idx >= 0 {
-			if possibleBlob.Hash == index.Entries[idx].Hash {
-				fmt.Println("Nothing to add. File are the same.")
-				return
-			}
-			// entry := index.Entries[idx]
-			index.Entries[idx].Mtime_s = Bit32(time.Now().Unix())
-			index.Entries[idx].FileSize = Bit32(len(possibleBlob.FileContent))
-			index.Entries[idx].Hash = possibleBlob.Hash
-			// No needed but for correctness.
-			index.Entries[idx].PathName = fileP
-			// Implementation to cache the file and compress its content.
-			// After commit the cache will be cleared and only entries(The tracked) files will be preserve.
-			var compressedFileContent bytes.Buffer
-			Compress(possibleBlob.Serialize(), &compressedFileContent)
-			// Entry already in cached.
-			if cachedIdx >= 0 {
-				cacheEntry := index.Cache[cachedIdx]
-				cacheEntry.PathName = fileP
-				cacheEntry.Hash = possibleBlob.Hash
-			} else {
-				// Add untracked/modified file to the cache.
-				index.Cache = append(index.Cache, CacheEntry{
-					PathName:              fileP,
-					Hash:                  possibleBlob.Hash,
-					CompressedFileContent: compressedFileContent.Bytes(),
-				})
-			}
-		} else {
-			index.Entries = append(index.Entries, IndexEntry{
-				Ctime_s:  Bit32(time.Now().Unix()),
-				Mtime_s:  Bit32(time.Now().Unix()),
-				FileSize: Bit32(len(possibleBlob.FileContent)),
-				Hash:     possibleBlob.Hash,
-				PathName: fileP,
-			})
-			// Add untracked/modified file to the cache.
-			var compressedFileContent bytes.Buffer
-			Compress(possibleBlob.Serialize(), &compressedFileContent)
-			index.Cache = append(index.Cache, CacheEntry{
-				PathName:              fileP,
-				Hash:                  possibleBlob.Hash,
-				CompressedFileContent: compressedFileContent.Bytes(),
-			})
+		if !staged {
+			entry := IndexEntry{Hash: hash, PathName: fileP}
+			fillStat(&entry, fi)
+			positions[fileP] = len(index.Entries)
+			index.Entries = append(index.Entries, entry)
+			continue
 		}
-
+		// The stat data is recorded again: the content may be the same while the stat data changed.
+		fillStat(&index.Entries[idx], fi)
+		index.Entries[idx].Hash = hash
 	}
+	return nil
 }
 
-// Get the entry from the cache.
-func GetEntryFromCache(repo *GotRepository, path string) (CacheEntry, error) {
-	idx := slices.IndexFunc(repo.Index.Cache, func(entry CacheEntry) bool {
-		return entry.PathName == relativize(repo, path)
-	})
-	if idx >= 0 {
-		return repo.Index.Cache[idx], nil
+// Create the index entry of the user file with the given blob hash.
+func newIndexEntry(repo *GotRepository, path string, hash string) IndexEntry {
+	entry := IndexEntry{Hash: hash, PathName: path}
+	statEntry(repo, &entry)
+	return entry
+}
+
+// Record the stat data of the user file in the entry. A file that can't be read keeps its former stat data.
+func statEntry(repo *GotRepository, entry *IndexEntry) {
+	if fi, err := os.Lstat(filepath.Join(repo.GotTree, entry.PathName)); err == nil {
+		fillStat(entry, fi)
 	}
-	return CacheEntry{}, ErrorNotBlobFound
-}
\ No newline at end of file
+}
@@ -2,9 +2,14 @@ package internal_test
 
 import (
 	"bytes"
+	"crypto/sha1"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	internal "github.com/danielrrv/got/internal"
 )
@@ -22,7 +27,7 @@ func TestConvertBit32ToByte(t *testing.T) {
 	})
 	t.Run("Serialize/Deserialize index", func(t *testing.T) {
 		theIndex := internal.Index{
-			Signature: internal.Signature,
+			Signature: internal.IndexSignature,
 			Version:   internal.IndexVersion,
 			Size:      3,
 			Entries: []internal.IndexEntry{
@@ -56,61 +61,189 @@ func TestConvertBit32ToByte(t *testing.T) {
 		}
 
 	})
-	t.Run("Serialize/Deserialize index with cache", func(t *testing.T) {
-		theIndex := internal.Index{
-			Signature: internal.Signature,
-			Version:   internal.IndexVersion,
-			Size:      3,
-			Entries: []internal.IndexEntry{
-				{Ctime_s: 1712343393,
-					Mtime_s:  1712343627,
-					FileSize: 23434334,
-					Hash:     hex.EncodeToString([]byte{0x96, 0xd2, 0xfa, 0x69, 0x73, 0xa9, 0xd6, 0x5f, 0x9a, 0x9f, 0xa1, 0x95, 0xca, 0x9b, 0x07, 0x7e, 0x62, 0xad, 0x79, 0x84}),
-					PathName: "applicaiton.js",
-				},
-				{Ctime_s: 1712343393,
-					Mtime_s:  1712343627,
-					FileSize: 23434334,
-					Hash:     hex.EncodeToString([]byte{0x96, 0xd2, 0xfa, 0x69, 0x73, 0xa9, 0xd6, 0x5f, 0x9a, 0x9f, 0xa1, 0x95, 0xca, 0x9b, 0x07, 0x7e, 0x62, 0xad, 0x79, 0x84}),
-					PathName: "file.txt",
-				},
-				{Ctime_s: 1712343393,
-					Mtime_s:  1712343627,
-					FileSize: 23434334,
-					Hash:     hex.EncodeToString([]byte{0x96, 0xd2, 0xfa, 0x69, 0x73, 0xa9, 0xd6, 0x5f, 0x9a, 0x9f, 0xa1, 0x95, 0xca, 0x9b, 0x07, 0x7e, 0x62, 0xad, 0x79, 0x84}),
-					PathName: "readme.md",
-				},
-			},
-			Cache: []internal.CacheEntry{
-				{PathName: "applicaiton.js",
-					Hash:                  hex.EncodeToString([]byte{0x96, 0xd2, 0xfa, 0x69, 0x73, 0xa9, 0xd6, 0x5f, 0x9a, 0x9f, 0xa1, 0x95, 0xca, 0x9b, 0x07, 0x7e, 0x62, 0xad, 0x79, 0x84}),
-					CompressedFileContent: []byte{0x96, 0xd2, 0xfa, 0x69, 0x73, 0xa9, 0xd6, 0x5f, 0x9a, 0x9f, 0xa1, 0x95, 0xca, 0x9b, 0x07, 0x7e, 0x62, 0xad, 0x79, 0x84},
-				},
-				{PathName: "file.txt",
-					Hash:                  hex.EncodeToString([]byte{0x96, 0xd2, 0xfa, 0x69, 0x73, 0xa9, 0xd6, 0x5f, 0x9a, 0x9f, 0xa1, 0x95, 0xca, 0x9b, 0x07, 0x7e, 0x62, 0xad, 0x79, 0x84}),
-					CompressedFileContent: []byte{0x96, 0xd2, 0xfa, 0x69, 0x73, 0xa9, 0xd6, 0x5f, 0x9a, 0x9f, 0xa1, 0x95, 0xca, 0x9b, 0x07, 0x7e, 0x62, 0xad, 0x79, 0x84},
-				},
-				{PathName: "readme.md",
-					Hash:                  hex.EncodeToString([]byte{0x96, 0xd2, 0xfa, 0x69, 0x73, 0xa9, 0xd6, 0x5f, 0x9a, 0x9f, 0xa1, 0x95, 0xca, 0x9b, 0x07, 0x7e, 0x62, 0xad, 0x79, 0x84}),
-					CompressedFileContent: []byte{0x96, 0xd2, 0xfa, 0x69, 0x73, 0xa9, 0xd6, 0x5f, 0x9a, 0x9f, 0xa1, 0x95, 0xca, 0x9b, 0x07, 0x7e, 0x62, 0xad, 0x79, 0x84},
-				},
-			},
+	t.Run("an index of a former version is upgraded", func(t *testing.T) {
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
 		}
-		data := theIndex.SerializeIndex()
-		fmt.Printf("%v\n", data)
+		// What it does: the cache of the former versions kept the staged content compressed, its size cut to 12 bits.
+		small, large := []byte("staged\n"), make([]byte, 0, 10*1024)
+		for sum := sha1.Sum(small); len(large) < 10*1024; sum = sha1.Sum(sum[:]) {
+			large = append(large, sum[:]...)
+		}
+		os.WriteFile(filepath.Join(repo.GotTree, "small.txt"), []byte("modified since\n"), 0644)
+		os.WriteFile(filepath.Join(repo.GotTree, "large.bin"), large, 0644)
+		hashOf := func(content []byte) string {
+			return string(internal.CreateSha1([]byte(fmt.Sprintf("blob %d\x00%s", len(content), content))))
+		}
+		former := []byte("DIRC1112")
+		former = append(former, internal.Bit32(2).Bytes()...)
+		files := []TestingFile{{RelativePath: "small.txt", Data: small}, {RelativePath: "large.bin", Data: large}}
+		for _, file := range files {
+			former = append(former, make([]byte, 12)...)
+			former = append(former, internal.Hex2bytes(hashOf(file.Data))...)
+			former = append(former, internal.Bit12(len(file.RelativePath)).Bytes()...)
+			former = append(former, []byte(file.RelativePath+"\x00")...)
+		}
+		// What it does: the content cut is the last one, the cache after it could not be read.
+		for _, file := range files {
+			var compressed bytes.Buffer
+			internal.Compress(file.Data, &compressed)
+			former = append(former, 0x13)
+			former = append(former, []byte(file.RelativePath+" ")...)
+			former = append(former, internal.Hex2bytes(hashOf(file.Data))...)
+			former = append(former, internal.Bit12(compressed.Len()).Bytes()...)
+			former = append(former, compressed.Bytes()...)
+		}
+		os.WriteFile(filepath.Join(repo.GotDir, "index"), former, 0644)
 
-		otherIndex := new(internal.Index)
-		otherIndex.DeserializeIndex(data)
-		fmt.Println("Entries")
-		for _, entry := range otherIndex.Entries {
-			fmt.Printf("hash=%v\tpath=%s\n", entry.Hash, entry.PathName)
-		}
-		fmt.Println("Cache")
-		for _, cacheFile := range otherIndex.Cache {
-			fmt.Printf("hash=%v\tpath=%s\n", cacheFile.Hash, cacheFile.PathName)
-			if cacheFile.CompressedFileContent[19] != 0x84{
-				t.Errorf("Expected to be equal.")
-			}
+		repo, err = internal.FindOrCreateRepo(repo.GotTree)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(repo.Index.Entries) != 2 || repo.Index.Version != internal.IndexVersion {
+			t.Fatalf("Expected the entries of the former version read, got %v", repo.Index)
+		}
+		if content, err := internal.ReadBlob(repo, hashOf(small)); err != nil || !bytes.Equal(content, small) {
+			t.Errorf("Expected the cached content written in DB, got %q %v", content, err)
+		}
+		if content, err := internal.ReadBlob(repo, hashOf(large)); err != nil || !bytes.Equal(content, large) {
+			t.Errorf("Expected the cut content taken from the unchanged worktree, %v", err)
+		}
+		if err := repo.Index.Persist(repo); err != nil {
+			t.Fatal(err)
+		}
+		if data, _ := os.ReadFile(filepath.Join(repo.GotDir, "index")); !bytes.Equal(data[4:8], internal.IndexVersion[:]) {
+			t.Errorf("Expected the index written in the current version, got %s", data[4:8])
+		}
+	})
+	t.Run("a corrupted index is detected", func(t *testing.T) {
+		index := internal.NewIndex()
+		index.Entries = []internal.IndexEntry{{Hash: "96d2fa6973a9d65f9a9fa195ca9b077e62ad7984", PathName: "a.txt"}}
+		data := index.SerializeIndex()
+		if err := internal.NewIndex().DeserializeIndex(data); err != nil {
+			t.Fatal(err)
+		}
+		data[len(data)-sha1.Size-2] ^= 0xFF
+		if err := internal.NewIndex().DeserializeIndex(data); !errors.Is(err, internal.ErrorCorruptIndex) {
+			t.Errorf("Expected the checksum mismatch reported, got %v", err)
+		}
+		if err := internal.NewIndex().DeserializeIndex(data[:20]); !errors.Is(err, internal.ErrorCorruptIndex) {
+			t.Errorf("Expected the truncated index reported, got %v", err)
+		}
+		repo, _ := internal.FindOrCreateRepo(t.TempDir())
+		os.WriteFile(filepath.Join(repo.GotDir, "index"), data, 0644)
+		if _, err := internal.FindOrCreateRepo(repo.GotTree); !errors.Is(err, internal.ErrorCorruptIndex) {
+			t.Errorf("Expected the repository with a corrupted index not to be read, got %v", err)
+		}
+	})
+	t.Run("a large file is staged and committed", func(t *testing.T) {
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		large := bytes.Repeat([]byte("0123456789abcdef"), 640)
+		for i := range large {
+			large[i] ^= byte(i * 31 % 256)
+		}
+		os.WriteFile(filepath.Join(repo.GotTree, "large.bin"), large, 0644)
+		if err := repo.Index.AddOrModifyEntries(repo, []string{"large.bin"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.Index.Persist(repo); err != nil {
+			t.Fatal(err)
+		}
+		repo, _ = internal.FindOrCreateRepo(repo.GotTree)
+		if content, err := internal.ReadBlob(repo, repo.Index.Entries[0].Hash); err != nil || !bytes.Equal(content, large) {
+			t.Errorf("Expected the staged content in DB, %v", err)
+		}
+		hash, err := internal.CommitIndex(repo, "large", internal.CommitOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		blob := internal.ReadTree(repo, internal.ReadCommit(repo, hash).Tree).Children[0]
+		if content, _ := internal.ReadBlob(repo, blob.Hash); !bytes.Equal(content, large) {
+			t.Errorf("Expected the committed content of %d bytes, got %d", len(large), len(content))
+		}
+	})
+	t.Run("Serialize/Deserialize the stat data", func(t *testing.T) {
+		entry := internal.IndexEntry{
+			Ctime_s: 1712343393, Ctime_ns: 123, Mtime_s: 1712343627, Mtime_ns: 456,
+			Dev: 2049, Ino: 393228, FileMode: 0100755, Uid: 1000, Gid: 100, FileSize: 23434334,
+			Hash:     "96d2fa6973a9d65f9a9fa195ca9b077e62ad7984",
+			PathName: "bin/run.sh",
+			Stage:    2,
+		}
+		index := internal.NewIndex()
+		index.Entries = []internal.IndexEntry{entry}
+		other := internal.NewIndex()
+		other.DeserializeIndex(index.SerializeIndex())
+		if len(other.Entries) != 1 || other.Entries[0] != entry {
+			t.Errorf("Expected the entry read back, got %+v", other.Entries)
+		}
+		// What it does: the former version keeps ctime, mtime and size seconds only.
+		former := []byte("DIRC1112")
+		former = append(former, internal.Bit32(1).Bytes()...)
+		for _, field := range []internal.Bit32{1712343393, 1712343627, 12} {
+			former = append(former, field.Bytes()...)
+		}
+		former = append(former, internal.Hex2bytes(entry.Hash)...)
+		former = append(former, internal.Bit12(len("a.txt")).Bytes()...)
+		former = append(former, []byte("a.txt\x00")...)
+		other = internal.NewIndex()
+		other.DeserializeIndex(former)
+		if len(other.Entries) != 1 || other.Entries[0].PathName != "a.txt" || other.Entries[0].Mtime_s != 1712343627 || other.Entries[0].FileSize != 12 {
+			t.Errorf("Expected the entry of the former version read, got %+v", other.Entries)
+		}
+	})
+	t.Run("the stat data spares reading unchanged files", func(t *testing.T) {
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(repo.GotTree, "a.txt")
+		os.WriteFile(path, []byte("a\n"), 0644)
+		hourAgo := time.Now().Add(-time.Hour)
+		os.Chtimes(path, hourAgo, hourAgo)
+		repo.Index.AddOrModifyEntries(repo, []string{"a.txt"})
+		if err := repo.Index.Persist(repo); err != nil {
+			t.Fatal(err)
+		}
+		repo, _ = internal.FindOrCreateRepo(repo.GotTree)
+		entry := repo.Index.Entries[0]
+		if fi, _ := os.Stat(path); entry.FileSize != 2 || entry.Mtime_s != internal.Bit32(fi.ModTime().Unix()) || entry.FileMode != 0100644 {
+			t.Errorf("Expected the stat data of the file recorded, got %+v", entry)
+		}
+		// Implementation to tell whether the file is read: the hash of the entry is taken as it is.
+		fake := "0123456789abcdef0123456789abcdef01234567"
+		repo.Index.Entries[0].Hash = fake
+		if hash := internal.WorktreeTree(repo).Children[0].Hash; hash != fake {
+			t.Errorf("Expected the unchanged file not to be read, got %s", hash)
+		}
+		os.Chtimes(path, hourAgo.Add(time.Second), hourAgo.Add(time.Second))
+		if hash := internal.WorktreeTree(repo).Children[0].Hash; hash != entry.Hash {
+			t.Errorf("Expected the touched file to be hashed, got %s", hash)
+		}
+	})
+	t.Run("racily clean entries are hashed", func(t *testing.T) {
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		// What it does: the file is written within the second the index is written.
+		os.WriteFile(filepath.Join(repo.GotTree, "a.txt"), []byte("a\n"), 0644)
+		repo.Index.AddOrModifyEntries(repo, []string{"a.txt"})
+		if err := repo.Index.Persist(repo); err != nil {
+			t.Fatal(err)
+		}
+		repo, _ = internal.FindOrCreateRepo(repo.GotTree)
+		if repo.Index.Entries[0].FileSize != 0 {
+			t.Errorf("Expected the racy entry smudged, got %+v", repo.Index.Entries[0])
+		}
+		staged := repo.Index.Entries[0].Hash
+		repo.Index.Entries[0].Hash = "0123456789abcdef0123456789abcdef01234567"
+		if hash := internal.WorktreeTree(repo).Children[0].Hash; hash != staged {
+			t.Errorf("Expected the racy file to be hashed, got %s", hash)
 		}
 	})
 }
@@ -0,0 +1,168 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var (
+	// Another got process holds the lock of the file.
+	ErrorLocked = errors.New("locked by another got process")
+)
+
+const (
+	// The lock of a file is the file next to it with this suffix, index.lock, HEAD.lock, refs/heads/main.lock.
+	lockSuffix = ".lock"
+	// A lock older than this is left over by a crashed process, whatever process it names.
+	staleLockAge = time.Hour
+	// A lock without a process yet is being created. Older than this, its process was killed meanwhile.
+	lockCreationAge = time.Second
+	// How often the lock is tried again while another process holds it.
+	lockRetryInterval = 10 * time.Millisecond
+)
+
+// How long to wait for a lock held by another process before giving up.
+var lockTimeout = 3 * time.Second
+
+// A lock held by this process. The file holds the id of the process, so that a lock left over by a crashed process
+// can be told from a live one.
+type lockFile struct {
+	path string
+}
+
+// Lock the file, waiting for the process holding it to release it. The lock of a process no longer running is
+// removed and taken over.
+func acquireLock(path string) (*lockFile, error) {
+	lockPath := path + lockSuffix
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		file, err := os.OpenFile(lockPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			_, err = fmt.Fprintf(file, "%d\n", os.Getpid())
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				os.Remove(lockPath)
+				return nil, err
+			}
+			return &lockFile{path: lockPath}, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		pid, stale := inspectLock(lockPath)
+		if stale {
+			continue
+		}
+		if time.Now().After(deadline) {
+			if pid > 0 {
+				return nil, fmt.Errorf("%w: %s is held by process %d", ErrorLocked, lockPath, pid)
+			}
+			return nil, fmt.Errorf("%w: %s exists", ErrorLocked, lockPath)
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+// Remove the lock. The file it protects is free for the other processes.
+func (l *lockFile) release() error {
+	return os.Remove(l.path)
+}
+
+// Read the process holding the lock. A stale lock is removed, and reported as such so that it is tried again:
+//   - Its process is not running anymore.
+//   - It names no process and it is too old to be being created.
+//   - It is older than staleLockAge.
+func inspectLock(lockPath string) (int, bool) {
+	fi, err := os.Stat(lockPath)
+	if err != nil {
+		// What it does: released meanwhile, try again.
+		return 0, errors.Is(err, os.ErrNotExist)
+	}
+	content, _ := os.ReadFile(lockPath)
+	pid, err := strconv.Atoi(string(bytes.TrimSpace(content)))
+	age := time.Since(fi.ModTime())
+	stale := age > staleLockAge
+	if err != nil || pid <= 0 {
+		pid, stale = 0, stale || age > lockCreationAge
+	} else if !processRunning(pid) {
+		stale = true
+	}
+	if !stale {
+		return pid, false
+	}
+	return pid, breakLock(lockPath, fi, content)
+}
+
+// Remove the stale lock inspected, never one taken over by another process meanwhile: the lock is renamed to a name
+// of this process first, rename moves whatever file has the path at once, then the file moved is checked. It is
+// removed when it is the lock inspected, with the same content, and put back otherwise.
+//
+// The name ends with the lock suffix, the refs folders skip it as any other lock.
+func breakLock(lockPath string, inspected os.FileInfo, content []byte) bool {
+	moved := fmt.Sprintf("%s.stale-%d-%d%s", strings.TrimSuffix(lockPath, lockSuffix), os.Getpid(), time.Now().UnixNano(), lockSuffix)
+	if err := os.Rename(lockPath, moved); err != nil {
+		// What it does: released or broken by another process meanwhile, try again.
+		return errors.Is(err, os.ErrNotExist)
+	}
+	fi, err := os.Stat(moved)
+	movedContent, _ := os.ReadFile(moved)
+	if err != nil || !os.SameFile(inspected, fi) || !bytes.Equal(content, movedContent) {
+		// What it does: the link fails when yet another lock took the path, the lock moved is lost then.
+		os.Link(moved, lockPath)
+		os.Remove(moved)
+		return false
+	}
+	os.Remove(moved)
+	return true
+}
+
+// Whether the process is running. The platforms that can't tell say it is.
+func processRunning(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return !errors.Is(process.Signal(syscall.Signal(0)), os.ErrProcessDone)
+}
+
+// Lock the index until Unlock, so that the commands changing the repository run one at a time. The index is read
+// again once locked: another command may have changed it since the repository was found.
+//
+// The index is persisted under the lock, the other files lock themselves on each write, see CreateOrUpdateRepoFile.
+func (repo *GotRepository) Lock() error {
+	if repo.indexLock != nil {
+		return nil
+	}
+	indexPath := filepath.Join(repo.GotDir, "index")
+	lock, err := acquireLock(indexPath)
+	if err != nil {
+		return err
+	}
+	index, err := readIndex(repo)
+	if err != nil {
+		lock.release()
+		return err
+	}
+	repo.Index = index
+	repo.indexLock = lock
+	return nil
+}
+
+// Release the lock of the index taken by Lock.
+func (repo *GotRepository) Unlock() error {
+	if repo.indexLock == nil {
+		return nil
+	}
+	err := repo.indexLock.release()
+	repo.indexLock = nil
+	return err
+}
@@ -0,0 +1,163 @@
+package internal_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	internal "github.com/danielrrv/got/internal"
+)
+
+// The id of a process that ran and exited.
+func deadProcessTesting(t *testing.T) int {
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	return cmd.Process.Pid
+}
+
+func TestLock(t *testing.T) {
+	t.Run("the commands changing the index run one at a time", func(t *testing.T) {
+		dir := t.TempDir()
+		first, err := internal.FindOrCreateRepo(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// What it does: both read the empty index before any of them adds a file.
+		second, _ := internal.FindOrCreateRepo(dir)
+		CreateFilesTesting(dir, nil, []TestingFile{
+			{Name: "a.txt", RelativePath: "a.txt", Data: []byte("a\n")},
+			{Name: "b.txt", RelativePath: "b.txt", Data: []byte("b\n")},
+		})
+		if err := first.Lock(); err != nil {
+			t.Fatal(err)
+		}
+		done := make(chan error)
+		go func() {
+			if err := second.Lock(); err != nil {
+				done <- err
+				return
+			}
+			defer second.Unlock()
+			second.Index.AddOrModifyEntries(second, []string{"b.txt"})
+			done <- second.Index.Persist(second)
+		}()
+		first.Index.AddOrModifyEntries(first, []string{"a.txt"})
+		if err := first.Index.Persist(first); err != nil {
+			t.Fatal(err)
+		}
+		first.Unlock()
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+		reopened, _ := internal.FindOrCreateRepo(dir)
+		paths := make([]string, 0)
+		for _, entry := range reopened.Index.Entries {
+			paths = append(paths, entry.PathName)
+		}
+		if !slices.Contains(paths, "a.txt") || !slices.Contains(paths, "b.txt") {
+			t.Errorf("Expected both files staged, got %v", paths)
+		}
+		if _, err := os.Stat(filepath.Join(reopened.GotDir, "index.lock")); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Expected the lock released")
+		}
+	})
+
+	t.Run("a held lock is reported once the wait is over", func(t *testing.T) {
+		defer internal.LockTimeoutTesting(50 * time.Millisecond)()
+		dir := t.TempDir()
+		holder, _ := internal.FindOrCreateRepo(dir)
+		waiter, _ := internal.FindOrCreateRepo(dir)
+		if err := holder.Lock(); err != nil {
+			t.Fatal(err)
+		}
+		defer holder.Unlock()
+		err := waiter.Lock()
+		if !errors.Is(err, internal.ErrorLocked) || !strings.Contains(err.Error(), fmt.Sprintf("index.lock is held by process %d", os.Getpid())) {
+			t.Errorf("Expected the lock of the index reported with its process, got %v", err)
+		}
+		if err := waiter.Index.Persist(waiter); !errors.Is(err, internal.ErrorLocked) {
+			t.Errorf("Expected the index not written under the lock of another, got %v", err)
+		}
+		os.WriteFile(filepath.Join(dir, ".got", "HEAD.lock"), []byte(fmt.Sprintf("%d\n", os.Getpid())), 0644)
+		ref := internal.Ref{IsDirect: true, Reference: "0123456789abcdef0123456789abcdef01234567"}
+		if err := ref.WriteRef(waiter); !errors.Is(err, internal.ErrorLocked) {
+			t.Errorf("Expected HEAD not written under the lock of another, got %v", err)
+		}
+		os.WriteFile(filepath.Join(dir, ".got", "refs", "heads", "main.lock"), []byte(fmt.Sprintf("%d\n", os.Getpid())), 0644)
+		if err := internal.UpdateBranch(waiter, "main", ref.Reference); !errors.Is(err, internal.ErrorLocked) {
+			t.Errorf("Expected the branch not written under the lock of another, got %v", err)
+		}
+		if branches, err := internal.ListBranches(waiter); err != nil || len(branches) != 0 {
+			t.Errorf("Expected the lock not listed as a branch, got %v %v", branches, err)
+		}
+	})
+
+	t.Run("stale locks are taken over", func(t *testing.T) {
+		defer internal.LockTimeoutTesting(50 * time.Millisecond)()
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		lockPath := filepath.Join(repo.GotDir, "index.lock")
+		longAgo := time.Now().Add(-2 * time.Hour)
+		for name, stale := range map[string]func(){
+			"exited process": func() {
+				os.WriteFile(lockPath, []byte(fmt.Sprintf("%d\n", deadProcessTesting(t))), 0644)
+			},
+			"no process written": func() {
+				os.WriteFile(lockPath, nil, 0644)
+				os.Chtimes(lockPath, longAgo, longAgo)
+			},
+			"too old": func() {
+				os.WriteFile(lockPath, []byte(fmt.Sprintf("%d\n", os.Getpid())), 0644)
+				os.Chtimes(lockPath, longAgo, longAgo)
+			},
+		} {
+			stale()
+			if err := repo.Lock(); err != nil {
+				t.Errorf("Expected the lock of %s taken over, got %v", name, err)
+				continue
+			}
+			if content, _ := os.ReadFile(lockPath); string(content) != fmt.Sprintf("%d\n", os.Getpid()) {
+				t.Errorf("Expected the lock to name this process, got %q", content)
+			}
+			if broken, _ := filepath.Glob(filepath.Join(repo.GotDir, "index.stale-*")); len(broken) != 0 {
+				t.Errorf("Expected the stale lock of %s removed, got %v", name, broken)
+			}
+			repo.Unlock()
+		}
+	})
+
+	t.Run("a lock taken over meanwhile is not broken", func(t *testing.T) {
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		lockPath := filepath.Join(repo.GotDir, "index.lock")
+		stale := []byte(fmt.Sprintf("%d\n", deadProcessTesting(t)))
+		os.WriteFile(lockPath, stale, 0644)
+		inspected, _ := os.Stat(lockPath)
+		// What it does: another process breaks the stale lock and takes it before this one does.
+		os.Remove(lockPath)
+		live := []byte(fmt.Sprintf("%d\n", os.Getpid()))
+		os.WriteFile(lockPath, live, 0644)
+		if internal.BreakLockTesting(lockPath, inspected, stale) {
+			t.Errorf("Expected the lock of the other process kept")
+		}
+		if content, _ := os.ReadFile(lockPath); !bytes.Equal(content, live) {
+			t.Errorf("Expected the lock put back, got %q", content)
+		}
+		if broken, _ := filepath.Glob(filepath.Join(repo.GotDir, "index.stale-*")); len(broken) != 0 {
+			t.Errorf("Expected no lock left aside, got %v", broken)
+		}
+	})
+}
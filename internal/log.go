@@ -0,0 +1,131 @@
+package internal
+
+import (
+	"errors"
+	"maps"
+	"strings"
+)
+
+// Follow was given no path or several.
+var ErrorFollowOnePath = errors.New("--follow requires exactly one path")
+
+// Options to filter the history walk.
+type LogOptions struct {
+	// Maximum number of commits to report. Zero means no limit.
+	MaxCount int
+	// Only report commits where a blob under one of these paths changed. Paths are relative to the worktree.
+	Paths []string
+	// Follow the single path across its renames and copies, its former path is filtered from the commit that renamed it.
+	Follow bool
+}
+
+// A commit found walking the history.
+type LogEntry struct {
+	// The commit object id.
+	Hash string
+	// The commit itself.
+	Commit *Commit
+}
+
+// Walk the history starting at the revision and following the parents of each commit back to the root.
+// Merged histories are interleaved by committer date, newest first. With paths, each commit is filtered by its own
+// paths: a rename followed on one side of a merge doesn't change the paths of the other side.
+func Log(repo *GotRepository, rev string, options LogOptions) ([]LogEntry, error) {
+	if options.Follow && len(options.Paths) != 1 {
+		return nil, ErrorFollowOnePath
+	}
+	hash, err := ResolveRevision(repo, rev)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]LogEntry, 0)
+	// What it does: guard against a corrupted history pointing back to itself, and report merged commits once.
+	visited := map[string]bool{hash: true}
+	// What it does: the paths filtered for each pending commit, the ones before the renames when following.
+	followed := map[string][]string{hash: options.Paths}
+	pending := []LogEntry{}
+	rawData, err := ReadObject(repo, CommitHeaderName, hash)
+	if err != nil {
+		return nil, err
+	}
+	commit := Commit{}.Deserialize(rawData)
+	pending = append(pending, LogEntry{Hash: hash, Commit: &commit})
+	for len(pending) > 0 {
+		if options.MaxCount > 0 && len(entries) >= options.MaxCount {
+			break
+		}
+		// What it does: take the newest pending commit.
+		next := 0
+		for i, entry := range pending {
+			if entry.Commit.Committer.When > pending[next].Commit.Committer.When {
+				next = i
+			}
+		}
+		entry := pending[next]
+		pending = append(pending[:next], pending[next+1:]...)
+		paths := followed[entry.Hash]
+		changed := len(paths) == 0 || pathsChanged(repo, entry.Commit, paths)
+		if changed {
+			entries = append(entries, entry)
+		}
+		for _, parent := range entry.Commit.Parents {
+			if visited[parent] {
+				continue
+			}
+			visited[parent] = true
+			followed[parent] = paths
+			if options.Follow && changed {
+				if from, ok := renamedFrom(repo, entry.Commit, parent, paths[0]); ok {
+					followed[parent] = []string{from}
+				}
+			}
+			rawData, err := ReadObject(repo, CommitHeaderName, parent)
+			if err != nil {
+				return nil, err
+			}
+			commit := Commit{}.Deserialize(rawData)
+			pending = append(pending, LogEntry{Hash: parent, Commit: &commit})
+		}
+	}
+	return entries, nil
+}
+
+// Determine whether any blob under the paths differs between the commit and each of its parents. A merge taking the
+// blobs of one parent as they were didn't change them, as git considers it TREESAME.
+func pathsChanged(repo *GotRepository, commit *Commit, paths []string) bool {
+	current := filterBlobs(flattenTree(repo, commit.Tree), paths)
+	if len(commit.Parents) == 0 {
+		return len(current) > 0
+	}
+	for _, parent := range commit.Parents {
+		if maps.Equal(current, filterBlobs(flattenTree(repo, ReadCommit(repo, parent).Tree), paths)) {
+			return false
+		}
+	}
+	return true
+}
+
+// The path the blob at path was renamed or copied from by the commit, compared with the parent.
+func renamedFrom(repo *GotRepository, commit *Commit, parent string, path string) (string, bool) {
+	changes := DiffTrees(ReadTree(repo, ReadCommit(repo, parent).Tree), ReadTree(repo, commit.Tree))
+	for _, change := range DetectRenames(repo, changes, RenameOptions{Threshold: DefaultRenameOptions.Threshold, Copies: true}) {
+		if change.Path == path && (change.Type == ChangeRenamed || change.Type == ChangeCopied) {
+			return change.OldPath, true
+		}
+	}
+	return "", false
+}
+
+// Keep the blobs that are either one of the paths or inside one of them.
+func filterBlobs(blobs map[string]string, paths []string) map[string]string {
+	filtered := make(map[string]string)
+	for path, hash := range blobs {
+		for _, p := range paths {
+			if p == "." || path == p || strings.HasPrefix(path, strings.TrimSuffix(p, "/")+"/") {
+				filtered[path] = hash
+				break
+			}
+		}
+	}
+	return filtered
+}
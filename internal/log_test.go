@@ -0,0 +1,156 @@
+package internal_test
+
+import (
+	"strings"
+	"testing"
+
+	internal "github.com/danielrrv/got/internal"
+)
+
+func TestLog(t *testing.T) {
+	t.Run("walk the parents back to the root", func(t *testing.T) {
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		first := CommitFilesTesting(repo, "first", "", map[string]string{"readme.md": "v1", "src/cache.rs": "v1"})
+		second := CommitFilesTesting(repo, "second", first, map[string]string{"readme.md": "v2", "src/cache.rs": "v1"})
+		third := CommitFilesTesting(repo, "third", second, map[string]string{"readme.md": "v2", "src/cache.rs": "v2"})
+
+		entries, err := internal.Log(repo, "", internal.LogOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 3 {
+			t.Fatalf("Expected 3 commits, got %d", len(entries))
+		}
+		for i, hash := range []string{third, second, first} {
+			if entries[i].Hash != hash {
+				t.Errorf("Expected commit %d to be %s, got %s", i, hash, entries[i].Hash)
+			}
+		}
+		if entries[2].Commit.Description != "first" {
+			t.Errorf("Expected the root commit to be the first one")
+		}
+	})
+	t.Run("limit and start revision", func(t *testing.T) {
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		first := CommitFilesTesting(repo, "first", "", map[string]string{"readme.md": "v1"})
+		second := CommitFilesTesting(repo, "second", first, map[string]string{"readme.md": "v2"})
+		CommitFilesTesting(repo, "third", second, map[string]string{"readme.md": "v3"})
+
+		entries, err := internal.Log(repo, "main", internal.LogOptions{MaxCount: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 2 {
+			t.Errorf("Expected 2 commits, got %d", len(entries))
+		}
+		entries, err = internal.Log(repo, second[:8], internal.LogOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 2 || entries[0].Hash != second {
+			t.Errorf("Expected the history to start at the abbreviated hash")
+		}
+		if _, err := internal.Log(repo, "no-such-branch", internal.LogOptions{}); err != internal.ErrorUnknownRevision {
+			t.Errorf("Expected unknown revision, got %v", err)
+		}
+	})
+	t.Run("filter by path", func(t *testing.T) {
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		first := CommitFilesTesting(repo, "first", "", map[string]string{"readme.md": "v1", "src/cache.rs": "v1"})
+		second := CommitFilesTesting(repo, "second", first, map[string]string{"readme.md": "v2", "src/cache.rs": "v1"})
+		third := CommitFilesTesting(repo, "third", second, map[string]string{"readme.md": "v2", "src/cache.rs": "v2"})
+
+		entries, err := internal.Log(repo, "", internal.LogOptions{Paths: []string{"src/cache.rs"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 2 || entries[0].Hash != third || entries[1].Hash != first {
+			t.Errorf("Expected only the commits touching src/cache.rs, got %v", entries)
+		}
+		entries, err = internal.Log(repo, "", internal.LogOptions{Paths: []string{"src"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 2 {
+			t.Errorf("Expected the directory to match the blobs inside, got %d", len(entries))
+		}
+		entries, err = internal.Log(repo, "", internal.LogOptions{Paths: []string{"readme.md"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 2 || entries[0].Hash != second {
+			t.Errorf("Expected only the commits touching readme.md")
+		}
+	})
+	t.Run("follow a file across its renames", func(t *testing.T) {
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		content := strings.Repeat("some content\n", 10)
+		first := CommitFilesTesting(repo, "first", "", map[string]string{"old.c": content, "readme.md": "v1"})
+		second := CommitFilesTesting(repo, "second", first, map[string]string{"old.c": content + "v2\n", "readme.md": "v1"})
+		third := CommitFilesTesting(repo, "third", second, map[string]string{"src/new.c": content + "v3\n", "readme.md": "v1"})
+		fourth := CommitFilesTesting(repo, "fourth", third, map[string]string{"src/new.c": content + "v3\n", "readme.md": "v2"})
+
+		entries, err := internal.Log(repo, fourth, internal.LogOptions{Paths: []string{"src/new.c"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 || entries[0].Hash != third {
+			t.Errorf("Expected the history of the path stopping at the rename, got %v", entries)
+		}
+		entries, err = internal.Log(repo, fourth, internal.LogOptions{Paths: []string{"src/new.c"}, Follow: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 3 || entries[0].Hash != third || entries[1].Hash != second || entries[2].Hash != first {
+			t.Errorf("Expected the history of the former path too, got %v", entries)
+		}
+		if _, err := internal.Log(repo, fourth, internal.LogOptions{Paths: []string{"a", "b"}, Follow: true}); err != internal.ErrorFollowOnePath {
+			t.Errorf("Expected a single path to follow, got %v", err)
+		}
+	})
+	t.Run("merges and renames on one side", func(t *testing.T) {
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		content := strings.Repeat("some content\n", 10)
+		first := CommitFilesTesting(repo, "first", "", map[string]string{"old.c": content, "readme.md": "v1"})
+		side := CommitFilesTesting(repo, "side", first, map[string]string{"old.c": content + "side\n", "readme.md": "v1"})
+		renamed := CommitFilesTesting(repo, "renamed", first, map[string]string{"new.c": content, "readme.md": "v1"})
+		merge := CommitFilesTesting(repo, "merge", renamed, map[string]string{"new.c": content + "side\n", "readme.md": "v1"}, side)
+		readme := CommitFilesTesting(repo, "readme", merge, map[string]string{"new.c": content + "side\n", "readme.md": "v2"})
+
+		entries, err := internal.Log(repo, readme, internal.LogOptions{Paths: []string{"new.c"}, Follow: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes := make(map[string]bool)
+		for _, entry := range entries {
+			hashes[entry.Hash] = true
+		}
+		if len(entries) != 4 || !hashes[merge] || !hashes[renamed] || !hashes[side] || !hashes[first] {
+			t.Errorf("Expected the merge and both sides with their own path, got %v", entries)
+		}
+		// What it does: a merge taking the file of one parent as it was didn't change it.
+		again := CommitFilesTesting(repo, "again", readme, map[string]string{"new.c": content + "side\n", "readme.md": "v2"}, renamed)
+		entries, err = internal.Log(repo, again, internal.LogOptions{Paths: []string{"new.c"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 2 || entries[0].Hash == again || entries[1].Hash == again {
+			t.Errorf("Expected the merge TREESAME to a parent skipped, got %v", entries)
+		}
+	})
+}
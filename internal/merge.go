@@ -0,0 +1,487 @@
+package internal
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const (
+	// The commit being merged while the merge is in progress.
+	mergeHeadFile = "MERGE_HEAD"
+	// The message of the merge commit while the merge is in progress.
+	mergeMsgFile = "MERGE_MSG"
+	// Size of the conflict markers.
+	conflictMarkerSize = 7
+)
+
+var (
+	// The commits have no common ancestor.
+	ErrorNoMergeBase = errors.New("refusing to merge unrelated histories")
+	// The stage area or the files the merge touches have local modifications.
+	ErrorMergeDirty = errors.New("local changes would be overwritten by merge")
+	// A merge is already in progress.
+	ErrorMergeInProgress = errors.New("a merge is in progress, commit the result first")
+)
+
+// Result of a merge.
+type MergeResult struct {
+	// The commit HEAD points to after the merge. Empty when the merge stopped on conflicts.
+	Hash string
+	// The common ancestor of both commits.
+	Base string
+	// HEAD already contains the merged commit.
+	UpToDate bool
+	// HEAD moved forward to the merged commit, no merge commit created.
+	FastForward bool
+	// Paths with conflicts, sorted.
+	Conflicts []string
+}
+
+// Find the best common ancestors of both commits: the common ancestors that aren't ancestors of another one.
+// They are sorted by committer date, newest first.
+//
+// The history is walked once from both commits, newest commit first, as git does: each commit is marked with the
+// sides reaching it. A commit reached from both is a common ancestor, its own ancestors are marked stale and the walk
+// stops once only stale commits are pending. The common ancestors reachable from another one are dropped then.
+func MergeBases(repo *GotRepository, a string, b string) []string {
+	const (
+		fromA = 1 << iota
+		fromB
+		stale
+	)
+	commits := make(map[string]*Commit)
+	readCommit := func(hash string) *Commit {
+		if commits[hash] == nil {
+			commits[hash] = ReadCommit(repo, hash)
+		}
+		return commits[hash]
+	}
+	flags := map[string]int{a: fromA}
+	flags[b] |= fromB
+	pending := []string{a}
+	if b != a {
+		pending = append(pending, b)
+	}
+	common := make([]string, 0)
+	for slices.ContainsFunc(pending, func(hash string) bool { return flags[hash]&stale == 0 }) {
+		// What it does: take the newest pending commit.
+		next := 0
+		for i, hash := range pending {
+			if readCommit(hash).Committer.When > readCommit(pending[next]).Committer.When {
+				next = i
+			}
+		}
+		hash := pending[next]
+		pending = append(pending[:next], pending[next+1:]...)
+		marks := flags[hash]
+		if marks&(fromA|fromB) == fromA|fromB && marks&stale == 0 {
+			common = append(common, hash)
+			marks |= stale
+		}
+		for _, parent := range readCommit(hash).Parents {
+			if flags[parent]&marks == marks {
+				continue
+			}
+			if flags[parent] == 0 || !slices.Contains(pending, parent) {
+				pending = append(pending, parent)
+			}
+			flags[parent] |= marks
+		}
+	}
+	// Implementation to drop the common ancestors reachable from another one, walking once from their parents.
+	redundant := make(map[string]bool)
+	walk := make([]string, 0)
+	for _, hash := range common {
+		walk = append(walk, readCommit(hash).Parents...)
+	}
+	for len(common) > 1 && len(walk) > 0 {
+		hash := walk[len(walk)-1]
+		walk = walk[:len(walk)-1]
+		if redundant[hash] {
+			continue
+		}
+		redundant[hash] = true
+		walk = append(walk, readCommit(hash).Parents...)
+	}
+	bases := slices.DeleteFunc(common, func(hash string) bool { return redundant[hash] })
+	slices.SortFunc(bases, func(x, y string) int {
+		return cmp.Or(cmp.Compare(readCommit(y).Committer.When, readCommit(x).Committer.When), cmp.Compare(x, y))
+	})
+	return bases
+}
+
+// Find the best common ancestor of both commits.
+func MergeBase(repo *GotRepository, a string, b string) (string, error) {
+	bases := MergeBases(repo, a, b)
+	if len(bases) == 0 {
+		return "", ErrorNoMergeBase
+	}
+	return bases[0], nil
+}
+
+// Three-way merge of the contents line by line. The changes of both sides are combined, and where they overlap
+// with different results the conflicting hunk is surrounded by markers:
+//
+//	<<<<<<< ours
+//	our lines
+//	=======
+//	their lines
+//	>>>>>>> theirs
+func MergeContents(base, ours, theirs []byte, oursLabel, theirsLabel string) ([]byte, bool) {
+	baseLines, ourLines, theirLines := SplitLines(base), SplitLines(ours), SplitLines(theirs)
+	// What it does: map every base line to its line on each side, -1 when the side changed it.
+	matchLines := func(side []string) []int {
+		match := make([]int, len(baseLines))
+		for i := range match {
+			match[i] = -1
+		}
+		for _, edit := range DiffLines(baseLines, side) {
+			if edit.Operation == EditEqual {
+				match[edit.OldIndex] = edit.NewIndex
+			}
+		}
+		return match
+	}
+	matchOurs, matchTheirs := matchLines(ourLines), matchLines(theirLines)
+
+	var out bytes.Buffer
+	conflict := false
+	b, o, t := 0, 0, 0
+	for b < len(baseLines) || o < len(ourLines) || t < len(theirLines) {
+		// Branch #1: the three sides agree on the line.
+		if b < len(baseLines) && matchOurs[b] == o && matchTheirs[b] == t {
+			out.WriteString(baseLines[b])
+			b, o, t = b+1, o+1, t+1
+			continue
+		}
+		// Branch #2: find the next line the three sides agree on. The lines up to it are a changed chunk.
+		nextB, nextO, nextT := len(baseLines), len(ourLines), len(theirLines)
+		for j := b; j < len(baseLines); j++ {
+			if matchOurs[j] >= o && matchTheirs[j] >= t {
+				nextB, nextO, nextT = j, matchOurs[j], matchTheirs[j]
+				break
+			}
+		}
+		baseChunk := baseLines[b:nextB]
+		ourChunk, theirChunk := ourLines[o:nextO], theirLines[t:nextT]
+		switch {
+		case slices.Equal(ourChunk, baseChunk):
+			writeLines(&out, theirChunk)
+		case slices.Equal(theirChunk, baseChunk), slices.Equal(ourChunk, theirChunk):
+			writeLines(&out, ourChunk)
+		default:
+			conflict = true
+			out.WriteString(strings.Repeat("<", conflictMarkerSize) + " " + oursLabel + "\n")
+			writeTerminatedLines(&out, ourChunk)
+			out.WriteString(strings.Repeat("=", conflictMarkerSize) + "\n")
+			writeTerminatedLines(&out, theirChunk)
+			out.WriteString(strings.Repeat(">", conflictMarkerSize) + " " + theirsLabel + "\n")
+		}
+		b, o, t = nextB, nextO, nextT
+	}
+	return out.Bytes(), conflict
+}
+
+func writeLines(out *bytes.Buffer, lines []string) {
+	for _, line := range lines {
+		out.WriteString(line)
+	}
+}
+
+// Write the lines making sure the last one ends with a new line, so a marker can follow.
+func writeTerminatedLines(out *bytes.Buffer, lines []string) {
+	writeLines(out, lines)
+	if len(lines) > 0 && !strings.HasSuffix(lines[len(lines)-1], "\n") {
+		out.WriteByte(newLine)
+	}
+}
+
+// Merge the revision into HEAD.
+//
+//   - When HEAD already contains the revision there is nothing to do.
+//   - When the revision contains HEAD, HEAD moves forward to it(fast-forward).
+//   - Otherwise the trees are merged three-way against their merge base and a merge commit with both parents
+//     is created. When there are conflicts, the files get conflict markers, the index records the three sides
+//     of each conflicted file and the merge is left in progress until the result is committed.
+func Merge(repo *GotRepository, rev string, message string) (*MergeResult, error) {
+	if readMergeHead(repo) != "" {
+		return nil, ErrorMergeInProgress
+	}
+	head := repo.GetHEADReference()
+	if head.Invalid {
+		return nil, ErrorNoCommitYet
+	}
+	theirs, err := ResolveRevision(repo, rev)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ReadObject(repo, CommitHeaderName, theirs); err != nil {
+		return nil, err
+	}
+	ours := head.Reference
+	base, err := MergeBase(repo, ours, theirs)
+	if err != nil {
+		return nil, err
+	}
+	result := &MergeResult{Base: base, Conflicts: make([]string, 0)}
+	if base == theirs {
+		result.UpToDate = true
+		result.Hash = ours
+		return result, nil
+	}
+	if base == ours {
+		if err := checkoutCommit(repo, theirs, false); err != nil {
+			return nil, err
+		}
+		if err := repo.AdvanceHEAD(theirs); err != nil {
+			return nil, err
+		}
+		result.FastForward = true
+		result.Hash = theirs
+		return result, nil
+	}
+	if len(DiffTrees(HEADTree(repo), IndexTree(repo))) > 0 {
+		return nil, ErrorMergeDirty
+	}
+	baseItems := flattenTreeItems(repo, ReadCommit(repo, base).Tree)
+	ourItems := flattenTreeItems(repo, ReadCommit(repo, ours).Tree)
+	theirItems := flattenTreeItems(repo, ReadCommit(repo, theirs).Tree)
+	baseBlobs, ourBlobs, theirBlobs := blobHashes(baseItems), blobHashes(ourItems), blobHashes(theirItems)
+	unique := make(map[string]bool)
+	for _, blobs := range []map[string]string{baseBlobs, ourBlobs, theirBlobs} {
+		for path := range blobs {
+			unique[path] = true
+		}
+	}
+	paths := make([]string, 0, len(unique))
+	for path := range unique {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+	// Implementation to refuse the merge before touching anything when a path is invalid, see verifyTreePath, or a
+	// local modification is in the way.
+	positions := repo.Index.positions()
+	for _, path := range paths {
+		if err := verifyTreePath(path); err != nil {
+			return nil, err
+		}
+		if ourBlobs[path] == theirBlobs[path] || theirBlobs[path] == baseBlobs[path] {
+			continue
+		}
+		if userHash, _ := hashWorktreeFile(repo, positions, path); userHash != ourBlobs[path] {
+			return nil, fmt.Errorf("%w: %s", ErrorMergeDirty, path)
+		}
+	}
+	if err := CreateOrUpdateRepoFile(repo, mergeHeadFile, []byte(theirs)); err != nil {
+		return nil, err
+	}
+	if message == "" {
+		message = fmt.Sprintf("Merge %s", rev)
+		if pathExist(branchPath(repo, rev), false) {
+			message = fmt.Sprintf("Merge branch '%s'", rev)
+		}
+	}
+	if err := CreateOrUpdateRepoFile(repo, mergeMsgFile, []byte(message)); err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		baseHash, ourHash, theirHash := baseBlobs[path], ourBlobs[path], theirBlobs[path]
+		mode := mergeModes(baseItems[path].Mode, ourItems[path].Mode, theirItems[path].Mode)
+		switch {
+		// Both sides agree, or only ours changed. The worktree and index have our side already, unless only their
+		// mode changed.
+		case ourHash == theirHash, theirHash == baseHash:
+			if ourHash == "" || bytes.Equal(mode, ourItems[path].Mode) {
+				continue
+			}
+			if err := takeMergeSide(repo, path, TreeItem{Mode: mode, Hash: ourHash}); err != nil {
+				return nil, err
+			}
+			continue
+		// Only theirs changed, take it.
+		case ourHash == baseHash:
+			if err := takeMergeSide(repo, path, TreeItem{Mode: mode, Hash: theirHash}); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		// Both sides changed the file differently.
+		merged, conflict, err := mergeBlobs(repo, baseHash, ourHash, theirHash, rev)
+		if err != nil {
+			return nil, err
+		}
+		if !conflict {
+			if err := writeWorktreeFile(repo, path, mode, merged); err != nil {
+				return nil, err
+			}
+			if err := repo.Index.AddOrModifyEntries(repo, []string{path}); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		result.Conflicts = append(result.Conflicts, path)
+		if merged != nil {
+			if err := writeWorktreeFile(repo, path, mode, merged); err != nil {
+				return nil, err
+			}
+		}
+		// Implementation to record the three sides of the conflict in the index.
+		repo.Index.Entries = slices.DeleteFunc(repo.Index.Entries, func(entry IndexEntry) bool {
+			return entry.PathName == path
+		})
+		for stage, hash := range []string{baseHash, ourHash, theirHash} {
+			if hash != "" {
+				entry := newIndexEntry(repo, path, hash)
+				entry.Stage = uint8(stage + 1)
+				repo.Index.Entries = append(repo.Index.Entries, entry)
+			}
+		}
+	}
+	slices.SortStableFunc(repo.Index.Entries, func(a, b IndexEntry) int {
+		return cmp.Or(cmp.Compare(a.PathName, b.PathName), cmp.Compare(a.Stage, b.Stage))
+	})
+	if err := repo.Index.Persist(repo); err != nil {
+		return nil, err
+	}
+	if len(result.Conflicts) > 0 {
+		return result, nil
+	}
+	hash, err := CommitIndex(repo, message, CommitOptions{})
+	if err != nil {
+		return nil, err
+	}
+	result.Hash = hash
+	return result, nil
+}
+
+// Merge the contents of the blobs. A missing hash means the file doesn't exist on that side.
+//
+// The merged content is nil when the conflict can't be expressed with markers(binary or deleted on one side),
+// then the worktree keeps our side.
+func mergeBlobs(repo *GotRepository, baseHash, ourHash, theirHash string, theirsLabel string) ([]byte, bool, error) {
+	if ourHash == "" || theirHash == "" {
+		return nil, true, nil
+	}
+	contents := make([][]byte, 0, 3)
+	for _, hash := range []string{baseHash, ourHash, theirHash} {
+		content := []byte{}
+		if hash != "" {
+			var err error
+			if content, err = ReadBlob(repo, hash); err != nil {
+				return nil, false, err
+			}
+		}
+		if IsBinary(content) {
+			return nil, true, nil
+		}
+		contents = append(contents, content)
+	}
+	merged, conflict := MergeContents(contents[0], contents[1], contents[2], "HEAD", theirsLabel)
+	return merged, conflict, nil
+}
+
+// The mode of the merged file: theirs when only they changed it, ours otherwise. A side without the file has no mode.
+func mergeModes(base, ours, theirs Mode) Mode {
+	if len(ours) == 0 || bytes.Equal(ours, base) && len(theirs) > 0 {
+		return theirs
+	}
+	return ours
+}
+
+// Take the side of the merge for the path: write the blob into the worktree with its mode and stage it. A missing
+// hash deletes it.
+func takeMergeSide(repo *GotRepository, path string, blob TreeItem) error {
+	repo.Index.Entries = slices.DeleteFunc(repo.Index.Entries, func(entry IndexEntry) bool {
+		return entry.PathName == path
+	})
+	hash := blob.Hash
+	if hash == "" {
+		if err := os.Remove(filepath.Join(repo.GotTree, path)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		removeEmptyDirs(repo, filepath.Dir(filepath.Join(repo.GotTree, path)))
+		return nil
+	}
+	content, err := ReadBlob(repo, hash)
+	if err != nil {
+		return err
+	}
+	if err := writeWorktreeFile(repo, path, blob.Mode, content); err != nil {
+		return err
+	}
+	repo.Index.Entries = append(repo.Index.Entries, newIndexEntry(repo, path, hash))
+	return nil
+}
+
+// Write the user file given its path relative to the worktree and its mode, creating its folders: an executable
+// file for 100755, a symbolic link to the content for 120000, a regular file otherwise.
+//
+// The path is checked first, see verifyTreePath, and none of its folders may be a symbolic link, which could lead
+// out of the worktree.
+func writeWorktreeFile(repo *GotRepository, path string, mode Mode, content []byte) error {
+	if err := verifyTreePath(path); err != nil {
+		return err
+	}
+	for dir := filepath.Dir(path); dir != "."; dir = filepath.Dir(dir) {
+		if fi, err := os.Lstat(filepath.Join(repo.GotTree, dir)); err == nil && fi.Mode()&fs.ModeSymlink != 0 {
+			return fmt.Errorf("%w: %q is beyond a symbolic link", ErrorInvalidTreePath, path)
+		}
+	}
+	absPath := filepath.Join(repo.GotTree, path)
+	if err := os.MkdirAll(filepath.Dir(absPath), 0755); err != nil {
+		return err
+	}
+	// What it does: a symbolic link is replaced rather than written through, and so is a file replaced by a link.
+	if fi, err := os.Lstat(absPath); err == nil && (fi.Mode()&fs.ModeSymlink != 0 || bytes.Equal(mode, SymlinkMode)) {
+		if err := os.Remove(absPath); err != nil {
+			return err
+		}
+	}
+	var perm fs.FileMode = 0644
+	switch {
+	case bytes.Equal(mode, SymlinkMode):
+		return os.Symlink(string(content), absPath)
+	case bytes.Equal(mode, ExecutableMode):
+		perm = 0755
+	}
+	if err := os.WriteFile(absPath, content, perm); err != nil {
+		return err
+	}
+	// What it does: the file existed already with other permissions.
+	return os.Chmod(absPath, perm)
+}
+
+// The commit being merged. Empty when there is no merge in progress.
+func readMergeHead(repo *GotRepository) string {
+	content, err := os.ReadFile(filepath.Join(repo.GotDir, mergeHeadFile))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(content))
+}
+
+// The message of the merge in progress.
+func ReadMergeMessage(repo *GotRepository) string {
+	content, err := os.ReadFile(filepath.Join(repo.GotDir, mergeMsgFile))
+	if err != nil {
+		return ""
+	}
+	return string(content)
+}
+
+// Forget the merge in progress.
+func clearMergeState(repo *GotRepository) error {
+	for _, file := range []string{mergeHeadFile, mergeMsgFile} {
+		if err := os.Remove(filepath.Join(repo.GotDir, file)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,297 @@
+package internal_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	internal "github.com/danielrrv/got/internal"
+)
+
+// Commit the base on main, then the feature changes on the feature branch and the main changes on main.
+func divergeTesting(t *testing.T, base, feature, main []TestingFile) (*internal.GotRepository, string) {
+	repo, err := internal.FindOrCreateRepo(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := commitWorktreeTesting(t, repo, "base", base)
+	if err := internal.CreateBranch(repo, "feature", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := internal.Checkout(repo, "feature", false); err != nil {
+		t.Fatal(err)
+	}
+	commitWorktreeTesting(t, repo, "feature", feature)
+	if _, err := internal.Checkout(repo, "main", false); err != nil {
+		t.Fatal(err)
+	}
+	if len(main) > 0 {
+		commitWorktreeTesting(t, repo, "main", main)
+	}
+	return repo, first
+}
+
+func TestMerge(t *testing.T) {
+	t.Run("merge contents", func(t *testing.T) {
+		base := []byte("1\n2\n3\n4\n5\n")
+		merged, conflict := internal.MergeContents(base, []byte("1\n2\n3\n4\nfive\n"), []byte("one\n2\n3\n4\n5\n"), "HEAD", "feature")
+		if conflict || string(merged) != "one\n2\n3\n4\nfive\n" {
+			t.Errorf("Expected both changes combined, got %q", merged)
+		}
+		merged, conflict = internal.MergeContents(base, []byte("1\n2\nthree\n4\n5\n"), []byte("1\n2\n3\n4\n5\n6\n"), "HEAD", "feature")
+		if conflict || string(merged) != "1\n2\nthree\n4\n5\n6\n" {
+			t.Errorf("Expected the insertion at the end combined, got %q", merged)
+		}
+		merged, conflict = internal.MergeContents(base, []byte("1\n2\nours\n4\n5\n"), []byte("1\n2\ntheirs\n4\n5\n"), "HEAD", "feature")
+		expected := "1\n2\n<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> feature\n4\n5\n"
+		if !conflict || string(merged) != expected {
+			t.Errorf("Expected a conflict with markers, got %q", merged)
+		}
+		merged, conflict = internal.MergeContents(base, []byte("1\n2\nsame\n4\n5\n"), []byte("1\n2\nsame\n4\n5\n"), "HEAD", "feature")
+		if conflict || string(merged) != "1\n2\nsame\n4\n5\n" {
+			t.Errorf("Expected the same change on both sides to merge clean, got %q", merged)
+		}
+	})
+
+	t.Run("merge base", func(t *testing.T) {
+		repo, first := divergeTesting(t,
+			[]TestingFile{{Name: "a.txt", RelativePath: "a.txt", Data: []byte("a")}},
+			[]TestingFile{{Name: "b.txt", RelativePath: "b.txt", Data: []byte("b")}},
+			[]TestingFile{{Name: "c.txt", RelativePath: "c.txt", Data: []byte("c")}},
+		)
+		feature, _ := internal.ResolveRevision(repo, "feature")
+		main, _ := internal.ResolveRevision(repo, "main")
+		if base, err := internal.MergeBase(repo, main, feature); err != nil || base != first {
+			t.Errorf("Expected the base commit as merge base, got %s %v", base, err)
+		}
+		if base, _ := internal.MergeBase(repo, first, feature); base != first {
+			t.Errorf("Expected the ancestor itself as merge base, got %s", base)
+		}
+		unrelated := CommitFilesTesting(repo, "unrelated", "", map[string]string{"z.txt": "z"})
+		if _, err := internal.MergeBase(repo, unrelated, feature); !errors.Is(err, internal.ErrorNoMergeBase) {
+			t.Errorf("Expected unrelated histories to have no merge base, got %v", err)
+		}
+	})
+
+	t.Run("criss-cross merge bases", func(t *testing.T) {
+		repo, _ := divergeTesting(t,
+			[]TestingFile{{Name: "a.txt", RelativePath: "a.txt", Data: []byte("a")}},
+			[]TestingFile{{Name: "b.txt", RelativePath: "b.txt", Data: []byte("b")}},
+			[]TestingFile{{Name: "c.txt", RelativePath: "c.txt", Data: []byte("c")}},
+		)
+		main, _ := internal.ResolveRevision(repo, "main")
+		feature, _ := internal.ResolveRevision(repo, "feature")
+		// What it does: main merges feature and feature merges the former main, both tips are bases then.
+		ours, err := internal.Merge(repo, "feature", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := internal.Checkout(repo, "feature", false); err != nil {
+			t.Fatal(err)
+		}
+		theirs, err := internal.Merge(repo, main, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		bases := internal.MergeBases(repo, ours.Hash, theirs.Hash)
+		slices.Sort(bases)
+		expected := []string{main, feature}
+		slices.Sort(expected)
+		if !slices.Equal(bases, expected) {
+			t.Errorf("Expected both tips as merge bases, got %v", bases)
+		}
+		if bases := internal.MergeBases(repo, ours.Hash, feature); !slices.Equal(bases, []string{feature}) {
+			t.Errorf("Expected the merged tip as the only merge base, got %v", bases)
+		}
+	})
+
+	t.Run("up to date and fast-forward", func(t *testing.T) {
+		repo, first := divergeTesting(t,
+			[]TestingFile{{Name: "a.txt", RelativePath: "a.txt", Data: []byte("a")}},
+			[]TestingFile{{Name: "b.txt", RelativePath: "src/b.txt", Data: []byte("b")}},
+			nil,
+		)
+		result, err := internal.Merge(repo, first, "")
+		if err != nil || !result.UpToDate {
+			t.Errorf("Expected merging an ancestor to be up to date, got %v %v", result, err)
+		}
+		result, err = internal.Merge(repo, "feature", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		feature, _ := internal.ResolveRevision(repo, "feature")
+		if !result.FastForward || result.Hash != feature {
+			t.Errorf("Expected a fast-forward to feature, got %v", result)
+		}
+		if main, _ := internal.ResolveRevision(repo, "main"); main != feature {
+			t.Errorf("Expected main to move to feature, got %s", main)
+		}
+		if content := readFileTesting(repo, "src/b.txt"); content != "b" {
+			t.Errorf("Expected the file of feature in the worktree, got %q", content)
+		}
+	})
+
+	t.Run("three-way merge", func(t *testing.T) {
+		repo, _ := divergeTesting(t,
+			[]TestingFile{
+				{Name: "a.txt", RelativePath: "a.txt", Data: []byte("1\n2\n3\n4\n5\n")},
+				{Name: "old.txt", RelativePath: "old.txt", Data: []byte("old")},
+			},
+			[]TestingFile{
+				{Name: "a.txt", RelativePath: "a.txt", Data: []byte("one\n2\n3\n4\n5\n")},
+				{Name: "c.txt", RelativePath: "src/c.txt", Data: []byte("c")},
+			},
+			[]TestingFile{{Name: "a.txt", RelativePath: "a.txt", Data: []byte("1\n2\n3\n4\nfive\n")}},
+		)
+		main, _ := internal.ResolveRevision(repo, "main")
+		feature, _ := internal.ResolveRevision(repo, "feature")
+		result, err := internal.Merge(repo, "feature", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.FastForward || len(result.Conflicts) > 0 {
+			t.Fatalf("Expected a clean merge commit, got %v", result)
+		}
+		commit := internal.ReadCommit(repo, result.Hash)
+		if !slices.Equal(commit.Parents, []string{main, feature}) {
+			t.Errorf("Expected main and feature as parents, got %v", commit.Parents)
+		}
+		if commit.Description != "Merge branch 'feature'" {
+			t.Errorf("Expected the default merge message, got %q", commit.Description)
+		}
+		if head, _ := internal.ResolveRevision(repo, "main"); head != result.Hash {
+			t.Errorf("Expected main to move to the merge commit, got %s", head)
+		}
+		if content := readFileTesting(repo, "a.txt"); content != "one\n2\n3\n4\nfive\n" {
+			t.Errorf("Expected both changes in a.txt, got %q", content)
+		}
+		if content := readFileTesting(repo, "src/c.txt"); content != "c" {
+			t.Errorf("Expected the file added by feature, got %q", content)
+		}
+		if changes := internal.DiffTrees(internal.HEADTree(repo), internal.IndexTree(repo)); len(changes) > 0 {
+			t.Errorf("Expected the index to match the merge commit, got %v", changes)
+		}
+		entries, err := internal.Log(repo, "", internal.LogOptions{})
+		if err != nil || len(entries) != 4 {
+			t.Errorf("Expected the log to walk both parents, got %d entries %v", len(entries), err)
+		}
+	})
+
+	t.Run("conflicts", func(t *testing.T) {
+		repo, _ := divergeTesting(t,
+			[]TestingFile{{Name: "a.txt", RelativePath: "a.txt", Data: []byte("1\n2\n3\n")}},
+			[]TestingFile{{Name: "a.txt", RelativePath: "a.txt", Data: []byte("1\ntheirs\n3\n")}},
+			[]TestingFile{{Name: "a.txt", RelativePath: "a.txt", Data: []byte("1\nours\n3\n")}},
+		)
+		main, _ := internal.ResolveRevision(repo, "main")
+		result, err := internal.Merge(repo, "feature", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(result.Conflicts, []string{"a.txt"}) || result.Hash != "" {
+			t.Fatalf("Expected a conflict in a.txt, got %v", result)
+		}
+		expected := "1\n<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> feature\n3\n"
+		if content := readFileTesting(repo, "a.txt"); content != expected {
+			t.Errorf("Expected conflict markers in a.txt, got %q", content)
+		}
+		stages := make([]uint8, 0)
+		for _, entry := range repo.Index.Entries {
+			stages = append(stages, entry.Stage)
+		}
+		if !slices.Equal(stages, []uint8{1, 2, 3}) {
+			t.Errorf("Expected the three sides of a.txt in the index, got %v", stages)
+		}
+		reloaded, _ := internal.FindOrCreateRepo(repo.GotTree)
+		if len(reloaded.Index.Entries) != 3 || reloaded.Index.Entries[2].Stage != 3 {
+			t.Errorf("Expected the stages to survive the index persistence, got %v", reloaded.Index.Entries)
+		}
+		if _, err := internal.CommitIndex(repo, "merge", internal.CommitOptions{}); !errors.Is(err, internal.ErrorUnmergedPaths) {
+			t.Errorf("Expected the commit to be refused with unmerged paths, got %v", err)
+		}
+		if _, err := internal.Merge(repo, "feature", ""); !errors.Is(err, internal.ErrorMergeInProgress) {
+			t.Errorf("Expected a second merge to be refused, got %v", err)
+		}
+
+		if err := os.WriteFile(filepath.Join(repo.GotTree, "a.txt"), []byte("1\nresolved\n3\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		repo.Index.AddOrModifyEntries(repo, []string{"a.txt"})
+		// What it does: without a message, the one of the merge is used.
+		hash, err := internal.CommitIndex(repo, "", internal.CommitOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if description := internal.ReadCommit(repo, hash).Description; !strings.HasPrefix(description, "Merge branch 'feature'") {
+			t.Errorf("Expected the message of the merge, got %q", description)
+		}
+		feature, _ := internal.ResolveRevision(repo, "feature")
+		if parents := internal.ReadCommit(repo, hash).Parents; !slices.Equal(parents, []string{main, feature}) {
+			t.Errorf("Expected the resolution to record both parents, got %v", parents)
+		}
+		if internal.ReadMergeMessage(repo) != "" {
+			t.Errorf("Expected the merge state to be cleared")
+		}
+	})
+
+	t.Run("checkout during a merge", func(t *testing.T) {
+		repo, _ := divergeTesting(t,
+			[]TestingFile{{Name: "a.txt", RelativePath: "a.txt", Data: []byte("1\n2\n3\n")}},
+			[]TestingFile{{Name: "a.txt", RelativePath: "a.txt", Data: []byte("1\ntheirs\n3\n")}},
+			[]TestingFile{{Name: "a.txt", RelativePath: "a.txt", Data: []byte("1\nours\n3\n")}},
+		)
+		if _, err := internal.Merge(repo, "feature", ""); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := internal.Checkout(repo, "feature", false); !errors.Is(err, internal.ErrorMergeInProgress) {
+			t.Errorf("Expected the checkout refused during the merge, got %v", err)
+		}
+		if _, err := internal.Checkout(repo, "feature", true); err != nil {
+			t.Fatal(err)
+		}
+		if internal.ReadMergeMessage(repo) != "" {
+			t.Errorf("Expected the forced checkout to abandon the merge")
+		}
+		feature, _ := internal.ResolveRevision(repo, "feature")
+		hash := commitWorktreeTesting(t, repo, "next", []TestingFile{{Name: "b.txt", RelativePath: "b.txt", Data: []byte("b")}})
+		if parents := internal.ReadCommit(repo, hash).Parents; !slices.Equal(parents, []string{feature}) {
+			t.Errorf("Expected the next commit without the merged one as parent, got %v", parents)
+		}
+	})
+
+	t.Run("refuse to overwrite local changes", func(t *testing.T) {
+		repo, _ := divergeTesting(t,
+			[]TestingFile{{Name: "a.txt", RelativePath: "a.txt", Data: []byte("a")}},
+			[]TestingFile{{Name: "a.txt", RelativePath: "a.txt", Data: []byte("feature")}},
+			[]TestingFile{{Name: "b.txt", RelativePath: "b.txt", Data: []byte("b")}},
+		)
+		if err := os.WriteFile(filepath.Join(repo.GotTree, "a.txt"), []byte("local"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := internal.Merge(repo, "feature", ""); !errors.Is(err, internal.ErrorMergeDirty) {
+			t.Errorf("Expected the merge to be refused, got %v", err)
+		}
+		if content := readFileTesting(repo, "a.txt"); content != "local" {
+			t.Errorf("Expected the local change kept, got %q", content)
+		}
+	})
+
+	t.Run("refuse paths out of the worktree", func(t *testing.T) {
+		repo, first := divergeTesting(t,
+			[]TestingFile{{Name: "a.txt", RelativePath: "a.txt", Data: []byte("a")}},
+			[]TestingFile{{Name: "b.txt", RelativePath: "b.txt", Data: []byte("b")}},
+			[]TestingFile{{Name: "c.txt", RelativePath: "c.txt", Data: []byte("c")}},
+		)
+		config, _ := os.ReadFile(filepath.Join(repo.GotDir, "config"))
+		unsafe := unsafeCommitTesting(repo, first, map[string]string{"a.txt": "a", ".got/config": "owned"})
+		if _, err := internal.Merge(repo, unsafe, ""); !errors.Is(err, internal.ErrorInvalidTreePath) {
+			t.Errorf("Expected the merge to be refused, got %v", err)
+		}
+		if content, _ := os.ReadFile(filepath.Join(repo.GotDir, "config")); string(content) != string(config) {
+			t.Errorf("Expected the repository folder untouched, got %q", content)
+		}
+	})
+}
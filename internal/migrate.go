@@ -0,0 +1,274 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// The objects are encoded with the object format already.
+	ErrorObjectFormatCurrent = errors.New("the objects are in git format already")
+)
+
+const (
+	// The former object id to new object id mapping of a migration in progress, one "former new" pair per line.
+	migrationMapFile = "MIGRATE_MAP"
+	// The folder of the new objects until the mapping is complete, objects/xx/yyyy alike.
+	migrationObjectsDir = "migrate-objects"
+)
+
+// Rewrite the objects of the repository in git format. As the hashes change, the trees, commits, refs and index
+// pointing to the former objects are rewritten to point to the new ones. The former objects are deleted once
+// everything points to the new ones.
+//
+// The migration goes in steps so that an interrupted one is finished by running it again:
+//  1. The new objects are written apart, in migrate-objects, and the mapping is written in MIGRATE_MAP. An
+//     interruption leaves the repository as it was, the objects written already are kept for the next run.
+//  2. The new objects join the former ones and core.objectformat is switched to git.
+//  3. The refs and the index are rewritten, then the former objects and MIGRATE_MAP deleted. Each step is done again
+//     when MIGRATE_MAP is found, the refs and entries pointing to the new objects already are left as they are.
+//
+// It returns the former object id to new object id mapping.
+func MigrateObjects(repo *GotRepository) (map[string]string, error) {
+	mapping, err := readMigrationMap(repo)
+	if err != nil {
+		return nil, err
+	}
+	if mapping == nil {
+		if mapping, err = migrateObjectsApart(repo); err != nil {
+			return nil, err
+		}
+	}
+	// Implementation to move the new objects among the former ones, then switch the object format.
+	staged := filepath.Join(repo.GotDir, migrationObjectsDir)
+	for _, hash := range mapping {
+		from := filepath.Join(staged, hash[:2], hash[2:])
+		to := filepath.Join(repo.GotDir, gotRepositoryDirObjects, hash[:2], hash[2:])
+		if !pathExist(from, false) {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+			return nil, err
+		}
+		if err := os.Rename(from, to); err != nil {
+			return nil, err
+		}
+	}
+	if err := syncDir(filepath.Join(repo.GotDir, gotRepositoryDirObjects)); err != nil {
+		return nil, err
+	}
+	config := repo.GetConfiguration()
+	config.Core.ObjectFormat = ObjectFormatGit
+	if err := repo.SetConfiguration(config); err != nil {
+		return nil, err
+	}
+	// Implementation to point the refs to the new commits.
+	err = filepath.WalkDir(filepath.Join(repo.GotDir, gotRepositoryDirRefs), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || strings.HasSuffix(path, lockSuffix) {
+			return err
+		}
+		return migrateRefFile(repo, mapping, path)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range []string{"HEAD", mergeHeadFile} {
+		if err := migrateRefFile(repo, mapping, filepath.Join(repo.GotDir, file)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	// Implementation to point the index to the new blobs.
+	for i, entry := range repo.Index.Entries {
+		if hash, ok := mapping[entry.Hash]; ok {
+			repo.Index.Entries[i].Hash = hash
+		}
+	}
+	if err := repo.Index.Persist(repo); err != nil {
+		return nil, err
+	}
+	// Implementation to delete the former objects, then the mapping: the migration is complete.
+	migrated := make(map[string]bool)
+	for _, hash := range mapping {
+		migrated[hash] = true
+	}
+	for hash := range mapping {
+		if migrated[hash] {
+			continue
+		}
+		if err := RemoveObjectFrom(repo, hash); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		os.Remove(filepath.Join(repo.GotDir, gotRepositoryDirObjects, hash[:2]))
+	}
+	if err := os.RemoveAll(staged); err != nil {
+		return nil, err
+	}
+	if err := os.Remove(filepath.Join(repo.GotDir, migrationMapFile)); err != nil {
+		return nil, err
+	}
+	return mapping, nil
+}
+
+// Write the objects in git format into migrate-objects, then their mapping into MIGRATE_MAP. The objects of the
+// repository are left as they are.
+func migrateObjectsApart(repo *GotRepository) (map[string]string, error) {
+	from, to := repo.ObjectFormat(), ObjectFormat(gitFormat{})
+	if from.Name() == to.Name() {
+		return nil, ErrorObjectFormatCurrent
+	}
+	hashes, err := listLooseObjects(filepath.Join(repo.GotDir, gotRepositoryDirObjects))
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Join(repo.GotDir, migrationObjectsDir), 0755); err != nil {
+		return nil, err
+	}
+	migration := &objectMigration{repo: repo, from: from, to: to, mapping: make(map[string]string)}
+	for _, hash := range hashes {
+		if _, err := migration.migrate(hash); err != nil {
+			return nil, err
+		}
+	}
+	var content bytes.Buffer
+	for former, hash := range migration.mapping {
+		fmt.Fprintf(&content, "%s %s\n", former, hash)
+	}
+	if err := syncDir(filepath.Join(repo.GotDir, migrationObjectsDir)); err != nil {
+		return nil, err
+	}
+	if err := CreateOrUpdateRepoFile(repo, migrationMapFile, content.Bytes()); err != nil {
+		return nil, err
+	}
+	return migration.mapping, nil
+}
+
+// The mapping of the migration in progress, nil when there is none.
+func readMigrationMap(repo *GotRepository) (map[string]string, error) {
+	content, err := os.ReadFile(filepath.Join(repo.GotDir, migrationMapFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	mapping := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+		former, hash, ok := strings.Cut(line, " ")
+		if !ok || !isHexString(former) || !isHexString(hash) || len(former) != 40 || len(hash) != 40 {
+			return nil, fmt.Errorf("%w: %s", ErrorMalformedObject, migrationMapFile)
+		}
+		mapping[former] = hash
+	}
+	return mapping, nil
+}
+
+type objectMigration struct {
+	repo     *GotRepository
+	from, to ObjectFormat
+	// Former object id to new object id.
+	mapping map[string]string
+}
+
+// Rewrite the object and the objects it points to. Returns the new object id.
+func (m *objectMigration) migrate(hash string) (string, error) {
+	if migrated, ok := m.mapping[hash]; ok {
+		return migrated, nil
+	}
+	header, data, err := readObjectWith(m.repo, m.from, hash)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", hash, err)
+	}
+	var object GotObject
+	switch header {
+	case BlobHeaderName:
+		object = rawData(data)
+	case TreeHeaderName:
+		tree, err := m.from.DecodeTree(TreeItem{Mode: TreeMode}, data)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", hash, err)
+		}
+		for i, child := range tree.Children {
+			if tree.Children[i].Hash, err = m.migrate(child.Hash); err != nil {
+				return "", err
+			}
+		}
+		object = tree
+	case CommitHeaderName:
+		commit := Commit{}.Deserialize(data)
+		if commit.Tree, err = m.migrate(commit.Tree); err != nil {
+			return "", err
+		}
+		for i, parent := range commit.Parents {
+			if commit.Parents[i], err = m.migrate(parent); err != nil {
+				return "", err
+			}
+		}
+		object = commit
+	default:
+		return "", fmt.Errorf("%s: %w", hash, ErrorIncorrectOBjectType)
+	}
+	// What it does: the new objects are kept apart until the mapping is complete, see MigrateObjects.
+	rawObj := m.to.Encode(header, serializeObject(m.to, object))
+	migrated := string(CreateSha1(rawObj))
+	if !isPacked(m.repo, migrated) {
+		if _, err := writeLooseObject(filepath.Join(m.repo.GotDir, migrationObjectsDir), rawObj); err != nil {
+			return "", err
+		}
+	}
+	m.mapping[hash] = migrated
+	return migrated, nil
+}
+
+// Rewrite the ref file when it points to a migrated object. Symbolic refs are left as they are.
+func migrateRefFile(repo *GotRepository, mapping map[string]string, path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	migrated, ok := mapping[strings.TrimSpace(string(content))]
+	if !ok {
+		return nil
+	}
+	// What it does: the ref is written as any other, under its lock.
+	name, err := filepath.Rel(repo.GotDir, path)
+	if err != nil {
+		return err
+	}
+	return CreateOrUpdateRepoFile(repo, name, []byte(migrated))
+}
+
+// The object ids of the loose objects in the objects folder, objects/xx/yyyy.
+func listLooseObjects(objectsDir string) ([]string, error) {
+	hashes := make([]string, 0)
+	dirs, err := os.ReadDir(objectsDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range dirs {
+		if !dir.IsDir() || len(dir.Name()) != 2 || !isHexString(dir.Name()) {
+			continue
+		}
+		files, err := os.ReadDir(filepath.Join(objectsDir, dir.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			if hash := dir.Name() + file.Name(); len(hash) == 40 && isHexString(hash) {
+				hashes = append(hashes, hash)
+			}
+		}
+	}
+	return hashes, nil
+}
+
+// Object data as it is.
+type rawData []byte
+
+func (r rawData) Serialize() []byte {
+	return bytes.Clone(r)
+}
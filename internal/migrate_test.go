@@ -0,0 +1,190 @@
+package internal_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	internal "github.com/danielrrv/got/internal"
+)
+
+func TestMigrateObjects(t *testing.T) {
+	t.Run("rewrite the store in git format", func(t *testing.T) {
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		setObjectFormatTesting(t, repo, internal.ObjectFormatGot)
+		base := commitWorktreeTesting(t, repo, "base", []TestingFile{
+			{Name: "a.txt", RelativePath: "a.txt", Data: []byte("1\n2\n3\n")},
+			{Name: "b.c", RelativePath: "src/lib/b.c", Data: []byte("hello\n")},
+		})
+		internal.CreateBranch(repo, "feature", "")
+		internal.Checkout(repo, "feature", false)
+		commitWorktreeTesting(t, repo, "feature", []TestingFile{{Name: "a.txt", RelativePath: "a.txt", Data: []byte("one\n2\n3\n")}})
+		internal.Checkout(repo, "main", false)
+		commitWorktreeTesting(t, repo, "main", []TestingFile{{Name: "a.txt", RelativePath: "a.txt", Data: []byte("1\n2\nthree\n")}})
+		merge, err := internal.Merge(repo, "feature", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// A staged file not committed yet.
+		CreateFilesTesting(repo.GotTree, nil, []TestingFile{{Name: "new.txt", RelativePath: "new.txt", Data: []byte("new\n")}})
+		repo.Index.AddOrModifyEntries(repo, []string{"new.txt"})
+		repo.Index.Persist(repo)
+		mergeTree := internal.ReadTree(repo, internal.ReadCommit(repo, merge.Hash).Tree)
+		before := mergeTree.FlatItems()
+
+		mapping, err := internal.MigrateObjects(repo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name := repo.ObjectFormat().Name(); name != internal.ObjectFormatGit {
+			t.Errorf("Expected the config to switch to git format, got %s", name)
+		}
+		head, err := internal.ResolveRevision(repo, "HEAD")
+		if err != nil || head != mapping[merge.Hash] {
+			t.Fatalf("Expected HEAD to point to the migrated merge commit, got %s %v", head, err)
+		}
+		commit := internal.ReadCommit(repo, head)
+		if len(commit.Parents) != 2 || commit.Description != "Merge branch 'feature'" {
+			t.Errorf("Expected the merge commit with both parents, got %v", commit)
+		}
+		feature, _ := internal.ResolveRevision(repo, "feature")
+		if commit.Parents[1] != feature {
+			t.Errorf("Expected the feature branch to point to the migrated commit")
+		}
+		if _, ok := mapping[base]; !ok {
+			t.Errorf("Expected the root commit to be migrated")
+		}
+		tree := internal.ReadTree(repo, commit.Tree)
+		after := tree.FlatItems()
+		if len(after) != len(before) {
+			t.Fatalf("Expected the same blobs, got %v", after)
+		}
+		for i, blob := range after {
+			if blob.Path != before[i].Path || blob.Hash != mapping[before[i].Hash] {
+				t.Errorf("Expected %s to be remapped, got %v", before[i].Path, blob)
+			}
+		}
+		// git hash-object of "hello\n".
+		if blob := after[slices.IndexFunc(after, func(ti internal.TreeItem) bool { return ti.Path == "src/lib/b.c" })]; blob.Hash != "ce013625030ba8dba906f756967f9e9ca394464a" {
+			t.Errorf("Expected the git hash of the blob, got %s", blob.Hash)
+		}
+		entries, err := internal.Log(repo, "", internal.LogOptions{})
+		if err != nil || len(entries) != 4 {
+			t.Errorf("Expected the whole history to be readable, got %d %v", len(entries), err)
+		}
+
+		reloaded, _ := internal.FindOrCreateRepo(repo.GotTree)
+		for _, entry := range reloaded.Index.Entries {
+			userHash, _ := internal.BlobFromUserPath(reloaded, entry.PathName)
+			if entry.Hash != userHash.Hash {
+				t.Errorf("Expected the index entry %s to match the worktree, got %s", entry.PathName, entry.Hash)
+			}
+		}
+		if _, err := internal.CommitIndex(reloaded, "add new", internal.CommitOptions{}); err != nil {
+			t.Errorf("Expected to commit on top of the migrated history, got %v", err)
+		}
+		for old := range mapping {
+			if _, err := os.Stat(filepath.Join(repo.GotDir, "objects", old[:2], old[2:])); !os.IsNotExist(err) {
+				t.Errorf("Expected the former object %s to be deleted", old)
+			}
+		}
+	})
+
+	t.Run("respect the locks of the refs", func(t *testing.T) {
+		defer internal.LockTimeoutTesting(50 * time.Millisecond)()
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		setObjectFormatTesting(t, repo, internal.ObjectFormatGot)
+		main := commitWorktreeTesting(t, repo, "main", []TestingFile{{Name: "a.txt", RelativePath: "a.txt", Data: []byte("a\n")}})
+		mainPath := filepath.Join(repo.GotDir, "refs", "heads", "main")
+		os.WriteFile(mainPath+".lock", []byte(fmt.Sprintf("%d\n", os.Getpid())), 0644)
+		if _, err := internal.MigrateObjects(repo); !errors.Is(err, internal.ErrorLocked) {
+			t.Errorf("Expected the locked ref refused, got %v", err)
+		}
+		if content, _ := os.ReadFile(mainPath); string(content) != main {
+			t.Errorf("Expected the locked ref untouched, got %q", content)
+		}
+	})
+
+	t.Run("finish an interrupted migration", func(t *testing.T) {
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		setObjectFormatTesting(t, repo, internal.ObjectFormatGot)
+		commitWorktreeTesting(t, repo, "first", []TestingFile{{Name: "a.txt", RelativePath: "a.txt", Data: []byte("a\n")}})
+		head := commitWorktreeTesting(t, repo, "second", []TestingFile{{Name: "b.txt", RelativePath: "src/b.txt", Data: []byte("b\n")}})
+		interrupted := errors.New("killed")
+		// What it does: the process is killed while the new objects are written.
+		written := 0
+		restore := internal.InterruptWritesTesting(func(tmpPath string) error {
+			if written++; written == 3 {
+				return interrupted
+			}
+			return nil
+		})
+		_, err = internal.MigrateObjects(repo)
+		restore()
+		if !errors.Is(err, interrupted) {
+			t.Fatalf("Expected the migration interrupted, got %v", err)
+		}
+		if name := repo.ObjectFormat().Name(); name != internal.ObjectFormatGot {
+			t.Errorf("Expected the former object format kept, got %s", name)
+		}
+		if entries, err := internal.Log(repo, "", internal.LogOptions{}); err != nil || len(entries) != 2 {
+			t.Errorf("Expected the repository readable as it was, got %v %v", entries, err)
+		}
+		// What it does: the process is killed while the refs are rewritten, after the object format switched.
+		restore = internal.InterruptWritesTesting(func(tmpPath string) error {
+			if strings.Contains(filepath.Base(tmpPath), "main") {
+				return interrupted
+			}
+			return nil
+		})
+		_, err = internal.MigrateObjects(repo)
+		restore()
+		if !errors.Is(err, interrupted) {
+			t.Fatalf("Expected the migration interrupted, got %v", err)
+		}
+		if !pathExistTesting(filepath.Join(repo.GotDir, "MIGRATE_MAP")) {
+			t.Errorf("Expected the mapping kept to finish the migration")
+		}
+		reloaded, _ := internal.FindOrCreateRepo(repo.GotTree)
+		mapping, err := internal.MigrateObjects(reloaded)
+		if err != nil {
+			t.Fatalf("Expected the migration finished, got %v", err)
+		}
+		if resolved, _ := internal.ResolveRevision(reloaded, "HEAD"); resolved != mapping[head] {
+			t.Errorf("Expected HEAD to point to the migrated commit, got %s", resolved)
+		}
+		if entries, err := internal.Log(reloaded, "", internal.LogOptions{}); err != nil || len(entries) != 2 {
+			t.Errorf("Expected the history readable in git format, got %v %v", entries, err)
+		}
+		if pathExistTesting(filepath.Join(repo.GotDir, "MIGRATE_MAP")) || pathExistTesting(filepath.Join(repo.GotDir, "migrate-objects")) {
+			t.Errorf("Expected the state of the migration deleted")
+		}
+		if _, err := internal.MigrateObjects(reloaded); !errors.Is(err, internal.ErrorObjectFormatCurrent) {
+			t.Errorf("Expected nothing left to migrate, got %v", err)
+		}
+	})
+
+	t.Run("nothing to migrate", func(t *testing.T) {
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := internal.MigrateObjects(repo); !errors.Is(err, internal.ErrorObjectFormatCurrent) {
+			t.Errorf("Expected the git format to be current, got %v", err)
+		}
+	})
+}
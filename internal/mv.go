@@ -0,0 +1,122 @@
+package internal
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+var (
+	// The file or folder to move has no tracked file.
+	ErrorNotTracked = errors.New("not under version control")
+	// The destination of the move exists. Force overwrites a file.
+	ErrorMoveDestinationExists = errors.New("destination exists, use -f to overwrite it")
+	// Several files are moved to a destination that is not a folder.
+	ErrorMoveDestinationNotFolder = errors.New("destination is not a folder")
+	// The file to move is conflicted, it is resolved first.
+	ErrorMoveConflicted = errors.New("conflicted file, resolve it first")
+	// A folder is moved into itself.
+	ErrorMoveIntoItself = errors.New("cannot move a folder into itself")
+)
+
+// A tracked file moved, relative to the worktree.
+type MovedFile struct {
+	From string
+	To   string
+}
+
+// Move or rename the tracked files and folders, relative to the folder pwd inside the worktree, in the worktree and
+// the index together. The sources are moved into the destination when it is a folder, the destination must be one for
+// several sources. The staged content is kept, the next commit records the renames.
+//
+// Nothing is moved when a source is not tracked or conflicted, or a destination exists, unless it is a file and force.
+func Move(repo *GotRepository, pwd string, sources []string, destination string, force bool) ([]MovedFile, error) {
+	dst, err := newPathspec(repo, pwd, destination)
+	if err != nil {
+		return nil, err
+	}
+	dstIsDir := pathExist(filepath.Join(repo.GotTree, dst.path), true)
+	if len(sources) > 1 && !dstIsDir {
+		return nil, fmt.Errorf("%w: %s", ErrorMoveDestinationNotFolder, destination)
+	}
+	// What it does: the sources are moved as a whole, untracked files included, and their tracked files one by one.
+	moves := make([]MovedFile, 0)
+	moved := make([]MovedFile, 0)
+	for _, given := range sources {
+		src, err := newPathspec(repo, pwd, given)
+		if err != nil {
+			return nil, err
+		}
+		target := dst.path
+		if dstIsDir {
+			target = path.Join(dst.path, path.Base(src.path))
+		}
+		if target == src.path || strings.HasPrefix(target, src.path+"/") {
+			return nil, fmt.Errorf("%w: %s", ErrorMoveIntoItself, given)
+		}
+		srcPath := filepath.Join(repo.GotTree, src.path)
+		if !pathExist(srcPath, false) {
+			return nil, fmt.Errorf("%w: %s", ErrorPathDoesNotExist, given)
+		}
+		isDir := pathExist(srcPath, true)
+		for _, entry := range repo.Index.Entries {
+			if entry.PathName != src.path && !strings.HasPrefix(entry.PathName, src.path+"/") {
+				continue
+			}
+			if entry.Stage != 0 {
+				return nil, fmt.Errorf("%w: %s", ErrorMoveConflicted, entry.PathName)
+			}
+			moved = append(moved, MovedFile{From: entry.PathName, To: target + strings.TrimPrefix(entry.PathName, src.path)})
+		}
+		if !slices.ContainsFunc(moved, func(m MovedFile) bool { return m.From == src.path || strings.HasPrefix(m.From, src.path+"/") }) {
+			return nil, fmt.Errorf("%w: %s", ErrorNotTracked, given)
+		}
+		if pathExist(filepath.Join(repo.GotTree, target), false) && (isDir || !force || pathExist(filepath.Join(repo.GotTree, target), true)) {
+			return nil, fmt.Errorf("%w: %s", ErrorMoveDestinationExists, target)
+		}
+		moves = append(moves, MovedFile{From: src.path, To: target})
+	}
+
+	// Implementation to move the worktree first, the index follows the files.
+	for _, m := range moves {
+		from, to := filepath.Join(repo.GotTree, m.From), filepath.Join(repo.GotTree, m.To)
+		if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+			return nil, err
+		}
+		if err := os.Rename(from, to); err != nil {
+			return nil, err
+		}
+		removeEmptyDirs(repo, filepath.Dir(from))
+	}
+	targets := make(map[string]string)
+	for _, m := range moved {
+		targets[m.From] = m.To
+	}
+	// What it does: a tracked file overwritten by force is replaced by the moved one.
+	repo.Index.Entries = slices.DeleteFunc(repo.Index.Entries, func(entry IndexEntry) bool {
+		_, isMoved := targets[entry.PathName]
+		return !isMoved && slices.ContainsFunc(moved, func(m MovedFile) bool { return m.To == entry.PathName })
+	})
+	// What it does: the stat data recorded is kept, as git does. A file modified since it was staged still differs from
+	// it, and the modification is seen once moved.
+	for i, entry := range repo.Index.Entries {
+		if to, ok := targets[entry.PathName]; ok {
+			repo.Index.Entries[i].PathName = to
+		}
+	}
+	slices.SortStableFunc(repo.Index.Entries, func(a, b IndexEntry) int {
+		return cmp.Compare(a.PathName, b.PathName)
+	})
+	if err := repo.Index.Persist(repo); err != nil {
+		return nil, err
+	}
+	slices.SortFunc(moved, func(a, b MovedFile) int {
+		return cmp.Compare(a.From, b.From)
+	})
+	return moved, nil
+}
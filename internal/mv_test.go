@@ -0,0 +1,108 @@
+package internal_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	internal "github.com/danielrrv/got/internal"
+)
+
+func TestMove(t *testing.T) {
+	files := []TestingFile{
+		{RelativePath: "readme.md", Data: []byte("readme\n")},
+		{RelativePath: "notes.md", Data: []byte("notes\n")},
+		{RelativePath: "src/main.c", Data: []byte("int main;\n")},
+		{RelativePath: "src/lib/util.c", Data: []byte("int util;\n")},
+	}
+
+	t.Run("rename files and folders", func(t *testing.T) {
+		repo, _ := internal.FindOrCreateRepo(t.TempDir())
+		commitWorktreeTesting(t, repo, "first", files)
+		staged := repo.Index.Entries[slices.IndexFunc(repo.Index.Entries, func(entry internal.IndexEntry) bool {
+			return entry.PathName == "src/lib/util.c"
+		})].Hash
+		os.WriteFile(filepath.Join(repo.GotTree, "src/lib/untracked.o"), []byte("obj\n"), 0644)
+		moved, err := internal.Move(repo, filepath.Join(repo.GotTree, "src"), []string{"lib"}, "pkg/util", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(moved) != 1 || moved[0].From != "src/lib/util.c" || moved[0].To != "src/pkg/util/util.c" {
+			t.Errorf("Expected the folder renamed relative to the current folder, got %v", moved)
+		}
+		if !pathExistTesting(filepath.Join(repo.GotTree, "src/pkg/util/untracked.o")) || pathExistTesting(filepath.Join(repo.GotTree, "src/lib")) {
+			t.Errorf("Expected the whole folder moved in the worktree")
+		}
+		if _, err := internal.Move(repo, repo.GotTree, []string{"readme.md", "notes.md"}, "src", false); err != nil {
+			t.Fatal(err)
+		}
+		repo, _ = internal.FindOrCreateRepo(repo.GotTree)
+		if paths := stagedPathsTesting(repo); !slices.Equal(paths, []string{"src/main.c", "src/notes.md", "src/pkg/util/util.c", "src/readme.md"}) {
+			t.Errorf("Expected the index to follow the files, got %v", paths)
+		}
+		if entry := repo.Index.Entries[slices.Index(stagedPathsTesting(repo), "src/pkg/util/util.c")]; entry.Hash != staged {
+			t.Errorf("Expected the staged content kept, got %v", entry)
+		}
+		hash, err := internal.CommitIndex(repo, "move", internal.CommitOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree := internal.ReadTree(repo, internal.ReadCommit(repo, hash).Tree)
+		if items := tree.FlatItems(); len(items) != 4 {
+			t.Errorf("Expected the moved files in the tree, got %v", items)
+		}
+	})
+
+	t.Run("keep the modifications not staged", func(t *testing.T) {
+		repo, _ := internal.FindOrCreateRepo(t.TempDir())
+		commitWorktreeTesting(t, repo, "first", files)
+		os.WriteFile(filepath.Join(repo.GotTree, "readme.md"), []byte("readme edited\n"), 0644)
+		// What it does: the edit is older than the index, its stat data alone would say the file is unchanged.
+		past := time.Now().Add(-time.Hour)
+		os.Chtimes(filepath.Join(repo.GotTree, "readme.md"), past, past)
+		if _, err := internal.Move(repo, repo.GotTree, []string{"readme.md"}, "moved.md", false); err != nil {
+			t.Fatal(err)
+		}
+		repo, _ = internal.FindOrCreateRepo(repo.GotTree)
+		if codes := statusCodesTesting(statusTesting(t, repo), "moved.md"); codes != "RM" {
+			t.Errorf("Expected the move staged and the modification not, got %s", codes)
+		}
+		result, err := internal.Add(repo, repo.GotTree, []string{"moved.md"}, internal.AddOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(result.Added, []string{"moved.md"}) {
+			t.Errorf("Expected the modification staged, got %v", result.Added)
+		}
+	})
+
+	t.Run("refuse to lose files", func(t *testing.T) {
+		repo, _ := internal.FindOrCreateRepo(t.TempDir())
+		commitWorktreeTesting(t, repo, "first", files)
+		os.WriteFile(filepath.Join(repo.GotTree, "untracked.txt"), []byte("new\n"), 0644)
+		if _, err := internal.Move(repo, repo.GotTree, []string{"untracked.txt"}, "other.txt", false); !errors.Is(err, internal.ErrorNotTracked) {
+			t.Errorf("Expected the untracked file refused, got %v", err)
+		}
+		if _, err := internal.Move(repo, repo.GotTree, []string{"readme.md"}, "notes.md", false); !errors.Is(err, internal.ErrorMoveDestinationExists) {
+			t.Errorf("Expected the existing destination refused, got %v", err)
+		}
+		if _, err := internal.Move(repo, repo.GotTree, []string{"src"}, "src/lib", false); !errors.Is(err, internal.ErrorMoveIntoItself) {
+			t.Errorf("Expected the folder moved into itself refused, got %v", err)
+		}
+		if _, err := internal.Move(repo, repo.GotTree, []string{"readme.md", "notes.md"}, "new.md", false); !errors.Is(err, internal.ErrorMoveDestinationNotFolder) {
+			t.Errorf("Expected several files moved to a file refused, got %v", err)
+		}
+		if _, err := internal.Move(repo, repo.GotTree, []string{"readme.md"}, "notes.md", true); err != nil {
+			t.Fatal(err)
+		}
+		if paths := stagedPathsTesting(repo); !slices.Equal(paths, []string{"notes.md", "src/lib/util.c", "src/main.c"}) {
+			t.Errorf("Expected the overwritten file replaced in the index, got %v", paths)
+		}
+		if content, _ := os.ReadFile(filepath.Join(repo.GotTree, "notes.md")); string(content) != "readme\n" {
+			t.Errorf("Expected the destination overwritten, got %q", content)
+		}
+	})
+}
@@ -0,0 +1,289 @@
+package internal
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	// Lines of context around the changes of a hunk.
+	DefaultContextLines = 3
+	// Bytes inspected to decide whether the content is binary. Same as git.
+	binaryProbeSize = 8000
+)
+
+type EditOperation int
+
+const (
+	EditEqual EditOperation = iota
+	EditDelete
+	EditInsert
+)
+
+// A single line of the edit script that turns the old lines into the new ones.
+type LineEdit struct {
+	Operation EditOperation
+	// Index of the line in the old lines. -1 for insertions.
+	OldIndex int
+	// Index of the line in the new lines. -1 for deletions.
+	NewIndex int
+	// The line, terminator included.
+	Text string
+}
+
+// A group of changes with their context in unified format.
+type Hunk struct {
+	// 1-based start of the hunk in the old lines. The line before the hunk when it has no old lines.
+	OldStart int
+	OldLines int
+	// 1-based start of the hunk in the new lines. The line before the hunk when it has no new lines.
+	NewStart int
+	NewLines int
+	// Edits of the hunk, context included.
+	Edits []LineEdit
+}
+
+// Split the content into lines keeping their terminator. The last line may have no terminator.
+func SplitLines(content []byte) []string {
+	lines := strings.SplitAfter(string(content), "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// Determine whether the content is binary. Like git, content with a NUL byte in its first 8000 bytes is binary.
+func IsBinary(content []byte) bool {
+	return bytes.IndexByte(content[:min(len(content), binaryProbeSize)], 0x00) >= 0
+}
+
+// Compute the shortest edit script between the old and the new lines with Myers' O(ND) algorithm, in linear space:
+// the middle snake of the shortest path splits the lines in two halves diffed the same way, see middleSnake.
+//
+// The deletions of a change come before its insertions, as git shows them.
+//
+// See "An O(ND) Difference Algorithm and Its Variations", Eugene W. Myers, 1986.
+func DiffLines(a, b []string) []LineEdit {
+	offset := len(a) + len(b) + 1
+	// What it does: both searches of every middleSnake share the same diagonals, each one only reads the ones it wrote.
+	forward, backward := make([]int, 2*offset+1), make([]int, 2*offset+1)
+	edits := diffRange(a, b, 0, 0, forward, backward, make([]LineEdit, 0, len(a)+len(b)))
+	return deletionsFirst(edits)
+}
+
+// Append the edit script between the lines a and b, found at aStart and bStart of the whole old and new lines.
+func diffRange(a, b []string, aStart, bStart int, forward, backward []int, edits []LineEdit) []LineEdit {
+	equal := func(edits []LineEdit, x, y, length int) []LineEdit {
+		for i := 0; i < length; i++ {
+			edits = append(edits, LineEdit{Operation: EditEqual, OldIndex: aStart + x + i, NewIndex: bStart + y + i, Text: a[x+i]})
+		}
+		return edits
+	}
+	// Implementation to take the common prefix and suffix out, the middle snake needs a change on both ends.
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	edits = equal(edits, 0, 0, prefix)
+	n, m := len(a)-prefix-suffix, len(b)-prefix-suffix
+	switch {
+	case n == 0:
+		for y := prefix; y < prefix+m; y++ {
+			edits = append(edits, LineEdit{Operation: EditInsert, OldIndex: -1, NewIndex: bStart + y, Text: b[y]})
+		}
+	case m == 0:
+		for x := prefix; x < prefix+n; x++ {
+			edits = append(edits, LineEdit{Operation: EditDelete, OldIndex: aStart + x, NewIndex: -1, Text: a[x]})
+		}
+	default:
+		subA, subB := a[prefix:prefix+n], b[prefix:prefix+m]
+		x, y, u, v := middleSnake(subA, subB, forward, backward)
+		edits = diffRange(subA[:x], subB[:y], aStart+prefix, bStart+prefix, forward, backward, edits)
+		edits = equal(edits, prefix+x, prefix+y, u-x)
+		edits = diffRange(subA[u:], subB[v:], aStart+prefix+u, bStart+prefix+v, forward, backward, edits)
+	}
+	return equal(edits, len(a)-suffix, len(b)-suffix, suffix)
+}
+
+// Find the middle snake of the shortest edit script between a and b, both with a change on their first and last
+// lines: the snake from (x, y) to (u, v) where the search from the start and the one from the end meet. The shortest
+// path goes through it, each half holds half of the changes.
+//
+// The diagonals k = x - y of forward keep the furthest x of the search from the start, the ones of backward the
+// furthest distance from the end, on the diagonal delta - k.
+func middleSnake(a, b []string, forward, backward []int) (int, int, int, int) {
+	n, m := len(a), len(b)
+	delta := n - m
+	offset := (len(forward) - 1) / 2
+	forward[offset+1], backward[offset+1] = 0, 0
+	for d := 0; d <= (n+m+1)/2; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && forward[offset+k-1] < forward[offset+k+1]) {
+				x = forward[offset+k+1]
+			} else {
+				x = forward[offset+k-1] + 1
+			}
+			y := x - k
+			startX, startY := x, y
+			for x < n && y < m && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			forward[offset+k] = x
+			// What it does: with an odd delta, the paths meet on a step of the search from the start.
+			if c := delta - k; delta%2 != 0 && c >= -(d-1) && c <= d-1 && x+backward[offset+c] >= n {
+				return startX, startY, x, y
+			}
+		}
+		for c := -d; c <= d; c += 2 {
+			var x int
+			if c == -d || (c != d && backward[offset+c-1] < backward[offset+c+1]) {
+				x = backward[offset+c+1]
+			} else {
+				x = backward[offset+c-1] + 1
+			}
+			y := x - c
+			startX, startY := x, y
+			for x < n && y < m && a[n-1-x] == b[m-1-y] {
+				x, y = x+1, y+1
+			}
+			backward[offset+c] = x
+			// What it does: with an even delta, the paths meet on a step of the search from the end.
+			if k := delta - c; delta%2 == 0 && k >= -d && k <= d && forward[offset+k]+x >= n {
+				return n - x, m - y, n - startX, m - startY
+			}
+		}
+	}
+	panic("the searches of the middle snake never met")
+}
+
+// Put the deletions of each change before its insertions. The halves of the middle snakes may interleave them.
+func deletionsFirst(edits []LineEdit) []LineEdit {
+	for start := 0; start < len(edits); {
+		if edits[start].Operation == EditEqual {
+			start++
+			continue
+		}
+		end := start
+		for end < len(edits) && edits[end].Operation != EditEqual {
+			end++
+		}
+		slices.SortStableFunc(edits[start:end], func(x, y LineEdit) int {
+			return cmp.Compare(x.Operation, y.Operation)
+		})
+		start = end
+	}
+	return edits
+}
+
+// Group the edit script into hunks with the given lines of context around the changes.
+func UnifiedHunks(edits []LineEdit, context int) []Hunk {
+	hunks := make([]Hunk, 0)
+	for i := 0; i < len(edits); {
+		if edits[i].Operation == EditEqual {
+			i++
+			continue
+		}
+		start := max(0, i-context)
+		end := i
+		// What it does: extend the hunk while the next change is close enough to share the context.
+		for j := i; j < len(edits); j++ {
+			if edits[j].Operation != EditEqual {
+				end = j
+				continue
+			}
+			if j-end > 2*context {
+				break
+			}
+		}
+		end = min(len(edits)-1, end+context)
+		hunks = append(hunks, newHunk(edits, start, end))
+		i = end + 1
+	}
+	return hunks
+}
+
+func newHunk(edits []LineEdit, start, end int) Hunk {
+	hunk := Hunk{Edits: edits[start : end+1]}
+	// Lines before the hunk on each side.
+	for _, edit := range edits[:start] {
+		if edit.Operation != EditInsert {
+			hunk.OldStart++
+		}
+		if edit.Operation != EditDelete {
+			hunk.NewStart++
+		}
+	}
+	for _, edit := range hunk.Edits {
+		if edit.Operation != EditInsert {
+			hunk.OldLines++
+		}
+		if edit.Operation != EditDelete {
+			hunk.NewLines++
+		}
+	}
+	if hunk.OldLines > 0 {
+		hunk.OldStart++
+	}
+	if hunk.NewLines > 0 {
+		hunk.NewStart++
+	}
+	return hunk
+}
+
+// Header of the hunk, @@ -start,lines +start,lines @@. The lines are omitted when there is exactly one, as git does.
+func (h Hunk) Header() string {
+	format := func(start, lines int) string {
+		if lines == 1 {
+			return fmt.Sprintf("%d", start)
+		}
+		return fmt.Sprintf("%d,%d", start, lines)
+	}
+	return fmt.Sprintf("@@ -%s +%s @@", format(h.OldStart, h.OldLines), format(h.NewStart, h.NewLines))
+}
+
+// Body of the hunk in unified format.
+func (h Hunk) String() string {
+	var out strings.Builder
+	out.WriteString(h.Header())
+	out.WriteByte(newLine)
+	for _, edit := range h.Edits {
+		switch edit.Operation {
+		case EditEqual:
+			out.WriteByte(' ')
+		case EditDelete:
+			out.WriteByte('-')
+		case EditInsert:
+			out.WriteByte('+')
+		}
+		out.WriteString(edit.Text)
+		if !strings.HasSuffix(edit.Text, "\n") {
+			out.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+	return out.String()
+}
+
+// Unified diff of the contents without file headers. Binary contents are reported as such.
+func UnifiedDiff(oldName, newName string, oldContent, newContent []byte, context int) string {
+	if IsBinary(oldContent) || IsBinary(newContent) {
+		return fmt.Sprintf("Binary files %s and %s differ\n", oldName, newName)
+	}
+	hunks := UnifiedHunks(DiffLines(SplitLines(oldContent), SplitLines(newContent)), context)
+	if len(hunks) == 0 {
+		return ""
+	}
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", oldName, newName)
+	for _, hunk := range hunks {
+		out.WriteString(hunk.String())
+	}
+	return out.String()
+}
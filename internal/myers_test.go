@@ -0,0 +1,107 @@
+package internal_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	internal "github.com/danielrrv/got/internal"
+)
+
+func TestMyers(t *testing.T) {
+	t.Run("shortest edit script", func(t *testing.T) {
+		a := strings.Split("ABCABBA", "")
+		b := strings.Split("CBABAC", "")
+		edits := internal.DiffLines(a, b)
+		changes := 0
+		oldLines, newLines := make([]string, 0), make([]string, 0)
+		for _, edit := range edits {
+			if edit.Operation != internal.EditEqual {
+				changes++
+			}
+			if edit.Operation != internal.EditInsert {
+				oldLines = append(oldLines, edit.Text)
+			}
+			if edit.Operation != internal.EditDelete {
+				newLines = append(newLines, edit.Text)
+			}
+		}
+		// The example of Myers' paper has a distance of 5.
+		if changes != 5 {
+			t.Errorf("Expected 5 changes, got %d", changes)
+		}
+		if strings.Join(oldLines, "") != "ABCABBA" || strings.Join(newLines, "") != "CBABAC" {
+			t.Errorf("Expected the edit script to rebuild both sequences")
+		}
+		if len(internal.DiffLines(nil, nil)) != 0 {
+			t.Errorf("Expected no edits between empty sequences")
+		}
+	})
+	t.Run("unified hunks with context", func(t *testing.T) {
+		old := make([]string, 0)
+		for _, line := range strings.Split("1 2 3 4 5 6 7 8 9 10 11 12 13 14 15 16 17 18 19 20", " ") {
+			old = append(old, line+"\n")
+		}
+		current := append([]string{}, old...)
+		current[1] = "two\n"
+		current[17] = "eighteen\n"
+		hunks := internal.UnifiedHunks(internal.DiffLines(old, current), 3)
+		if len(hunks) != 2 {
+			t.Fatalf("Expected distant changes in 2 hunks, got %d", len(hunks))
+		}
+		if hunks[0].Header() != "@@ -1,5 +1,5 @@" || hunks[1].Header() != "@@ -15,6 +15,6 @@" {
+			t.Errorf("Unexpected headers %s and %s", hunks[0].Header(), hunks[1].Header())
+		}
+		current[5] = "six\n"
+		if hunks := internal.UnifiedHunks(internal.DiffLines(old, current), 3); len(hunks) != 2 || hunks[0].Header() != "@@ -1,9 +1,9 @@" {
+			t.Errorf("Expected close changes to share a hunk, got %v", hunks)
+		}
+		if hunks := internal.UnifiedHunks(internal.DiffLines(old, current), 0); len(hunks) != 3 {
+			t.Errorf("Expected a hunk per change without context, got %d", len(hunks))
+		}
+	})
+	t.Run("unified diff", func(t *testing.T) {
+		diff := internal.UnifiedDiff("a/readme.md", "b/readme.md", []byte("a\nb\nc\n"), []byte("a\nB\nc"), 3)
+		expected := "--- a/readme.md\n+++ b/readme.md\n@@ -1,3 +1,3 @@\n a\n-b\n-c\n+B\n+c\n\\ No newline at end of file\n"
+		if diff != expected {
+			t.Errorf("Expected\n%s\ngot\n%s", expected, diff)
+		}
+		diff = internal.UnifiedDiff("/dev/null", "b/readme.md", nil, []byte("a\n"), 3)
+		if !strings.Contains(diff, "@@ -0,0 +1 @@\n+a\n") {
+			t.Errorf("Expected the added file hunk, got\n%s", diff)
+		}
+		if diff := internal.UnifiedDiff("a/x", "b/x", []byte("same\n"), []byte("same\n"), 3); diff != "" {
+			t.Errorf("Expected no diff for the same content, got %s", diff)
+		}
+		if diff := internal.UnifiedDiff("a/x", "b/x", []byte("text"), []byte{0x01, 0x00, 0x02}, 3); diff != "Binary files a/x and b/x differ\n" {
+			t.Errorf("Expected binary files to be reported, got %s", diff)
+		}
+	})
+	t.Run("large inputs fully changed", func(t *testing.T) {
+		// What it does: keeping the diagonals of every step, 10000 steps here, would take hundreds of megabytes.
+		old, current := make([]string, 5000), make([]string, 5000)
+		for i := range old {
+			old[i], current[i] = fmt.Sprintf("old %d\n", i), fmt.Sprintf("new %d\n", i)
+		}
+		current[2500] = old[2500]
+		edits := internal.DiffLines(old, current)
+		if len(edits) != 9999 {
+			t.Fatalf("Expected every line changed but one, got %d edits", len(edits))
+		}
+		for i, edit := range edits {
+			expected := internal.EditDelete
+			switch {
+			case i == 5000:
+				expected = internal.EditEqual
+			case i >= 2500 && i < 5000 || i >= 7500:
+				expected = internal.EditInsert
+			}
+			if edit.Operation != expected {
+				t.Fatalf("Expected the deletions of each change before its insertions, got %+v at %d", edit, i)
+			}
+		}
+		if hunks := internal.UnifiedHunks(edits, 3); len(hunks) != 1 || hunks[0].Header() != "@@ -1,5000 +1,5000 @@" {
+			t.Errorf("Expected a single hunk, got %d", len(hunks))
+		}
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"crypto/sha1"
 	"encoding/hex"
 	"errors"
+	"fmt"
 	"io"
 	"io/fs"
 	"os"
@@ -17,9 +18,11 @@ import (
 const (
 	newLine          = '\n'
 	tab              = '\t'
+	space            = ' '
 	CommitHeaderName = string("commit")
 	TreeHeaderName   = string("tree")
 	BlobHeaderName   = string("blob")
+	TagHeaderName    = string("tag")
 )
 
 var (
@@ -74,29 +77,60 @@ func Decompress(b []byte, c *bytes.Buffer) {
 
 // Read any got object given the hash/object id and header(commit, tree, tags, blob)
 func ReadObject(repo *GotRepository, header string, hash string) ([]byte, error) {
-	//decompress(header[unbound size uint8]|0x20[uint8 x 1]|size[uint32 x 1]|0x00[uint8 x 1]|data[unbound size uint8])
-	sizePos := len(header) + 1
-	// dataStartPos := len(header) + 3	
-	content, err := os.ReadFile(filepath.Join(repo.GotDir, gotRepositoryDirObjects, hash[:2], hash[2:]))
+	objectType, data, err := readObjectWith(repo, repo.ObjectFormat(), hash)
 	if err != nil {
 		return nil, err
 	}
-	// Decompress the object.
-	var bb bytes.Buffer
-	Decompress(content, &bb)
-	if !bytes.Equal(bb.Bytes()[0:len(header)], []byte(header)){
+	if objectType != header {
 		return nil, ErrorIncorrectOBjectType
 	}
-	//Implementation to validate the correctness at this point.
-	if bb.Bytes()[len(header)] != 0x20 {
-		return nil, ErrorMalformedObject
-	}
-	//Size of data is uint32
-	sizeOfData := Bit32FromBytes(bb.Bytes()[sizePos:sizePos + 4])
-	// after :sizePos + 4, data comes.
-	data := bb.Bytes()[sizePos+5: sizePos + 5 + int(sizeOfData)]
 	return data, nil
+}
+
+// Read the object encoded with the given format. Returns its type and data.
+//
+// The object is looked for in the packs when it is not loose.
+func readObjectWith(repo *GotRepository, format ObjectFormat, hash string) (string, []byte, error) {
+	objPath, err := HashToPath(repo, hash)
+	if err != nil {
+		return "", nil, err
+	}
+	header, data, err := readLooseObject(objPath, format)
+	if errors.Is(err, os.ErrNotExist) {
+		if header, data, packErr := readPackedObject(repo, hash); packErr == nil {
+			return header, data, nil
+		} else if !errors.Is(packErr, ErrorNotInPack) {
+			return "", nil, packErr
+		}
+	}
+	return header, data, err
+}
 
+// Read the loose object file encoded with the given format. Returns its type and data.
+func readLooseObject(objPath string, format ObjectFormat) (string, []byte, error) {
+	content, err := os.ReadFile(objPath)
+	if err != nil {
+		return "", nil, err
+	}
+	raw, err := inflateObject(content)
+	if err != nil {
+		return "", nil, err
+	}
+	return format.Decode(raw)
+}
+
+// Zlib uncompress the object. Unlike Decompress, the corrupted data is reported instead of panicking.
+func inflateObject(b []byte) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrorMalformedObject, err)
+	}
+	defer r.Close()
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrorMalformedObject, err)
+	}
+	return raw, nil
 }
 
 // Remove object given the objectId.
@@ -116,25 +150,18 @@ func CreateSha1(data []byte) []byte {
 	return hash
 }
 
-// Base method to abstract serialization of any GotObject.
-func newObject(header string, g GotObject) *Object {
-	data := g.Serialize()
-	return &Object{
-		Header: []byte(header),
-		Pad1:   0x20,
-		Size:   uint32(len(data)),
-		Pad2:   0x00,
-		Data:   data,
+// Base method to abstract serialization of any GotObject. The trees depend on the object format.
+func serializeObject(format ObjectFormat, g GotObject) []byte {
+	if f, ok := g.(formatObject); ok {
+		return f.serializeWith(format)
 	}
+	return g.Serialize()
 }
 
-// Build object from data.
-func BuildObject(header string, g GotObject) []byte {
-	obj := newObject(header, g)
-	packet :=AllocatePacket(0)
-	// header[unbound size uint8]|0x20[uint8 x 1]|size[uint32 x 1]|0x00[uint8 x 1]|data[unbound size uint8]
-	packet.Set(obj.Header, []byte{obj.Pad1}, Bit32(obj.Size).Bytes(), []byte{obj.Pad2}, obj.Data) 
-	return packet.buff
+// Build object from data with the object format of the repository.
+func BuildObject(repo *GotRepository, header string, g GotObject) []byte {
+	format := repo.ObjectFormat()
+	return format.Encode(header, serializeObject(format, g))
 }
 
 // obtain the object's path given the hash.
@@ -148,7 +175,7 @@ func HashToPath(repo *GotRepository, hash string) (string, error) {
 // Create in-memory the object with its hash given the data and object type.
 func CreatePossibleObjectFromData(repo *GotRepository, g GotObject, header string) (string, error) {
 	//1. Build the object
-	rawObj := BuildObject(header, g)
+	rawObj := BuildObject(repo, header, g)
 	//2. Derive the has
 	hash := CreateSha1(rawObj)
 	return string(hash), nil
@@ -156,28 +183,40 @@ func CreatePossibleObjectFromData(repo *GotRepository, g GotObject, header strin
 
 // [Persist] the object in disk given the data. CratePossibleObject must have generated the same hash. Use cautionsly.
 func WriteObject(repo *GotRepository, g GotObject, header string) (string, error) {
+	return writeObjectWith(repo, repo.ObjectFormat(), g, header)
+}
+
+// Persist the object encoded with the given format.
+func writeObjectWith(repo *GotRepository, format ObjectFormat, g GotObject, header string) (string, error) {
 	//1. Build the object
-	rawObj := BuildObject(header, g)
+	rawObj := format.Encode(header, serializeObject(format, g))
+	// What it does: the packed objects aren't written loose again.
+	if hash := string(CreateSha1(rawObj)); isPacked(repo, hash) {
+		return hash, nil
+	}
+	return writeLooseObject(filepath.Join(repo.GotDir, gotRepositoryDirObjects), rawObj)
+}
+
+// Persist the encoded object in the objects folder, objects/xx/yyyy. Returns its hash.
+func writeLooseObject(objectsDir string, rawObj []byte) (string, error) {
 	//2. Derive the has
 	hash := CreateSha1(rawObj)
 	//3. Compress
 	var bb bytes.Buffer
 	Compress(rawObj, &bb)
 	//4. Object parent folder not created.
-	if dir := filepath.Join(repo.GotDir, gotRepositoryDirObjects, string(hash[:2])); !pathExist(dir, true) {
+	if dir := filepath.Join(objectsDir, string(hash[:2])); !pathExist(dir, true) {
 		os.Mkdir(dir, fs.ModePerm|0644)
 	}
 	//Create final path from the hash.
-	objPath, err := HashToPath(repo, string(hash))
-	if err != nil {
-		return "", err
+	objPath := filepath.Join(objectsDir, string(hash[:2]), string(hash[2:]))
+	// What it does: the same id means the same content, the object is written once.
+	if pathExist(objPath, false) {
+		return string(hash), nil
 	}
-	//5. Write the data in the object. Corruption may happen.
-	file, err := os.OpenFile(objPath, os.O_RDWR|os.O_CREATE, 0644)
-	if err != nil {
+	//5. Write the data in the object, a crash leaves either no object or the whole of it.
+	if err := writeFileAtomic(objectsDir, objPath, bb.Bytes()); err != nil {
 		return "", err
 	}
-	defer file.Close()
-	file.Write(bb.Bytes())
 	return string(hash), nil
 }
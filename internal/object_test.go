@@ -10,19 +10,14 @@ import (
 	internal "github.com/danielrrv/got/internal"
 )
 
-const (
-	RoorDir = "/home/daniel/got"
-)
-
 func TestSerialize(t *testing.T) {
 	t.Run("Serialize/Serialize", func(t *testing.T) {
 		commit := internal.Commit{
-			Author:      "Danielx",
-			Committer:   "Daniel Rodirguez",
+			Author:      internal.Signature{Name: "Danielx", Email: "daniel@got.dev", When: 1685000000, Offset: -300},
+			Committer:   internal.Signature{Name: "Daniel Rodirguez", Email: "daniel@got.dev", When: 1685000000, Offset: -300},
 			Tree:        "3456787654334567",
 			Description: "Some beuatiful day",
-			Date:        "25-05-2023",
-			Parent:      "34567876543",
+			Parents:     []string{"34567876543"},
 		}
 		var dummy internal.Commit
 		commit2 := dummy.Deserialize(commit.Serialize())
@@ -33,14 +28,13 @@ func TestSerialize(t *testing.T) {
 	})
 	t.Run("Write a commit object", func(t *testing.T) {
 		commit := internal.Commit{
-			Author:      "Daniel",
-			Committer:   "Daniel Rodirguez",
+			Author:      internal.Signature{Name: "Daniel", Email: "daniel@got.dev", When: 1685000000, Offset: -300},
+			Committer:   internal.Signature{Name: "Daniel Rodirguez", Email: "daniel@got.dev", When: 1685000000, Offset: -300},
 			Tree:        "3456787654334567",
 			Description: "Some beuatiful day",
-			Date:        "25-05-2023",
-			Parent:      "34567876543",
+			Parents:     []string{"34567876543"},
 		}
-		repo, err := internal.FindOrCreateRepo(RoorDir)
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
 		if err != nil {
 			t.Errorf("No repo found.")
 		}
@@ -65,14 +59,13 @@ func TestSerialize(t *testing.T) {
 		// t.FailNow()
 		
 		commit := internal.Commit{
-			Author:      "Daniel",
-			Committer:   "Daniel Rodirguez",
+			Author:      internal.Signature{Name: "Daniel", Email: "daniel@got.dev", When: 1685000000, Offset: -300},
+			Committer:   internal.Signature{Name: "Daniel Rodirguez", Email: "daniel@got.dev", When: 1685000000, Offset: -300},
 			Tree:        "3456787654334567",
 			Description: "Some beuatiful day",
-			Date:        "25-05-2023",
-			Parent:      "34567876543",
+			Parents:     []string{"34567876543"},
 		}
-		repo, err := internal.FindOrCreateRepo("/home/daniel/got")
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
 		if err != nil {
 			t.Errorf("No repo found.")
 		}
@@ -92,8 +85,8 @@ func TestSerialize(t *testing.T) {
 			t.Errorf("%v", err.Error())
 		}
 		fmt.Println(commit2)
-		if commit2.Date != commit.Date {
-			t.Errorf("Expected to commit2.Date equals to commit.Date")
+		if commit2.Committer != commit.Committer {
+			t.Errorf("Expected to commit2.Committer equals to commit.Committer")
 		}
 		err = internal.RemoveObjectFrom(repo, hash)
 		if err != nil {
@@ -0,0 +1,524 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const (
+	packDir = "pack"
+	// The object types of the pack entries.
+	packCommit   = 1
+	packTree     = 2
+	packBlob     = 3
+	packTag      = 4
+	packOfsDelta = 6
+	packRefDelta = 7
+	// The longest entry header: type and size of a 64 bits size, plus the base offset or base sha1.
+	packEntryHeaderSize = 10 + sha1.Size
+	// The bytes of the delta bases kept in memory by each pack.
+	packBaseCacheSize = 32 << 20
+)
+
+var (
+	// The pack or its index can't be read.
+	ErrorMalformedPack = errors.New("malformed pack")
+	// The object isn't in the pack.
+	ErrorNotInPack = errors.New("object not in pack")
+
+	packSignature  = []byte("PACK")
+	packIdxMagic   = []byte{0xff, 't', 'O', 'c'}
+	packHeaderName = map[byte]string{
+		packCommit: CommitHeaderName,
+		packTree:   TreeHeaderName,
+		packBlob:   BlobHeaderName,
+		packTag:    TagHeaderName,
+	}
+)
+
+// A pack file of git along with its index(.idx). The objects are read on demand.
+type Pack struct {
+	// Location of the .pack file.
+	Path string
+	file *os.File
+	size int64
+	// Object ids sorted as in the index.
+	hashes  []string
+	offsets map[string]int64
+	// The objects the deltas are based on, by offset. Emptied when it holds more than packBaseCacheSize bytes.
+	bases       map[int64]packedObject
+	basesCached int
+}
+
+type packedObject struct {
+	header string
+	data   []byte
+}
+
+// Open the pack file and its index, found next to it with the .idx extension.
+func OpenPack(path string) (*Pack, error) {
+	idx, err := os.ReadFile(strings.TrimSuffix(path, ".pack") + ".idx")
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	pack := &Pack{Path: path, file: file, offsets: make(map[string]int64), bases: make(map[int64]packedObject)}
+	if err := pack.readHeader(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if err := pack.readIndex(idx); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return pack, nil
+}
+
+// Release the pack file.
+func (p *Pack) Close() error {
+	return p.file.Close()
+}
+
+// [PACK]|[version uint32, 2 or 3]|[number of objects uint32]
+func (p *Pack) readHeader() error {
+	fi, err := p.file.Stat()
+	if err != nil {
+		return err
+	}
+	p.size = fi.Size()
+	header := make([]byte, 12)
+	if _, err := p.file.ReadAt(header, 0); err != nil || !bytes.Equal(header[:4], packSignature) {
+		return ErrorMalformedPack
+	}
+	if version := binary.BigEndian.Uint32(header[4:8]); version != 2 && version != 3 {
+		return ErrorMalformedPack
+	}
+	return nil
+}
+
+// Read the index of the pack, version 1 or 2:
+//
+//	v1: [fanout 256 x uint32]|[offset uint32, sha1] x N
+//	v2: [magic]|[version]|[fanout 256 x uint32]|[sha1 x N]|[crc32 x N]|[offset uint32 x N]|[offset uint64 x M]
+//
+// The offsets with the high bit set in v2 index the table of 64 bits offsets.
+func (p *Pack) readIndex(idx []byte) error {
+	v2 := bytes.HasPrefix(idx, packIdxMagic)
+	fanout := 0
+	if v2 {
+		if len(idx) < 8 || binary.BigEndian.Uint32(idx[4:8]) != 2 {
+			return ErrorMalformedPack
+		}
+		fanout = 8
+	}
+	if len(idx) < fanout+256*4 {
+		return ErrorMalformedPack
+	}
+	n := int(binary.BigEndian.Uint32(idx[fanout+255*4 : fanout+256*4]))
+	entries := fanout + 256*4
+	if !v2 {
+		if len(idx) < entries+n*(4+sha1.Size) {
+			return ErrorMalformedPack
+		}
+		for i := 0; i < n; i++ {
+			entry := idx[entries+i*(4+sha1.Size):]
+			hash := Bytes2hex(entry[4 : 4+sha1.Size])
+			p.hashes = append(p.hashes, hash)
+			p.offsets[hash] = int64(binary.BigEndian.Uint32(entry[:4]))
+		}
+		return nil
+	}
+	offsets := entries + n*(sha1.Size+4)
+	large := offsets + n*4
+	if len(idx) < large {
+		return ErrorMalformedPack
+	}
+	for i := 0; i < n; i++ {
+		hash := Bytes2hex(idx[entries+i*sha1.Size : entries+(i+1)*sha1.Size])
+		offset := int64(binary.BigEndian.Uint32(idx[offsets+i*4:]))
+		if offset&0x80000000 != 0 {
+			at := large + int(offset&0x7fffffff)*8
+			if len(idx) < at+8 {
+				return ErrorMalformedPack
+			}
+			offset = int64(binary.BigEndian.Uint64(idx[at:]))
+		}
+		p.hashes = append(p.hashes, hash)
+		p.offsets[hash] = offset
+	}
+	return nil
+}
+
+// The object ids in the pack.
+func (p *Pack) Hashes() []string {
+	return slices.Clone(p.hashes)
+}
+
+// Determine whether or not the object is in the pack.
+func (p *Pack) Has(hash string) bool {
+	_, ok := p.offsets[hash]
+	return ok
+}
+
+// Read the object from the pack. Returns its type and data, the deltas applied.
+func (p *Pack) Read(hash string) (string, []byte, error) {
+	offset, ok := p.offsets[hash]
+	if !ok {
+		return "", nil, ErrorNotInPack
+	}
+	object, err := p.readAt(offset, 0)
+	if err != nil {
+		return "", nil, err
+	}
+	return object.header, object.data, nil
+}
+
+// Read the entry at the offset, rebuilding the deltas from their chain of bases. The depth guards against
+// deltas based on themselves.
+//
+//	[type 3 bits and size, 7 bits groups]|[base offset or base sha1 for deltas]|[zlib data]
+func (p *Pack) readAt(offset int64, depth int) (packedObject, error) {
+	if object, ok := p.bases[offset]; ok {
+		return object, nil
+	}
+	if offset < 12 || offset >= p.size || depth > 4096 {
+		return packedObject{}, ErrorMalformedPack
+	}
+	d := make([]byte, packEntryHeaderSize)
+	n, err := p.file.ReadAt(d, offset)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return packedObject{}, err
+	}
+	d = d[:n]
+	c := d[0]
+	kind := (c >> 4) & 0x07
+	size := uint64(c & 0x0f)
+	pos := 1
+	for shift := 4; c&0x80 != 0; shift += 7 {
+		if pos >= len(d) {
+			return packedObject{}, ErrorMalformedPack
+		}
+		c = d[pos]
+		size |= uint64(c&0x7f) << shift
+		pos++
+	}
+	baseOffset := int64(-1)
+	switch kind {
+	case packOfsDelta:
+		// What it does: the distance to the base is big endian, each extra group adding one.
+		if pos >= len(d) {
+			return packedObject{}, ErrorMalformedPack
+		}
+		c = d[pos]
+		distance := int64(c & 0x7f)
+		pos++
+		for c&0x80 != 0 {
+			if pos >= len(d) {
+				return packedObject{}, ErrorMalformedPack
+			}
+			c = d[pos]
+			distance = ((distance + 1) << 7) | int64(c&0x7f)
+			pos++
+		}
+		baseOffset = offset - distance
+	case packRefDelta:
+		if pos+sha1.Size > len(d) {
+			return packedObject{}, ErrorMalformedPack
+		}
+		base, ok := p.offsets[Bytes2hex(d[pos:pos+sha1.Size])]
+		if !ok {
+			return packedObject{}, ErrorNotInPack
+		}
+		baseOffset = base
+		pos += sha1.Size
+	default:
+		if _, ok := packHeaderName[kind]; !ok {
+			return packedObject{}, ErrorMalformedPack
+		}
+	}
+	data, err := inflate(io.NewSectionReader(p.file, offset+int64(pos), p.size-offset-int64(pos)), size)
+	if err != nil {
+		return packedObject{}, err
+	}
+	if baseOffset < 0 {
+		return packedObject{header: packHeaderName[kind], data: data}, nil
+	}
+	base, err := p.readAt(baseOffset, depth+1)
+	if err != nil {
+		return packedObject{}, err
+	}
+	p.cacheBase(baseOffset, base)
+	if data, err = applyDelta(base.data, data); err != nil {
+		return packedObject{}, err
+	}
+	return packedObject{header: base.header, data: data}, nil
+}
+
+// Keep the base in memory, the revisions of a file share most of their chain.
+func (p *Pack) cacheBase(offset int64, base packedObject) {
+	if _, ok := p.bases[offset]; ok {
+		return
+	}
+	if p.basesCached+len(base.data) > packBaseCacheSize {
+		clear(p.bases)
+		p.basesCached = 0
+	}
+	p.bases[offset] = base
+	p.basesCached += len(base.data)
+}
+
+// Zlib uncompress the data expected to have the given size.
+func inflate(r io.Reader, size uint64) ([]byte, error) {
+	zr, err := zlib.NewReader(r)
+	if err != nil {
+		return nil, ErrorMalformedPack
+	}
+	defer zr.Close()
+	data, err := io.ReadAll(zr)
+	if err != nil || uint64(len(data)) != size {
+		return nil, ErrorMalformedPack
+	}
+	return data, nil
+}
+
+// Open the packs of the objects folder, objects/pack/*.pack.
+func openPacks(objectsDir string) ([]*Pack, error) {
+	paths, err := filepath.Glob(filepath.Join(objectsDir, packDir, "*.pack"))
+	if err != nil {
+		return nil, err
+	}
+	packs := make([]*Pack, 0, len(paths))
+	for _, path := range paths {
+		pack, err := OpenPack(path)
+		if err != nil {
+			return nil, err
+		}
+		packs = append(packs, pack)
+	}
+	return packs, nil
+}
+
+// The packs of the repository, opened once.
+func (repo *GotRepository) Packs() ([]*Pack, error) {
+	if repo.packs != nil {
+		return repo.packs, nil
+	}
+	packs, err := openPacks(filepath.Join(repo.GotDir, gotRepositoryDirObjects))
+	if err != nil {
+		return nil, err
+	}
+	repo.packs = packs
+	return packs, nil
+}
+
+// Close the packs of the repository so that they are opened again when needed.
+func (repo *GotRepository) closePacks() {
+	for _, pack := range repo.packs {
+		pack.Close()
+	}
+	repo.packs = nil
+}
+
+// Read the object from the packs of the repository.
+func readPackedObject(repo *GotRepository, hash string) (string, []byte, error) {
+	packs, err := repo.Packs()
+	if err != nil {
+		return "", nil, err
+	}
+	for _, pack := range packs {
+		if pack.Has(hash) {
+			return pack.Read(hash)
+		}
+	}
+	return "", nil, ErrorNotInPack
+}
+
+// Determine whether or not the object is in DB, loose or packed.
+func (repo *GotRepository) HasObject(hash string) bool {
+	if objPath, err := HashToPath(repo, hash); err != nil || pathExist(objPath, false) {
+		return err == nil
+	}
+	return isPacked(repo, hash)
+}
+
+// Determine whether or not the object is in a pack of the repository.
+func isPacked(repo *GotRepository, hash string) bool {
+	packs, err := repo.Packs()
+	if err != nil {
+		return false
+	}
+	return slices.ContainsFunc(packs, func(pack *Pack) bool { return pack.Has(hash) })
+}
+
+// An object to write into a pack. The delta is against the base, another object of the same pack.
+type packInput struct {
+	hash   string
+	header string
+	data   []byte
+	// The base name of the file, for blobs.
+	name  string
+	base  string
+	delta []byte
+	// The length of the chain of deltas up to a whole object. Zero for the whole objects.
+	depth int
+}
+
+// Write the objects into objects/pack/pack-<checksum>.pack along with its index v2. The bases are written
+// before the deltas pointing to them. Returns the path of the pack.
+//
+//	[PACK]|[version 2]|[number of objects uint32]|[entries]|[sha1 of the former bytes]
+func writePack(objectsDir string, objects []packInput) (string, error) {
+	dir := filepath.Join(objectsDir, packDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(dir, "tmp_pack_")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	checksum := sha1.New()
+	w := bufio.NewWriter(io.MultiWriter(tmp, checksum))
+	header := append(slices.Clone(packSignature), 0, 0, 0, 2)
+	header = binary.BigEndian.AppendUint32(header, uint32(len(objects)))
+	w.Write(header)
+	offset := int64(len(header))
+	offsets := make(map[string]int64, len(objects))
+	crcs := make(map[string]uint32, len(objects))
+	ordered := slices.Clone(objects)
+	// What it does: the bases are written first as the deltas point back to them.
+	slices.SortStableFunc(ordered, func(a, b packInput) int {
+		return cmp.Compare(a.depth, b.depth)
+	})
+	for _, object := range ordered {
+		entry, err := encodePackEntry(object, offset, offsets)
+		if err != nil {
+			return "", err
+		}
+		w.Write(entry)
+		offsets[object.hash] = offset
+		crcs[object.hash] = crc32.ChecksumIEEE(entry)
+		offset += int64(len(entry))
+	}
+	if err := w.Flush(); err != nil {
+		return "", err
+	}
+	sum := checksum.Sum(nil)
+	if _, err := tmp.Write(sum); err != nil {
+		return "", err
+	}
+	if err := tmp.Sync(); err != nil {
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, "pack-"+hex.EncodeToString(sum))
+	if err := writeFileAtomic(dir, path+".idx", encodePackIndex(offsets, crcs, sum)); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), path+".pack"); err != nil {
+		return "", err
+	}
+	return path + ".pack", syncDir(dir)
+}
+
+// Encode the entry given the offset where it is written and the offsets of the former entries.
+func encodePackEntry(object packInput, offset int64, offsets map[string]int64) ([]byte, error) {
+	kind, data := byte(0), object.data
+	for k, name := range packHeaderName {
+		if name == object.header {
+			kind = k
+		}
+	}
+	if kind == 0 {
+		return nil, ErrorIncorrectOBjectType
+	}
+	var entry []byte
+	if object.base != "" {
+		kind, data = packOfsDelta, object.delta
+	}
+	// Implementation to write the type and size: 4 bits of size in the first byte, then 7 bits groups.
+	size := uint64(len(data))
+	c := kind<<4 | byte(size&0x0f)
+	size >>= 4
+	for size > 0 {
+		entry = append(entry, c|0x80)
+		c = byte(size & 0x7f)
+		size >>= 7
+	}
+	entry = append(entry, c)
+	if object.base != "" {
+		base, ok := offsets[object.base]
+		if !ok {
+			return nil, ErrorNotInPack
+		}
+		// What it does: the distance to the base, big endian, each extra group minus one.
+		distance := offset - base
+		encoded := []byte{byte(distance & 0x7f)}
+		for distance >>= 7; distance > 0; distance >>= 7 {
+			distance--
+			encoded = append([]byte{byte(0x80 | distance&0x7f)}, encoded...)
+		}
+		entry = append(entry, encoded...)
+	}
+	var bb bytes.Buffer
+	Compress(data, &bb)
+	return append(entry, bb.Bytes()...), nil
+}
+
+// Encode the index v2 of the pack.
+func encodePackIndex(offsets map[string]int64, crcs map[string]uint32, packChecksum []byte) []byte {
+	hashes := make([]string, 0, len(offsets))
+	for hash := range offsets {
+		hashes = append(hashes, hash)
+	}
+	slices.Sort(hashes)
+	idx := append(slices.Clone(packIdxMagic), 0, 0, 0, 2)
+	var fanout [256]uint32
+	for _, hash := range hashes {
+		first := Hex2bytes(hash[:2])[0]
+		for i := int(first); i < 256; i++ {
+			fanout[i]++
+		}
+	}
+	for _, count := range fanout {
+		idx = binary.BigEndian.AppendUint32(idx, count)
+	}
+	for _, hash := range hashes {
+		idx = append(idx, Hex2bytes(hash)...)
+	}
+	for _, hash := range hashes {
+		idx = binary.BigEndian.AppendUint32(idx, crcs[hash])
+	}
+	large := make([]byte, 0)
+	for _, hash := range hashes {
+		offset := offsets[hash]
+		if offset < 0x80000000 {
+			idx = binary.BigEndian.AppendUint32(idx, uint32(offset))
+			continue
+		}
+		idx = binary.BigEndian.AppendUint32(idx, 0x80000000|uint32(len(large)/8))
+		large = binary.BigEndian.AppendUint64(large, uint64(offset))
+	}
+	idx = append(idx, large...)
+	idx = append(idx, packChecksum...)
+	sum := sha1.Sum(idx)
+	return append(idx, sum[:]...)
+}
@@ -0,0 +1,147 @@
+package internal
+
+import (
+	"bufio"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// The unreachable objects younger than this are kept by default. A command may be about to point to them.
+	DefaultPruneExpire = 14 * 24 * time.Hour
+	// The folder of the reflogs, as git lays it out: logs/HEAD, logs/refs/heads/main.
+	reflogDir = "logs"
+)
+
+type PruneOptions struct {
+	// List the objects without removing them.
+	DryRun bool
+	// The unreachable objects modified within this duration are kept. Zero prunes them all.
+	Expire time.Duration
+}
+
+type PrunedObject struct {
+	Hash string
+	// The object type: blob, tree, commit or tag.
+	Type string
+}
+
+// Remove the loose objects no branch, tag, HEAD, index entry or reflog leads to, walking the parents and
+// trees of the commits down to the blobs. The objects younger than the expiry are kept, and so are the
+// packed ones.
+//
+// The walk fails when a reachable object is missing, nothing is removed from a broken history.
+func Prune(repo *GotRepository, options PruneOptions) ([]PrunedObject, error) {
+	roots, err := reachabilityRoots(repo)
+	if err != nil {
+		return nil, err
+	}
+	reachable := make(map[string]bool)
+	err = walkReachable(repo, roots, func(hash string, header string, data []byte) error {
+		reachable[hash] = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	objectsDir := filepath.Join(repo.GotDir, gotRepositoryDirObjects)
+	hashes, err := listLooseObjects(objectsDir)
+	if err != nil {
+		return nil, err
+	}
+	expire := time.Now().Add(-options.Expire)
+	pruned := make([]PrunedObject, 0)
+	for _, hash := range hashes {
+		if reachable[hash] {
+			continue
+		}
+		objPath := filepath.Join(objectsDir, hash[:2], hash[2:])
+		fi, err := os.Stat(objPath)
+		if err != nil {
+			return nil, err
+		}
+		if options.Expire > 0 && fi.ModTime().After(expire) {
+			continue
+		}
+		// What it does: the type is for the listing only, a corrupted object is pruned all the same.
+		header, _, err := readLooseObject(objPath, repo.ObjectFormat())
+		if err != nil {
+			header = "unknown"
+		}
+		pruned = append(pruned, PrunedObject{Hash: hash, Type: header})
+		if options.DryRun {
+			continue
+		}
+		if err := RemoveObjectFrom(repo, hash); err != nil {
+			return nil, err
+		}
+		os.Remove(filepath.Join(objectsDir, hash[:2]))
+	}
+	return pruned, nil
+}
+
+// The objects that must be kept: the branches, tags, HEAD, the merge in progress, the blobs of the index
+// and the commits of the reflogs.
+func reachabilityRoots(repo *GotRepository) ([]string, error) {
+	refs, err := readRefs(repo.GotDir)
+	if err != nil {
+		return nil, err
+	}
+	roots := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		roots = append(roots, ref.hash)
+	}
+	if ref := repo.GetHEADReference(); !ref.Invalid && ref.IsDirect {
+		roots = append(roots, ref.Reference)
+	}
+	if mergeHead := readMergeHead(repo); mergeHead != "" {
+		roots = append(roots, mergeHead)
+	}
+	// What it does: the staged blobs not committed yet are pointed to by the index only.
+	for _, entry := range repo.Index.Entries {
+		if repo.HasObject(entry.Hash) {
+			roots = append(roots, entry.Hash)
+		}
+	}
+	reflogs, err := readReflogHashes(repo)
+	if err != nil {
+		return nil, err
+	}
+	return append(roots, reflogs...), nil
+}
+
+// The commits the reflogs went through. Each line is written as git does:
+//
+//	<former hash> <new hash> Name <email> 1700000000 +0100\t<message>
+//
+// The entries of the commits no longer in DB are left out.
+func readReflogHashes(repo *GotRepository) ([]string, error) {
+	hashes := make([]string, 0)
+	err := filepath.WalkDir(filepath.Join(repo.GotDir, reflogDir), func(path string, d fs.DirEntry, err error) error {
+		if os.IsNotExist(err) {
+			return fs.SkipAll
+		}
+		if err != nil || d.IsDir() {
+			return err
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			for _, hash := range fields[:min(2, len(fields))] {
+				if len(hash) == 40 && isHexString(hash) && strings.Trim(hash, "0") != "" && repo.HasObject(hash) {
+					hashes = append(hashes, hash)
+				}
+			}
+		}
+		return scanner.Err()
+	})
+	return hashes, err
+}
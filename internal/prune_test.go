@@ -0,0 +1,120 @@
+package internal_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	internal "github.com/danielrrv/got/internal"
+)
+
+// Move main back to the first commit, leaving the second one unreachable. Every object is made a month old.
+func abandonCommitTesting(t *testing.T) (*internal.GotRepository, string, string) {
+	repo, err := internal.FindOrCreateRepo(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := commitWorktreeTesting(t, repo, "first", []TestingFile{{Name: "a.txt", RelativePath: "a.txt", Data: []byte("1\n")}})
+	second := commitWorktreeTesting(t, repo, "second", []TestingFile{{Name: "a.txt", RelativePath: "a.txt", Data: []byte("2\n")}})
+	internal.UpdateBranch(repo, "main", first)
+	if _, err := internal.Checkout(repo, "main", true); err != nil {
+		t.Fatal(err)
+	}
+	monthAgo := time.Now().Add(-30 * 24 * time.Hour)
+	for _, hash := range looseObjectsTesting(repo) {
+		os.Chtimes(filepath.Join(repo.GotDir, "objects", hash[:2], hash[2:]), monthAgo, monthAgo)
+	}
+	return repo, first, second
+}
+
+func TestPrune(t *testing.T) {
+	t.Run("remove the unreachable objects", func(t *testing.T) {
+		repo, first, second := abandonCommitTesting(t)
+		secondTree := internal.ReadCommit(repo, second).Tree
+		before := looseObjectsTesting(repo)
+
+		listed, err := internal.Prune(repo, internal.PruneOptions{DryRun: true, Expire: internal.DefaultPruneExpire})
+		if err != nil {
+			t.Fatal(err)
+		}
+		types := make(map[string]string)
+		for _, object := range listed {
+			types[object.Hash] = object.Type
+		}
+		// What it does: the commit, its root tree and the blob "2\n" are reachable from the second commit only.
+		if len(listed) != 3 || types[second] != internal.CommitHeaderName || types[secondTree] != internal.TreeHeaderName {
+			t.Errorf("Expected the second commit, its tree and blob to be listed, got %v", listed)
+		}
+		if after := looseObjectsTesting(repo); !slices.Equal(after, before) {
+			t.Errorf("Expected the dry run to remove nothing")
+		}
+
+		pruned, err := internal.Prune(repo, internal.PruneOptions{Expire: internal.DefaultPruneExpire})
+		if err != nil || len(pruned) != 3 {
+			t.Fatalf("Expected 3 objects pruned, got %v %v", pruned, err)
+		}
+		if slices.Contains(looseObjectsTesting(repo), second) {
+			t.Errorf("Expected the second commit to be removed")
+		}
+		entries, err := internal.Log(repo, "", internal.LogOptions{})
+		if err != nil || len(entries) != 1 || entries[0].Hash != first {
+			t.Errorf("Expected the history of main intact, got %v %v", entries, err)
+		}
+		if content, err := internal.ReadBlob(repo, internal.ReadTree(repo, entries[0].Commit.Tree).Children[0].Hash); err != nil || string(content) != "1\n" {
+			t.Errorf("Expected the blob of main intact, got %q %v", content, err)
+		}
+	})
+
+	t.Run("keep the objects younger than the expiry", func(t *testing.T) {
+		repo, _, _ := abandonCommitTesting(t)
+		orphan, _ := internal.WriteObject(repo, rawObject("just written\n"), internal.BlobHeaderName)
+		pruned, err := internal.Prune(repo, internal.PruneOptions{Expire: internal.DefaultPruneExpire})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if slices.ContainsFunc(pruned, func(object internal.PrunedObject) bool { return object.Hash == orphan }) {
+			t.Errorf("Expected the recent object to be kept")
+		}
+		pruned, err = internal.Prune(repo, internal.PruneOptions{})
+		if err != nil || len(pruned) != 1 || pruned[0].Hash != orphan {
+			t.Errorf("Expected the recent object pruned without expiry, got %v %v", pruned, err)
+		}
+	})
+
+	t.Run("the reflogs and the index keep their objects", func(t *testing.T) {
+		repo, first, second := abandonCommitTesting(t)
+		line := first + " " + second + " Ada <ada@example.com> 1700000000 +0000\tcommit: second\n"
+		os.MkdirAll(filepath.Join(repo.GotDir, "logs"), 0755)
+		if err := os.WriteFile(filepath.Join(repo.GotDir, "logs", "HEAD"), []byte(line), 0644); err != nil {
+			t.Fatal(err)
+		}
+		staged, _ := internal.WriteObject(repo, rawObject("staged\n"), internal.BlobHeaderName)
+		os.WriteFile(filepath.Join(repo.GotTree, "staged.txt"), []byte("staged\n"), 0644)
+		repo.Index.AddOrModifyEntries(repo, []string{"staged.txt"})
+		pruned, err := internal.Prune(repo, internal.PruneOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pruned) != 0 {
+			t.Errorf("Expected nothing pruned, got %v", pruned)
+		}
+		if !slices.Contains(looseObjectsTesting(repo), staged) {
+			t.Errorf("Expected the staged blob to be kept")
+		}
+	})
+
+	t.Run("refuse to prune a broken history", func(t *testing.T) {
+		repo, first, _ := abandonCommitTesting(t)
+		internal.RemoveObjectFrom(repo, internal.ReadCommit(repo, first).Tree)
+		before := looseObjectsTesting(repo)
+		if _, err := internal.Prune(repo, internal.PruneOptions{}); !errors.Is(err, internal.ErrorMissingObject) {
+			t.Errorf("Expected the missing tree to be reported, got %v", err)
+		}
+		if after := looseObjectsTesting(repo); len(after) != len(before) {
+			t.Errorf("Expected nothing removed")
+		}
+	})
+}
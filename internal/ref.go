@@ -1,16 +1,22 @@
 package internal
 
 import (
+	"bytes"
 	"crypto/sha1"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
-	"regexp"
+	"strings"
 )
 
 var (
-	//Maximun 16 characters for branch names. No validation so far.
-	refRegex = regexp.MustCompile(`(^ref: )(refs/heads/[a-zA-Z-]{1,16}[/]?[a-zA-Z-]{1,16})`)
+	// The revision is neither a reference nor an object id.
+	ErrorUnknownRevision = errors.New("unknown revision")
+	// The abbreviated object id matches more than one object.
+	ErrorAmbiguousRevision = errors.New("ambiguous revision")
+	// HEAD does not point to any commit yet.
+	ErrorNoCommitYet = errors.New("HEAD does not point to any commit yet")
 )
 
 type Ref struct {
@@ -27,6 +33,38 @@ func (r *Ref) WriteRef(repo *GotRepository) error {
 	return CreateOrUpdateRepoFile(repo, "HEAD", []byte(fmt.Sprintf(r.Reference)))
 }
 
+// Get the branch HEAD points to. The second value is false when HEAD is detached.
+func (repo *GotRepository) GetHEADBranch() (string, bool) {
+	refData, err := os.ReadFile(filepath.Join(repo.GotDir, "HEAD"))
+	if err != nil {
+		panic(err)
+	}
+	prefix := "ref: " + filepath.Join(gotRepositoryDirRefs, gotRepositoryDirRefsHeads) + "/"
+	head := string(bytes.TrimSpace(refData))
+	if !strings.HasPrefix(head, prefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(head, prefix), true
+}
+
+// Point the branch to the commit. The branch is created when it doesn't exist.
+func UpdateBranch(repo *GotRepository, branch string, hash string) error {
+	refPath := filepath.Join(gotRepositoryDirRefs, gotRepositoryDirRefsHeads, branch)
+	if err := os.MkdirAll(filepath.Dir(filepath.Join(repo.GotDir, refPath)), 0755); err != nil {
+		return err
+	}
+	return CreateOrUpdateRepoFile(repo, refPath, []byte(hash))
+}
+
+// Move HEAD forward to the commit. The branch HEAD points to is updated, or HEAD itself when detached.
+func (repo *GotRepository) AdvanceHEAD(hash string) error {
+	if branch, ok := repo.GetHEADBranch(); ok {
+		return UpdateBranch(repo, branch, hash)
+	}
+	ref := Ref{IsDirect: true, Reference: hash}
+	return ref.WriteRef(repo)
+}
+
 func (repo *GotRepository) GetHEADReference() *Ref {
 	refData, err := os.ReadFile(filepath.Join(repo.GotDir, "HEAD"))
 	if err != nil {
@@ -36,27 +74,24 @@ func (repo *GotRepository) GetHEADReference() *Ref {
 }
 
 func parseReference(repo *GotRepository, referenceData []byte) *Ref {
+	referenceData = bytes.TrimSpace(referenceData)
 	// Implementation to determine the ref is indirect. So validate the existance of it. Otherwise is first commit.
-	if matchGroup := refRegex.FindAllStringSubmatch(string(referenceData), -1); matchGroup != nil {
-		if len(matchGroup[0]) >= 3 {
-			refPath := matchGroup[0][2]
-			content, err := os.ReadFile(filepath.Join(repo.GotDir, refPath))
-			if err != nil {
-				//Invalidate beucase reading the refs/heads/{ref-branch} failed.
-				return &Ref{
-					Invalid:   true,
-					IsDirect:  false,
-					Reference: string(referenceData),
-				}
+	if refPath, ok := bytes.CutPrefix(referenceData, []byte("ref: ")); ok && ValidateRefName(string(refPath)) == nil {
+		content, err := os.ReadFile(filepath.Join(repo.GotDir, string(refPath)))
+		if err != nil {
+			//Invalidate beucase reading the refs/heads/{ref-branch} failed.
+			return &Ref{
+				Invalid:   true,
+				IsDirect:  false,
+				Reference: string(referenceData),
 			}
-			//Find the refs/heads/{ref-branch} has content.
-			return parseReference(repo, content)
 		}
+		//Find the refs/heads/{ref-branch} has content.
+		return parseReference(repo, content)
 	} else {
 		if len(referenceData) == sha1.Size*2 {
-			_, err := os.Stat(filepath.Join(repo.GotDir, "objects", string(referenceData[:2]), string(referenceData[2:])))
-			if err != nil {
-				// - Invalidate beucase reading the file failed.
+			if !repo.HasObject(string(referenceData)) {
+				// - Invalidate beucase the object is neither loose nor packed.
 				// - The reference is the hash.
 				return &Ref{
 					Invalid:   true,
@@ -78,5 +113,71 @@ func parseReference(repo *GotRepository, referenceData []byte) *Ref {
 			}
 		}
 	}
-	return nil
+}
+
+// Resolve a revision into an object id. The revision can be HEAD, a branch, a tag, a full
+// reference(refs/heads/main) or an object id, complete or abbreviated to at least 4 characters.
+// Annotated tags resolve to the object they tag.
+func ResolveRevision(repo *GotRepository, rev string) (string, error) {
+	if rev == "" || rev == "HEAD" {
+		ref := repo.GetHEADReference()
+		if ref.Invalid {
+			return "", ErrorNoCommitYet
+		}
+		return ref.Reference, nil
+	}
+	// What it does: references take precedence over object ids, as git does. A name that is not a valid reference, as
+	// one with "..", is not looked up, it can't point out of the refs folder.
+	for _, refPath := range []string{rev, filepath.Join(gotRepositoryDirRefs, gotRepositoryDirRefsHeads, rev), filepath.Join(gotRepositoryDirRefs, gotRepositoryDirRefsTags, rev)} {
+		if ValidateRefName(rev) != nil || !strings.HasPrefix(refPath, gotRepositoryDirRefs+"/") {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(repo.GotDir, refPath))
+		if err == nil {
+			return peelTag(repo, string(bytes.TrimSpace(content))), nil
+		}
+	}
+	if !isHexString(rev) || len(rev) < 4 || len(rev) > sha1.Size*2 {
+		return "", ErrorUnknownRevision
+	}
+	rev = strings.ToLower(rev)
+	candidates := make(map[string]bool)
+	entries, _ := os.ReadDir(filepath.Join(repo.GotDir, gotRepositoryDirObjects, rev[:2]))
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), rev[2:]) {
+			candidates[rev[:2]+entry.Name()] = true
+		}
+	}
+	packs, err := repo.Packs()
+	if err != nil {
+		return "", err
+	}
+	for _, pack := range packs {
+		for _, hash := range pack.Hashes() {
+			if strings.HasPrefix(hash, rev) {
+				candidates[hash] = true
+			}
+		}
+	}
+	if len(candidates) > 1 {
+		return "", ErrorAmbiguousRevision
+	}
+	found := ""
+	for hash := range candidates {
+		found = hash
+	}
+	if found == "" {
+		return "", ErrorUnknownRevision
+	}
+	return peelTag(repo, found), nil
+}
+
+// Determine whether the string is made of hexadecimal characters only.
+func isHexString(s string) bool {
+	for _, c := range s {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return false
+		}
+	}
+	return len(s) > 0
 }
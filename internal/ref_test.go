@@ -94,4 +94,20 @@ func TestReference(t *testing.T) {
 		}
 	})
 
+	t.Run("ReferenceFromHEAD when the branch has digits, dots and slashes", func(t *testing.T) {
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			panic(err)
+		}
+		hash := CommitFilesTesting(repo, "first", "", map[string]string{"readme.md": "v1"})
+		if err := internal.UpdateBranch(repo, "release-2024.10/a-very-long-branch-name", hash); err != nil {
+			t.Fatal(err)
+		}
+		ref := internal.Ref{IsDirect: false, Reference: "release-2024.10/a-very-long-branch-name"}
+		ref.WriteRef(repo)
+		if ref := repo.GetHEADReference(); ref.Invalid || ref.Reference != hash {
+			t.Errorf("Expected HEAD to resolve through the branch, got %v", ref)
+		}
+	})
+
 }
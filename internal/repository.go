@@ -40,6 +40,12 @@ type GotRepository struct {
 	GotDir string
 	// Temporary database.
 	Index *Index
+	// The packs of objects/pack, opened on demand.
+	packs []*Pack
+	// The lock of the index while the repository is locked.
+	indexLock *lockFile
+	// The configuration of .got/config, read once. See GetConfiguration.
+	config *GotConfig
 }
 
 var BaseRepoConfig = GotConfig{
@@ -49,27 +55,79 @@ var BaseRepoConfig = GotConfig{
 		Email: "dejemonosdevainas@email.com",
 	},
 	Branch: "master",
+	Core: CoreConfig{
+		ObjectFormat: ObjectFormatGit,
+	},
 }
 
-// Create a file inside of the repo dir(.got)
+// Create a file inside of the repo dir(.got). The previous content is replaced at once, see writeFileAtomic.
+//
+// The file is locked while it is written, HEAD.lock for HEAD. The index is already locked when the repository is.
 func CreateOrUpdateRepoFile(repo *GotRepository, filename string, data []byte) error {
 	path := filepath.Join(repo.GotDir, filename)
-	_, err := os.Stat(path)
+	if filename != "index" || repo.indexLock == nil {
+		lock, err := acquireLock(path)
+		if err != nil {
+			return err
+		}
+		defer lock.release()
+	}
+	return writeFileAtomic(repo.GotDir, path, data)
+}
+
+// Called once the data is in the temporary file, right before it takes the place of the file. The tests replace it
+// to interrupt the writes.
+var beforeRename = func(tmpPath string) error { return nil }
 
-	// The error is different from `file doesn't exist` then return.
-	if err != nil && !errors.Is(err, os.ErrNotExist) {
+// Write the file so that it holds either the former content or the new one, never a part of it:
+//  1. The data goes to a temporary file of tmpDir, which must be on the same file system as the path.
+//  2. The temporary file is flushed to disk and renamed to the path, rename replaces the file at once.
+//  3. The folder of the path is flushed so that the rename survives a crash.
+//
+// A killed process leaves the temporary file behind at most, "tmp_<name>_<random>", nothing reads it.
+func writeFileAtomic(tmpDir string, path string, data []byte) (err error) {
+	tmp, err := os.CreateTemp(tmpDir, "tmp_"+filepath.Base(path)+"_")
+	if err != nil {
 		return err
 	}
-	// The file either doesn't exist or user want to write in any case on it.
-	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0644)
-	if err == nil {
-		defer file.Close()
-		if _, err := file.Write(data); err != nil {
-			return err
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
 		}
+	}()
+	if _, err := tmp.Write(data); err != nil {
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := beforeRename(tmp.Name()); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// Flush the entries of the folder to disk. Some platforms can't open folders to do so, they are left as they are.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
 		return nil
 	}
-	return err
+	defer d.Close()
+	if err := d.Sync(); err != nil && !errors.Is(err, os.ErrInvalid) && !errors.Is(err, errors.ErrUnsupported) {
+		return err
+	}
+	return nil
 }
 
 // Set the repo configuration after setup. Future usage.
@@ -117,17 +175,12 @@ func FindOrCreateRepo(path string) (*GotRepository, error) {
 	//The folder path/.got exist and it has a version file that will determine this is already created repo.
 	// The existance of index doesn't guarantee that the others important folders are created.
 	if pathExist(filepath.Join(repo.GotDir, "index"), false) && pathExist(filepath.Join(repo.GotDir, gotRepositoryDirObjects), false) {
-		content, err := os.ReadFile(filepath.Join(repo.GotDir, "index"))
+		index, err := readIndex(repo)
 		if err != nil {
-			panic(err)
-		}
-		
-		if len(content) > 0 {
-			repo.Index.DeserializeIndex(content)
-			return repo, nil
-		} else {
-			goto IndexFromScratch
+			return nil, err
 		}
+		repo.Index = index
+		return repo, nil
 		// Otherwise returns default repo with index nil.
 	} else {
 		//The path/.got doesn't exist. Let's create it.
@@ -196,175 +249,67 @@ type DirEntry struct {
 	RelativePath string
 }
 
-// List recursively the files in the worktree.
-func listWorkTree(rootDir string) []string {
-	entries := make([]string, 0)
-	dirs, err := os.ReadDir(rootDir)
-	if err != nil {
-		panic(err)
-	}
-	// Implementation to discard .got folder.
-	dirs = slices.DeleteFunc(dirs, func(e fs.DirEntry) bool {
-		return e.Name() == ".got" && e.IsDir() || e.Name() == ".git" && e.IsDir()
-	})
-	for _, dir := range dirs {
-		if dir.IsDir() {
-			entries = append(entries, listWorkTree(filepath.Join(rootDir, dir.Name()))...)
-		} else {
-			entries = append(entries, filepath.Join(rootDir, dir.Name()))
-		}
-	}
-	return entries
-}
-
-func relativize(repo *GotRepository, path string) string {
-	rel, err := filepath.Rel(repo.GotTree, path)
-	if err != nil {
-		panic(err)
-	}
-	return rel
-}
-
-func relativizeMultiPaths(repo *GotRepository, paths []string) []string {
-	rels := make([]string, 0)
-	for _, path := range paths {
-		rels = append(rels, relativize(repo, path))
-	}
-	return rels
-}
-
-// Candiate to pointer Got Reposu
-func (repo *GotRepository) Status() {
-	//read all the files in the worktree.
-	worktree := listWorkTree(repo.GotTree)
-	//Container for tracked files(already either in index or in DB)
-	trackedFiles := make([]string, 0)
-	// Container for untracked files.
-	untrackedFiles := make([]string, 0)
-
-	cacheFiles := make([]string, 0)
-	noStageFiles := make([]string, 0)
-
-	for _, node := range worktree {
-		// - what it does: Find out whether the node/file is already in index.
-		// - Here we don't know if the blob is index only or it has been persisted in DB already.
-		if idxAtIndex := slices.IndexFunc(repo.Index.Entries, func(entry IndexEntry) bool {
-			return relativize(repo, node) == entry.PathName
-		}); idxAtIndex >= 0 {
-			trackedFiles = append(trackedFiles, repo.Index.Entries[idxAtIndex].PathName)
-		} else {
-			untrackedFiles = append(untrackedFiles, node)
+// List recursively the files in the worktree. The ignored files are left out unless tracked, and the ignored folders
+// are not read unless they have tracked files. A nil ignore lists them all.
+//
+// The second list is the ignored files and folders left out, relative to the worktree, the folders ending with "/".
+func listWorkTree(repo *GotRepository, ignore *Ignore) ([]string, []string) {
+	ignored := make([]string, 0)
+	tracked := make(map[string]bool)
+	for _, entry := range repo.Index.Entries {
+		for path := entry.PathName; path != "."; path = filepath.ToSlash(filepath.Dir(path)) {
+			tracked[path] = true
 		}
 	}
-
-	var headCommit *Commit
-	// Get the HEAD reference to compare with its tree.
-	ref := repo.GetHEADReference()
-
-	if ref.Invalid {
-		fmt.Println("HEAD reference is invalid. Whether there no commit or the file is incorrect.")
-		headCommit = nil
-	} else {
-		headCommit = ReadCommit(repo, ref.Reference)
-	}
-	// What it means: There is already a worktree and there are commit already on the HEAD.
-	if headCommit != nil {
-		fmt.Println("There already a tree. So there might be a blon from tree in the tree.")
-		// Based on the HEAD commit, obtain the tree associated.
-		rawTree, err := ReadObject(repo, TreeHeaderName, headCommit.Tree)
+	var list func(rootDir string) []string
+	list = func(rootDir string) []string {
+		entries := make([]string, 0)
+		dirs, err := os.ReadDir(rootDir)
 		if err != nil {
 			panic(err)
 		}
-		var dummy TreeItem
-		tree := dummy.Deserialize(rawTree)
-		// What it does: recursively make all tree blob flatten into an array of strings.
-		pathsInTree := tree.FlatItems()
-
-		for _, trackFile := range trackedFiles {
-			// - Find out if the tracked file is persisted on the tree of the HEAD.
-			// - if is persisted compare its hash with latest file state hash of the user.
-			//   -  if the hashes are different, files are different and user has modified the file.
-			//     - if blob is in cache means that the user has already added the file to stage area.
-			//     - if cache hash is different from latest file state hash of the user,then user has modified the file since the
-			//        the last time the files has been added to stage area.
-			if idxPersisted := slices.IndexFunc(pathsInTree, func(ti TreeItem) bool {
-				return relativize(repo, ti.Path) == trackFile
-			}); idxPersisted >= 0 {
-				// Generate an in-memory object from latest user tracked file.
-				hash, err := CreatePossibleObjectFromData(repo, Blob{Path: filepath.Join(repo.GotTree, trackFile)}, BlobHeaderName)
-				if err != nil {
-					panic(err)
-				}
-				// Validation #1: tree blob different from user blob. File changed.
-				if hash != pathsInTree[idxPersisted].Hash {
-					// Validation #2: stage area blob different from user blob. File has changed.
-					if idxAtCache := slices.IndexFunc(repo.Index.Cache, func(cache CacheEntry) bool {
-						return trackFile == cache.PathName
-					}); idxAtCache >= 0 {
-						if repo.Index.Cache[idxAtCache].Hash != hash {
-							// File has changed from previous state of the stage area.
-							cacheFiles = append(cacheFiles, trackFile)
-						} else {
-							// Cache and user file are the same. File recently added but not modified.
-						}
-					} else {
-						fmt.Println("File no added after being modified")
-						//File no added after being modified
-						noStageFiles = append(noStageFiles, trackFile)
-					}
-
-				} else {
-					fmt.Println("Tracked file is not modified.")
-					// Tracked file is not modified.
+		// Implementation to discard .got folder.
+		dirs = slices.DeleteFunc(dirs, func(e fs.DirEntry) bool {
+			return e.Name() == ".got" && e.IsDir() || e.Name() == ".git" && e.IsDir()
+		})
+		for _, dir := range dirs {
+			path := filepath.Join(rootDir, dir.Name())
+			if rel := filepath.ToSlash(relativize(repo, path)); ignore != nil && !tracked[rel] && ignore.Ignored(rel, dir.IsDir()) {
+				if dir.IsDir() {
+					rel += "/"
 				}
-			} else {
-				fmt.Println("File tracked for first time because is not in tree.")
-				//File tracked for first time because is not in tree.
+				ignored = append(ignored, rel)
+				continue
 			}
-		}
-	} else {
-		fmt.Println("This is the first commit. Only matter validation of the cache vs user files.")
-		cacheFiles = append(cacheFiles, trackedFiles...)
-		for _, trackFile := range trackedFiles {
-			//user file state
-			hash, err := CreatePossibleObjectFromData(repo, Blob{Path: filepath.Join(repo.GotTree, trackFile)}, BlobHeaderName)
-			if err != nil {
-				panic(err)
-			}
-			if idxAtCache := slices.IndexFunc(repo.Index.Cache, func(cache CacheEntry) bool {
-				return trackFile == cache.PathName
-			}); idxAtCache >= 0 {
-				
-				if repo.Index.Cache[idxAtCache].Hash != hash {
-					noStageFiles = append(noStageFiles, trackFile)
-				} else {
-					fmt.Printf("Files are the same nothig has changed %s", trackFile )
-					//Files are the same nothig has changed.
-				}
+			if dir.IsDir() {
+				entries = append(entries, list(path)...)
 			} else {
-				// Never happen
+				entries = append(entries, path)
 			}
 		}
+		return entries
+	}
+	return list(repo.GotTree), ignored
+}
 
-		//
-
-		// }
-		// THis is the first commit. Only matter validation of the cache vs user files.
+// Make the path relative to the worktree. Relative paths are already relative to the worktree.
+func relativize(repo *GotRepository, path string) string {
+	if !filepath.IsAbs(path) {
+		return filepath.Clean(path)
 	}
-	formatFiles := func(files []string) string {
-		var ret string
-		for _, file := range files {
-			ret += fmt.Sprintf("%s\n", file)
-		}
-		return ret
+	rel, err := filepath.Rel(repo.GotTree, path)
+	if err != nil {
+		panic(err)
 	}
-	fmt.Printf(`\nChanges to be committed:
-				%sChange not staged for next commit:
-				%sUntracked files:
-				%s`, formatFiles(cacheFiles), formatFiles(noStageFiles), formatFiles(relativizeMultiPaths(repo, untrackedFiles)))
+	return rel
 }
 
+// The configuration of the repository. The config file is read the first time only, SetConfiguration keeps it up
+// to date.
 func (repo *GotRepository) GetConfiguration() GotConfig {
+	if repo.config != nil {
+		return *repo.config
+	}
 	content, err := os.ReadFile(filepath.Join(repo.GotDir, "config"))
 	if err != nil {
 		panic(err)
@@ -373,5 +318,15 @@ func (repo *GotRepository) GetConfiguration() GotConfig {
 	if err = Unmarshal(content, &config); err != nil {
 		panic(err)
 	}
+	repo.config = &config
 	return config
 }
+
+// Write the configuration into the config file.
+func (repo *GotRepository) SetConfiguration(config GotConfig) error {
+	if err := CreateOrUpdateRepoFile(repo, "config", config.toBytes()); err != nil {
+		return err
+	}
+	repo.config = &config
+	return nil
+}
@@ -1,9 +1,11 @@
 package internal_test
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"testing"
 
 	internal "github.com/danielrrv/got/internal"
@@ -50,13 +52,17 @@ func TestRepository(t *testing.T) {
 		if err != nil {
 			t.Error(err)
 		}
-		repo.Status()
+		if status := statusTesting(t, repo); !status.Clean() || status.Head != "" {
+			t.Errorf("Expected a clean status without commit, got %+v", status)
+		}
 		CreateFilesTesting(tmp, []string{"src"}, []TestingFile{
 			{Name: "readme.md", RelativePath: "src/readme.md", Data: []byte("some-readme")},
 			{Name: "cache.rs", RelativePath: "src/cache.rs", Data: []byte("some-cache")},
 			{Name: "base64.c", RelativePath: "src/base64.c", Data: []byte("some-base64")},
 		})
-		repo.Status()
+		if status := statusTesting(t, repo); len(status.Untracked) != 3 {
+			t.Errorf("Expected the files untracked, got %v", status.Untracked)
+		}
 
 		repo.Index.AddOrModifyEntries(repo, []string{"src/readme.md"})
 		repo.Index.Persist(repo)
@@ -81,8 +87,6 @@ func TestRepository(t *testing.T) {
 			panic(err)
 		} 
 		fmt.Println("hash of the commit:",hash)
-		// // Implementation to clear the cache after committing changes in DB.
-		repo.Index.Cache = nil
 		//Persist on disk/
 		repo.Index.Persist(repo)
 		//Save the reference HEAD.
@@ -94,27 +98,114 @@ func TestRepository(t *testing.T) {
 		ref.WriteRef(repo)
 
 		//Find out the new status
-		repo.Status()
+		if status := statusTesting(t, repo); len(status.Untracked) != 2 || status.Head != hash {
+			t.Errorf("Expected the other files untracked on the commit, got %+v", status)
+		}
 
 		//Modify the file. Cache is clear because commit was made recently.
 		CreateFilesTesting(tmp, []string{"src"}, []TestingFile{
 			{Name: "readme.md", RelativePath: "src/readme.md", Data: []byte("let's change the content of this file with some modifications")},
 		})
 		//Find pit tje new status
-		repo.Status()
+		if status := statusTesting(t, repo); statusCodesTesting(status, "src/readme.md")[1] != 'M' {
+			t.Errorf("Expected the file modified, got %+v", status.Entries)
+		}
 
 		// Now add the file and see status
 		repo.Index.AddOrModifyEntries(repo, []string{"src/readme.md"})
 		repo.Index.Persist(repo)
 		//Find pit tje new status
-		repo.Status()
+		if status := statusTesting(t, repo); statusCodesTesting(status, "src/readme.md")[1] != '.' {
+			t.Errorf("Expected the modification staged, got %+v", status.Entries)
+		}
 		//Modify some lines
 		CreateFilesTesting(tmp, []string{"src"}, []TestingFile{
 			{Name: "readme.md", RelativePath: "src/readme.md", Data: []byte("let's change the content of this file with some modifications\n Let's add a new line and see")},
 		})
 		//Find pit the new status
-		repo.Status()
+		if status := statusTesting(t, repo); statusCodesTesting(status, "src/readme.md")[1] != 'M' {
+			t.Errorf("Expected the file modified again, got %+v", status.Entries)
+		}
 		
 	})
 
+	t.Run("interrupted writes leave the former files whole", func(t *testing.T) {
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		first := commitWorktreeTesting(t, repo, "first", []TestingFile{
+			{Name: "a.txt", RelativePath: "a.txt", Data: []byte("a\n")},
+			{Name: "b.txt", RelativePath: "b.txt", Data: []byte("b\n")},
+		})
+		files := []string{"index", "HEAD", "config", "refs/heads/main"}
+		before := make(map[string]string)
+		for _, file := range files {
+			content, _ := os.ReadFile(filepath.Join(repo.GotDir, file))
+			before[file] = string(content)
+		}
+		objects := looseObjectsTesting(repo)
+
+		// What it does: the temporary file keeps half of its data, as if the process was killed while writing it.
+		killed := errors.New("killed")
+		restore := internal.InterruptWritesTesting(func(tmpPath string) error {
+			content, _ := os.ReadFile(tmpPath)
+			os.WriteFile(tmpPath, content[:len(content)/2], 0644)
+			return killed
+		})
+		if _, err := internal.WriteObject(repo, rawObject("never written\n"), internal.BlobHeaderName); !errors.Is(err, killed) {
+			t.Errorf("Expected the object write interrupted, got %v", err)
+		}
+		// The index shrinks: a shorter file must not keep the trailing bytes of the former one.
+		repo.Index.Entries = repo.Index.Entries[:1]
+		if err := repo.Index.Persist(repo); !errors.Is(err, killed) {
+			t.Errorf("Expected the index write interrupted, got %v", err)
+		}
+		if err := internal.UpdateBranch(repo, "main", "0123456789abcdef0123456789abcdef01234567"); !errors.Is(err, killed) {
+			t.Errorf("Expected the ref write interrupted, got %v", err)
+		}
+		ref := internal.Ref{IsDirect: true, Reference: first}
+		if err := ref.WriteRef(repo); !errors.Is(err, killed) {
+			t.Errorf("Expected the HEAD write interrupted, got %v", err)
+		}
+		if err := internal.CreateOrUpdateRepoFile(repo, "config", []byte("[core]\n")); !errors.Is(err, killed) {
+			t.Errorf("Expected the config write interrupted, got %v", err)
+		}
+		restore()
+
+		for _, file := range files {
+			if content, _ := os.ReadFile(filepath.Join(repo.GotDir, file)); string(content) != before[file] {
+				t.Errorf("Expected %s untouched, got %q", file, content)
+			}
+		}
+		if after := looseObjectsTesting(repo); !slices.Equal(after, objects) {
+			t.Errorf("Expected no partial object, got %v", after)
+		}
+		if leftovers, _ := filepath.Glob(filepath.Join(repo.GotDir, "tmp_*")); len(leftovers) != 0 {
+			t.Errorf("Expected the temporary files removed, got %v", leftovers)
+		}
+		reopened, err := internal.FindOrCreateRepo(repo.GotTree)
+		if err != nil || len(reopened.Index.Entries) != 2 {
+			t.Errorf("Expected the former index read back, got %v", err)
+		}
+	})
+
+	t.Run("the temporary files of a killed process are ignored", func(t *testing.T) {
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		commitWorktreeTesting(t, repo, "first", []TestingFile{{Name: "a.txt", RelativePath: "a.txt", Data: []byte("a\n")}})
+		os.WriteFile(filepath.Join(repo.GotDir, "tmp_index_123"), []byte("DIRC partial"), 0644)
+		os.WriteFile(filepath.Join(repo.GotDir, "objects", "tmp_0123_456"), []byte("x"), 0644)
+		if _, err := internal.FindOrCreateRepo(repo.GotTree); err != nil {
+			t.Fatal(err)
+		}
+		if problems, err := internal.Fsck(repo); err != nil || len(problems) != 0 {
+			t.Errorf("Expected the leftovers not to be objects nor refs, got %v %v", problems, err)
+		}
+		if branches, err := internal.ListBranches(repo); err != nil || len(branches) != 1 {
+			t.Errorf("Expected a single branch, got %v %v", branches, err)
+		}
+	})
 }
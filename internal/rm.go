@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+var (
+	// A folder given to rm without Recursive.
+	ErrorRemoveFolder = errors.New("not removing a folder recursively without -r")
+	// The file to remove differs from the staged one, or the staged one from HEAD. Force removes it.
+	ErrorRemoveModified = errors.New("the file has local modifications, use --cached to keep it or -f to remove it")
+	// The staged file differs from both HEAD and the worktree, even keeping the file loses the staged content.
+	ErrorRemoveStagedModified = errors.New("the file has staged content different from both the file and HEAD, use -f to remove it")
+)
+
+type RemoveOptions struct {
+	// Remove the files from the index only, the worktree keeps them.
+	Cached bool
+	// Remove the files of the folders given.
+	Recursive bool
+	// Remove the files even when their modifications are lost.
+	Force bool
+}
+
+// Stop tracking the files the paths match, relative to the folder pwd inside the worktree, and delete them from the
+// worktree unless Cached. The index is persisted, the next commit records the removals. The paths are the ones of
+// add, see Add, and match the tracked files only.
+//
+// Nothing is removed when a file would lose its modifications, as git does:
+//   - The staged file differs from both HEAD and the worktree.
+//   - Unless Cached, the staged file differs from HEAD or the worktree file from the staged one.
+func Remove(repo *GotRepository, pwd string, paths []string, options RemoveOptions) ([]string, error) {
+	head := make(map[string]string)
+	if ref := repo.GetHEADReference(); !ref.Invalid {
+		head = flattenTree(repo, ReadCommit(repo, ref.Reference).Tree)
+	}
+	removed := make([]string, 0)
+	removing := make(map[string]bool)
+	for _, given := range paths {
+		spec, err := newPathspec(repo, pwd, given)
+		if err != nil {
+			return nil, err
+		}
+		found := false
+		for _, entry := range repo.Index.Entries {
+			if !spec.match(entry.PathName) || removing[entry.PathName] {
+				continue
+			}
+			if spec.glob == nil && entry.PathName != spec.path && !options.Recursive {
+				return nil, fmt.Errorf("%w: %s", ErrorRemoveFolder, given)
+			}
+			found = true
+			removing[entry.PathName] = true
+			removed = append(removed, entry.PathName)
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: %s", ErrorPathspecNoMatch, given)
+		}
+	}
+	slices.Sort(removed)
+	if !options.Force {
+		positions := repo.Index.positions()
+		for _, entry := range repo.Index.Entries {
+			if entry.Stage != 0 || !removing[entry.PathName] {
+				continue
+			}
+			worktree, exists := hashWorktreeFile(repo, positions, entry.PathName)
+			stagedChanged := head[entry.PathName] != entry.Hash
+			worktreeChanged := exists && worktree != entry.Hash
+			switch {
+			case stagedChanged && worktreeChanged:
+				return nil, fmt.Errorf("%w: %s", ErrorRemoveStagedModified, entry.PathName)
+			case !options.Cached && (stagedChanged || worktreeChanged):
+				return nil, fmt.Errorf("%w: %s", ErrorRemoveModified, entry.PathName)
+			}
+		}
+	}
+	repo.Index.Entries = slices.DeleteFunc(repo.Index.Entries, func(entry IndexEntry) bool {
+		return removing[entry.PathName]
+	})
+	if !options.Cached {
+		for _, path := range removed {
+			file := filepath.Join(repo.GotTree, path)
+			if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return nil, err
+			}
+			removeEmptyDirs(repo, filepath.Dir(file))
+		}
+	}
+	if err := repo.Index.Persist(repo); err != nil {
+		return nil, err
+	}
+	return removed, nil
+}
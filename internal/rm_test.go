@@ -0,0 +1,91 @@
+package internal_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	internal "github.com/danielrrv/got/internal"
+)
+
+func pathExistTesting(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestRemove(t *testing.T) {
+	files := []TestingFile{
+		{RelativePath: "readme.md", Data: []byte("readme\n")},
+		{RelativePath: "src/main.c", Data: []byte("int main;\n")},
+		{RelativePath: "src/lib/util.c", Data: []byte("int util;\n")},
+	}
+
+	t.Run("remove files and folders, and commit the removals", func(t *testing.T) {
+		repo, _ := internal.FindOrCreateRepo(t.TempDir())
+		commitWorktreeTesting(t, repo, "first", files)
+		if _, err := internal.Remove(repo, repo.GotTree, []string{"src"}, internal.RemoveOptions{}); !errors.Is(err, internal.ErrorRemoveFolder) {
+			t.Errorf("Expected the folder refused without recursive, got %v", err)
+		}
+		removed, err := internal.Remove(repo, filepath.Join(repo.GotTree, "src"), []string{"lib"}, internal.RemoveOptions{Recursive: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(removed, []string{"src/lib/util.c"}) || pathExistTesting(filepath.Join(repo.GotTree, "src/lib")) {
+			t.Errorf("Expected the folder removed from the worktree, got %v", removed)
+		}
+		if _, err := internal.Remove(repo, repo.GotTree, []string{"readme.md"}, internal.RemoveOptions{Cached: true}); err != nil {
+			t.Fatal(err)
+		}
+		if !pathExistTesting(filepath.Join(repo.GotTree, "readme.md")) {
+			t.Errorf("Expected the file kept in the worktree")
+		}
+		repo, _ = internal.FindOrCreateRepo(repo.GotTree)
+		if paths := stagedPathsTesting(repo); !slices.Equal(paths, []string{"src/main.c"}) {
+			t.Errorf("Expected the files removed from the index, got %v", paths)
+		}
+		status := statusTesting(t, repo)
+		if statusCodesTesting(status, "readme.md") != "D." || statusCodesTesting(status, "src/lib/util.c") != "D." {
+			t.Errorf("Expected the removals staged in the status, got %+v", status.Entries)
+		}
+		hash, err := internal.CommitIndex(repo, "remove", internal.CommitOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree := internal.ReadTree(repo, internal.ReadCommit(repo, hash).Tree)
+		if items := tree.FlatItems(); len(items) != 1 {
+			t.Errorf("Expected the removed files out of the tree, got %v", items)
+		}
+		if _, err := internal.Remove(repo, repo.GotTree, []string{"readme.md"}, internal.RemoveOptions{}); !errors.Is(err, internal.ErrorPathspecNoMatch) {
+			t.Errorf("Expected the untracked file refused, got %v", err)
+		}
+	})
+
+	t.Run("modifications are not thrown away", func(t *testing.T) {
+		repo, _ := internal.FindOrCreateRepo(t.TempDir())
+		commitWorktreeTesting(t, repo, "first", files)
+		main := filepath.Join(repo.GotTree, "src/main.c")
+		os.WriteFile(main, []byte("int main(void);\n"), 0644)
+		if _, err := internal.Remove(repo, repo.GotTree, []string{"src/main.c"}, internal.RemoveOptions{}); !errors.Is(err, internal.ErrorRemoveModified) {
+			t.Errorf("Expected the modified file refused, got %v", err)
+		}
+		internal.Add(repo, repo.GotTree, []string{"src/main.c"}, internal.AddOptions{})
+		if _, err := internal.Remove(repo, repo.GotTree, []string{"src/main.c"}, internal.RemoveOptions{}); !errors.Is(err, internal.ErrorRemoveModified) {
+			t.Errorf("Expected the staged file refused, got %v", err)
+		}
+		os.WriteFile(main, []byte("int main(int argc);\n"), 0644)
+		if _, err := internal.Remove(repo, repo.GotTree, []string{"src/main.c"}, internal.RemoveOptions{Cached: true}); !errors.Is(err, internal.ErrorRemoveStagedModified) {
+			t.Errorf("Expected the staged content lost refused, got %v", err)
+		}
+		if !slices.Contains(stagedPathsTesting(repo), "src/main.c") || !pathExistTesting(main) {
+			t.Errorf("Expected nothing removed")
+		}
+		if _, err := internal.Remove(repo, repo.GotTree, []string{"src/main.c"}, internal.RemoveOptions{Force: true}); err != nil {
+			t.Fatal(err)
+		}
+		if slices.Contains(stagedPathsTesting(repo), "src/main.c") || pathExistTesting(main) {
+			t.Errorf("Expected the file removed by force")
+		}
+	})
+}
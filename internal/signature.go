@@ -0,0 +1,220 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Environment variables overriding the identity and the date of the commits.
+	envAuthorName     = "GOT_AUTHOR_NAME"
+	envAuthorEmail    = "GOT_AUTHOR_EMAIL"
+	envAuthorDate     = "GOT_AUTHOR_DATE"
+	envCommitterName  = "GOT_COMMITTER_NAME"
+	envCommitterEmail = "GOT_COMMITTER_EMAIL"
+	envCommitterDate  = "GOT_COMMITTER_DATE"
+)
+
+var (
+	// The signature isn't in "Name <email> time zone" form.
+	ErrorInvalidSignature = errors.New("invalid signature")
+	// The identity isn't in "Name <email>" form.
+	ErrorInvalidIdentity = errors.New("invalid identity, expected \"Name <email>\"")
+	// The date isn't in any of the supported formats.
+	ErrorInvalidDate = errors.New("invalid date")
+)
+
+// Layouts accepted for dates besides git's "<unix time> <zone>" and "@<unix time>". Dates without zone are local.
+var dateLayouts = []string{
+	time.RFC3339,
+	time.RFC1123Z,
+	"2006-01-02 15:04:05 -0700",
+	time.DateTime,
+	"2006-01-02T15:04:05",
+	time.DateOnly,
+}
+
+// Who made the change and when, as git records it: "Name <email> 1700000000 +0100".
+type Signature struct {
+	Name  string
+	Email string
+	// Seconds since the Unix epoch.
+	When int64
+	// Offset of the time zone in minutes east of UTC.
+	Offset int
+}
+
+// Create the signature at the given time keeping its time zone.
+func NewSignature(name string, email string, when time.Time) Signature {
+	_, offset := when.Zone()
+	return Signature{Name: name, Email: email, When: when.Unix(), Offset: offset / 60}
+}
+
+// The time of the signature in its own time zone.
+func (s Signature) Time() time.Time {
+	return time.Unix(s.When, 0).In(time.FixedZone("", s.Offset*60))
+}
+
+// The time zone as git writes it, +hhmm or -hhmm.
+func (s Signature) Zone() string {
+	sign, offset := '+', s.Offset
+	if offset < 0 {
+		sign, offset = '-', -offset
+	}
+	return fmt.Sprintf("%c%02d%02d", sign, offset/60, offset%60)
+}
+
+// The identity without the date, "Name <email>".
+func (s Signature) Identity() string {
+	return fmt.Sprintf("%s <%s>", s.Name, s.Email)
+}
+
+func (s Signature) String() string {
+	return fmt.Sprintf("%s %d %s", s.Identity(), s.When, s.Zone())
+}
+
+func (s Signature) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *Signature) UnmarshalText(text []byte) error {
+	signature, err := ParseSignature(string(text))
+	if err != nil {
+		return err
+	}
+	*s = signature
+	return nil
+}
+
+// Parse a signature in "Name <email> 1700000000 +0100" form.
+func ParseSignature(value string) (Signature, error) {
+	end := strings.LastIndexByte(value, '>')
+	if end < 0 {
+		return Signature{}, fmt.Errorf("%w: %q", ErrorInvalidSignature, value)
+	}
+	signature, err := ParseIdentity(value[:end+1])
+	if err != nil {
+		return Signature{}, fmt.Errorf("%w: %q", ErrorInvalidSignature, value)
+	}
+	fields := strings.Fields(value[end+1:])
+	if len(fields) != 2 {
+		return Signature{}, fmt.Errorf("%w: %q", ErrorInvalidSignature, value)
+	}
+	if signature.When, signature.Offset, err = parseRawDate(fields[0], fields[1]); err != nil {
+		return Signature{}, fmt.Errorf("%w: %q", ErrorInvalidSignature, value)
+	}
+	return signature, nil
+}
+
+// Parse an identity in "Name <email>" form.
+func ParseIdentity(value string) (Signature, error) {
+	start := strings.IndexByte(value, '<')
+	end := strings.LastIndexByte(value, '>')
+	if start < 0 || end < start || strings.TrimSpace(value[end+1:]) != "" {
+		return Signature{}, fmt.Errorf("%w: %q", ErrorInvalidIdentity, value)
+	}
+	return Signature{Name: strings.TrimSpace(value[:start]), Email: value[start+1 : end]}, nil
+}
+
+// Parse the date in git's "<unix time> <zone>" or "@<unix time>" forms, or any of the supported layouts.
+func ParseDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if unix, found := strings.CutPrefix(value, "@"); found {
+		when, err := strconv.ParseInt(unix, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%w: %q", ErrorInvalidDate, value)
+		}
+		return time.Unix(when, 0).UTC(), nil
+	}
+	if unix, zone, found := strings.Cut(value, " "); found {
+		if when, offset, err := parseRawDate(unix, zone); err == nil {
+			return time.Unix(when, 0).In(time.FixedZone("", offset*60)), nil
+		}
+	}
+	for _, layout := range dateLayouts {
+		if when, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return when, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%w: %q", ErrorInvalidDate, value)
+}
+
+// Parse the unix time and the +hhmm zone.
+func parseRawDate(unix string, zone string) (int64, int, error) {
+	when, err := strconv.ParseInt(unix, 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(zone) != 5 || (zone[0] != '+' && zone[0] != '-') {
+		return 0, 0, ErrorInvalidDate
+	}
+	hours, errHours := strconv.Atoi(zone[1:3])
+	minutes, errMinutes := strconv.Atoi(zone[3:5])
+	if errHours != nil || errMinutes != nil || minutes >= 60 {
+		return 0, 0, ErrorInvalidDate
+	}
+	offset := hours*60 + minutes
+	if zone[0] == '-' {
+		offset = -offset
+	}
+	return when, offset, nil
+}
+
+// Options of a new commit.
+type CommitOptions struct {
+	// The author in "Name <email>" form. The configured user by default.
+	Author string
+	// The author date. The current time by default.
+	Date string
+}
+
+// Obtain the author and committer of a new commit. The configured user at the current time is overridden by
+// the GOT_AUTHOR_* and GOT_COMMITTER_* environment variables, and the author by the options in turn.
+func (repo *GotRepository) Signatures(options CommitOptions) (Signature, Signature, error) {
+	config := repo.GetConfiguration()
+	now := time.Now()
+	author, err := signatureFromEnv(NewSignature(config.User.Name, config.User.Email, now), envAuthorName, envAuthorEmail, envAuthorDate)
+	if err != nil {
+		return Signature{}, Signature{}, err
+	}
+	committer, err := signatureFromEnv(NewSignature(config.User.Name, config.User.Email, now), envCommitterName, envCommitterEmail, envCommitterDate)
+	if err != nil {
+		return Signature{}, Signature{}, err
+	}
+	if options.Author != "" {
+		identity, err := ParseIdentity(options.Author)
+		if err != nil {
+			return Signature{}, Signature{}, err
+		}
+		author.Name, author.Email = identity.Name, identity.Email
+	}
+	if options.Date != "" {
+		when, err := ParseDate(options.Date)
+		if err != nil {
+			return Signature{}, Signature{}, err
+		}
+		author = NewSignature(author.Name, author.Email, when)
+	}
+	return author, committer, nil
+}
+
+func signatureFromEnv(signature Signature, nameVar, emailVar, dateVar string) (Signature, error) {
+	if name, ok := os.LookupEnv(nameVar); ok {
+		signature.Name = name
+	}
+	if email, ok := os.LookupEnv(emailVar); ok {
+		signature.Email = email
+	}
+	if date, ok := os.LookupEnv(dateVar); ok {
+		when, err := ParseDate(date)
+		if err != nil {
+			return Signature{}, fmt.Errorf("%s: %w", dateVar, err)
+		}
+		signature = NewSignature(signature.Name, signature.Email, when)
+	}
+	return signature, nil
+}
@@ -0,0 +1,119 @@
+package internal_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	internal "github.com/danielrrv/got/internal"
+)
+
+func TestSignature(t *testing.T) {
+	t.Run("format and parse", func(t *testing.T) {
+		signature := internal.Signature{Name: "Daniel Rodriguez", Email: "daniel@got.dev", When: 1700000000, Offset: 60}
+		if signature.String() != "Daniel Rodriguez <daniel@got.dev> 1700000000 +0100" {
+			t.Errorf("Expected git's signature form, got %q", signature.String())
+		}
+		parsed, err := internal.ParseSignature(signature.String())
+		if err != nil || parsed != signature {
+			t.Errorf("Expected the signature to round-trip, got %v %v", parsed, err)
+		}
+		negative := internal.Signature{Name: "Ana", Email: "ana@got.dev", When: 0, Offset: -(3*60 + 30)}
+		if negative.Zone() != "-0330" {
+			t.Errorf("Expected a negative zone, got %s", negative.Zone())
+		}
+		if parsed, _ := internal.ParseSignature(negative.String()); parsed != negative {
+			t.Errorf("Expected the negative zone to round-trip, got %v", parsed)
+		}
+		if got := signature.Time().Format(time.RFC3339); got != "2023-11-14T23:13:20+01:00" {
+			t.Errorf("Expected the time in its own zone, got %s", got)
+		}
+		for _, invalid := range []string{"Daniel 1700000000 +0100", "Daniel <daniel@got.dev>", "Daniel <daniel@got.dev> 1700000000 0100", "Daniel <daniel@got.dev> now +0100"} {
+			if _, err := internal.ParseSignature(invalid); !errors.Is(err, internal.ErrorInvalidSignature) {
+				t.Errorf("Expected %q to be invalid, got %v", invalid, err)
+			}
+		}
+	})
+
+	t.Run("parse dates", func(t *testing.T) {
+		cases := map[string]int64{
+			"1700000000 +0100":                1700000000,
+			"@1700000000":                     1700000000,
+			"2023-11-14T23:13:20+01:00":       1700000000,
+			"Tue, 14 Nov 2023 23:13:20 +0100": 1700000000,
+			"2023-11-14 23:13:20 +0100":       1700000000,
+		}
+		for value, expected := range cases {
+			when, err := internal.ParseDate(value)
+			if err != nil || when.Unix() != expected {
+				t.Errorf("Expected %q to be %d, got %d %v", value, expected, when.Unix(), err)
+			}
+		}
+		if when, _ := internal.ParseDate("1700000000 -0500"); internal.NewSignature("", "", when).Offset != -300 {
+			t.Errorf("Expected the zone of the date to be kept")
+		}
+		if _, err := internal.ParseDate("yesterday"); !errors.Is(err, internal.ErrorInvalidDate) {
+			t.Errorf("Expected an invalid date, got %v", err)
+		}
+	})
+
+	t.Run("overrides", func(t *testing.T) {
+		repo, err := internal.FindOrCreateRepo(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("GOT_AUTHOR_NAME", "Env Author")
+		t.Setenv("GOT_AUTHOR_EMAIL", "author@got.dev")
+		t.Setenv("GOT_AUTHOR_DATE", "1600000000 +0200")
+		t.Setenv("GOT_COMMITTER_NAME", "Env Committer")
+		t.Setenv("GOT_COMMITTER_EMAIL", "committer@got.dev")
+		t.Setenv("GOT_COMMITTER_DATE", "@1650000000")
+		author, committer, err := repo.Signatures(internal.CommitOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if author.String() != "Env Author <author@got.dev> 1600000000 +0200" {
+			t.Errorf("Expected the author from the environment, got %s", author)
+		}
+		if committer.String() != "Env Committer <committer@got.dev> 1650000000 +0000" {
+			t.Errorf("Expected the committer from the environment, got %s", committer)
+		}
+		author, committer, err = repo.Signatures(internal.CommitOptions{Author: "Ana <ana@got.dev>", Date: "1700000000 -0300"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if author.String() != "Ana <ana@got.dev> 1700000000 -0300" {
+			t.Errorf("Expected the options to override the author, got %s", author)
+		}
+		if committer.Name != "Env Committer" {
+			t.Errorf("Expected the committer not to be overridden by the options, got %s", committer)
+		}
+		if _, _, err := repo.Signatures(internal.CommitOptions{Author: "Ana"}); !errors.Is(err, internal.ErrorInvalidIdentity) {
+			t.Errorf("Expected an invalid author, got %v", err)
+		}
+		t.Setenv("GOT_COMMITTER_DATE", "soon")
+		if _, _, err := repo.Signatures(internal.CommitOptions{}); !errors.Is(err, internal.ErrorInvalidDate) {
+			t.Errorf("Expected an invalid committer date, got %v", err)
+		}
+	})
+
+	t.Run("reproducible commits", func(t *testing.T) {
+		t.Setenv("GOT_AUTHOR_DATE", "1700000000 +0100")
+		t.Setenv("GOT_COMMITTER_DATE", "1700000000 +0100")
+		hashes := make([]string, 0)
+		for range 2 {
+			repo, err := internal.FindOrCreateRepo(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			hash := commitWorktreeTesting(t, repo, "first", []TestingFile{{Name: "a.txt", RelativePath: "a.txt", Data: []byte("a")}})
+			hashes = append(hashes, hash)
+			if commit := internal.ReadCommit(repo, hash); commit.Author.When != 1700000000 || commit.Committer.Offset != 60 {
+				t.Errorf("Expected the dates from the environment, got %v", commit)
+			}
+		}
+		if hashes[0] != hashes[1] {
+			t.Errorf("Expected the same commit hash, got %v", hashes)
+		}
+	})
+}
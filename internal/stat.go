@@ -0,0 +1,85 @@
+package internal
+
+import (
+	"io/fs"
+	"time"
+)
+
+// The git modes of the files as the index keeps them.
+const (
+	statModeRegular    = 0100644
+	statModeExecutable = 0100755
+	statModeSymlink    = 0120000
+	// A commit of another repository, the submodules. The worktree only has their empty folders.
+	statModeGitlink = 0160000
+)
+
+// Fill the stat data of the entry from the file info: times, size and mode here, the rest by the platform, see
+// fillSysStat. Every field is truncated to 32 bits, as git does.
+func fillStat(entry *IndexEntry, fi fs.FileInfo) {
+	entry.Mtime_s = Bit32(fi.ModTime().Unix())
+	entry.Mtime_ns = Bit32(fi.ModTime().Nanosecond())
+	entry.FileSize = Bit32(fi.Size())
+	entry.FileMode = statMode(fi)
+	// What it does: the platforms without a change time keep the modification time.
+	entry.Ctime_s, entry.Ctime_ns = entry.Mtime_s, entry.Mtime_ns
+	fillSysStat(entry, fi)
+}
+
+// The git mode of the file of the info: a symbolic link, an executable or a regular file.
+func statMode(fi fs.FileInfo) Bit32 {
+	switch {
+	case fi.Mode()&fs.ModeSymlink != 0:
+		return statModeSymlink
+	case fi.Mode()&0111 != 0:
+		return statModeExecutable
+	}
+	return statModeRegular
+}
+
+// Whether the stat data of the entry is the one of the file info. The content is the same then, unless the file
+// changed within the same timestamp the index was written, see isRacy.
+func (entry IndexEntry) statMatches(fi fs.FileInfo) bool {
+	current := IndexEntry{}
+	fillStat(&current, fi)
+	return entry.Ctime_s == current.Ctime_s && entry.Ctime_ns == current.Ctime_ns &&
+		entry.Mtime_s == current.Mtime_s && entry.Mtime_ns == current.Mtime_ns &&
+		entry.Dev == current.Dev && entry.Ino == current.Ino && entry.FileMode == current.FileMode &&
+		entry.Uid == current.Uid && entry.Gid == current.Gid && entry.FileSize == current.FileSize
+}
+
+// Whether the file may have changed after its stat data was recorded without its stat data changing: the file was
+// modified within the timestamp of the index, the granularity of the file system may hide a later write.
+func (entry IndexEntry) isRacy(timestamp time.Time) bool {
+	mtime := time.Unix(int64(entry.Mtime_s), int64(entry.Mtime_ns))
+	return !mtime.Before(timestamp)
+}
+
+// The positions of the entries at stage 0 by path. The operations looking up many paths build it once, it holds
+// until the entries are removed or reordered.
+func (index *Index) positions() map[string]int {
+	positions := make(map[string]int, len(index.Entries))
+	for i, entry := range index.Entries {
+		if entry.Stage == 0 {
+			positions[entry.PathName] = i
+		}
+	}
+	return positions
+}
+
+// Whether the stat data of the entry says the file of the given info is unchanged. The hash of the entry is the hash
+// of the file then, without reading it.
+func (index *Index) unchanged(entry IndexEntry, fi fs.FileInfo) bool {
+	return entry.statMatches(fi) && !entry.isRacy(index.timestamp)
+}
+
+// Smudge the entries modified within the timestamp the index is about to be written with: their size is set to 0
+// so that the stat data never matches again, and the file is hashed to tell whether it changed. An empty file is
+// hashed to the same content.
+func (index *Index) smudgeRacyEntries(timestamp time.Time) {
+	for i := range index.Entries {
+		if index.Entries[i].isRacy(timestamp) {
+			index.Entries[i].FileSize = 0
+		}
+	}
+}
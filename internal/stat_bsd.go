@@ -0,0 +1,19 @@
+//go:build darwin || freebsd || netbsd
+
+package internal
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// Fill the change time, device, inode and owner of the file.
+func fillSysStat(entry *IndexEntry, fi fs.FileInfo) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return
+	}
+	entry.Ctime_s, entry.Ctime_ns = Bit32(st.Ctimespec.Sec), Bit32(st.Ctimespec.Nsec)
+	entry.Dev, entry.Ino = Bit32(st.Dev), Bit32(st.Ino)
+	entry.Uid, entry.Gid = Bit32(st.Uid), Bit32(st.Gid)
+}
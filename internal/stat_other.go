@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !freebsd && !netbsd
+
+package internal
+
+import "io/fs"
+
+// The platform tells the modification time, size and mode only. The change time is the modification time.
+func fillSysStat(entry *IndexEntry, fi fs.FileInfo) {}
@@ -0,0 +1,436 @@
+package internal
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// The state of a file on one side of the status, as the letters of git's short format.
+type StatusCode byte
+
+const (
+	StatusUnmodified StatusCode = '.'
+	StatusAdded      StatusCode = 'A'
+	StatusModified   StatusCode = 'M'
+	StatusDeleted    StatusCode = 'D'
+	StatusRenamed    StatusCode = 'R'
+	// A file replaced by a symbolic link, or the other way around.
+	StatusTypeChanged StatusCode = 'T'
+	// A conflicted file of a merge in progress.
+	StatusUnmerged StatusCode = 'U'
+)
+
+type StatusOptions struct {
+	// List the ignored files too.
+	Ignored bool
+}
+
+// A tracked file with changes.
+type StatusEntry struct {
+	// The path relative to the worktree, the new one of a renamed file.
+	Path string
+	// The former path of a renamed file.
+	OrigPath string
+	// The change staged, between HEAD and the index.
+	Staged StatusCode
+	// The change not staged, between the index and the worktree.
+	Unstaged StatusCode
+	// How much of the former file a renamed file keeps, in percent.
+	Similarity int
+	// The mode and hash of the file in HEAD, in the index and the mode in the worktree. Zero and empty when missing.
+	HeadMode     uint32
+	IndexMode    uint32
+	WorktreeMode uint32
+	HeadHash     string
+	IndexHash    string
+	// The mode and hash of the base, ours and theirs of a conflicted file.
+	StageModes  [3]uint32
+	StageHashes [3]string
+}
+
+type StatusResult struct {
+	// The branch HEAD points to, empty when detached.
+	Branch string
+	// The commit of HEAD, empty when there is no commit yet.
+	Head string
+	// The tracked files with changes, sorted by path.
+	Entries []StatusEntry
+	// The files not tracked, relative to the worktree.
+	Untracked []string
+	// The ignored files, and the ignored folders ending with "/", when asked for.
+	Ignored []string
+}
+
+// Whether nothing is staged, modified or untracked.
+func (s *StatusResult) Clean() bool {
+	return len(s.Entries) == 0 && len(s.Untracked) == 0
+}
+
+// Compare HEAD, the index and the worktree:
+//   - The staged changes are the ones between the tree of HEAD and the index. The deleted files found again at another
+//     path with similar content are renames. See DetectRenames.
+//   - The changes not staged are the ones between the index and the worktree.
+//   - The untracked files are the files of the worktree the index doesn't have, the ignored ones aside. See Ignore.
+//
+// The modes are compared on both sides as git does: a file that became or stopped being executable is modified, a
+// file that changed of type, such as a file replaced by a symbolic link, is a typechange.
+func (repo *GotRepository) Status(options StatusOptions) (*StatusResult, error) {
+	ignore, err := NewIgnore(repo)
+	if err != nil {
+		return nil, err
+	}
+	result := &StatusResult{Untracked: make([]string, 0), Ignored: make([]string, 0)}
+	result.Branch, _ = repo.GetHEADBranch()
+	headTree := TreeItem{Mode: TreeMode}
+	if hash, err := ResolveRevision(repo, "HEAD"); err == nil {
+		result.Head = hash
+		headTree = ReadTree(repo, ReadCommit(repo, hash).Tree)
+	} else if !errors.Is(err, ErrorNoCommitYet) && !errors.Is(err, ErrorUnknownRevision) {
+		return nil, err
+	}
+	headBlobs := blobsByPath(headTree)
+
+	entries := make(map[string]*StatusEntry)
+	entryOf := func(path string) *StatusEntry {
+		if entry, ok := entries[path]; ok {
+			return entry
+		}
+		entry := &StatusEntry{Path: path, Staged: StatusUnmodified, Unstaged: StatusUnmodified}
+		if head, ok := headBlobs[path]; ok {
+			entry.HeadMode, entry.HeadHash = parseMode(head.Mode), head.Hash
+		}
+		entries[path] = entry
+		return entry
+	}
+	for _, change := range DetectRenames(repo, DiffTrees(headTree, IndexTree(repo)), DefaultRenameOptions) {
+		switch change.Type {
+		case ChangeAdded:
+			entryOf(change.Path).Staged = StatusAdded
+		case ChangeDeleted:
+			entryOf(change.Path).Staged = StatusDeleted
+		case ChangeModified, ChangeModeChanged:
+			entryOf(change.Path).Staged = StatusModified
+			if fileType(parseMode(change.OldMode)) != fileType(parseMode(change.NewMode)) {
+				entryOf(change.Path).Staged = StatusTypeChanged
+			}
+		case ChangeRenamed:
+			entry := entryOf(change.Path)
+			entry.Staged, entry.OrigPath, entry.Similarity = StatusRenamed, change.OldPath, change.Similarity
+			entry.HeadMode, entry.HeadHash = parseMode(change.OldMode), change.OldHash
+		}
+	}
+	tracked := make(map[string]bool)
+	positions := repo.Index.positions()
+	for _, indexEntry := range repo.Index.Entries {
+		tracked[indexEntry.PathName] = true
+		if indexEntry.Stage != 0 {
+			entry := entryOf(indexEntry.PathName)
+			entry.Staged, entry.Unstaged = StatusUnmerged, StatusUnmerged
+			entry.StageModes[indexEntry.Stage-1] = indexMode(indexEntry)
+			entry.StageHashes[indexEntry.Stage-1] = indexEntry.Hash
+			entry.WorktreeMode = worktreeMode(repo, indexEntry.PathName)
+			continue
+		}
+		unstaged := StatusUnmodified
+		// What it does: the file is stat once, its mode and stat data serve every comparison.
+		fi, err := os.Lstat(filepath.Join(repo.GotTree, indexEntry.PathName))
+		exists := err == nil && !fi.IsDir()
+		var mode Bit32
+		if exists {
+			mode = statMode(fi)
+		}
+		switch {
+		case indexEntry.FileMode == statModeGitlink:
+			// What it does: the submodules are checked out as empty folders, their content is another repository.
+			mode = statModeGitlink
+		case !exists:
+			unstaged = StatusDeleted
+		case fileType(uint32(mode)) != fileType(indexMode(indexEntry)):
+			unstaged = StatusTypeChanged
+		// What it does: the entries of the former index versions lack the mode, only their content is compared.
+		case indexEntry.FileMode != 0 && mode != indexEntry.FileMode:
+			unstaged = StatusModified
+		default:
+			if hashUserFile(repo, positions, indexEntry.PathName, fi) != indexEntry.Hash {
+				unstaged = StatusModified
+			}
+		}
+		if _, changed := entries[indexEntry.PathName]; !changed && unstaged == StatusUnmodified {
+			continue
+		}
+		entry := entryOf(indexEntry.PathName)
+		entry.Unstaged = unstaged
+		entry.IndexMode, entry.IndexHash = indexMode(indexEntry), indexEntry.Hash
+		entry.WorktreeMode = uint32(mode)
+	}
+	for _, entry := range entries {
+		result.Entries = append(result.Entries, *entry)
+	}
+	slices.SortFunc(result.Entries, func(a, b StatusEntry) int {
+		return cmp.Compare(a.Path, b.Path)
+	})
+
+	files, ignored := listWorkTree(repo, ignore)
+	for _, file := range files {
+		if path := filepath.ToSlash(relativize(repo, file)); !tracked[path] {
+			result.Untracked = append(result.Untracked, path)
+		}
+	}
+	if options.Ignored {
+		result.Ignored = ignored
+	}
+	return result, nil
+}
+
+// The mode of a tree entry as a number, 0100644 for "100644".
+func parseMode(mode Mode) uint32 {
+	value, _ := strconv.ParseUint(string(mode), 8, 32)
+	return uint32(value)
+}
+
+// The type of file of the mode: regular file, symbolic link or gitlink. A regular file becoming executable keeps its
+// type, a file replaced by a symbolic link changes it.
+func fileType(mode uint32) uint32 {
+	return mode & 0170000
+}
+
+// The mode of the file of the index entry. The entries of the former index versions lack it, they are regular files.
+func indexMode(entry IndexEntry) uint32 {
+	if entry.FileMode == 0 {
+		return statModeRegular
+	}
+	return uint32(entry.FileMode)
+}
+
+// The mode of the file in the worktree, zero when it doesn't exist.
+func worktreeMode(repo *GotRepository, path string) uint32 {
+	fi, err := os.Lstat(filepath.Join(repo.GotTree, path))
+	if err != nil || fi.IsDir() {
+		return 0
+	}
+	return uint32(statMode(fi))
+}
+
+type StatusFormat int
+
+const (
+	// The sections of git's default format, for people.
+	StatusLong StatusFormat = iota
+	// The two letters of each file, relative to the current folder.
+	StatusShort
+	// The short format relative to the worktree, stable across versions. See git status --porcelain=v1.
+	StatusPorcelainV1
+	// The modes and hashes of each file besides its letters. See git status --porcelain=v2.
+	StatusPorcelainV2
+)
+
+type StatusWriteOptions struct {
+	Format StatusFormat
+	// Show the branch: a "##" line in the short formats, "# branch." headers in porcelain v2.
+	Branch bool
+	// End the lines with NUL instead of newline and don't quote the paths, for the short and porcelain formats.
+	NulTerminated bool
+	// The folder the paths of the long and short formats are relative to. Empty means the worktree.
+	Pwd string
+}
+
+// Write the status in the format of git status.
+func WriteStatus(repo *GotRepository, w io.Writer, status *StatusResult, options StatusWriteOptions) error {
+	var out bytes.Buffer
+	display := func(path string) string {
+		if options.Pwd != "" && options.Format != StatusPorcelainV1 && options.Format != StatusPorcelainV2 {
+			if rel, err := filepath.Rel(options.Pwd, filepath.Join(repo.GotTree, filepath.FromSlash(path))); err == nil {
+				path = filepath.ToSlash(rel) + map[bool]string{true: "/", false: ""}[strings.HasSuffix(path, "/")]
+			}
+		}
+		if options.NulTerminated && options.Format != StatusLong {
+			return path
+		}
+		return quotePath(path)
+	}
+	switch options.Format {
+	case StatusLong:
+		writeLongStatus(&out, status, display)
+	case StatusShort, StatusPorcelainV1:
+		writeShortStatus(&out, status, options, display)
+	case StatusPorcelainV2:
+		writePorcelainV2Status(&out, status, options, display)
+	}
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+func writeLongStatus(out *bytes.Buffer, status *StatusResult, display func(string) string) {
+	if status.Branch != "" {
+		fmt.Fprintf(out, "On branch %s\n", status.Branch)
+	} else {
+		fmt.Fprintf(out, "HEAD detached at %s\n", shortHash(status.Head))
+	}
+	if status.Head == "" {
+		out.WriteString("\nNo commits yet\n")
+	}
+	labels := map[StatusCode]string{StatusAdded: "new file:", StatusModified: "modified:", StatusDeleted: "deleted:",
+		StatusRenamed: "renamed:", StatusTypeChanged: "typechange:"}
+	section := func(title string, line func(entry StatusEntry) (string, bool)) {
+		lines := make([]string, 0)
+		for _, entry := range status.Entries {
+			if text, ok := line(entry); ok {
+				lines = append(lines, text)
+			}
+		}
+		if len(lines) > 0 {
+			fmt.Fprintf(out, "\n%s:\n", title)
+			for _, text := range lines {
+				fmt.Fprintf(out, "\t%s\n", text)
+			}
+		}
+	}
+	section("Changes to be committed", func(entry StatusEntry) (string, bool) {
+		if entry.Staged == StatusUnmodified || entry.Staged == StatusUnmerged {
+			return "", false
+		}
+		if entry.Staged == StatusRenamed {
+			return fmt.Sprintf("%-12s%s -> %s", labels[entry.Staged], display(entry.OrigPath), display(entry.Path)), true
+		}
+		return fmt.Sprintf("%-12s%s", labels[entry.Staged], display(entry.Path)), true
+	})
+	section("Unmerged paths", func(entry StatusEntry) (string, bool) {
+		return fmt.Sprintf("%-17s%s", "both modified:", display(entry.Path)), entry.Staged == StatusUnmerged
+	})
+	section("Changes not staged for commit", func(entry StatusEntry) (string, bool) {
+		if entry.Unstaged == StatusUnmodified || entry.Unstaged == StatusUnmerged {
+			return "", false
+		}
+		return fmt.Sprintf("%-12s%s", labels[entry.Unstaged], display(entry.Path)), true
+	})
+	for _, list := range []struct {
+		title string
+		paths []string
+	}{{"Untracked files", status.Untracked}, {"Ignored files", status.Ignored}} {
+		if len(list.paths) == 0 {
+			continue
+		}
+		fmt.Fprintf(out, "\n%s:\n", list.title)
+		for _, path := range list.paths {
+			fmt.Fprintf(out, "\t%s\n", display(path))
+		}
+	}
+	if status.Clean() {
+		out.WriteString("\nnothing to commit, working tree clean\n")
+	}
+}
+
+func writeShortStatus(out *bytes.Buffer, status *StatusResult, options StatusWriteOptions, display func(string) string) {
+	end := "\n"
+	if options.NulTerminated {
+		end = "\x00"
+	}
+	if options.Branch {
+		switch {
+		case status.Branch == "":
+			out.WriteString("## HEAD (no branch)" + end)
+		case status.Head == "":
+			out.WriteString("## No commits yet on " + status.Branch + end)
+		default:
+			out.WriteString("## " + status.Branch + end)
+		}
+	}
+	letter := func(code StatusCode) byte {
+		if code == StatusUnmodified {
+			return ' '
+		}
+		return byte(code)
+	}
+	for _, entry := range status.Entries {
+		fmt.Fprintf(out, "%c%c ", letter(entry.Staged), letter(entry.Unstaged))
+		switch {
+		case entry.OrigPath == "":
+			out.WriteString(display(entry.Path) + end)
+		case options.NulTerminated:
+			// What it does: git writes the new path first with -z.
+			out.WriteString(entry.Path + end + entry.OrigPath + end)
+		default:
+			out.WriteString(display(entry.OrigPath) + " -> " + display(entry.Path) + end)
+		}
+	}
+	for _, path := range status.Untracked {
+		out.WriteString("?? " + display(path) + end)
+	}
+	for _, path := range status.Ignored {
+		out.WriteString("!! " + display(path) + end)
+	}
+}
+
+func writePorcelainV2Status(out *bytes.Buffer, status *StatusResult, options StatusWriteOptions, display func(string) string) {
+	end := "\n"
+	if options.NulTerminated {
+		end = "\x00"
+	}
+	if options.Branch {
+		out.WriteString("# branch.oid " + cmp.Or(status.Head, "(initial)") + end)
+		out.WriteString("# branch.head " + cmp.Or(status.Branch, "(detached)") + end)
+	}
+	hash := func(h string) string {
+		return cmp.Or(h, strings.Repeat("0", 40))
+	}
+	for _, entry := range status.Entries {
+		xy := string([]byte{byte(entry.Staged), byte(entry.Unstaged)})
+		switch {
+		case entry.Staged == StatusUnmerged:
+			fmt.Fprintf(out, "u %s N... %06o %06o %06o %06o %s %s %s %s%s", xy,
+				entry.StageModes[0], entry.StageModes[1], entry.StageModes[2], entry.WorktreeMode,
+				hash(entry.StageHashes[0]), hash(entry.StageHashes[1]), hash(entry.StageHashes[2]), display(entry.Path), end)
+		case entry.OrigPath != "":
+			separator := "\t"
+			if options.NulTerminated {
+				separator = "\x00"
+			}
+			fmt.Fprintf(out, "2 %s N... %06o %06o %06o %s %s R%d %s%s%s%s", xy, entry.HeadMode, entry.IndexMode,
+				entry.WorktreeMode, hash(entry.HeadHash), hash(entry.IndexHash), entry.Similarity, display(entry.Path),
+				separator, display(entry.OrigPath), end)
+		default:
+			fmt.Fprintf(out, "1 %s N... %06o %06o %06o %s %s %s%s", xy, entry.HeadMode, entry.IndexMode,
+				entry.WorktreeMode, hash(entry.HeadHash), hash(entry.IndexHash), display(entry.Path), end)
+		}
+	}
+	for _, path := range status.Untracked {
+		out.WriteString("? " + display(path) + end)
+	}
+	for _, path := range status.Ignored {
+		out.WriteString("! " + display(path) + end)
+	}
+}
+
+// Quote the path as git does when it has control characters, quotes, backslashes or bytes out of ASCII.
+func quotePath(path string) string {
+	if !strings.ContainsFunc(path, func(r rune) bool {
+		return r < 0x20 || r == '"' || r == '\\' || r >= 0x7f
+	}) {
+		return path
+	}
+	var quoted strings.Builder
+	quoted.WriteByte('"')
+	escapes := map[byte]string{'\a': `\a`, '\b': `\b`, '\t': `\t`, '\n': `\n`, '\v': `\v`, '\f': `\f`, '\r': `\r`,
+		'"': `\"`, '\\': `\\`}
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		switch escape, ok := escapes[c]; {
+		case ok:
+			quoted.WriteString(escape)
+		case c < 0x20 || c >= 0x7f:
+			fmt.Fprintf(&quoted, `\%03o`, c)
+		default:
+			quoted.WriteByte(c)
+		}
+	}
+	quoted.WriteByte('"')
+	return quoted.String()
+}
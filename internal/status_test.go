@@ -0,0 +1,237 @@
+package internal_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	internal "github.com/danielrrv/got/internal"
+)
+
+func statusTesting(t *testing.T, repo *internal.GotRepository) *internal.StatusResult {
+	status, err := repo.Status(internal.StatusOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return status
+}
+
+// The staged and unstaged codes of the file, ".." when it has no change.
+func statusCodesTesting(status *internal.StatusResult, path string) string {
+	for _, entry := range status.Entries {
+		if entry.Path == path {
+			return string([]byte{byte(entry.Staged), byte(entry.Unstaged)})
+		}
+	}
+	return ".."
+}
+
+func writeStatusTesting(t *testing.T, repo *internal.GotRepository, status *internal.StatusResult, options internal.StatusWriteOptions) string {
+	var out bytes.Buffer
+	if err := internal.WriteStatus(repo, &out, status, options); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func TestStatus(t *testing.T) {
+	// What it does: the global excludes file of the user running the tests is not read.
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	files := []TestingFile{
+		{RelativePath: "readme.md", Data: []byte("readme\n")},
+		{RelativePath: "notes.md", Data: []byte("notes\n")},
+		{RelativePath: "src/main.c", Data: []byte("int main;\n")},
+		{RelativePath: "src/util.c", Data: []byte("int util;\n")},
+		{RelativePath: "link", Data: []byte("target\n")},
+	}
+	// A repository with a change of each kind:
+	//   - readme.md modified, notes.md deleted and link replaced by a symbolic link in the worktree.
+	//   - src/util.c renamed into src/lib.c, src/new.c added and modified after.
+	//   - untracked.txt untracked, build.o ignored.
+	changedRepoTesting := func(t *testing.T) *internal.GotRepository {
+		repo, _ := internal.FindOrCreateRepo(t.TempDir())
+		commitWorktreeTesting(t, repo, "first", files)
+		os.WriteFile(filepath.Join(repo.GotTree, ".gotignore"), []byte("*.o\n"), 0644)
+		os.WriteFile(filepath.Join(repo.GotTree, "readme.md"), []byte("readme changed\n"), 0644)
+		os.Remove(filepath.Join(repo.GotTree, "notes.md"))
+		os.Remove(filepath.Join(repo.GotTree, "link"))
+		os.Symlink("readme.md", filepath.Join(repo.GotTree, "link"))
+		if _, err := internal.Move(repo, repo.GotTree, []string{"src/util.c"}, "src/lib.c", false); err != nil {
+			t.Fatal(err)
+		}
+		os.WriteFile(filepath.Join(repo.GotTree, "src/new.c"), []byte("int new;\n"), 0644)
+		if _, err := internal.Add(repo, repo.GotTree, []string{"src/new.c", ".gotignore"}, internal.AddOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		os.WriteFile(filepath.Join(repo.GotTree, "src/new.c"), []byte("int new = 1;\n"), 0644)
+		os.WriteFile(filepath.Join(repo.GotTree, "untracked.txt"), []byte("untracked\n"), 0644)
+		os.WriteFile(filepath.Join(repo.GotTree, "build.o"), []byte("obj\n"), 0644)
+		return repo
+	}
+
+	t.Run("staged and unstaged changes", func(t *testing.T) {
+		repo := changedRepoTesting(t)
+		status, err := repo.Status(internal.StatusOptions{Ignored: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := map[string]string{
+			".gotignore": "A.",
+			"readme.md":  ".M",
+			"notes.md":   ".D",
+			"link":       ".T",
+			"src/lib.c":  "R.",
+			"src/new.c":  "AM",
+			"src/main.c": "..",
+		}
+		for path, codes := range expected {
+			if got := statusCodesTesting(status, path); got != codes {
+				t.Errorf("Expected %s for %s, got %s", codes, path, got)
+			}
+		}
+		if len(status.Entries) != 6 {
+			t.Errorf("Expected the unchanged files left out, got %+v", status.Entries)
+		}
+		rename := status.Entries[slices.IndexFunc(status.Entries, func(entry internal.StatusEntry) bool {
+			return entry.Path == "src/lib.c"
+		})]
+		if rename.OrigPath != "src/util.c" || rename.Similarity != 100 || rename.HeadHash != rename.IndexHash {
+			t.Errorf("Expected the move detected as a rename, got %+v", rename)
+		}
+		if !slices.Equal(status.Untracked, []string{"untracked.txt"}) || !slices.Equal(status.Ignored, []string{"build.o"}) {
+			t.Errorf("Expected the untracked and ignored files apart, got %v and %v", status.Untracked, status.Ignored)
+		}
+		if status.Branch == "" || status.Head == "" || status.Clean() {
+			t.Errorf("Expected the branch and commit of HEAD, got %+v", status)
+		}
+		if status, _ := repo.Status(internal.StatusOptions{}); len(status.Ignored) != 0 {
+			t.Errorf("Expected the ignored files only when asked, got %v", status.Ignored)
+		}
+	})
+
+	t.Run("long format", func(t *testing.T) {
+		repo := changedRepoTesting(t)
+		status, _ := repo.Status(internal.StatusOptions{})
+		out := writeStatusTesting(t, repo, status, internal.StatusWriteOptions{Pwd: filepath.Join(repo.GotTree, "src")})
+		for _, line := range []string{
+			"On branch " + status.Branch + "\n",
+			"Changes to be committed:\n\tnew file:   ../.gotignore\n\trenamed:    util.c -> lib.c\n\tnew file:   new.c\n",
+			"Changes not staged for commit:\n\ttypechange: ../link\n\tdeleted:    ../notes.md\n\tmodified:   ../readme.md\n\tmodified:   new.c\n",
+			"Untracked files:\n\t../untracked.txt\n",
+		} {
+			if !strings.Contains(out, line) {
+				t.Errorf("Expected %q in the status, got\n%s", line, out)
+			}
+		}
+
+		repo, _ = internal.FindOrCreateRepo(t.TempDir())
+		out = writeStatusTesting(t, repo, statusTesting(t, repo), internal.StatusWriteOptions{})
+		if !strings.Contains(out, "No commits yet") || !strings.Contains(out, "nothing to commit, working tree clean") {
+			t.Errorf("Expected an empty repository, got\n%s", out)
+		}
+	})
+
+	t.Run("short and porcelain v1 formats", func(t *testing.T) {
+		repo := changedRepoTesting(t)
+		status, _ := repo.Status(internal.StatusOptions{Ignored: true})
+		porcelain := "## " + status.Branch + "\nA  .gotignore\n T link\n D notes.md\n M readme.md\n" +
+			"R  src/util.c -> src/lib.c\nAM src/new.c\n?? untracked.txt\n!! build.o\n"
+		src := filepath.Join(repo.GotTree, "src")
+		if out := writeStatusTesting(t, repo, status, internal.StatusWriteOptions{Format: internal.StatusPorcelainV1, Branch: true, Pwd: src}); out != porcelain {
+			t.Errorf("Expected the paths relative to the worktree\n%s, got\n%s", porcelain, out)
+		}
+		out := writeStatusTesting(t, repo, status, internal.StatusWriteOptions{Format: internal.StatusShort, Pwd: src})
+		if !strings.Contains(out, "R  util.c -> lib.c\n") || !strings.Contains(out, " M ../readme.md\n") {
+			t.Errorf("Expected the short paths relative to the current folder, got\n%s", out)
+		}
+		out = writeStatusTesting(t, repo, status, internal.StatusWriteOptions{Format: internal.StatusPorcelainV1, NulTerminated: true})
+		if !strings.Contains(out, "\x00R  src/lib.c\x00src/util.c\x00") || strings.Contains(out, "\n") {
+			t.Errorf("Expected the entries ended with NUL, the new path of a rename first, got %q", out)
+		}
+
+		repo, _ = internal.FindOrCreateRepo(t.TempDir())
+		os.WriteFile(filepath.Join(repo.GotTree, "tab\there.txt"), []byte("tab\n"), 0644)
+		status = statusTesting(t, repo)
+		out = writeStatusTesting(t, repo, status, internal.StatusWriteOptions{Format: internal.StatusPorcelainV1, Branch: true})
+		if out != "## No commits yet on "+status.Branch+"\n?? \"tab\\there.txt\"\n" {
+			t.Errorf("Expected the branch without commit and the path quoted, got %q", out)
+		}
+	})
+
+	t.Run("porcelain v2 format", func(t *testing.T) {
+		repo := changedRepoTesting(t)
+		status, _ := repo.Status(internal.StatusOptions{Ignored: true})
+		entry := func(path string) internal.StatusEntry {
+			return status.Entries[slices.IndexFunc(status.Entries, func(entry internal.StatusEntry) bool {
+				return entry.Path == path
+			})]
+		}
+		zero := strings.Repeat("0", 40)
+		readme, lib, added := entry("readme.md"), entry("src/lib.c"), entry(".gotignore")
+		mode := "100644"
+		out := writeStatusTesting(t, repo, status, internal.StatusWriteOptions{Format: internal.StatusPorcelainV2, Branch: true})
+		for _, line := range []string{
+			"# branch.oid " + status.Head + "\n# branch.head " + status.Branch + "\n",
+			"1 .M N... 100644 " + mode + " " + mode + " " + readme.HeadHash + " " + readme.HeadHash + " readme.md\n",
+			fmt.Sprintf("1 A. N... 000000 %06o %06o ", added.IndexMode, added.WorktreeMode) + zero + " " + added.IndexHash + " .gotignore\n",
+			"1 .T N... 100644 " + mode + " 120000 ",
+			"1 .D N... 100644 " + mode + " 000000 ",
+			"2 R. N... 100644 " + mode + " " + mode + " " + lib.HeadHash + " " + lib.HeadHash + " R100 src/lib.c\tsrc/util.c\n",
+			"? untracked.txt\n! build.o\n",
+		} {
+			if !strings.Contains(out, line) {
+				t.Errorf("Expected %q in the status, got\n%s", line, out)
+			}
+		}
+		out = writeStatusTesting(t, repo, status, internal.StatusWriteOptions{Format: internal.StatusPorcelainV2, NulTerminated: true})
+		if !strings.Contains(out, " R100 src/lib.c\x00src/util.c\x00") {
+			t.Errorf("Expected the paths of a rename split by NUL, got %q", out)
+		}
+
+		repo, _ = internal.FindOrCreateRepo(t.TempDir())
+		out = writeStatusTesting(t, repo, statusTesting(t, repo), internal.StatusWriteOptions{Format: internal.StatusPorcelainV2, Branch: true})
+		if !strings.HasPrefix(out, "# branch.oid (initial)\n") {
+			t.Errorf("Expected the initial commit, got %q", out)
+		}
+	})
+
+	t.Run("mode changes", func(t *testing.T) {
+		repo, _ := internal.FindOrCreateRepo(t.TempDir())
+		commitWorktreeTesting(t, repo, "first", files)
+		os.Chmod(filepath.Join(repo.GotTree, "readme.md"), 0755)
+		os.Chmod(filepath.Join(repo.GotTree, "notes.md"), 0755)
+		os.Remove(filepath.Join(repo.GotTree, "link"))
+		os.Symlink("readme.md", filepath.Join(repo.GotTree, "link"))
+		if _, err := internal.Add(repo, repo.GotTree, []string{"notes.md", "link"}, internal.AddOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		status := statusTesting(t, repo)
+		for path, codes := range map[string]string{"readme.md": ".M", "notes.md": "M.", "link": "T.", "src/main.c": ".."} {
+			if got := statusCodesTesting(status, path); got != codes {
+				t.Errorf("Expected %s for %s, got %s", codes, path, got)
+			}
+		}
+		notes := status.Entries[slices.IndexFunc(status.Entries, func(entry internal.StatusEntry) bool {
+			return entry.Path == "notes.md"
+		})]
+		if notes.HeadMode != 0100644 || notes.IndexMode != 0100755 || notes.HeadHash != notes.IndexHash {
+			t.Errorf("Expected the mode change staged, got %+v", notes)
+		}
+		out := writeStatusTesting(t, repo, status, internal.StatusWriteOptions{Format: internal.StatusPorcelainV1})
+		if out != "T  link\nM  notes.md\n M readme.md\n" {
+			t.Errorf("Expected the mode changes in the short format, got %q", out)
+		}
+
+		if _, err := internal.CommitIndex(repo, "modes", internal.CommitOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		os.Chmod(filepath.Join(repo.GotTree, "notes.md"), 0644)
+		if got := statusCodesTesting(statusTesting(t, repo), "notes.md"); got != ".M" {
+			t.Errorf("Expected the executable bit removed as a change, got %s", got)
+		}
+	})
+}
@@ -0,0 +1,42 @@
+package internal
+
+// The annotated tag object, serialized as git does:
+//
+//	object <hash>
+//	type commit
+//	tag v1.0.0
+//	tagger Name <email> 1700000000 +0100
+//
+//	<message>
+type Tag struct {
+	// The tagged object.
+	Object string `object:"object"`
+	// The type of the tagged object.
+	Type string `object:"type"`
+	// The tag name.
+	Name    string    `object:"tag"`
+	Tagger  Signature `object:"tagger"`
+	Message string    `object:"-"`
+}
+
+// Turn Tag instance into array of bytes.
+func (t Tag) Serialize() []byte {
+	return serializeHeaders(t)
+}
+
+// Convert an array of byte to a Tag instance.
+func (t Tag) Deserialize(d []byte) Tag {
+	deserializeHeaders(d, &t)
+	return t
+}
+
+// Follow the annotated tags until an object that isn't a tag. Any other object is returned as it is.
+func peelTag(repo *GotRepository, hash string) string {
+	for {
+		header, data, err := readObjectWith(repo, repo.ObjectFormat(), hash)
+		if err != nil || header != TagHeaderName {
+			return hash
+		}
+		hash = Tag{}.Deserialize(data).Object
+	}
+}
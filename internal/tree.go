@@ -17,19 +17,34 @@ type Mode []byte
 var (
 	BlobMode Mode = []byte{0x31, 0x30, 0x30, 0x36, 0x34, 0x34} //100644
 	TreeMode Mode = []byte{0x30, 0x34, 0x30, 0x30, 0x30, 0x30} //040000
+	// The modes git writes besides the regular files and trees. Found in the imported git repositories.
+	ExecutableMode Mode = []byte("100755")
+	SymlinkMode    Mode = []byte("120000")
+	// A commit of another repository, the submodules.
+	GitlinkMode Mode = []byte("160000")
+	// Git writes the mode of the trees without the leading zero.
+	gitTreeMode = []byte("40000")
 
 	ErrorCorruptedData = errors.New("invalid object persistance. Temporal hash isn't final hash")
+	// A tree has a path that would be written out of the worktree or into the repository folder.
+	ErrorInvalidTreePath = errors.New("invalid path in tree")
 )
 
+// The type of the object the entry of the mode points to. Any regular file mode is a blob, as git reads the 100664 of
+// its former versions, and a mode git doesn't write is unknown.
 func (m Mode) String() string {
 	switch (string)(m) {
-	case string(BlobMode):
+	case string(SymlinkMode):
 		return `blob`
-	case string(TreeMode):
+	case string(TreeMode), string(gitTreeMode):
 		return `tree`
-	default:
-		panic("No conversion type.")
+	case string(GitlinkMode):
+		return `commit`
 	}
+	if len(m) == len(BlobMode) && bytes.HasPrefix(m, []byte("100")) && isOctalMode(m) {
+		return `blob`
+	}
+	return `unknown`
 }
 
 type TreeItem struct {
@@ -44,6 +59,8 @@ type TreeItem struct {
 type OFS struct {
 	path string
 	mode Mode
+	// Blob hash as staged in the index. Empty for trees.
+	hash string
 }
 
 // Location implements GotObject.
@@ -51,26 +68,6 @@ func (o OFS) Location() string {
 	return o.path
 }
 
-// Read the user file.
-func (o OFS) Serialize() []byte {
-	repo, err := FindOrCreateRepo(filepath.Dir(o.path))
-	if err != nil {
-		panic(err)
-	}
-	// Find the blob in cache.
-	idx := slices.IndexFunc(repo.Index.Cache, func(entry CacheEntry) bool {
-		return entry.PathName == relativize(repo, o.path)
-	})
-	if idx >= 0 {
-		var bb bytes.Buffer
-		Decompress(repo.Index.Cache[idx].CompressedFileContent, &bb)
-		return bb.Bytes()
-	}else{
-		panic("Object is not in cache. Got index invalid")
-	}
-	
-}
-
 func (t TreeItem) Location() string {
 	return t.Path
 }
@@ -79,30 +76,16 @@ func (o *OFS) String() {
 	fmt.Printf("%s,%s", o.path, string(o.mode))
 }
 
-// Find index of OFS element based on path-key.
-func indexOf(offs []OFS, key string) int {
-	for i, of := range offs {
-		if of.path == key {
-			return i
-		}
-	}
-	return -1
-}
-
 // Traverse the tree graph.
 func (t *TreeItem) TraverseTree(visitBlob func(TreeItem), visitTree func(TreeItem)) {
 	if bytes.Equal(t.Mode, TreeMode) {
 		visitTree(*t)
 	}
 	for _, item := range t.Children {
-		if bytes.Equal(item.Mode, BlobMode) {
-			visitBlob(item)
-		}
 		if bytes.Equal(item.Mode, TreeMode) {
-			visitTree(item)
-			for _, child := range item.Children {
-				child.TraverseTree(visitBlob, visitTree)
-			}
+			item.TraverseTree(visitBlob, visitTree)
+		} else {
+			visitBlob(item)
 		}
 	}
 }
@@ -117,29 +100,34 @@ func (t *TreeItem) FlatItems() []TreeItem {
 }
 
 // Convert map of OFS into TreeItem graph. Intermediate converter.
+//
+// The parent is the directory relative to the worktree, "." being the worktree root.
 func FromMapToTree(repo *GotRepository, m map[string][]OFS, parent string) TreeItem {
 	items := m[parent]
 	re := make([]TreeItem, 0)
 	for _, item := range items {
-		// Branch #1: The item is blob. Just create the in-memory object and append.
-		if bytes.Equal(item.mode, BlobMode) {
-			//possible hash of a OFS blob must be equal to the actual blob.
-			hash, err := CreatePossibleObjectFromData(repo, item, BlobHeaderName)
-			if err != nil {
-				panic(err)
+		// Branch #1: The item is blob, an executable, a symbolic link or a gitlink. Just create the in-memory object
+		// and append.
+		if !bytes.Equal(item.mode, TreeMode) {
+			hash := item.hash
+			// What it does: the blob is not staged, its hash comes from the user file.
+			if hash == "" {
+				blob, err := BlobFromUserPath(repo, item.path)
+				if err != nil {
+					panic(err)
+				}
+				hash = blob.Hash
 			}
 			re = append(re, TreeItem{
 				Path:     item.path,
 				Hash:     hash,
-				Mode:     BlobMode,
+				Mode:     item.mode,
 				Children: nil,
 			})
 			continue
 		}
 		// Branch #2: the item is tree. Keep drill down recursively the graph.
-		if bytes.Equal(item.mode, TreeMode) {
-			re = append(re, FromMapToTree(repo, m, item.path))
-		}
+		re = append(re, FromMapToTree(repo, m, item.path))
 	}
 	// Based parent tree.
 	t := TreeItem{
@@ -157,33 +145,44 @@ func FromMapToTree(repo *GotRepository, m map[string][]OFS, parent string) TreeI
 	return t
 }
 
-// Create map of OFS from array of files.
+// Create map of OFS from array of files. The map key is the directory relative to the worktree, "." for the root.
+//
+// The blob hash and mode are taken from the index when the file is staged.
 func CreateTreeFromFiles(repo *GotRepository, files []string) map[string][]OFS {
 	m := make(map[string][]OFS)
+	inserted := make(map[string]bool)
+	positions := repo.Index.positions()
 	for _, wholePath := range files {
-		// Split by file system separator. Not MS.Window tested.
-		dirs := strings.Split(wholePath, string(filepath.Separator))
-		for i := len(dirs) - 1; i > 0; i-- {
-			if ok, err := isFile(filepath.Join(repo.GotTree, filepath.Join(dirs[0:i]...), dirs[i])); ok {
-				if err != nil {
-					panic(err)
-				}
-				if indexOf(m[dirs[i-1]], dirs[i]) == -1 {
-					m[dirs[i-1]] = append(m[dirs[i-1]], OFS{path: filepath.Join(repo.GotTree, wholePath), mode: BlobMode})
-				}
-			} else {
-				if indexOf(m[dirs[i-1]], dirs[i]) == -1 {
-					m[dirs[i-1]] = append(m[dirs[i-1]], OFS{path: filepath.Join(repo.GotTree, filepath.Join(dirs[0:i]...)), mode: TreeMode})
-				}
-			}
+		wholePath = relativize(repo, wholePath)
+		ofs := OFS{path: wholePath, mode: BlobMode}
+		if idx, ok := positions[wholePath]; ok {
+			ofs.hash = repo.Index.Entries[idx].Hash
+			ofs.mode = treeEntryMode(repo.Index.Entries[idx].FileMode)
 		}
+		insertOFS(m, inserted, ofs)
 	}
 	return m
 }
 
-// Determine whether or not the path is file.
+// Insert the blob in the map of its directory, linking every directory up to the root with its parent. The paths
+// already inserted are kept in the set given, the same for every blob of the map.
+func insertOFS(m map[string][]OFS, inserted map[string]bool, blob OFS) {
+	if inserted[blob.path] {
+		return
+	}
+	inserted[blob.path] = true
+	dir := filepath.Dir(blob.path)
+	m[dir] = append(m[dir], blob)
+	// What it does: a directory already inserted is linked up to the root already.
+	for ; dir != "." && !inserted[dir]; dir = filepath.Dir(dir) {
+		inserted[dir] = true
+		m[filepath.Dir(dir)] = append(m[filepath.Dir(dir)], OFS{path: dir, mode: TreeMode})
+	}
+}
+
+// Determine whether or not the path is file. A symbolic link is a file, whatever it points to.
 func isFile(path string) (bool, error) {
-	fi, err := os.Stat(path)
+	fi, err := os.Lstat(path)
 	if err != nil {
 		return false, err
 	}
@@ -193,76 +192,184 @@ func isFile(path string) (bool, error) {
 	return true, nil
 }
 
-// Convert TreeItem into []bytes. No recursive.
+// Convert TreeItem into []bytes as git does. No recursive.
+//
+// Entries carry the base name and are sorted as if the trees had a trailing slash:
+//
+//	[mode ASCII octal, no leading zero]|[space with 0x20]|[name]|[terminator 0x00]|[sha1 of 20 bytes]
 func (t TreeItem) Serialize() []byte {
-	bb := make([]byte, 0)
-	// What it does: Sort the path so that the hash of the tree with the same item but different order give the same hash.
-	slices.SortFunc(t.Children, func(a, b TreeItem) int {
-		return cmp.Compare(a.Path, b.Path)
+	children := slices.Clone(t.Children)
+	slices.SortFunc(children, func(a, b TreeItem) int {
+		return cmp.Compare(gitTreeSortKey(a), gitTreeSortKey(b))
 	})
-	// [mode of 4 bytes]|[space with 0x20]|[path no limit]|[terminator 0x00]|[sha1 of 20 bytes]
-	for _, buf := range t.Children {
-		bb = append(bb, buf.Mode...)
-		bb = append(bb, byte(0x20))
-		bb = append(bb, []byte(buf.Path)...) //Must be full path from got tree.
-		bb = append(bb, byte(0x00))
-		bb = append(bb, []byte(Hex2bytes(buf.Hash))...)
+	bb := make([]byte, 0)
+	for _, child := range children {
+		mode := []byte(child.Mode)
+		if bytes.Equal(mode, TreeMode) {
+			mode = gitTreeMode
+		}
+		bb = append(bb, mode...)
+		bb = append(bb, space)
+		bb = append(bb, filepath.Base(child.Path)...)
+		bb = append(bb, 0x00)
+		bb = append(bb, Hex2bytes(child.Hash)...)
 	}
 	return bb
 }
 
-// Deserialize raw bytes to TreeItem struct.
-func (t TreeItem) Deserialize(d []byte) TreeItem {
+// Git compares the tree names as if they ended with a slash.
+func gitTreeSortKey(t TreeItem) string {
+	if bytes.Equal(t.Mode, TreeMode) {
+		return filepath.Base(t.Path) + "/"
+	}
+	return filepath.Base(t.Path)
+}
 
+// Deserialize raw bytes to TreeItem struct. No recursive, the children trees only carry their hash.
+// The children paths are joined to the tree path.
+func (t TreeItem) Deserialize(d []byte) TreeItem {
 	for len(d) > 0 {
 		// The Mode separator 0x20.
-		modeSep := bytes.Index(d, []byte{0x20})
-		// The path terminator 0x00
-		pathTerm := bytes.Index(d, []byte{0x00})
-		//Implementation to deserialize a blob.
-		if bytes.Equal(d[0:modeSep], BlobMode) {
-			t.Children = append(t.Children, TreeItem{
-				//Mode[0, 0x20]
-				Mode: d[0:modeSep],
-				//Path[0x20 + 1, 0x00]
-				Path: string(d[modeSep+1 : pathTerm]),
-				//Hash[0x00, 0x00  + sha1.Size(20 bytes)]
-				Hash:     string(Bytes2hex(d[pathTerm+1 : sha1.Size+pathTerm+1])),
-				Children: nil,
-			})
-			// Discard consumed bytes pathTermIndex + 20bytes(sha1) + 1(The skipped 0x00)
-			d = d[pathTerm+sha1.Size+1:]
-			//Implementation to skip going through tree when already consumed a treeItem.
-			continue
+		modeSep := bytes.IndexByte(d, space)
+		// The name terminator 0x00
+		nameTerm := bytes.IndexByte(d, 0x00)
+		if modeSep < 0 || nameTerm < modeSep || len(d) < nameTerm+sha1.Size+1 {
+			panic(ErrorMalformedObject)
 		}
-		// Implementation to deserialize a tree.
-		if bytes.Equal(d[0:modeSep], TreeMode) {
-			// Find the a possible repository.
-			//TODO: Find a way to get the real repository.
-			repo, err := FindOrCreateRepo(string(d[modeSep+1 : pathTerm]))
-			if err != nil {
-				panic(err)
-			}
-			// Read the tree from DB based on the hash of it.
-			content, err := ReadObject(repo, TreeHeaderName, string(Bytes2hex(d[pathTerm+1:sha1.Size+pathTerm+1])))
-			if err != nil {
-				panic(err)
-			}
-			// Append the children of this if exist.
-			if len(content) > 0 {
-				t.Children = append(t.Children, t.Deserialize(content))
-			}
-			// Discard consumed bytes pathTermIndex + 20bytes(sha1) + 1(The skipped 0x00)
-			d = d[pathTerm+1+sha1.Size:]
+		mode := Mode(bytes.Clone(d[:modeSep]))
+		if bytes.Equal(mode, gitTreeMode) {
+			mode = TreeMode
+		} else if !isOctalMode(mode) {
+			panic(ErrorMalformedObject)
 		}
+		t.Children = append(t.Children, TreeItem{
+			Mode: mode,
+			Path: filepath.Join(t.Path, string(d[modeSep+1:nameTerm])),
+			//Hash[0x00, 0x00  + sha1.Size(20 bytes)]
+			Hash: Bytes2hex(d[nameTerm+1 : nameTerm+1+sha1.Size]),
+		})
+		// Discard consumed bytes nameTerm + 20bytes(sha1) + 1(The skipped 0x00)
+		d = d[nameTerm+1+sha1.Size:]
 	}
 	return t
 }
 
+// Whether or not the mode is written in octal digits.
+func isOctalMode(mode Mode) bool {
+	if len(mode) == 0 {
+		return false
+	}
+	for _, c := range mode {
+		if c < '0' || c > '7' {
+			return false
+		}
+	}
+	return true
+}
+
+// Read the tree graph from DB. The children trees are read recursively.
 func ReadTree(repo *GotRepository, objId string) TreeItem {
+	return readTree(repo, repo.ObjectFormat(), objId, "")
+}
+
+// Read the tree graph whose path relative to the worktree is given.
+func readTree(repo *GotRepository, format ObjectFormat, objId string, path string) TreeItem {
 	rawData, err := ReadObject(repo, TreeHeaderName, objId)
 	if err != nil {
 		panic(err)
 	}
-	return new(TreeItem).Deserialize(rawData)
-}
\ No newline at end of file
+	tree, err := format.DecodeTree(TreeItem{Mode: TreeMode, Hash: objId, Path: path}, rawData)
+	if err != nil {
+		panic(err)
+	}
+	for i, child := range tree.Children {
+		if bytes.Equal(child.Mode, TreeMode) {
+			subtree := readTree(repo, format, child.Hash, child.Path)
+			tree.Children[i].Children = subtree.Children
+		}
+	}
+	return tree
+}
+
+// Whether the name can be the one of a tree entry, as git's verify_path: not empty, "." nor "..", without "/" or NUL,
+// and not the folder of a repository, ".got" or ".git" in any case.
+func validTreeEntryName(name string) bool {
+	switch {
+	case name == "" || name == "." || name == "..":
+		return false
+	case strings.ContainsAny(name, "/\x00"):
+		return false
+	case strings.EqualFold(name, gotRootRepositoryDir) || strings.EqualFold(name, ".git"):
+		return false
+	}
+	return true
+}
+
+// Check that the path of a tree, relative to the worktree, stays inside the worktree and out of the repository
+// folder. Each of its folders and its name must be a valid entry name, see validTreeEntryName.
+func verifyTreePath(path string) error {
+	for _, name := range strings.Split(filepath.ToSlash(path), "/") {
+		if !validTreeEntryName(name) {
+			return fmt.Errorf("%w: %q", ErrorInvalidTreePath, path)
+		}
+	}
+	return nil
+}
+
+// Flatten the tree of the given hash into a map of blob path to blob hash.
+func flattenTree(repo *GotRepository, objId string) map[string]string {
+	return blobHashes(flattenTreeItems(repo, objId))
+}
+
+// The hashes of the blobs of the flattened tree, see flattenTreeItems.
+func blobHashes(items map[string]TreeItem) map[string]string {
+	blobs := make(map[string]string)
+	for path, item := range items {
+		// What it does: the submodules aren't in DB, their commits belong to another repository.
+		if bytes.Equal(item.Mode, GitlinkMode) {
+			continue
+		}
+		blobs[path] = item.Hash
+	}
+	return blobs
+}
+
+// Flatten the tree of the given hash into a map of path to entry, its mode and hash. The gitlinks are kept.
+func flattenTreeItems(repo *GotRepository, objId string) map[string]TreeItem {
+	items := make(map[string]TreeItem)
+	if objId == "" {
+		return items
+	}
+	tree := ReadTree(repo, objId)
+	for _, item := range tree.FlatItems() {
+		items[relativize(repo, item.Path)] = item
+	}
+	return items
+}
+
+// The mode of the tree entry of an index entry. The modes git doesn't record are regular files, as the entries of
+// the former index versions without mode.
+func treeEntryMode(fileMode Bit32) Mode {
+	switch fileMode {
+	case statModeExecutable:
+		return ExecutableMode
+	case statModeSymlink:
+		return SymlinkMode
+	case statModeGitlink:
+		return GitlinkMode
+	}
+	return BlobMode
+}
+
+// The mode of the index entry of a tree entry, see treeEntryMode.
+func indexFileMode(mode Mode) Bit32 {
+	switch string(mode) {
+	case string(ExecutableMode):
+		return statModeExecutable
+	case string(SymlinkMode):
+		return statModeSymlink
+	case string(GitlinkMode):
+		return statModeGitlink
+	}
+	return statModeRegular
+}
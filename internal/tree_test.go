@@ -20,9 +20,14 @@ func TestTree(t *testing.T) {
 		if err != nil {
 			t.Errorf("No repo found.")
 		}
-		files := []string{filepath.Join(tmp, "test/a/co.txt"), filepath.Join(tmp, "test/a/c/cx.txt"), filepath.Join(tmp, "test/a/b/mx.txt"), filepath.Join(tmp, "test/a/b/jx.txt")}
-		internal.CreateTreeFromFiles(repo, files)
-		// fmt.Printf("%v\n", m)
+		files := []string{filepath.Join(tmp, "test/a/co.txt"), filepath.Join(tmp, "test/a/c/cx.txt"), filepath.Join(tmp, "test/a/b/mx.txt"), filepath.Join(tmp, "test/a/b/jx.txt"), filepath.Join(tmp, "test/a/co.txt")}
+		m := internal.CreateTreeFromFiles(repo, files)
+		// What it does: every folder and file is listed once in its parent, the file given twice too.
+		for parent, count := range map[string]int{".": 1, "test": 1, "test/a": 3, "test/a/b": 2, "test/a/c": 1} {
+			if len(m[parent]) != count {
+				t.Errorf("Expected %d entries in %s, got %v", count, parent, m[parent])
+			}
+		}
 	})
 
 	t.Run("Serialize/deserialize tree", func(t *testing.T) {
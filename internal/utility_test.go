@@ -4,8 +4,12 @@ import (
 	// "io/fs"
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
-	// internal "github.com/danielrrv/got/internal"
+	"strings"
+	"testing"
+
+	internal "github.com/danielrrv/got/internal"
 )
 
 
@@ -29,7 +33,7 @@ func CreateFilesTesting(projectTemporalFolder string, folders []string, files []
 
 	for _, file := range files {
 		fmt.Println("Creating file", filepath.Join(projectTemporalFolder, file.RelativePath))
-		fd, err := os.OpenFile(filepath.Join(projectTemporalFolder, file.RelativePath), os.O_WRONLY|os.O_CREATE, 0755)
+		fd, err := os.OpenFile(filepath.Join(projectTemporalFolder, file.RelativePath), os.O_WRONLY|os.O_CREATE, 0644)
 		if err != nil {
 			panic(err)
 		}
@@ -40,3 +44,76 @@ func CreateFilesTesting(projectTemporalFolder string, folders []string, files []
 		fd.Close()
 	}
 }
+
+// Raw content to be written as object.
+type rawObject []byte
+
+func (r rawObject) Serialize() []byte {
+	return r
+}
+
+// Write the files(path to content) as blobs and trees, then commit them on top of the parent and move main to it.
+func CommitFilesTesting(repo *internal.GotRepository, message string, parent string, files map[string]string, merged ...string) string {
+	tree := treeFilesTesting(repo, ".", files)
+	commit := internal.CreateCommit(repo, &tree, message, append([]string{parent}, merged...)...)
+	hash, err := internal.WriteObject(repo, *commit, internal.CommitHeaderName)
+	if err != nil {
+		panic(err)
+	}
+	if err := internal.CreateOrUpdateRepoFile(repo, filepath.Join("refs", "heads", "main"), []byte(hash)); err != nil {
+		panic(err)
+	}
+	return hash
+}
+
+func treeFilesTesting(repo *internal.GotRepository, dir string, files map[string]string) internal.TreeItem {
+	children := make([]internal.TreeItem, 0)
+	subdirs := make(map[string]bool)
+	for path, content := range files {
+		if dir != "." && !strings.HasPrefix(path, dir+"/") {
+			continue
+		}
+		if filepath.Dir(path) == dir {
+			hash, err := internal.WriteObject(repo, rawObject(content), internal.BlobHeaderName)
+			if err != nil {
+				panic(err)
+			}
+			children = append(children, internal.TreeItem{Mode: internal.BlobMode, Path: path, Hash: hash})
+			continue
+		}
+		rel := strings.TrimPrefix(path, dir+"/")
+		subdirs[filepath.Join(dir, strings.Split(rel, "/")[0])] = true
+	}
+	for subdir := range subdirs {
+		children = append(children, treeFilesTesting(repo, subdir, files))
+	}
+	tree := internal.TreeItem{Mode: internal.TreeMode, Path: dir, Children: children}
+	hash, err := internal.WriteObject(repo, tree, internal.TreeHeaderName)
+	if err != nil {
+		panic(err)
+	}
+	tree.Hash = hash
+	return tree
+}
+
+// Run git in the folder with a fixed identity and date. The test is skipped when git isn't installed.
+func gitTesting(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	git, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git is not installed")
+	}
+	cmd := exec.Command(git, args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"HOME="+dir,
+		"GIT_CONFIG_NOSYSTEM=1",
+		"GIT_AUTHOR_NAME=Ada", "GIT_AUTHOR_EMAIL=ada@example.com", "GIT_AUTHOR_DATE=1700000000 +0100",
+		"GIT_COMMITTER_NAME=Ada", "GIT_COMMITTER_EMAIL=ada@example.com", "GIT_COMMITTER_DATE=1700000000 +0100",
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}